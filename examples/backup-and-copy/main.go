@@ -0,0 +1,193 @@
+// Command backup-and-copy backs up a branch and copies its data into a new
+// branch, e.g. to experiment with a copy of production data. Usage:
+//
+//	PLANETSCALE_SERVICE_TOKEN_NAME=... PLANETSCALE_SERVICE_TOKEN=... \
+//		go run ./examples/backup-and-copy -org my-org -database my-db -branch main -copy-branch copy
+//
+// The API can't restore backups into a branch, so the rows are copied from
+// the live branch over a MySQL connection once the backup finished. The
+// backup keeps the state of the branch at the time of the copy.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+	"github.com/planetscale/planetscale-go/planetscale/clone"
+	"github.com/planetscale/planetscale-go/planetscale/dbutil"
+)
+
+// batchSize is the number of rows inserted per statement.
+const batchSize = 500
+
+type config struct {
+	org          string
+	database     string
+	branch       string
+	copyBranch   string
+	pollInterval time.Duration
+}
+
+// connectFunc opens a connection to a database branch.
+type connectFunc func(ctx context.Context, client *ps.Client, org, database, branch string) (*sql.DB, error)
+
+func main() {
+	cfg := &config{}
+	flag.StringVar(&cfg.org, "org", "", "PlanetScale organization")
+	flag.StringVar(&cfg.database, "database", "", "database of the branch")
+	flag.StringVar(&cfg.branch, "branch", "main", "branch to back up")
+	flag.StringVar(&cfg.copyBranch, "copy-branch", "", "branch to copy the data into")
+	flag.DurationVar(&cfg.pollInterval, "poll-interval", 2*time.Second, "interval to check the backup and branch")
+	flag.Parse()
+
+	client, err := newClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := run(context.Background(), os.Stdout, client, cfg, dial); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, w io.Writer, client *ps.Client, cfg *config, connect connectFunc) error {
+	if cfg.org == "" || cfg.database == "" || cfg.branch == "" || cfg.copyBranch == "" {
+		return errors.New("-org, -database, -branch and -copy-branch are required")
+	}
+
+	backupOp, err := client.Operations.CreateBackup(ctx, &ps.CreateBackupRequest{
+		Organization: cfg.org,
+		Database:     cfg.database,
+		Branch:       cfg.branch,
+	})
+	if err != nil {
+		return err
+	}
+
+	backupOp.PollInterval = cfg.pollInterval
+	if err := backupOp.Wait(ctx); err != nil {
+		return fmt.Errorf("waiting for backup %s: %s", backupOp.Backup, err)
+	}
+	fmt.Fprintf(w, "backup %s of branch %s finished\n", backupOp.Backup, cfg.branch)
+
+	branchOp, err := client.Operations.CreateBranch(ctx, &ps.CreateDatabaseBranchRequest{
+		Organization: cfg.org,
+		Database:     cfg.database,
+		Name:         cfg.copyBranch,
+		ParentBranch: cfg.branch,
+		Notes:        fmt.Sprintf("copy of branch %s, backed up as %s", cfg.branch, backupOp.Backup),
+	})
+	if err != nil {
+		return err
+	}
+
+	branchOp.PollInterval = cfg.pollInterval
+	if err := branchOp.Wait(ctx); err != nil {
+		return fmt.Errorf("waiting for branch %s: %s", cfg.copyBranch, err)
+	}
+	fmt.Fprintf(w, "branch %s is ready\n", cfg.copyBranch)
+
+	if connect == nil {
+		return nil
+	}
+
+	src, err := connect(ctx, client, cfg.org, cfg.database, cfg.branch)
+	if err != nil {
+		return fmt.Errorf("connecting to branch %s: %s", cfg.branch, err)
+	}
+	defer src.Close()
+
+	dst, err := connect(ctx, client, cfg.org, cfg.database, cfg.copyBranch)
+	if err != nil {
+		return fmt.Errorf("connecting to branch %s: %s", cfg.copyBranch, err)
+	}
+	defer dst.Close()
+
+	tables, err := listTables(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if err := createTable(ctx, src, dst, table); err != nil {
+			return fmt.Errorf("creating table %s: %s", table, err)
+		}
+
+		n, err := clone.CopyRows(ctx, src, dst, table, batchSize)
+		if err != nil {
+			return fmt.Errorf("copying table %s: %s", table, err)
+		}
+		fmt.Fprintf(w, "copied %d rows of table %s\n", n, table)
+	}
+
+	return nil
+}
+
+func listTables(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SHOW FULL TABLES WHERE Table_type = 'BASE TABLE'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+
+	return tables, rows.Err()
+}
+
+// createTable creates the table in dst if it doesn't exist yet.
+func createTable(ctx context.Context, src, dst *sql.DB, table string) error {
+	var name, create string
+	err := src.QueryRowContext(ctx, "SHOW CREATE TABLE "+quote(table)).Scan(&name, &create)
+	if err != nil {
+		return err
+	}
+
+	create = strings.Replace(create, "CREATE TABLE", "CREATE TABLE IF NOT EXISTS", 1)
+	_, err = dst.ExecContext(ctx, create)
+	return err
+}
+
+func quote(ident string) string {
+	return "`" + strings.Replace(ident, "`", "``", -1) + "`"
+}
+
+func dial(ctx context.Context, client *ps.Client, org, database, branch string) (*sql.DB, error) {
+	return dbutil.Dial(ctx, &dbutil.DialConfig{
+		Organization: org,
+		Database:     database,
+		Branch:       branch,
+		Client:       client,
+	})
+}
+
+// newClient creates a client authenticated with the service token from the
+// environment.
+func newClient() (*ps.Client, error) {
+	var opts []ps.ClientOption
+	if url := os.Getenv("PLANETSCALE_API_URL"); url != "" {
+		opts = append(opts, ps.WithBaseURL(url))
+	}
+	opts = append(opts, ps.WithServiceToken(
+		os.Getenv("PLANETSCALE_SERVICE_TOKEN_NAME"),
+		os.Getenv("PLANETSCALE_SERVICE_TOKEN"),
+	))
+
+	return ps.NewClient(opts...)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	"github.com/planetscale/planetscale-go/internal/mysqltest"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+func newTestClient(c *qt.C) (*fakeapi.Server, *ps.Client) {
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	return api, client
+}
+
+func testConfig() *config {
+	return &config{
+		org:          "my-org",
+		database:     "my-db",
+		branch:       "main",
+		copyBranch:   "copy",
+		pollInterval: time.Millisecond,
+	}
+}
+
+var backupLine = regexp.MustCompile(`^backup backup-[0-9a-f]+ of branch main finished\n`)
+
+func TestRun(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	_, client := newTestClient(c)
+
+	var out bytes.Buffer
+	err := run(ctx, &out, client, testConfig(), nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(backupLine.MatchString(out.String()), qt.IsTrue, qt.Commentf("output: %s", out.String()))
+	c.Assert(backupLine.ReplaceAllString(out.String(), ""), qt.Equals, "branch copy is ready\n")
+
+	backups, err := client.Backups.List(ctx, &ps.ListBackupsRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "main",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(backups, qt.HasLen, 1)
+	c.Assert(backups[0].State, qt.Equals, "success")
+}
+
+func TestRun_mysql(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	connect := mysqltest.Connect(t)
+	_, client := newTestClient(c)
+
+	src, err := connect(ctx, client, "my-org", "my-db", "main")
+	c.Assert(err, qt.IsNil)
+	defer src.Close()
+
+	_, err = src.Exec("CREATE TABLE users (id bigint NOT NULL, name varchar(255), PRIMARY KEY (id))")
+	c.Assert(err, qt.IsNil)
+	_, err = src.Exec("INSERT INTO users VALUES (1, 'ada'), (2, NULL)")
+	c.Assert(err, qt.IsNil)
+
+	var out bytes.Buffer
+	err = run(ctx, &out, client, testConfig(), connect)
+	c.Assert(err, qt.IsNil)
+	c.Assert(out.String(), qt.Contains, "copied 2 rows of table users\n")
+
+	dst, err := connect(ctx, client, "my-org", "my-db", "copy")
+	c.Assert(err, qt.IsNil)
+	defer dst.Close()
+
+	var count, nulls int
+	err = dst.QueryRow("SELECT COUNT(*), SUM(name IS NULL) FROM users").Scan(&count, &nulls)
+	c.Assert(err, qt.IsNil)
+	c.Assert(count, qt.Equals, 2)
+	c.Assert(nulls, qt.Equals, 1)
+}
@@ -0,0 +1,154 @@
+// Command deploy-request opens a deploy request for a branch, prints its
+// schema diff, deploys it and watches the deployment until it finishes.
+// Usage:
+//
+//	PLANETSCALE_SERVICE_TOKEN_NAME=... PLANETSCALE_SERVICE_TOKEN=... \
+//		go run ./examples/deploy-request -org my-org -database my-db -branch pr-42
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+	"github.com/planetscale/planetscale-go/planetscale/watch"
+)
+
+type config struct {
+	org          string
+	database     string
+	branch       string
+	into         string
+	notes        string
+	pollInterval time.Duration
+}
+
+func main() {
+	cfg := &config{}
+	flag.StringVar(&cfg.org, "org", "", "PlanetScale organization")
+	flag.StringVar(&cfg.database, "database", "", "database of the branch")
+	flag.StringVar(&cfg.branch, "branch", "", "branch with the schema changes")
+	flag.StringVar(&cfg.into, "into", "main", "branch to deploy the changes into")
+	flag.StringVar(&cfg.notes, "notes", "", "notes of the deploy request")
+	flag.DurationVar(&cfg.pollInterval, "poll-interval", 2*time.Second, "interval to check the deployment")
+	flag.Parse()
+
+	client, err := newClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := run(context.Background(), os.Stdout, client, cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, w io.Writer, client *ps.Client, cfg *config) error {
+	if cfg.org == "" || cfg.database == "" || cfg.branch == "" {
+		return errors.New("-org, -database and -branch are required")
+	}
+
+	dr, err := client.DeployRequests.Create(ctx, &ps.CreateDeployRequestRequest{
+		Organization: cfg.org,
+		Database:     cfg.database,
+		Branch:       cfg.branch,
+		IntoBranch:   cfg.into,
+		Notes:        cfg.notes,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "opened deploy request #%d from %s into %s\n", dr.Number, dr.Branch, dr.IntoBranch)
+
+	diffs, err := client.DeployRequests.Diff(ctx, &ps.DiffRequest{
+		Organization: cfg.org,
+		Database:     cfg.database,
+		Number:       dr.Number,
+	})
+	if err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		fmt.Fprintf(w, "-- %s\n%s\n", d.Name, d.Raw)
+	}
+
+	op, err := client.Operations.Deploy(ctx, &ps.PerformDeployRequest{
+		Organization: cfg.org,
+		Database:     cfg.database,
+		Number:       dr.Number,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "deploying deploy request #%d\n", dr.Number)
+
+	if err := wait(ctx, w, client, cfg, op); err != nil {
+		return err
+	}
+
+	res, err := op.Result()
+	if dr, ok := res.(*ps.DeployRequest); ok && dr.Deployment != nil {
+		fmt.Fprintf(w, "deployment finished with state %s\n", dr.Deployment.State)
+	}
+	return err
+}
+
+// wait polls the deploy operation until it's done and prints the changes to
+// the deploy request that the watcher picks up in the meantime.
+func wait(ctx context.Context, w io.Writer, client *ps.Client, cfg *config, op *ps.Operation) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := watch.DeployRequests(ctx, client.DeployRequests, &ps.ListDeployRequestsRequest{
+		Organization: cfg.org,
+		Database:     cfg.database,
+	}, &watch.Options{ResyncInterval: cfg.pollInterval})
+
+	ticker := time.NewTicker(cfg.pollInterval)
+	defer ticker.Stop()
+
+	var lastState string
+	for {
+		select {
+		case ev := <-events:
+			dr := ev.DeployRequest
+			if dr == nil || dr.Number != op.Number || dr.Deployment == nil {
+				continue
+			}
+			if dr.Deployment.State != lastState {
+				lastState = dr.Deployment.State
+				fmt.Fprintf(w, "deploy request #%d: %s\n", dr.Number, lastState)
+			}
+		case <-ticker.C:
+			if err := op.Poll(ctx); err != nil {
+				return err
+			}
+			if op.Done() {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// newClient creates a client authenticated with the service token from the
+// environment.
+func newClient() (*ps.Client, error) {
+	var opts []ps.ClientOption
+	if url := os.Getenv("PLANETSCALE_API_URL"); url != "" {
+		opts = append(opts, ps.WithBaseURL(url))
+	}
+	opts = append(opts, ps.WithServiceToken(
+		os.Getenv("PLANETSCALE_SERVICE_TOKEN_NAME"),
+		os.Getenv("PLANETSCALE_SERVICE_TOKEN"),
+	))
+
+	return ps.NewClient(opts...)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+const usersTable = "CREATE TABLE `users` (\n  `id` bigint NOT NULL,\n  PRIMARY KEY (`id`)\n)"
+
+func TestRun(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	_, err = client.DatabaseBranches.Create(ctx, &ps.CreateDatabaseBranchRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Name:         "pr-42",
+		ParentBranch: "main",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(api.SetSchema("my-org", "my-db", "pr-42", map[string]string{"users": usersTable}), qt.IsNil)
+
+	var out bytes.Buffer
+	err = run(ctx, &out, client, &config{
+		org:          "my-org",
+		database:     "my-db",
+		branch:       "pr-42",
+		into:         "main",
+		pollInterval: time.Millisecond,
+	})
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(out.String(), qt.Contains, "opened deploy request #1 from pr-42 into main\n"+
+		"-- users\n"+usersTable+"\n"+
+		"deploying deploy request #1\n")
+	c.Assert(out.String(), qt.Contains, "deployment finished with state complete\n")
+
+	schema, err := api.Schema("my-org", "my-db", "main")
+	c.Assert(err, qt.IsNil)
+	c.Assert(schema, qt.DeepEquals, map[string]string{"users": usersTable})
+}
+
+func TestRun_missingFlags(t *testing.T) {
+	c := qt.New(t)
+
+	client, err := ps.NewClient()
+	c.Assert(err, qt.IsNil)
+
+	err = run(context.Background(), &bytes.Buffer{}, client, &config{org: "my-org"})
+	c.Assert(err, qt.ErrorMatches, "-org, -database and -branch are required")
+}
@@ -0,0 +1,117 @@
+// Command preview-branch creates a preview branch of a database, waits until
+// the branch is ready and connects to it. Usage:
+//
+//	PLANETSCALE_SERVICE_TOKEN_NAME=... PLANETSCALE_SERVICE_TOKEN=... \
+//		go run ./examples/preview-branch -org my-org -database my-db -branch pr-42
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+	"github.com/planetscale/planetscale-go/planetscale/dbutil"
+)
+
+type config struct {
+	org          string
+	database     string
+	branch       string
+	parent       string
+	pollInterval time.Duration
+}
+
+// connectFunc opens a connection to a database branch.
+type connectFunc func(ctx context.Context, client *ps.Client, org, database, branch string) (*sql.DB, error)
+
+func main() {
+	cfg := &config{}
+	flag.StringVar(&cfg.org, "org", "", "PlanetScale organization")
+	flag.StringVar(&cfg.database, "database", "", "database to create the branch in")
+	flag.StringVar(&cfg.branch, "branch", "", "name of the preview branch")
+	flag.StringVar(&cfg.parent, "parent", "main", "branch to create the preview branch from")
+	flag.DurationVar(&cfg.pollInterval, "poll-interval", 2*time.Second, "interval to check if the branch is ready")
+	flag.Parse()
+
+	client, err := newClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := run(context.Background(), os.Stdout, client, cfg, dial); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, w io.Writer, client *ps.Client, cfg *config, connect connectFunc) error {
+	if cfg.org == "" || cfg.database == "" || cfg.branch == "" {
+		return errors.New("-org, -database and -branch are required")
+	}
+
+	fmt.Fprintf(w, "creating branch %s from %s\n", cfg.branch, cfg.parent)
+	op, err := client.Operations.CreateBranch(ctx, &ps.CreateDatabaseBranchRequest{
+		Organization: cfg.org,
+		Database:     cfg.database,
+		Name:         cfg.branch,
+		ParentBranch: cfg.parent,
+		Notes:        "preview branch",
+	})
+	if err != nil {
+		return err
+	}
+
+	op.PollInterval = cfg.pollInterval
+	if err := op.Wait(ctx); err != nil {
+		return fmt.Errorf("waiting for branch %s: %s", cfg.branch, err)
+	}
+	fmt.Fprintf(w, "branch %s is ready\n", cfg.branch)
+
+	if connect == nil {
+		return nil
+	}
+
+	db, err := connect(ctx, client, cfg.org, cfg.database, cfg.branch)
+	if err != nil {
+		return fmt.Errorf("connecting to branch %s: %s", cfg.branch, err)
+	}
+	defer db.Close()
+
+	var version string
+	if err := db.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "connected to branch %s, MySQL version %s\n", cfg.branch, version)
+
+	return nil
+}
+
+func dial(ctx context.Context, client *ps.Client, org, database, branch string) (*sql.DB, error) {
+	return dbutil.Dial(ctx, &dbutil.DialConfig{
+		Organization: org,
+		Database:     database,
+		Branch:       branch,
+		Client:       client,
+	})
+}
+
+// newClient creates a client authenticated with the service token from the
+// environment.
+func newClient() (*ps.Client, error) {
+	var opts []ps.ClientOption
+	if url := os.Getenv("PLANETSCALE_API_URL"); url != "" {
+		opts = append(opts, ps.WithBaseURL(url))
+	}
+	opts = append(opts, ps.WithServiceToken(
+		os.Getenv("PLANETSCALE_SERVICE_TOKEN_NAME"),
+		os.Getenv("PLANETSCALE_SERVICE_TOKEN"),
+	))
+
+	return ps.NewClient(opts...)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	"github.com/planetscale/planetscale-go/internal/mysqltest"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+func newTestClient(c *qt.C) (*fakeapi.Server, *ps.Client) {
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	return api, client
+}
+
+func testConfig() *config {
+	return &config{
+		org:          "my-org",
+		database:     "my-db",
+		branch:       "pr-42",
+		parent:       "main",
+		pollInterval: time.Millisecond,
+	}
+}
+
+func TestRun(t *testing.T) {
+	c := qt.New(t)
+	_, client := newTestClient(c)
+
+	var out bytes.Buffer
+	err := run(context.Background(), &out, client, testConfig(), nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(out.String(), qt.Equals, "creating branch pr-42 from main\nbranch pr-42 is ready\n")
+
+	b, err := client.DatabaseBranches.Get(context.Background(), &ps.GetDatabaseBranchRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "pr-42",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(b.ParentBranch, qt.Equals, "main")
+	c.Assert(b.Status, qt.Equals, "ready")
+}
+
+func TestRun_mysql(t *testing.T) {
+	c := qt.New(t)
+	connect := mysqltest.Connect(t)
+	_, client := newTestClient(c)
+
+	var out bytes.Buffer
+	err := run(context.Background(), &out, client, testConfig(), connect)
+	c.Assert(err, qt.IsNil)
+	c.Assert(out.String(), qt.Matches, `(?s).*connected to branch pr-42, MySQL version .*\n`)
+}
+
+func TestRun_missingFlags(t *testing.T) {
+	c := qt.New(t)
+	_, client := newTestClient(c)
+
+	err := run(context.Background(), &bytes.Buffer{}, client, &config{org: "my-org"}, nil)
+	c.Assert(err, qt.ErrorMatches, "-org, -database and -branch are required")
+}
@@ -0,0 +1,123 @@
+// Command rotate-service-tokens replaces a service token with a new one that
+// has the same accesses and deletes the old token. Usage:
+//
+//	PLANETSCALE_SERVICE_TOKEN_NAME=... PLANETSCALE_SERVICE_TOKEN=... \
+//		go run ./examples/rotate-service-tokens -org my-org -token-id abc123
+//
+// The token used to authenticate needs the permission to manage service
+// tokens and shouldn't be the token that is rotated.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+type config struct {
+	org     string
+	tokenID string
+}
+
+func main() {
+	cfg := &config{}
+	flag.StringVar(&cfg.org, "org", "", "PlanetScale organization")
+	flag.StringVar(&cfg.tokenID, "token-id", "", "ID of the service token to rotate")
+	flag.Parse()
+
+	client, err := newClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := run(context.Background(), os.Stdout, client, cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, w io.Writer, client *ps.Client, cfg *config) error {
+	if cfg.org == "" || cfg.tokenID == "" {
+		return errors.New("-org and -token-id are required")
+	}
+
+	accesses, err := client.ServiceTokens.GetAccess(ctx, &ps.GetServiceTokenAccessRequest{
+		Organization: cfg.org,
+		ID:           cfg.tokenID,
+	})
+	if err != nil {
+		return fmt.Errorf("fetching accesses of service token %s: %s", cfg.tokenID, err)
+	}
+
+	// accesses are granted per database
+	byDatabase := make(map[string][]string)
+	for _, a := range accesses {
+		byDatabase[a.Resource.Name] = append(byDatabase[a.Resource.Name], a.Access)
+	}
+
+	databases := make([]string, 0, len(byDatabase))
+	for db := range byDatabase {
+		databases = append(databases, db)
+	}
+	sort.Strings(databases)
+
+	st, err := client.ServiceTokens.Create(ctx, &ps.CreateServiceTokenRequest{
+		Organization: cfg.org,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, db := range databases {
+		_, err := client.ServiceTokens.AddAccess(ctx, &ps.AddServiceTokenAccessRequest{
+			Organization: cfg.org,
+			ID:           st.ID,
+			Database:     db,
+			Accesses:     byDatabase[db],
+		})
+		if err != nil {
+			// don't leave a half configured token behind, the old
+			// token is still valid
+			_ = client.ServiceTokens.Delete(ctx, &ps.DeleteServiceTokenRequest{
+				Organization: cfg.org,
+				ID:           st.ID,
+			})
+			return fmt.Errorf("granting access to database %s: %s", db, err)
+		}
+		fmt.Fprintf(w, "granted %v on %s\n", byDatabase[db], db)
+	}
+
+	err = client.ServiceTokens.Delete(ctx, &ps.DeleteServiceTokenRequest{
+		Organization: cfg.org,
+		ID:           cfg.tokenID,
+	})
+	if err != nil {
+		return fmt.Errorf("deleting service token %s: %s", cfg.tokenID, err)
+	}
+	fmt.Fprintf(w, "deleted service token %s\n", cfg.tokenID)
+
+	fmt.Fprintf(w, "PLANETSCALE_SERVICE_TOKEN_NAME=%s\n", st.ID)
+	fmt.Fprintf(w, "PLANETSCALE_SERVICE_TOKEN=%s\n", st.Token)
+	return nil
+}
+
+// newClient creates a client authenticated with the service token from the
+// environment.
+func newClient() (*ps.Client, error) {
+	var opts []ps.ClientOption
+	if url := os.Getenv("PLANETSCALE_API_URL"); url != "" {
+		opts = append(opts, ps.WithBaseURL(url))
+	}
+	opts = append(opts, ps.WithServiceToken(
+		os.Getenv("PLANETSCALE_SERVICE_TOKEN_NAME"),
+		os.Getenv("PLANETSCALE_SERVICE_TOKEN"),
+	))
+
+	return ps.NewClient(opts...)
+}
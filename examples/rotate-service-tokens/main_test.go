@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+func TestRun(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+	api.CreateDatabase("my-org", "other-db")
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	old, err := client.ServiceTokens.Create(ctx, &ps.CreateServiceTokenRequest{Organization: "my-org"})
+	c.Assert(err, qt.IsNil)
+	for db, accesses := range map[string][]string{
+		"my-db":    {"read_branch", "create_deploy_request"},
+		"other-db": {"read_branch"},
+	} {
+		_, err := client.ServiceTokens.AddAccess(ctx, &ps.AddServiceTokenAccessRequest{
+			Organization: "my-org",
+			ID:           old.ID,
+			Database:     db,
+			Accesses:     accesses,
+		})
+		c.Assert(err, qt.IsNil)
+	}
+
+	var out bytes.Buffer
+	err = run(ctx, &out, client, &config{org: "my-org", tokenID: old.ID})
+	c.Assert(err, qt.IsNil)
+
+	tokens, err := client.ServiceTokens.List(ctx, &ps.ListServiceTokensRequest{Organization: "my-org"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(tokens, qt.HasLen, 1)
+	c.Assert(tokens[0].ID, qt.Not(qt.Equals), old.ID)
+
+	c.Assert(out.String(), qt.Matches, fmt.Sprintf(
+		"granted \\[read_branch create_deploy_request\\] on my-db\n"+
+			"granted \\[read_branch\\] on other-db\n"+
+			"deleted service token %s\n"+
+			"PLANETSCALE_SERVICE_TOKEN_NAME=%s\n"+
+			"PLANETSCALE_SERVICE_TOKEN=[0-9a-f]+\n", old.ID, tokens[0].ID))
+
+	accesses, err := client.ServiceTokens.GetAccess(ctx, &ps.GetServiceTokenAccessRequest{
+		Organization: "my-org",
+		ID:           tokens[0].ID,
+	})
+	c.Assert(err, qt.IsNil)
+
+	var got []string
+	for _, a := range accesses {
+		got = append(got, a.Resource.Name+":"+a.Access)
+	}
+	c.Assert(got, qt.DeepEquals, []string{
+		"my-db:read_branch",
+		"my-db:create_deploy_request",
+		"other-db:read_branch",
+	})
+}
+
+func TestRun_unknownToken(t *testing.T) {
+	c := qt.New(t)
+
+	_, ts := fakeapi.NewServer(c)
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	err = run(context.Background(), &bytes.Buffer{}, client, &config{org: "my-org", tokenID: "unknown"})
+	c.Assert(err, qt.ErrorMatches, "fetching accesses of service token unknown: .*")
+}
@@ -0,0 +1,1097 @@
+// Package fakeapi implements an in-memory fake of the PlanetScale API, which
+// is used to test the workflows built on top of the client end to end.
+package fakeapi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+// Server is a fake PlanetScale API. Resources that take time to become ready
+// on PlanetScale, such as databases, branches, backups and deployments, are
+// pending on creation and become ready once they have been fetched.
+type Server struct {
+	mu   sync.Mutex
+	orgs map[string]*org
+
+	// MySQLHost and MySQLPort are returned as the address of all database
+	// branches.
+	MySQLHost string
+	MySQLPort int
+
+	// ExportURL is the base URL of backup exports, which are served by the
+	// fake API under /exports/. NewServer sets it to the URL of the test
+	// server.
+	ExportURL string
+
+	caKey  *rsa.PrivateKey
+	caCert *x509.Certificate
+	caPEM  string
+
+	requests []string
+
+	exports         map[string][]byte
+	interruptExport int64
+}
+
+type org struct {
+	dbs    map[string]*database
+	tokens map[string]*token
+}
+
+type database struct {
+	db       *ps.Database
+	pending  bool
+	branches map[string]*branch
+	drs      map[uint64]*deployRequest
+	nextDR   uint64
+}
+
+type branch struct {
+	branch  *ps.DatabaseBranch
+	pending bool
+
+	// schema maps table names to their CREATE TABLE statement.
+	schema map[string]string
+
+	backups map[string]*backup
+}
+
+type backup struct {
+	backup  *ps.Backup
+	pending bool
+
+	// data is the content of the backup once it's completed.
+	data []byte
+}
+
+type deployRequest struct {
+	dr      *ps.DeployRequest
+	pending bool
+	reviews []*ps.DeployRequestReview
+}
+
+type token struct {
+	token    *ps.ServiceToken
+	accesses []*ps.ServiceTokenAccess
+}
+
+// New returns a new, empty fake API.
+func New() *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("fakeapi: generating CA key: %s", err))
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fakeapi-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(fmt.Sprintf("fakeapi: creating CA certificate: %s", err))
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(fmt.Sprintf("fakeapi: parsing CA certificate: %s", err))
+	}
+
+	return &Server{
+		orgs:      make(map[string]*org),
+		MySQLHost: "127.0.0.1",
+		MySQLPort: 3306,
+		caKey:     key,
+		caCert:    cert,
+		caPEM:     string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		exports:   make(map[string][]byte),
+	}
+}
+
+// NewServer starts a fake API and returns the HTTP server serving it. The
+// server is closed when the test finishes.
+func NewServer(t interface{ Cleanup(func()) }) (*Server, *httptest.Server) {
+	s := New()
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	s.ExportURL = ts.URL
+	return s, ts
+}
+
+// CreateDatabase creates a ready database with a ready "main" branch.
+func (s *Server) CreateDatabase(orgName, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db := s.newDatabase(s.org(orgName), name)
+	db.pending = false
+	db.db.State = "ready"
+}
+
+// SetSchema replaces the schema of a branch. tables maps table names to their
+// CREATE TABLE statement.
+func (s *Server) SetSchema(orgName, db, branchName string, tables map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.branch(orgName, db, branchName)
+	if err != nil {
+		return err
+	}
+
+	b.schema = copySchema(tables)
+	return nil
+}
+
+// Schema returns the schema of a branch.
+func (s *Server) Schema(orgName, db, branchName string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.branch(orgName, db, branchName)
+	if err != nil {
+		return nil, err
+	}
+
+	return copySchema(b.schema), nil
+}
+
+// CreateServiceToken creates a service token with the given name. Tokens
+// created through the API have no name.
+func (s *Server) CreateServiceToken(orgName, name string) *ps.ServiceToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.newServiceToken(s.org(orgName))
+	t.token.Name = name
+
+	out := *t.token
+	return &out
+}
+
+// GrantOrganizationAccess grants a service token an access to the
+// organization itself, which the API can't grant.
+func (s *Server) GrantOrganizationAccess(orgName, id, access string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.org(orgName).tokens[id]
+	if !ok {
+		return fmt.Errorf("service token %s not found", id)
+	}
+
+	t.accesses = append(t.accesses, &ps.ServiceTokenAccess{
+		ID:       len(t.accesses) + 1,
+		Access:   access,
+		Type:     "OrganizationAccess",
+		Resource: ps.Database{Name: orgName},
+	})
+	return nil
+}
+
+// SetDeploymentState overrides the state of the deployment of a deploy
+// request, e.g. to simulate a failed deployment.
+func (s *Server) SetDeploymentState(orgName, db string, number uint64, state string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.org(orgName).dbs[db]
+	if !ok {
+		return fmt.Errorf("database %s not found", db)
+	}
+
+	dr, ok := d.drs[number]
+	if !ok {
+		return fmt.Errorf("deploy request %d not found", number)
+	}
+
+	dr.dr.Deployment.State = state
+	dr.pending = false
+	return nil
+}
+
+// BackupData returns the content of a completed backup, which is what its
+// exports serve.
+func (s *Server) BackupData(orgName, db, branchName, name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.branch(orgName, db, branchName)
+	if err != nil {
+		return nil, err
+	}
+
+	bk, ok := b.backups[name]
+	if !ok || bk.pending {
+		return nil, fmt.Errorf("backup %s not found or not completed", name)
+	}
+	return bk.data, nil
+}
+
+// InterruptExport makes the next export download drop the connection after
+// n bytes of the response body.
+func (s *Server) InterruptExport(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.interruptExport = n
+}
+
+// Requests returns the requests received so far, formatted as "METHOD path".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	if strings.HasPrefix(r.URL.Path, "/exports/") {
+		s.serveExport(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_params", err.Error())
+		return
+	}
+
+	v, status, err := s.route(r.Method, strings.Trim(r.URL.Path, "/"), body)
+	if err != nil {
+		if e, ok := err.(*apiError); ok {
+			writeError(w, e.status, e.code, e.msg)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "internal", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if v != nil {
+		_ = json.NewEncoder(w).Encode(v)
+	}
+}
+
+type apiError struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e *apiError) Error() string { return e.msg }
+
+func notFound() error {
+	return &apiError{status: http.StatusNotFound, code: "not_found", msg: "Not Found"}
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &apiError{status: http.StatusUnprocessableEntity, code: "invalid_params", msg: fmt.Sprintf(format, args...)}
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"code": code, "message": msg})
+}
+
+type list struct {
+	Type     string      `json:"type"`
+	NextPage *string     `json:"next_page"`
+	PrevPage *string     `json:"prev_page"`
+	Data     interface{} `json:"data"`
+}
+
+func newList(data interface{}) *list {
+	return &list{Type: "list", Data: data}
+}
+
+// route dispatches a request for the given path, e.g.
+// "v1/organizations/my-org/databases".
+func (s *Server) route(method, path string, body []byte) (interface{}, int, error) {
+	seg := strings.Split(path, "/")
+	if len(seg) < 2 || seg[0] != "v1" {
+		return nil, 0, notFound()
+	}
+	seg = seg[1:]
+
+	switch {
+	case len(seg) == 1 && seg[0] == "regions" && method == http.MethodGet:
+		return newList([]*ps.Region{{Slug: "us-east", Name: "US East", Enabled: true}}), http.StatusOK, nil
+	case len(seg) == 1 && seg[0] == "organizations" && method == http.MethodGet:
+		var orgs []*ps.Organization
+		for _, name := range sortedKeys(s.orgs) {
+			orgs = append(orgs, &ps.Organization{Name: name})
+		}
+		return newList(orgs), http.StatusOK, nil
+	case len(seg) == 2 && seg[0] == "organizations" && method == http.MethodGet:
+		if _, ok := s.orgs[seg[1]]; !ok {
+			return nil, 0, notFound()
+		}
+		return &ps.Organization{Name: seg[1]}, http.StatusOK, nil
+	case len(seg) >= 3 && seg[0] == "organizations" && seg[2] == "databases":
+		return s.routeDatabases(method, s.org(seg[1]), seg[3:], body)
+	case len(seg) >= 3 && seg[0] == "organizations" && seg[2] == "service-tokens":
+		return s.routeServiceTokens(method, s.org(seg[1]), seg[3:], body)
+	}
+
+	return nil, 0, notFound()
+}
+
+func (s *Server) routeDatabases(method string, o *org, seg []string, body []byte) (interface{}, int, error) {
+	if len(seg) == 0 {
+		switch method {
+		case http.MethodGet:
+			var dbs []*ps.Database
+			for _, name := range sortedKeys(o.dbs) {
+				dbs = append(dbs, o.dbs[name].db)
+			}
+			return newList(dbs), http.StatusOK, nil
+		case http.MethodPost:
+			req := &ps.CreateDatabaseRequest{}
+			if err := json.Unmarshal(body, req); err != nil {
+				return nil, 0, invalid("%s", err)
+			}
+			if req.Name == "" {
+				return nil, 0, invalid("name is required")
+			}
+			if _, ok := o.dbs[req.Name]; ok {
+				return nil, 0, invalid("database %s already exists", req.Name)
+			}
+			db := s.newDatabase(o, req.Name)
+			db.db.Notes = req.Notes
+			return db.db, http.StatusCreated, nil
+		}
+		return nil, 0, notFound()
+	}
+
+	db, ok := o.dbs[seg[0]]
+	if !ok {
+		return nil, 0, notFound()
+	}
+
+	if len(seg) == 1 {
+		switch method {
+		case http.MethodGet:
+			out := copyDatabase(db.db)
+			if db.pending {
+				db.pending = false
+				db.db.State = "ready"
+			}
+			return out, http.StatusOK, nil
+		case http.MethodDelete:
+			delete(o.dbs, seg[0])
+			return nil, http.StatusNoContent, nil
+		}
+		return nil, 0, notFound()
+	}
+
+	switch seg[1] {
+	case "branches":
+		return s.routeBranches(method, db, seg[2:], body)
+	case "deploy-requests":
+		return s.routeDeployRequests(method, db, seg[2:], body)
+	}
+
+	return nil, 0, notFound()
+}
+
+func (s *Server) routeBranches(method string, db *database, seg []string, body []byte) (interface{}, int, error) {
+	if len(seg) == 0 {
+		switch method {
+		case http.MethodGet:
+			var branches []*ps.DatabaseBranch
+			for _, name := range sortedKeys(db.branches) {
+				branches = append(branches, db.branches[name].branch)
+			}
+			return newList(branches), http.StatusOK, nil
+		case http.MethodPost:
+			req := &ps.CreateDatabaseBranchRequest{}
+			if err := json.Unmarshal(body, req); err != nil {
+				return nil, 0, invalid("%s", err)
+			}
+			if req.Name == "" {
+				return nil, 0, invalid("name is required")
+			}
+			if _, ok := db.branches[req.Name]; ok {
+				return nil, 0, invalid("branch %s already exists", req.Name)
+			}
+			parent, ok := db.branches[req.ParentBranch]
+			if !ok {
+				return nil, 0, invalid("parent branch %s doesn't exist", req.ParentBranch)
+			}
+
+			now := time.Now().UTC()
+			b := &branch{
+				branch: &ps.DatabaseBranch{
+					Name:         req.Name,
+					Notes:        req.Notes,
+					ParentBranch: req.ParentBranch,
+					Status:       "pending",
+					CreatedAt:    now,
+					UpdatedAt:    now,
+				},
+				pending: true,
+				schema:  copySchema(parent.schema),
+				backups: make(map[string]*backup),
+			}
+			db.branches[req.Name] = b
+			return b.branch, http.StatusCreated, nil
+		}
+		return nil, 0, notFound()
+	}
+
+	b, ok := db.branches[seg[0]]
+	if !ok {
+		return nil, 0, notFound()
+	}
+
+	if len(seg) == 1 {
+		switch method {
+		case http.MethodGet:
+			return b.branch, http.StatusOK, nil
+		case http.MethodDelete:
+			delete(db.branches, seg[0])
+			return nil, http.StatusNoContent, nil
+		}
+		return nil, 0, notFound()
+	}
+
+	switch {
+	case seg[1] == "status" && method == http.MethodGet:
+		ready := !b.pending
+		if b.pending {
+			b.pending = false
+			b.branch.Status = "ready"
+		}
+		return &ps.DatabaseBranchStatus{
+			Ready: ready,
+			Credentials: ps.DatabaseBranchCredentials{
+				GatewayHost: s.MySQLHost,
+				GatewayPort: s.MySQLPort,
+				User:        "root",
+			},
+		}, http.StatusOK, nil
+	case seg[1] == "schema" && method == http.MethodGet:
+		var diffs []*ps.Diff
+		for _, name := range sortedKeys(b.schema) {
+			diffs = append(diffs, &ps.Diff{Name: name, Raw: b.schema[name]})
+		}
+		return newList(diffs), http.StatusOK, nil
+	case seg[1] == "diff" && method == http.MethodGet:
+		var parent map[string]string
+		if p, ok := db.branches[b.branch.ParentBranch]; ok {
+			parent = p.schema
+		}
+		return newList(diffSchemas(parent, b.schema)), http.StatusOK, nil
+	case seg[1] == "refresh-schema" && method == http.MethodPost:
+		return nil, http.StatusNoContent, nil
+	case seg[1] == "create-certificate" && method == http.MethodPost:
+		return s.createCertificate(b, body)
+	case seg[1] == "backups":
+		return s.routeBackups(method, b, seg[2:])
+	}
+
+	return nil, 0, notFound()
+}
+
+func (s *Server) routeBackups(method string, b *branch, seg []string) (interface{}, int, error) {
+	if len(seg) == 0 {
+		switch method {
+		case http.MethodGet:
+			var backups []*ps.Backup
+			for _, name := range sortedKeys(b.backups) {
+				backups = append(backups, b.backups[name].backup)
+			}
+			return newList(backups), http.StatusOK, nil
+		case http.MethodPost:
+			now := time.Now().UTC()
+			bk := &backup{
+				backup: &ps.Backup{
+					Name:      "backup-" + randomID(4),
+					State:     "pending",
+					CreatedAt: now,
+					UpdatedAt: now,
+					StartedAt: now,
+					ExpiresAt: now.Add(7 * 24 * time.Hour),
+				},
+				pending: true,
+			}
+			b.backups[bk.backup.Name] = bk
+			return bk.backup, http.StatusCreated, nil
+		}
+		return nil, 0, notFound()
+	}
+
+	bk, ok := b.backups[seg[0]]
+	if !ok || len(seg) > 2 {
+		return nil, 0, notFound()
+	}
+
+	if len(seg) == 2 {
+		if seg[1] != "export" || method != http.MethodPost {
+			return nil, 0, notFound()
+		}
+		if bk.pending {
+			return nil, 0, invalid("backup %s is not completed", bk.backup.Name)
+		}
+
+		id := randomID(16)
+		s.exports[id] = bk.data
+		sum := sha256.Sum256(bk.data)
+		return &ps.BackupExport{
+			URL:       s.ExportURL + "/exports/" + id,
+			Size:      int64(len(bk.data)),
+			SHA256:    hex.EncodeToString(sum[:]),
+			ExpiresAt: time.Now().UTC().Add(time.Hour),
+		}, http.StatusCreated, nil
+	}
+
+	switch method {
+	case http.MethodGet:
+		out := *bk.backup
+		if bk.pending {
+			bk.pending = false
+			bk.backup.State = "success"
+			bk.backup.CompletedAt = time.Now().UTC()
+			bk.backup.Size = int64(len(b.schema)) * 1024
+			bk.data = backupData(b.schema, bk.backup.Size)
+		}
+		return &out, http.StatusOK, nil
+	case http.MethodDelete:
+		delete(b.backups, seg[0])
+		return nil, http.StatusNoContent, nil
+	}
+
+	return nil, 0, notFound()
+}
+
+// serveExport serves the data of a backup export, supporting range requests.
+func (s *Server) serveExport(w http.ResponseWriter, r *http.Request) {
+	data, ok := s.exports[strings.TrimPrefix(r.URL.Path, "/exports/")]
+	if !ok || r.Method != http.MethodGet {
+		writeError(w, http.StatusNotFound, "not_found", "Not Found")
+		return
+	}
+
+	if s.interruptExport > 0 {
+		w = &cutWriter{ResponseWriter: w, n: s.interruptExport}
+		s.interruptExport = 0
+	}
+
+	http.ServeContent(w, r, "backup", time.Time{}, bytes.NewReader(data))
+}
+
+// cutWriter drops the response body after n bytes. As the response is
+// shorter than its Content-Length, the server closes the connection.
+type cutWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *cutWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > w.n {
+		_, err := w.ResponseWriter.Write(p[:w.n])
+		w.n = 0
+		return len(p), err
+	}
+
+	w.n -= int64(len(p))
+	return w.ResponseWriter.Write(p)
+}
+
+// backupData returns size bytes of a backup of schema.
+func backupData(schema map[string]string, size int64) []byte {
+	var dump bytes.Buffer
+	for _, name := range sortedKeys(schema) {
+		dump.WriteString(schema[name] + ";\n")
+	}
+	if dump.Len() == 0 {
+		return nil
+	}
+
+	data := bytes.Repeat(dump.Bytes(), int(size)/dump.Len()+1)
+	return data[:size]
+}
+
+func (s *Server) routeDeployRequests(method string, db *database, seg []string, body []byte) (interface{}, int, error) {
+	if len(seg) == 0 {
+		switch method {
+		case http.MethodGet:
+			var numbers []uint64
+			for n := range db.drs {
+				numbers = append(numbers, n)
+			}
+			sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+			var drs []*ps.DeployRequest
+			for _, n := range numbers {
+				drs = append(drs, db.drs[n].dr)
+			}
+			return newList(drs), http.StatusOK, nil
+		case http.MethodPost:
+			req := &ps.CreateDeployRequestRequest{}
+			if err := json.Unmarshal(body, req); err != nil {
+				return nil, 0, invalid("%s", err)
+			}
+			if _, ok := db.branches[req.Branch]; !ok {
+				return nil, 0, invalid("branch %s doesn't exist", req.Branch)
+			}
+			if _, ok := db.branches[req.IntoBranch]; !ok {
+				return nil, 0, invalid("branch %s doesn't exist", req.IntoBranch)
+			}
+			for _, dr := range db.drs {
+				if dr.dr.Branch == req.Branch && dr.dr.State == "open" {
+					return nil, 0, invalid("branch %s already has an open deploy request", req.Branch)
+				}
+			}
+
+			db.nextDR++
+			now := time.Now().UTC()
+			dr := &deployRequest{dr: &ps.DeployRequest{
+				ID:         randomID(6),
+				Branch:     req.Branch,
+				IntoBranch: req.IntoBranch,
+				Number:     db.nextDR,
+				State:      "open",
+				Notes:      req.Notes,
+				Deployment: &ps.Deployment{
+					ID:                  randomID(6),
+					State:               "ready",
+					Deployable:          true,
+					DeployRequestNumber: db.nextDR,
+					IntoBranch:          req.IntoBranch,
+					CreatedAt:           now,
+					UpdatedAt:           now,
+				},
+				CreatedAt: now,
+				UpdatedAt: now,
+			}}
+			db.drs[dr.dr.Number] = dr
+			return dr.dr, http.StatusCreated, nil
+		}
+		return nil, 0, notFound()
+	}
+
+	number, err := strconv.ParseUint(seg[0], 10, 64)
+	if err != nil {
+		return nil, 0, notFound()
+	}
+
+	dr, ok := db.drs[number]
+	if !ok {
+		return nil, 0, notFound()
+	}
+
+	if len(seg) == 1 {
+		switch method {
+		case http.MethodGet:
+			out := copyDeployRequest(dr.dr)
+			if dr.pending {
+				dr.pending = false
+				s.completeDeployment(db, dr)
+			}
+			return out, http.StatusOK, nil
+		case http.MethodPatch:
+			req := &ps.CloseRequest{}
+			if err := json.Unmarshal(body, req); err != nil {
+				return nil, 0, invalid("%s", err)
+			}
+			if req.State == "closed" {
+				now := time.Now().UTC()
+				dr.dr.State = "closed"
+				dr.dr.ClosedAt = &now
+			}
+			return dr.dr, http.StatusOK, nil
+		}
+		return nil, 0, notFound()
+	}
+
+	switch {
+	case seg[1] == "deploy" && method == http.MethodPost:
+		if dr.dr.State != "open" {
+			return nil, 0, invalid("deploy request %d is %s", number, dr.dr.State)
+		}
+		now := time.Now().UTC()
+		dr.dr.Deployment.State = "queued"
+		dr.dr.Deployment.QueuedAt = &now
+		dr.pending = true
+		return dr.dr, http.StatusOK, nil
+	case seg[1] == "cancel" && method == http.MethodPost:
+		if dr.dr.Deployment.State != "queued" {
+			return nil, 0, invalid("deploy request %d is not queued", number)
+		}
+		dr.dr.Deployment.State = "complete_cancel"
+		dr.pending = false
+		return dr.dr, http.StatusOK, nil
+	case seg[1] == "reviews" && method == http.MethodPost:
+		var req struct {
+			State string `json:"state"`
+			Body  string `json:"body"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, 0, invalid("%s", err)
+		}
+		now := time.Now().UTC()
+		review := &ps.DeployRequestReview{
+			ID:        randomID(6),
+			Body:      req.Body,
+			State:     req.State,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		dr.reviews = append(dr.reviews, review)
+		if req.State == ps.ReviewApprove.String() {
+			dr.dr.Approved = true
+		}
+		return review, http.StatusCreated, nil
+	case seg[1] == "diff" && method == http.MethodGet:
+		from, into := db.branches[dr.dr.IntoBranch], db.branches[dr.dr.Branch]
+		var fromSchema, intoSchema map[string]string
+		if from != nil {
+			fromSchema = from.schema
+		}
+		if into != nil {
+			intoSchema = into.schema
+		}
+		return newList(diffSchemas(fromSchema, intoSchema)), http.StatusOK, nil
+	}
+
+	return nil, 0, notFound()
+}
+
+// completeDeployment applies the schema of the deploy request's branch to the
+// branch it's deployed into.
+func (s *Server) completeDeployment(db *database, dr *deployRequest) {
+	if dr.dr.Deployment.State != "queued" {
+		return
+	}
+
+	from, into := db.branches[dr.dr.Branch], db.branches[dr.dr.IntoBranch]
+	if from == nil || into == nil {
+		dr.dr.Deployment.State = "error"
+		return
+	}
+
+	now := time.Now().UTC()
+	if len(diffSchemas(into.schema, from.schema)) == 0 {
+		dr.dr.Deployment.State = "no_changes"
+	} else {
+		into.schema = copySchema(from.schema)
+		dr.dr.Deployment.State = "complete"
+	}
+	dr.dr.Deployment.FinishedAt = &now
+	dr.dr.State = "closed"
+	dr.dr.ClosedAt = &now
+}
+
+func (s *Server) routeServiceTokens(method string, o *org, seg []string, body []byte) (interface{}, int, error) {
+	if len(seg) == 0 {
+		switch method {
+		case http.MethodGet:
+			var tokens []*ps.ServiceToken
+			for _, id := range sortedKeys(o.tokens) {
+				// the token itself is only returned on creation
+				tokens = append(tokens, &ps.ServiceToken{ID: id, Name: o.tokens[id].token.Name, Type: "ServiceToken"})
+			}
+			return newList(tokens), http.StatusOK, nil
+		case http.MethodPost:
+			return s.newServiceToken(o).token, http.StatusCreated, nil
+		}
+		return nil, 0, notFound()
+	}
+
+	t, ok := o.tokens[seg[0]]
+	if !ok {
+		return nil, 0, notFound()
+	}
+
+	if len(seg) == 1 {
+		if method == http.MethodDelete {
+			delete(o.tokens, seg[0])
+			return nil, http.StatusNoContent, nil
+		}
+		return nil, 0, notFound()
+	}
+
+	if seg[1] != "access" || len(seg) > 2 {
+		return nil, 0, notFound()
+	}
+
+	switch method {
+	case http.MethodGet:
+		return newList(t.accesses), http.StatusOK, nil
+	case http.MethodPost, http.MethodDelete:
+		req := &ps.AddServiceTokenAccessRequest{}
+		if err := json.Unmarshal(body, req); err != nil {
+			return nil, 0, invalid("%s", err)
+		}
+		db, ok := o.dbs[req.Database]
+		if !ok {
+			return nil, 0, invalid("database %s doesn't exist", req.Database)
+		}
+
+		if method == http.MethodDelete {
+			remove := make(map[string]bool)
+			for _, a := range req.Accesses {
+				remove[a] = true
+			}
+			var kept []*ps.ServiceTokenAccess
+			for _, a := range t.accesses {
+				if !(a.Type == "DatabaseAccess" && a.Resource.Name == req.Database && remove[a.Access]) {
+					kept = append(kept, a)
+				}
+			}
+			t.accesses = kept
+			return nil, http.StatusNoContent, nil
+		}
+
+		var added []*ps.ServiceTokenAccess
+		for _, access := range req.Accesses {
+			exists := false
+			for _, a := range t.accesses {
+				if a.Type == "DatabaseAccess" && a.Resource.Name == req.Database && a.Access == access {
+					exists = true
+					added = append(added, a)
+				}
+			}
+			if exists {
+				continue
+			}
+
+			a := &ps.ServiceTokenAccess{
+				ID:       len(t.accesses) + 1,
+				Access:   access,
+				Type:     "DatabaseAccess",
+				Resource: ps.Database{Name: db.db.Name},
+			}
+			t.accesses = append(t.accesses, a)
+			added = append(added, a)
+		}
+		return newList(added), http.StatusOK, nil
+	}
+
+	return nil, 0, notFound()
+}
+
+// createCertificate signs the CSR of the request with the fake CA.
+func (s *Server) createCertificate(b *branch, body []byte) (interface{}, int, error) {
+	var req struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, 0, invalid("%s", err)
+	}
+
+	block, _ := pem.Decode([]byte(req.CSR))
+	if block == nil {
+		return nil, 0, invalid("invalid CSR")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, 0, invalid("invalid CSR: %s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.caCert, csr.PublicKey, s.caKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return map[string]interface{}{
+		"certificate":       string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		"certificate_chain": s.caPEM,
+		"remote_addr":       s.MySQLHost,
+		"ports": map[string]int{
+			"proxy":     s.MySQLPort,
+			"mysql-tls": s.MySQLPort,
+		},
+	}, http.StatusCreated, nil
+}
+
+func (s *Server) org(name string) *org {
+	o, ok := s.orgs[name]
+	if !ok {
+		o = &org{
+			dbs:    make(map[string]*database),
+			tokens: make(map[string]*token),
+		}
+		s.orgs[name] = o
+	}
+	return o
+}
+
+func (s *Server) newDatabase(o *org, name string) *database {
+	now := time.Now().UTC()
+	db := &database{
+		db: &ps.Database{
+			Name:      name,
+			State:     "pending",
+			Region:    ps.Region{Slug: "us-east", Name: "US East", Enabled: true},
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		pending: true,
+		branches: map[string]*branch{
+			"main": {
+				branch: &ps.DatabaseBranch{
+					Name:      "main",
+					Status:    "ready",
+					CreatedAt: now,
+					UpdatedAt: now,
+				},
+				schema:  make(map[string]string),
+				backups: make(map[string]*backup),
+			},
+		},
+		drs: make(map[uint64]*deployRequest),
+	}
+	o.dbs[name] = db
+	return db
+}
+
+func (s *Server) newServiceToken(o *org) *token {
+	t := &token{token: &ps.ServiceToken{
+		ID:    randomID(6),
+		Type:  "ServiceToken",
+		Token: randomID(20),
+	}}
+	o.tokens[t.token.ID] = t
+	return t
+}
+
+func (s *Server) branch(orgName, db, branchName string) (*branch, error) {
+	d, ok := s.org(orgName).dbs[db]
+	if !ok {
+		return nil, fmt.Errorf("database %s not found", db)
+	}
+
+	b, ok := d.branches[branchName]
+	if !ok {
+		return nil, fmt.Errorf("branch %s not found", branchName)
+	}
+
+	return b, nil
+}
+
+// diffSchemas returns the tables that differ between from and to. Dropped
+// tables are returned with an empty Raw statement.
+func diffSchemas(from, to map[string]string) []*ps.Diff {
+	names := make(map[string]bool)
+	for name := range from {
+		names[name] = true
+	}
+	for name := range to {
+		names[name] = true
+	}
+
+	var diffs []*ps.Diff
+	for _, name := range sortedKeys(names) {
+		if from[name] != to[name] {
+			diffs = append(diffs, &ps.Diff{Name: name, Raw: to[name]})
+		}
+	}
+	return diffs
+}
+
+func copySchema(schema map[string]string) map[string]string {
+	out := make(map[string]string, len(schema))
+	for k, v := range schema {
+		out[k] = v
+	}
+	return out
+}
+
+func copyDatabase(db *ps.Database) *ps.Database {
+	c := *db
+	return &c
+}
+
+func copyDeployRequest(dr *ps.DeployRequest) *ps.DeployRequest {
+	c := *dr
+	if dr.Deployment != nil {
+		d := *dr.Deployment
+		c.Deployment = &d
+	}
+	return &c
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*org:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*database:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*branch:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*backup:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*token:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]bool:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,93 @@
+package fakeapi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+func newTestClient(c *qt.C) (*Server, *ps.Client) {
+	s, ts := NewServer(c)
+	s.CreateDatabase("my-org", "my-db")
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	return s, client
+}
+
+func TestServer_deploy(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	s, client := newTestClient(c)
+
+	_, err := client.DatabaseBranches.Create(ctx, &ps.CreateDatabaseBranchRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Name:         "dev",
+		ParentBranch: "main",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(s.SetSchema("my-org", "my-db", "dev", map[string]string{"t": "CREATE TABLE t"}), qt.IsNil)
+
+	dr, err := client.DeployRequests.Create(ctx, &ps.CreateDeployRequestRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "dev",
+		IntoBranch:   "main",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(dr.Number, qt.Equals, uint64(1))
+
+	_, err = client.DeployRequests.Create(ctx, &ps.CreateDeployRequestRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "dev",
+		IntoBranch:   "main",
+	})
+	c.Assert(err, qt.ErrorMatches, "branch dev already has an open deploy request")
+
+	op, err := client.Operations.Deploy(ctx, &ps.PerformDeployRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Number:       dr.Number,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(op.Wait(ctx), qt.IsNil)
+
+	schema, err := s.Schema("my-org", "my-db", "main")
+	c.Assert(err, qt.IsNil)
+	c.Assert(schema, qt.DeepEquals, map[string]string{"t": "CREATE TABLE t"})
+	c.Assert(s.Requests(), qt.Contains, "POST /v1/organizations/my-org/databases/my-db/deploy-requests/1/deploy")
+}
+
+func TestServer_createCertificate(t *testing.T) {
+	c := qt.New(t)
+	_, client := newTestClient(c)
+
+	pkey, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, qt.IsNil)
+
+	cert, err := client.Certificates.Create(context.Background(), &ps.CreateCertificateRequest{
+		Organization: "my-org",
+		DatabaseName: "my-db",
+		Branch:       "main",
+		PrivateKey:   pkey,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(cert.RemoteAddr, qt.Equals, "127.0.0.1")
+	c.Assert(cert.Ports.MySQL, qt.Equals, 3306)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.CACert)
+	_, err = cert.ClientCert.Leaf.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	c.Assert(err, qt.IsNil)
+}
@@ -0,0 +1,75 @@
+// Package mysqltest connects tests to a local MySQL server, which stands in
+// for the branches of a PlanetScale database.
+package mysqltest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+// DSNEnv is the environment variable with the DSN of the local MySQL server,
+// e.g. "root@tcp(127.0.0.1:3306)/". The docker-compose.yml of the repository
+// starts a matching server.
+const DSNEnv = "PLANETSCALE_GO_TEST_MYSQL_DSN"
+
+var invalidChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// Connect returns a function that connects to the local MySQL server instead
+// of a PlanetScale branch. Every branch is mapped to its own MySQL database,
+// which is dropped when the test finishes. The test is skipped if DSNEnv
+// isn't set.
+func Connect(t testing.TB) func(ctx context.Context, client *ps.Client, org, database, branch string) (*sql.DB, error) {
+	dsn := os.Getenv(DSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", DSNEnv)
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("invalid %s: %s", DSNEnv, err)
+	}
+
+	return func(ctx context.Context, _ *ps.Client, org, database, branch string) (*sql.DB, error) {
+		name := invalidChars.ReplaceAllString(fmt.Sprintf("pstest_%s_%s_%s", org, database, branch), "_")
+
+		admin, err := sql.Open("mysql", cfg.FormatDSN())
+		if err != nil {
+			return nil, err
+		}
+		defer admin.Close()
+
+		if _, err := admin.ExecContext(ctx, "CREATE DATABASE IF NOT EXISTS `"+name+"`"); err != nil {
+			return nil, err
+		}
+
+		t.Cleanup(func() {
+			admin, err := sql.Open("mysql", cfg.FormatDSN())
+			if err != nil {
+				return
+			}
+			defer admin.Close()
+			_, _ = admin.Exec("DROP DATABASE IF EXISTS `" + name + "`")
+		})
+
+		branchCfg := cfg.Clone()
+		branchCfg.DBName = name
+		db, err := sql.Open("mysql", branchCfg.FormatDSN())
+		if err != nil {
+			return nil, err
+		}
+
+		if err := db.PingContext(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+
+		return db, nil
+	}
+}
@@ -0,0 +1,339 @@
+// Package s3stub implements an in-memory stand-in for S3-compatible object
+// storage such as MinIO, which is used to test uploads end to end. It
+// verifies Signature Version 4 signatures and payload checksums like S3
+// does, and supports single and multipart uploads.
+package s3stub
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server is a fake S3-compatible store.
+type Server struct {
+	mu sync.Mutex
+
+	accessKeyID     string
+	secretAccessKey string
+
+	buckets  map[string]map[string][]byte
+	uploads  map[string]*upload
+	nextID   int
+	failPart int
+	requests []string
+}
+
+type upload struct {
+	bucket string
+	key    string
+	parts  map[int][]byte
+}
+
+// New returns a new store without buckets, which accepts requests signed
+// with the given credentials.
+func New(accessKeyID, secretAccessKey string) *Server {
+	return &Server{
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		buckets:         make(map[string]map[string][]byte),
+		uploads:         make(map[string]*upload),
+	}
+}
+
+// NewServer starts a store and returns the HTTP server serving it. The
+// server is closed when the test finishes.
+func NewServer(t interface{ Cleanup(func()) }, accessKeyID, secretAccessKey string) (*Server, *httptest.Server) {
+	s := New(accessKeyID, secretAccessKey)
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// CreateBucket creates an empty bucket.
+func (s *Server) CreateBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buckets[name] = make(map[string][]byte)
+}
+
+// Object returns the data of an object.
+func (s *Server) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.buckets[bucket][key]
+	return data, ok
+}
+
+// Uploads returns the number of multipart uploads that were neither
+// completed nor aborted.
+func (s *Server) Uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.uploads)
+}
+
+// FailPart makes uploads of part n of multipart uploads fail.
+func (s *Server) FailPart(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failPart = n
+}
+
+// Requests returns the requests received so far, formatted as
+// "METHOD path?query".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req := r.Method + " " + r.URL.Path
+	if r.URL.RawQuery != "" {
+		req += "?" + r.URL.RawQuery
+	}
+	s.requests = append(s.requests, req)
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	if code, msg := s.verify(r); code != "" {
+		writeError(w, http.StatusForbidden, code, msg)
+		return
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	sum := sha256.Sum256(body)
+	if payloadHash != "UNSIGNED-PAYLOAD" && payloadHash != hex.EncodeToString(sum[:]) {
+		writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.")
+		return
+	}
+
+	seg := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(seg) != 2 || seg[1] == "" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "Only object operations are supported.")
+		return
+	}
+
+	bucket, ok := s.buckets[seg[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+		return
+	}
+	key := seg[1]
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodPut && query.Get("uploadId") != "":
+		s.uploadPart(w, query, body)
+	case r.Method == http.MethodPut:
+		bucket[key] = body
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodPost && query["uploads"] != nil:
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.uploads[id] = &upload{bucket: seg[0], key: key, parts: make(map[int][]byte)}
+		writeXML(w, &struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadID string `xml:"UploadId"`
+		}{Bucket: seg[0], Key: key, UploadID: id})
+	case r.Method == http.MethodPost && query.Get("uploadId") != "":
+		s.completeUpload(w, query.Get("uploadId"), body)
+	case r.Method == http.MethodDelete && query.Get("uploadId") != "":
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet:
+		data, ok := bucket[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		_, _ = w.Write(data)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "The operation is not supported.")
+	}
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, query url.Values, body []byte) {
+	u, ok := s.uploads[query.Get("uploadId")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+		return
+	}
+
+	n, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || n < 1 {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "Part number must be a positive integer.")
+		return
+	}
+
+	if n == s.failPart {
+		writeError(w, http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again.")
+		return
+	}
+
+	u.parts[n] = body
+	w.Header().Set("ETag", etag(body))
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, id string, body []byte) {
+	u, ok := s.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+		return
+	}
+
+	var req struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &req); err != nil || len(req.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed.")
+		return
+	}
+
+	var data []byte
+	for i, p := range req.Parts {
+		part, ok := u.parts[p.PartNumber]
+		if !ok || p.ETag != etag(part) {
+			writeError(w, http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found.")
+			return
+		}
+		if i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber {
+			writeError(w, http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order.")
+			return
+		}
+		data = append(data, part...)
+	}
+
+	s.buckets[u.bucket][u.key] = data
+	delete(s.uploads, id)
+
+	writeXML(w, &struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{Bucket: u.bucket, Key: u.key, ETag: fmt.Sprintf(`"%x-%d"`, md5.Sum(data), len(req.Parts))})
+}
+
+var authPattern = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=([^/]+)/(\d{8})/([^/]+)/s3/aws4_request, ?SignedHeaders=([^,]+), ?Signature=([0-9a-f]{64})$`)
+
+// verify checks the signature of a request. It returns the S3 error code and
+// message if the signature is invalid.
+func (s *Server) verify(r *http.Request) (string, string) {
+	m := authPattern.FindStringSubmatch(r.Header.Get("Authorization"))
+	if m == nil {
+		return "AccessDenied", "Missing or malformed Authorization header."
+	}
+	accessKeyID, date, region, signedHeaders, signature := m[1], m[2], m[3], m[4], m[5]
+
+	if accessKeyID != s.accessKeyID {
+		return "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records."
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if !strings.HasPrefix(amzDate, date) {
+		return "SignatureDoesNotMatch", "The date of the credential scope does not match X-Amz-Date."
+	}
+
+	var headers strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	var query []string
+	for k, vs := range r.URL.Query() {
+		for _, v := range vs {
+			query = append(query, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	sort.Strings(query)
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		strings.Join(query, "&"),
+		headers.String(),
+		signedHeaders,
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.secretAccessKey)
+	for _, v := range []string{date, region, "s3", "aws4_request"} {
+		key = sign(key, v)
+	}
+
+	if !hmac.Equal([]byte(hex.EncodeToString(sign(key, stringToSign))), []byte(signature)) {
+		return "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."
+	}
+	return "", ""
+}
+
+func sign(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode encodes s like S3 does for canonical query strings.
+func uriEncode(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return fmt.Sprintf("%q", hex.EncodeToString(sum[:]))
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(&struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: msg})
+}
@@ -0,0 +1,283 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveFields are the names of request and result fields that are never
+// written to the audit log.
+var sensitiveFields = map[string]bool{
+	"CACert":     true,
+	"ClientCert": true,
+	"Password":   true,
+	"PrivateKey": true,
+	"Secret":     true,
+	"Token":      true,
+	"URL":        true, // pre-signed download URLs grant access on their own
+}
+
+// Record is a single entry of the audit log. Records are chained: every
+// record contains the hash of the previous one, so removing or modifying a
+// record invalidates all following records.
+type Record struct {
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"`
+	Service string    `json:"service"`
+	Method  string    `json:"method"`
+
+	// Request and Result are the redacted request and result of the call.
+	Request json.RawMessage `json:"request"`
+	Result  json.RawMessage `json:"result,omitempty"`
+
+	// Duration is the duration of the call in nanoseconds.
+	Duration time.Duration `json:"duration"`
+
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+
+	// RequestID and ServerRequestID identify a failed call in the client
+	// and API logs.
+	RequestID       string `json:"request_id,omitempty"`
+	ServerRequestID string `json:"server_request_id,omitempty"`
+
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// computeHash returns the hash of the record, which covers all fields except
+// Hash itself.
+func (r *Record) computeHash() (string, error) {
+	c := *r
+	c.Hash = ""
+
+	out, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(out)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Sink persists audit records.
+type Sink interface {
+	Write(*Record) error
+}
+
+// Config defines the configuration of a Logger.
+type Config struct {
+	// Actor identifies who makes the changes, e.g. the name of the
+	// automation or the user running it.
+	Actor string
+
+	// Sink is where the records are written to.
+	Sink Sink
+
+	// OnError is called if a record couldn't be written. The API call
+	// itself isn't affected, since the change already happened.
+	OnError func(error)
+}
+
+// Logger records every mutating call made through the services it wraps.
+type Logger struct {
+	cfg Config
+
+	mu       sync.Mutex
+	prevHash string
+}
+
+// New returns a new audit logger. If the sink has a LastHash method, such as
+// FileSink, the hash chain continues from the last record of the sink.
+func New(cfg *Config) (*Logger, error) {
+	if cfg.Sink == nil {
+		return nil, errors.New("audit sink is not set")
+	}
+
+	if cfg.Actor == "" {
+		return nil, errors.New("actor is not set")
+	}
+
+	l := &Logger{cfg: *cfg}
+	if hs, ok := cfg.Sink.(interface{ LastHash() string }); ok {
+		l.prevHash = hs.LastHash()
+	}
+
+	return l, nil
+}
+
+// Wrap replaces the services of the client with audited ones. Read-only
+// calls are passed through without being recorded.
+func (l *Logger) Wrap(client *ps.Client) {
+	client.Backups = l.Backups(client.Backups)
+	client.BackupExports = l.BackupExports(client.BackupExports)
+	client.Certificates = l.Certificates(client.Certificates)
+	client.Databases = l.Databases(client.Databases)
+	client.DatabaseBranches = l.DatabaseBranches(client.DatabaseBranches)
+	client.DeployRequests = l.DeployRequests(client.DeployRequests)
+	client.ServiceTokens = l.ServiceTokens(client.ServiceTokens)
+}
+
+// log writes a record for a single call.
+func (l *Logger) log(service, method string, req, result interface{}, err error, start time.Time) {
+	r := &Record{
+		Time:     start.UTC(),
+		Actor:    l.cfg.Actor,
+		Service:  service,
+		Method:   method,
+		Duration: time.Since(start),
+	}
+
+	var encErr error
+	r.Request, encErr = redact(req)
+	if encErr != nil {
+		l.onError(fmt.Errorf("audit: error encoding request of %s.%s: %s", service, method, encErr))
+	}
+
+	if err != nil {
+		r.Error = err.Error()
+		var psErr *ps.Error
+		if errors.As(err, &psErr) {
+			r.ErrorCode = string(psErr.Code)
+			r.RequestID = psErr.RequestID
+			r.ServerRequestID = psErr.ServerRequestID
+		}
+	} else if result != nil {
+		r.Result, encErr = redact(result)
+		if encErr != nil {
+			l.onError(fmt.Errorf("audit: error encoding result of %s.%s: %s", service, method, encErr))
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r.PrevHash = l.prevHash
+	hash, hashErr := r.computeHash()
+	if hashErr != nil {
+		l.onError(fmt.Errorf("audit: error hashing record: %s", hashErr))
+		return
+	}
+	r.Hash = hash
+
+	if err := l.cfg.Sink.Write(r); err != nil {
+		l.onError(fmt.Errorf("audit: error writing record: %s", err))
+		return
+	}
+
+	l.prevHash = hash
+}
+
+func (l *Logger) onError(err error) {
+	if l.cfg.OnError != nil {
+		l.cfg.OnError(err)
+	}
+}
+
+// Verify reads JSON lines records from r and checks the hash chain. It
+// returns the number of valid records and an error describing the first
+// broken record, if any.
+func Verify(r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+
+	var (
+		n        int
+		prevHash string
+	)
+	for {
+		rec := &Record{}
+		err := dec.Decode(rec)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("record %d: malformed record: %s", n+1, err)
+		}
+
+		if n > 0 && rec.PrevHash != prevHash {
+			return n, fmt.Errorf("record %d: previous hash doesn't match, records were removed or reordered", n+1)
+		}
+
+		hash, err := rec.computeHash()
+		if err != nil {
+			return n, fmt.Errorf("record %d: %s", n+1, err)
+		}
+
+		if hash != rec.Hash {
+			return n, fmt.Errorf("record %d: hash doesn't match, record was modified", n+1)
+		}
+
+		prevHash = rec.Hash
+		n++
+	}
+}
+
+// redact encodes v as JSON, replacing sensitive fields. Structs are encoded
+// with their Go field names, so fields that are not part of the API request
+// body, such as Organization, are recorded too.
+func redact(v interface{}) (json.RawMessage, error) {
+	return json.Marshal(redactValue(reflect.ValueOf(v)))
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func redactValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if v.Type().Implements(jsonMarshalerType) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem())
+	case reflect.Struct:
+		t := v.Type()
+		out := make(map[string]interface{}, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+
+			if sensitiveFields[f.Name] {
+				out[f.Name] = redacted
+				continue
+			}
+
+			out[f.Name] = redactValue(v.Field(i))
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i))
+		}
+		return out
+	case reflect.Map, reflect.Func, reflect.Chan:
+		// not used by the API types
+		return nil
+	default:
+		return v.Interface()
+	}
+}
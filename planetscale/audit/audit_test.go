@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+const testOrg = "my-org"
+
+func newTestClient(c *qt.C, l *Logger) *ps.Client {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/service-tokens"):
+			_, _ = w.Write([]byte(`{"id":"test-id","type":"ServiceToken","token":"secret-token"}`))
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/service-tokens"):
+			_, _ = w.Write([]byte(`{"data":[{"id":"test-id","type":"ServiceToken"}]}`))
+		case r.Method == http.MethodDelete:
+			w.Header().Set(ps.RequestIDHeader, "server-id")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":"not_found","message":"Not Found"}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	c.Cleanup(ts.Close)
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	l.Wrap(client)
+	return client
+}
+
+func decodeRecords(c *qt.C, buf *bytes.Buffer) []*Record {
+	var records []*Record
+	dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for dec.More() {
+		r := &Record{}
+		c.Assert(dec.Decode(r), qt.IsNil)
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestLogger(t *testing.T) {
+	c := qt.New(t)
+
+	var buf bytes.Buffer
+	l, err := New(&Config{Actor: "ci-bot", Sink: NewWriterSink(&buf)})
+	c.Assert(err, qt.IsNil)
+
+	client := newTestClient(c, l)
+	ctx := context.Background()
+
+	st, err := client.ServiceTokens.Create(ctx, &ps.CreateServiceTokenRequest{Organization: testOrg})
+	c.Assert(err, qt.IsNil)
+	c.Assert(st.Token, qt.Equals, "secret-token")
+
+	// read-only calls are not recorded
+	_, err = client.ServiceTokens.List(ctx, &ps.ListServiceTokensRequest{Organization: testOrg})
+	c.Assert(err, qt.IsNil)
+
+	err = client.Databases.Delete(ctx, &ps.DeleteDatabaseRequest{Organization: testOrg, Database: "my-db"})
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	records := decodeRecords(c, &buf)
+	c.Assert(records, qt.HasLen, 2)
+
+	r := records[0]
+	c.Assert(r.Actor, qt.Equals, "ci-bot")
+	c.Assert(r.Service, qt.Equals, "ServiceTokens")
+	c.Assert(r.Method, qt.Equals, "Create")
+	c.Assert(string(r.Request), qt.Equals, `{"Organization":"my-org"}`)
+	c.Assert(string(r.Result), qt.Equals, `{"ID":"test-id","Name":"","Token":"[REDACTED]","Type":"ServiceToken"}`)
+	c.Assert(r.PrevHash, qt.Equals, "")
+	c.Assert(r.Error, qt.Equals, "")
+
+	r = records[1]
+	c.Assert(r.Service, qt.Equals, "Databases")
+	c.Assert(r.Method, qt.Equals, "Delete")
+	c.Assert(string(r.Request), qt.Equals, `{"Database":"my-db","Organization":"my-org"}`)
+	c.Assert(r.Result, qt.IsNil)
+	c.Assert(r.Error, qt.Equals, "Not Found")
+	c.Assert(r.ErrorCode, qt.Equals, string(ps.ErrNotFound))
+	c.Assert(r.RequestID, qt.Matches, "[0-9a-f]{32}")
+	c.Assert(r.ServerRequestID, qt.Equals, "server-id")
+	c.Assert(r.PrevHash, qt.Equals, records[0].Hash)
+
+	n, err := Verify(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, qt.IsNil)
+	c.Assert(n, qt.Equals, 2)
+}
+
+func TestVerify_tampered(t *testing.T) {
+	c := qt.New(t)
+
+	var buf bytes.Buffer
+	l, err := New(&Config{Actor: "ci-bot", Sink: NewWriterSink(&buf)})
+	c.Assert(err, qt.IsNil)
+
+	client := newTestClient(c, l)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := client.ServiceTokens.Create(ctx, &ps.CreateServiceTokenRequest{Organization: testOrg})
+		c.Assert(err, qt.IsNil)
+	}
+
+	lines := strings.SplitAfter(buf.String(), "\n")
+
+	modified := strings.Join(lines, "")
+	modified = strings.Replace(modified, `"actor":"ci-bot"`, `"actor":"someone-else"`, 1)
+	n, err := Verify(strings.NewReader(modified))
+	c.Assert(err, qt.ErrorMatches, "record 1: hash doesn't match, record was modified")
+	c.Assert(n, qt.Equals, 0)
+
+	removed := lines[0] + lines[2]
+	n, err = Verify(strings.NewReader(removed))
+	c.Assert(err, qt.ErrorMatches, "record 2: previous hash doesn't match, records were removed or reordered")
+	c.Assert(n, qt.Equals, 1)
+}
+
+func TestRedact(t *testing.T) {
+	c := qt.New(t)
+
+	out, err := redact(&ps.CreateCertificateRequest{
+		Organization: testOrg,
+		DatabaseName: "my-db",
+		Branch:       "main",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(out), qt.Equals, `{"Branch":"main","DatabaseName":"my-db","Organization":"my-org","PrivateKey":"[REDACTED]"}`)
+
+	out, err = redact(&ps.BackupExport{
+		URL:    "https://exports.example.com/backup?signature=abc",
+		Size:   1024,
+		SHA256: "abc",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(out), qt.Equals, `{"ExpiresAt":"0001-01-01T00:00:00Z","SHA256":"abc","Size":1024,"URL":"[REDACTED]"}`)
+}
+
+func TestNew_missingConfig(t *testing.T) {
+	c := qt.New(t)
+
+	_, err := New(&Config{Actor: "ci-bot"})
+	c.Assert(err, qt.ErrorMatches, "audit sink is not set")
+
+	_, err = New(&Config{Sink: NewWriterSink(&bytes.Buffer{})})
+	c.Assert(err, qt.ErrorMatches, "actor is not set")
+}
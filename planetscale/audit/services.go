@@ -0,0 +1,204 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+// Backups returns a BackupsService that records calls to Create and Delete.
+func (l *Logger) Backups(next ps.BackupsService) ps.BackupsService {
+	return &backupsService{BackupsService: next, l: l}
+}
+
+type backupsService struct {
+	ps.BackupsService
+	l *Logger
+}
+
+func (s *backupsService) Create(ctx context.Context, req *ps.CreateBackupRequest) (*ps.Backup, error) {
+	start := time.Now()
+	res, err := s.BackupsService.Create(ctx, req)
+	s.l.log("Backups", "Create", req, res, err, start)
+	return res, err
+}
+
+func (s *backupsService) Delete(ctx context.Context, req *ps.DeleteBackupRequest) error {
+	start := time.Now()
+	err := s.BackupsService.Delete(ctx, req)
+	s.l.log("Backups", "Delete", req, nil, err, start)
+	return err
+}
+
+// BackupExports returns a BackupExportsService that records calls to Export.
+func (l *Logger) BackupExports(next ps.BackupExportsService) ps.BackupExportsService {
+	return &backupExportsService{BackupExportsService: next, l: l}
+}
+
+type backupExportsService struct {
+	ps.BackupExportsService
+	l *Logger
+}
+
+func (s *backupExportsService) Export(ctx context.Context, req *ps.ExportBackupRequest) (*ps.BackupExport, error) {
+	start := time.Now()
+	res, err := s.BackupExportsService.Export(ctx, req)
+	s.l.log("BackupExports", "Export", req, res, err, start)
+	return res, err
+}
+
+// Certificates returns a CertificatesService that records calls to Create.
+func (l *Logger) Certificates(next ps.CertificatesService) ps.CertificatesService {
+	return &certificatesService{CertificatesService: next, l: l}
+}
+
+type certificatesService struct {
+	ps.CertificatesService
+	l *Logger
+}
+
+func (s *certificatesService) Create(ctx context.Context, req *ps.CreateCertificateRequest) (*ps.Cert, error) {
+	start := time.Now()
+	res, err := s.CertificatesService.Create(ctx, req)
+	s.l.log("Certificates", "Create", req, res, err, start)
+	return res, err
+}
+
+// Databases returns a DatabasesService that records calls to Create and Delete.
+func (l *Logger) Databases(next ps.DatabasesService) ps.DatabasesService {
+	return &databasesService{DatabasesService: next, l: l}
+}
+
+type databasesService struct {
+	ps.DatabasesService
+	l *Logger
+}
+
+func (s *databasesService) Create(ctx context.Context, req *ps.CreateDatabaseRequest) (*ps.Database, error) {
+	start := time.Now()
+	res, err := s.DatabasesService.Create(ctx, req)
+	s.l.log("Databases", "Create", req, res, err, start)
+	return res, err
+}
+
+func (s *databasesService) Delete(ctx context.Context, req *ps.DeleteDatabaseRequest) error {
+	start := time.Now()
+	err := s.DatabasesService.Delete(ctx, req)
+	s.l.log("Databases", "Delete", req, nil, err, start)
+	return err
+}
+
+// DatabaseBranches returns a DatabaseBranchesService that records calls to Create, Delete and RefreshSchema.
+func (l *Logger) DatabaseBranches(next ps.DatabaseBranchesService) ps.DatabaseBranchesService {
+	return &databaseBranchesService{DatabaseBranchesService: next, l: l}
+}
+
+type databaseBranchesService struct {
+	ps.DatabaseBranchesService
+	l *Logger
+}
+
+func (s *databaseBranchesService) Create(ctx context.Context, req *ps.CreateDatabaseBranchRequest) (*ps.DatabaseBranch, error) {
+	start := time.Now()
+	res, err := s.DatabaseBranchesService.Create(ctx, req)
+	s.l.log("DatabaseBranches", "Create", req, res, err, start)
+	return res, err
+}
+
+func (s *databaseBranchesService) Delete(ctx context.Context, req *ps.DeleteDatabaseBranchRequest) error {
+	start := time.Now()
+	err := s.DatabaseBranchesService.Delete(ctx, req)
+	s.l.log("DatabaseBranches", "Delete", req, nil, err, start)
+	return err
+}
+
+func (s *databaseBranchesService) RefreshSchema(ctx context.Context, req *ps.RefreshSchemaRequest) error {
+	start := time.Now()
+	err := s.DatabaseBranchesService.RefreshSchema(ctx, req)
+	s.l.log("DatabaseBranches", "RefreshSchema", req, nil, err, start)
+	return err
+}
+
+// DeployRequests returns a DeployRequestsService that records calls to CancelDeploy, CloseDeploy, Create, CreateReview and Deploy.
+func (l *Logger) DeployRequests(next ps.DeployRequestsService) ps.DeployRequestsService {
+	return &deployRequestsService{DeployRequestsService: next, l: l}
+}
+
+type deployRequestsService struct {
+	ps.DeployRequestsService
+	l *Logger
+}
+
+func (s *deployRequestsService) CancelDeploy(ctx context.Context, req *ps.CancelDeployRequestRequest) (*ps.DeployRequest, error) {
+	start := time.Now()
+	res, err := s.DeployRequestsService.CancelDeploy(ctx, req)
+	s.l.log("DeployRequests", "CancelDeploy", req, res, err, start)
+	return res, err
+}
+
+func (s *deployRequestsService) CloseDeploy(ctx context.Context, req *ps.CloseDeployRequestRequest) (*ps.DeployRequest, error) {
+	start := time.Now()
+	res, err := s.DeployRequestsService.CloseDeploy(ctx, req)
+	s.l.log("DeployRequests", "CloseDeploy", req, res, err, start)
+	return res, err
+}
+
+func (s *deployRequestsService) Create(ctx context.Context, req *ps.CreateDeployRequestRequest) (*ps.DeployRequest, error) {
+	start := time.Now()
+	res, err := s.DeployRequestsService.Create(ctx, req)
+	s.l.log("DeployRequests", "Create", req, res, err, start)
+	return res, err
+}
+
+func (s *deployRequestsService) CreateReview(ctx context.Context, req *ps.ReviewDeployRequestRequest) (*ps.DeployRequestReview, error) {
+	start := time.Now()
+	res, err := s.DeployRequestsService.CreateReview(ctx, req)
+	s.l.log("DeployRequests", "CreateReview", req, res, err, start)
+	return res, err
+}
+
+func (s *deployRequestsService) Deploy(ctx context.Context, req *ps.PerformDeployRequest) (*ps.DeployRequest, error) {
+	start := time.Now()
+	res, err := s.DeployRequestsService.Deploy(ctx, req)
+	s.l.log("DeployRequests", "Deploy", req, res, err, start)
+	return res, err
+}
+
+// ServiceTokens returns a ServiceTokenService that records calls to Create, Delete, AddAccess and DeleteAccess.
+func (l *Logger) ServiceTokens(next ps.ServiceTokenService) ps.ServiceTokenService {
+	return &serviceTokenService{ServiceTokenService: next, l: l}
+}
+
+type serviceTokenService struct {
+	ps.ServiceTokenService
+	l *Logger
+}
+
+func (s *serviceTokenService) Create(ctx context.Context, req *ps.CreateServiceTokenRequest) (*ps.ServiceToken, error) {
+	start := time.Now()
+	res, err := s.ServiceTokenService.Create(ctx, req)
+	s.l.log("ServiceTokens", "Create", req, res, err, start)
+	return res, err
+}
+
+func (s *serviceTokenService) Delete(ctx context.Context, req *ps.DeleteServiceTokenRequest) error {
+	start := time.Now()
+	err := s.ServiceTokenService.Delete(ctx, req)
+	s.l.log("ServiceTokens", "Delete", req, nil, err, start)
+	return err
+}
+
+func (s *serviceTokenService) AddAccess(ctx context.Context, req *ps.AddServiceTokenAccessRequest) ([]*ps.ServiceTokenAccess, error) {
+	start := time.Now()
+	res, err := s.ServiceTokenService.AddAccess(ctx, req)
+	s.l.log("ServiceTokens", "AddAccess", req, res, err, start)
+	return res, err
+}
+
+func (s *serviceTokenService) DeleteAccess(ctx context.Context, req *ps.DeleteServiceTokenAccessRequest) error {
+	start := time.Now()
+	err := s.ServiceTokenService.DeleteAccess(ctx, req)
+	s.l.log("ServiceTokens", "DeleteAccess", req, nil, err, start)
+	return err
+}
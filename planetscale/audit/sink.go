@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// WriterSink writes records as JSON lines to an io.Writer.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+var _ Sink = &WriterSink{}
+
+// NewWriterSink returns a sink that writes JSON lines to w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// Write writes the record as a single line.
+func (s *WriterSink) Write(r *Record) error {
+	out, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	out = append(out, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(out)
+	return err
+}
+
+// FileSink appends records as JSON lines to a file. Every record is synced to
+// disk before the call returns.
+type FileSink struct {
+	mu       sync.Mutex
+	f        *os.File
+	lastHash string
+}
+
+var _ Sink = &FileSink{}
+
+// NewFileSink opens or creates the JSON lines file at path. New records are
+// appended and chained to the last record already in the file.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	lastHash, err := readLastHash(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error reading audit log %s: %s", path, err)
+	}
+
+	return &FileSink{f: f, lastHash: lastHash}, nil
+}
+
+// LastHash returns the hash of the last record in the file.
+func (s *FileSink) LastHash() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastHash
+}
+
+// Write appends the record to the file.
+func (s *FileSink) Write(r *Record) error {
+	out, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	out = append(out, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.f.Write(out); err != nil {
+		return err
+	}
+
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+
+	s.lastHash = r.Hash
+	return nil
+}
+
+// Close closes the underlying file.
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
+
+func readLastHash(f *os.File) (string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	var last []byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			last = append(last[:0], scanner.Bytes()...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if last == nil {
+		return "", nil
+	}
+
+	r := &Record{}
+	if err := json.Unmarshal(last, r); err != nil {
+		return "", fmt.Errorf("malformed last record: %s", err)
+	}
+
+	return r.Hash, nil
+}
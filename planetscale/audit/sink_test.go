@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+func TestFileSink_continuesChain(t *testing.T) {
+	c := qt.New(t)
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileSink(path)
+		c.Assert(err, qt.IsNil)
+
+		l, err := New(&Config{Actor: "ci-bot", Sink: sink})
+		c.Assert(err, qt.IsNil)
+
+		client := newTestClient(c, l)
+		_, err = client.ServiceTokens.Create(ctx, &ps.CreateServiceTokenRequest{Organization: testOrg})
+		c.Assert(err, qt.IsNil)
+
+		c.Assert(sink.Close(), qt.IsNil)
+	}
+
+	fi, err := os.Stat(path)
+	c.Assert(err, qt.IsNil)
+	c.Assert(fi.Mode().Perm(), qt.Equals, os.FileMode(0600))
+
+	f, err := os.Open(path)
+	c.Assert(err, qt.IsNil)
+	defer f.Close()
+
+	n, err := Verify(f)
+	c.Assert(err, qt.IsNil)
+	c.Assert(n, qt.Equals, 2)
+}
+
+func TestFileSink_malformed(t *testing.T) {
+	c := qt.New(t)
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	c.Assert(ioutil.WriteFile(path, []byte("not json\n"), 0600), qt.IsNil)
+
+	_, err := NewFileSink(path)
+	c.Assert(err, qt.ErrorMatches, "error reading audit log .*: malformed last record: .*")
+}
@@ -0,0 +1,421 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultBaseURL is the base URL of the PlanetScale OAuth server.
+	DefaultBaseURL = "https://auth.planetscale.com/"
+
+	formMediaType = "application/x-www-form-urlencoded"
+	jsonMediaType = "application/json"
+
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	defaultCheckInterval = 5 * time.Second
+)
+
+var (
+	// ErrAccessDenied is returned when the user denied the authorization
+	// request.
+	ErrAccessDenied = errors.New("access denied by user")
+
+	// ErrExpiredToken is returned when the device code expired before the
+	// user authorized the request.
+	ErrExpiredToken = errors.New("device code expired, please try again")
+)
+
+// Authenticator implements the OAuth 2.0 device authorization grant (RFC 8628)
+// against the PlanetScale OAuth server.
+type Authenticator struct {
+	client   *http.Client
+	baseURL  *url.URL
+	clientID string
+	scopes   []string
+	store    TokenStore
+}
+
+// AuthenticatorOption provides a variadic option for configuring the
+// authenticator.
+type AuthenticatorOption func(a *Authenticator) error
+
+// WithBaseURL overrides the base URL of the OAuth server.
+func WithBaseURL(baseURL string) AuthenticatorOption {
+	return func(a *Authenticator) error {
+		parsedURL, err := url.Parse(baseURL)
+		if err != nil {
+			return err
+		}
+
+		a.baseURL = parsedURL
+		return nil
+	}
+}
+
+// WithHTTPClient configures the authenticator with the given HTTP client.
+func WithHTTPClient(client *http.Client) AuthenticatorOption {
+	return func(a *Authenticator) error {
+		if client == nil {
+			client = cleanhttp.DefaultClient()
+		}
+
+		a.client = client
+		return nil
+	}
+}
+
+// WithClientID sets the OAuth client ID.
+func WithClientID(clientID string) AuthenticatorOption {
+	return func(a *Authenticator) error {
+		if clientID == "" {
+			return errors.New("missing client ID")
+		}
+
+		a.clientID = clientID
+		return nil
+	}
+}
+
+// WithScopes sets the scopes requested during the authorization.
+func WithScopes(scopes ...string) AuthenticatorOption {
+	return func(a *Authenticator) error {
+		a.scopes = scopes
+		return nil
+	}
+}
+
+// WithTokenStore configures where tokens obtained by Login are persisted.
+// If not set, tokens are kept in memory only.
+func WithTokenStore(store TokenStore) AuthenticatorOption {
+	return func(a *Authenticator) error {
+		if store == nil {
+			return errors.New("missing token store")
+		}
+
+		a.store = store
+		return nil
+	}
+}
+
+// New returns an authenticator for the PlanetScale OAuth server. The OAuth
+// client ID has to be set with WithClientID.
+func New(opts ...AuthenticatorOption) (*Authenticator, error) {
+	baseURL, err := url.Parse(DefaultBaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Authenticator{
+		client:  cleanhttp.DefaultClient(),
+		baseURL: baseURL,
+		store:   NewMemoryStore(),
+	}
+
+	for _, opt := range opts {
+		err := opt(a)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if a.clientID == "" {
+		return nil, errors.New("missing client ID")
+	}
+
+	return a, nil
+}
+
+// DeviceVerification contains the information needed by the user to
+// authorize a device.
+type DeviceVerification struct {
+	// DeviceCode is the code used to poll for the access token. It must not
+	// be shown to the user.
+	DeviceCode string
+
+	// UserCode is the code the user has to enter on the verification page.
+	UserCode string
+
+	// VerificationURL is the page where the user enters the UserCode.
+	VerificationURL string
+
+	// VerificationCompleteURL is the verification page with the UserCode
+	// already filled in.
+	VerificationCompleteURL string
+
+	// CheckInterval is the interval to wait between polling for the token.
+	CheckInterval time.Duration
+
+	// ExpiresAt is the time the device code expires.
+	ExpiresAt time.Time
+}
+
+// PromptFunc is called with the verification details that need to be shown
+// to the user, e.g. by printing them or opening a browser.
+type PromptFunc func(context.Context, *DeviceVerification) error
+
+// Login runs the complete device flow. It requests a device code, calls
+// prompt with the verification details, polls until the user authorized the
+// device and persists the resulting token in the token store.
+func (a *Authenticator) Login(ctx context.Context, prompt PromptFunc) (*oauth2.Token, error) {
+	v, err := a.RequestDeviceCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if prompt != nil {
+		if err := prompt(ctx, v); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := a.GetAccessTokenForDevice(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.store.SetToken(token); err != nil {
+		return nil, fmt.Errorf("error storing access token: %s", err)
+	}
+
+	return token, nil
+}
+
+// Logout removes the token from the token store.
+func (a *Authenticator) Logout() error {
+	return a.store.DeleteToken()
+}
+
+// TokenSource returns a token source that reads the token from the token
+// store. Expired tokens are refreshed and written back to the store. It can
+// be passed to planetscale.WithTokenSource.
+func (a *Authenticator) TokenSource() oauth2.TokenSource {
+	tokenURL, _ := a.baseURL.Parse("oauth/token")
+
+	return &refreshingTokenSource{
+		ctx:   context.WithValue(context.Background(), oauth2.HTTPClient, a.client),
+		store: a.store,
+		config: &oauth2.Config{
+			ClientID: a.clientID,
+			Scopes:   a.scopes,
+			Endpoint: oauth2.Endpoint{
+				TokenURL:  tokenURL.String(),
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+		},
+	}
+}
+
+type deviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// RequestDeviceCode requests a new device code from the OAuth server.
+func (a *Authenticator) RequestDeviceCode(ctx context.Context) (*DeviceVerification, error) {
+	form := url.Values{}
+	form.Set("client_id", a.clientID)
+	if len(a.scopes) > 0 {
+		form.Set("scope", strings.Join(a.scopes, " "))
+	}
+
+	req, err := a.newFormRequest(ctx, "oauth/authorize_device", form)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request for device code: %s", err)
+	}
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	out, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, decodeError(res.StatusCode, out)
+	}
+
+	dcr := &deviceCodeResponse{}
+	if err := json.Unmarshal(out, dcr); err != nil {
+		return nil, fmt.Errorf("error decoding device code response: %s", err)
+	}
+
+	interval := time.Duration(dcr.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+
+	v := &DeviceVerification{
+		DeviceCode:              dcr.DeviceCode,
+		UserCode:                dcr.UserCode,
+		VerificationURL:         dcr.VerificationURI,
+		VerificationCompleteURL: dcr.VerificationURIComplete,
+		CheckInterval:           interval,
+	}
+	if dcr.ExpiresIn > 0 {
+		v.ExpiresAt = time.Now().Add(time.Duration(dcr.ExpiresIn) * time.Second)
+	}
+
+	return v, nil
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// oauthError represents an error response as defined in RFC 6749.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *oauthError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Description)
+	}
+	return e.Code
+}
+
+// GetAccessTokenForDevice polls the OAuth server until the user authorized
+// the device, the device code expired or the context is canceled.
+func (a *Authenticator) GetAccessTokenForDevice(ctx context.Context, v *DeviceVerification) (*oauth2.Token, error) {
+	interval := v.CheckInterval
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+
+	for {
+		token, err := a.requestToken(ctx, v.DeviceCode)
+		if err == nil {
+			return token, nil
+		}
+
+		oerr, ok := err.(*oauthError)
+		if !ok {
+			return nil, err
+		}
+
+		switch oerr.Code {
+		case "authorization_pending":
+		case "slow_down":
+			// RFC 8628 section 3.5: increase the interval by 5 seconds
+			interval += 5 * time.Second
+		case "access_denied":
+			return nil, ErrAccessDenied
+		case "expired_token":
+			return nil, ErrExpiredToken
+		default:
+			return nil, err
+		}
+
+		if !v.ExpiresAt.IsZero() && time.Now().After(v.ExpiresAt) {
+			return nil, ErrExpiredToken
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (a *Authenticator) requestToken(ctx context.Context, deviceCode string) (*oauth2.Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", deviceCodeGrantType)
+	form.Set("device_code", deviceCode)
+	form.Set("client_id", a.clientID)
+
+	req, err := a.newFormRequest(ctx, "oauth/token", form)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request for access token: %s", err)
+	}
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	out, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, decodeError(res.StatusCode, out)
+	}
+
+	tr := &tokenResponse{}
+	if err := json.Unmarshal(out, tr); err != nil {
+		return nil, fmt.Errorf("error decoding token response: %s", err)
+	}
+
+	if tr.AccessToken == "" {
+		return nil, errors.New("token response doesn't contain an access token")
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  tr.AccessToken,
+		TokenType:    tr.TokenType,
+		RefreshToken: tr.RefreshToken,
+	}
+	if tr.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+func (a *Authenticator) newFormRequest(ctx context.Context, path string, form url.Values) (*http.Request, error) {
+	u, err := a.baseURL.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", formMediaType)
+	req.Header.Set("Accept", jsonMediaType)
+
+	return req.WithContext(ctx), nil
+}
+
+// decodeError returns an *oauthError if the body contains an OAuth error
+// response, otherwise a generic error containing the body.
+func decodeError(statusCode int, body []byte) error {
+	oerr := &oauthError{}
+	if err := json.Unmarshal(body, oerr); err != nil || oerr.Code == "" {
+		return fmt.Errorf("unexpected response from OAuth server (%s): %s",
+			http.StatusText(statusCode), string(body))
+	}
+
+	return oerr
+}
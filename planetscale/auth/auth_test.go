@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/planetscale"
+	"golang.org/x/oauth2"
+)
+
+const testClientID = "test-client-id"
+
+// fakeOAuthServer implements the device authorization endpoints of an OAuth
+// server. The device is authorized after pendingPolls token requests.
+type fakeOAuthServer struct {
+	t            *testing.T
+	pendingPolls int
+	denied       bool
+
+	mu    sync.Mutex
+	polls int
+}
+
+func (f *fakeOAuthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c := qt.New(f.t)
+	c.Assert(r.Method, qt.Equals, http.MethodPost)
+	c.Assert(r.ParseForm(), qt.IsNil)
+	c.Assert(r.PostForm.Get("client_id"), qt.Equals, testClientID)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case "/oauth/authorize_device":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code":               "device-code",
+			"user_code":                 "ABCD-EFGH",
+			"verification_uri":          "https://example.com/activate",
+			"verification_uri_complete": "https://example.com/activate?code=ABCD-EFGH",
+			"expires_in":                60,
+			"interval":                  0,
+		})
+	case "/oauth/token":
+		if r.PostForm.Get("grant_type") == "refresh_token" {
+			c.Assert(r.PostForm.Get("refresh_token"), qt.Equals, "refresh-token")
+			_, _ = w.Write([]byte(`{"access_token":"refreshed-token","token_type":"Bearer","expires_in":3600}`))
+			return
+		}
+
+		c.Assert(r.PostForm.Get("grant_type"), qt.Equals, deviceCodeGrantType)
+		c.Assert(r.PostForm.Get("device_code"), qt.Equals, "device-code")
+
+		f.mu.Lock()
+		f.polls++
+		polls := f.polls
+		f.mu.Unlock()
+
+		if f.denied {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"access_denied"}`))
+			return
+		}
+
+		if polls <= f.pendingPolls {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"authorization_pending"}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"access_token":"access-token","token_type":"Bearer","refresh_token":"refresh-token","expires_in":3600}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestAuthenticator(c *qt.C, srv http.Handler, opts ...AuthenticatorOption) *Authenticator {
+	ts := httptest.NewServer(srv)
+	c.Cleanup(ts.Close)
+
+	opts = append([]AuthenticatorOption{
+		WithBaseURL(ts.URL),
+		WithClientID(testClientID),
+	}, opts...)
+
+	a, err := New(opts...)
+	c.Assert(err, qt.IsNil)
+	return a
+}
+
+func TestNew_missingClientID(t *testing.T) {
+	c := qt.New(t)
+
+	_, err := New()
+	c.Assert(err, qt.ErrorMatches, "missing client ID")
+}
+
+func TestAuthenticator_Login(t *testing.T) {
+	c := qt.New(t)
+
+	store := NewMemoryStore()
+	a := newTestAuthenticator(c, &fakeOAuthServer{t: t, pendingPolls: 2}, WithTokenStore(store))
+	ctx := context.Background()
+
+	var prompted *DeviceVerification
+	token, err := a.Login(ctx, func(ctx context.Context, v *DeviceVerification) error {
+		prompted = v
+		// don't wait between polls in tests
+		v.CheckInterval = time.Millisecond
+		return nil
+	})
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(prompted.UserCode, qt.Equals, "ABCD-EFGH")
+	c.Assert(prompted.VerificationURL, qt.Equals, "https://example.com/activate")
+	c.Assert(prompted.VerificationCompleteURL, qt.Equals, "https://example.com/activate?code=ABCD-EFGH")
+
+	c.Assert(token.AccessToken, qt.Equals, "access-token")
+	c.Assert(token.RefreshToken, qt.Equals, "refresh-token")
+	c.Assert(token.Expiry.After(time.Now()), qt.IsTrue)
+
+	stored, err := store.Token()
+	c.Assert(err, qt.IsNil)
+	c.Assert(stored.AccessToken, qt.Equals, "access-token")
+}
+
+func TestAuthenticator_Login_accessDenied(t *testing.T) {
+	c := qt.New(t)
+
+	store := NewMemoryStore()
+	a := newTestAuthenticator(c, &fakeOAuthServer{t: t, denied: true}, WithTokenStore(store))
+
+	_, err := a.Login(context.Background(), nil)
+	c.Assert(err, qt.Equals, ErrAccessDenied)
+
+	_, err = store.Token()
+	c.Assert(err, qt.Equals, ErrTokenNotFound)
+}
+
+func TestAuthenticator_GetAccessTokenForDevice_canceled(t *testing.T) {
+	c := qt.New(t)
+
+	a := newTestAuthenticator(c, &fakeOAuthServer{t: t, pendingPolls: 1000})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	v, err := a.RequestDeviceCode(ctx)
+	c.Assert(err, qt.IsNil)
+	v.CheckInterval = time.Millisecond
+
+	_, err = a.GetAccessTokenForDevice(ctx, v)
+	c.Assert(err, qt.ErrorMatches, ".*context deadline exceeded")
+}
+
+func TestAuthenticator_TokenSource(t *testing.T) {
+	c := qt.New(t)
+
+	a := newTestAuthenticator(c, &fakeOAuthServer{t: t})
+	ctx := context.Background()
+
+	_, err := a.Login(ctx, nil)
+	c.Assert(err, qt.IsNil)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Authorization"), qt.Equals, "Bearer access-token")
+		_, _ = w.Write([]byte(`{"data":[]}`))
+	}))
+	c.Cleanup(api.Close)
+
+	client, err := planetscale.NewClient(
+		planetscale.WithBaseURL(api.URL),
+		planetscale.WithTokenSource(a.TokenSource()),
+	)
+	c.Assert(err, qt.IsNil)
+
+	_, err = client.Organizations.List(ctx)
+	c.Assert(err, qt.IsNil)
+}
+
+func TestAuthenticator_TokenSource_loggedOut(t *testing.T) {
+	c := qt.New(t)
+
+	a := newTestAuthenticator(c, &fakeOAuthServer{t: t})
+
+	_, err := a.TokenSource().Token()
+	c.Assert(err, qt.Equals, ErrTokenNotFound)
+}
+
+func TestAuthenticator_TokenSource_refresh(t *testing.T) {
+	c := qt.New(t)
+
+	store := NewMemoryStore()
+	a := newTestAuthenticator(c, &fakeOAuthServer{t: t}, WithTokenStore(store))
+
+	err := store.SetToken(&oauth2.Token{
+		AccessToken:  "expired-token",
+		RefreshToken: "refresh-token",
+		Expiry:       time.Now().Add(-time.Hour),
+	})
+	c.Assert(err, qt.IsNil)
+
+	token, err := a.TokenSource().Token()
+	c.Assert(err, qt.IsNil)
+	c.Assert(token.AccessToken, qt.Equals, "refreshed-token")
+
+	stored, err := store.Token()
+	c.Assert(err, qt.IsNil)
+	c.Assert(stored.AccessToken, qt.Equals, "refreshed-token")
+	c.Assert(stored.RefreshToken, qt.Equals, "refresh-token")
+}
+
+func TestAuthenticator_TokenSource_expiredWithoutRefreshToken(t *testing.T) {
+	c := qt.New(t)
+
+	store := NewMemoryStore()
+	a := newTestAuthenticator(c, &fakeOAuthServer{t: t}, WithTokenStore(store))
+
+	err := store.SetToken(&oauth2.Token{
+		AccessToken: "expired-token",
+		Expiry:      time.Now().Add(-time.Hour),
+	})
+	c.Assert(err, qt.IsNil)
+
+	_, err = a.TokenSource().Token()
+	c.Assert(err, qt.ErrorMatches, "access token expired, please login again")
+}
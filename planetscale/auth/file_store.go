@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	fileStoreVersion = 1
+
+	kdfNone   = "none"
+	kdfPBKDF2 = "pbkdf2-sha256"
+
+	// defaultPBKDF2Iterations is the number of PBKDF2 iterations used to
+	// derive the encryption key from a passphrase.
+	defaultPBKDF2Iterations = 210000
+
+	saltSize = 16
+	keySize  = 32
+)
+
+// ErrDecrypt is returned if the token file can't be decrypted, i.e. because
+// the passphrase or key is wrong or the file was modified.
+var ErrDecrypt = errors.New("unable to decrypt token file, wrong passphrase or key?")
+
+// EncryptedFileStore is a TokenStore that keeps the token in a file encrypted
+// with AES-256-GCM. It only relies on the standard library and works the
+// same on every operating system.
+type EncryptedFileStore struct {
+	path string
+
+	// passphrase is set if the key is derived from a passphrase, otherwise
+	// key is used directly.
+	passphrase []byte
+	key        []byte
+	iterations int
+
+	mu sync.Mutex
+}
+
+var _ TokenStore = &EncryptedFileStore{}
+
+// encryptedFile is the on-disk representation of an encrypted token.
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// NewPassphraseFileStore returns a token store that encrypts the token in
+// the file at path with a key derived from the given passphrase.
+func NewPassphraseFileStore(path, passphrase string) (*EncryptedFileStore, error) {
+	if path == "" {
+		return nil, errors.New("missing token file path")
+	}
+
+	if passphrase == "" {
+		return nil, errors.New("missing passphrase")
+	}
+
+	return &EncryptedFileStore{
+		path:       path,
+		passphrase: []byte(passphrase),
+		iterations: defaultPBKDF2Iterations,
+	}, nil
+}
+
+// NewKeyFileStore returns a token store that encrypts the token in the file
+// at path with the given 32 byte key.
+func NewKeyFileStore(path string, key []byte) (*EncryptedFileStore, error) {
+	if path == "" {
+		return nil, errors.New("missing token file path")
+	}
+
+	if len(key) != keySize {
+		return nil, fmt.Errorf("invalid key size %d, key must be %d bytes", len(key), keySize)
+	}
+
+	return &EncryptedFileStore{
+		path: path,
+		key:  key,
+	}, nil
+}
+
+// Token decrypts and returns the token stored in the file.
+func (s *EncryptedFileStore) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrTokenNotFound
+		}
+		return nil, err
+	}
+
+	ef := &encryptedFile{}
+	if err := json.Unmarshal(out, ef); err != nil {
+		return nil, fmt.Errorf("malformed token file %s: %s", s.path, err)
+	}
+
+	if ef.Version != fileStoreVersion {
+		return nil, fmt.Errorf("unsupported token file version %d", ef.Version)
+	}
+
+	key, err := s.deriveKey(ef.KDF, ef.Salt, ef.Iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ef.Nonce) != gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	plaintext, err := gcm.Open(nil, ef.Nonce, ef.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	token := &oauth2.Token{}
+	if err := json.Unmarshal(plaintext, token); err != nil {
+		return nil, fmt.Errorf("malformed token in %s: %s", s.path, err)
+	}
+
+	return token, nil
+}
+
+// SetToken encrypts the token and writes it to the file. The file is
+// replaced atomically and is only readable by the current user.
+func (s *EncryptedFileStore) SetToken(token *oauth2.Token) error {
+	if token == nil {
+		return errors.New("missing token")
+	}
+
+	plaintext, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	ef := &encryptedFile{
+		Version: fileStoreVersion,
+		KDF:     kdfNone,
+	}
+
+	if s.passphrase != nil {
+		ef.KDF = kdfPBKDF2
+		ef.Iterations = s.iterations
+		ef.Salt = make([]byte, saltSize)
+		if _, err := io.ReadFull(rand.Reader, ef.Salt); err != nil {
+			return err
+		}
+	}
+
+	key, err := s.deriveKey(ef.KDF, ef.Salt, ef.Iterations)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	ef.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, ef.Nonce); err != nil {
+		return err
+	}
+	ef.Ciphertext = gcm.Seal(nil, ef.Nonce, plaintext, nil)
+
+	out, err := json.Marshal(ef)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return writeFileAtomic(s.path, out)
+}
+
+// DeleteToken removes the token file.
+func (s *EncryptedFileStore) DeleteToken() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *EncryptedFileStore) deriveKey(kdf string, salt []byte, iterations int) ([]byte, error) {
+	switch kdf {
+	case kdfNone:
+		if s.key == nil {
+			return nil, errors.New("token file was encrypted with a key, but the store is configured with a passphrase")
+		}
+		return s.key, nil
+	case kdfPBKDF2:
+		if s.passphrase == nil {
+			return nil, errors.New("token file was encrypted with a passphrase, but the store is configured with a key")
+		}
+		if iterations <= 0 || len(salt) == 0 {
+			return nil, errors.New("malformed key derivation parameters in token file")
+		}
+		return pbkdf2Key(s.passphrase, salt, iterations, keySize), nil
+	default:
+		return nil, fmt.Errorf("unsupported key derivation function %q", kdf)
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2Key derives a key from the password and salt as defined by RFC 8018,
+// using HMAC-SHA256 as the pseudorandom function.
+func pbkdf2Key(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+
+	return dk[:keyLen]
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		os.Remove(tmpName)
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	return os.Rename(tmpName, path)
+}
+
+// DefaultPlaintextTokenPath returns the path of the plaintext access token
+// file written by older versions of the PlanetScale CLI.
+func DefaultPlaintextTokenPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".config", "planetscale", "access-token"), nil
+}
+
+// MigratePlaintextToken moves the access token from the plaintext file at
+// path into the given store and removes the plaintext file. It returns false
+// if there is no file to migrate.
+func MigratePlaintextToken(path string, store TokenStore) (bool, error) {
+	out, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	accessToken := strings.TrimSpace(string(out))
+	if accessToken == "" {
+		return false, fmt.Errorf("plaintext token file %s is empty", path)
+	}
+
+	if err := store.SetToken(&oauth2.Token{AccessToken: accessToken}); err != nil {
+		return false, fmt.Errorf("error storing migrated token: %s", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return false, fmt.Errorf("token was migrated but plaintext file couldn't be removed: %s", err)
+	}
+
+	return true, nil
+}
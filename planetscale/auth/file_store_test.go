@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"golang.org/x/oauth2"
+)
+
+func newTestPassphraseStore(c *qt.C, path, passphrase string) *EncryptedFileStore {
+	store, err := NewPassphraseFileStore(path, passphrase)
+	c.Assert(err, qt.IsNil)
+
+	// keep the tests fast
+	store.iterations = 1000
+	return store
+}
+
+func TestEncryptedFileStore_passphrase(t *testing.T) {
+	c := qt.New(t)
+
+	path := filepath.Join(t.TempDir(), "planetscale", "token")
+	store := newTestPassphraseStore(c, path, "correct horse battery staple")
+
+	_, err := store.Token()
+	c.Assert(err, qt.Equals, ErrTokenNotFound)
+
+	expiry := time.Date(2021, time.January, 14, 10, 19, 23, 0, time.UTC)
+	err = store.SetToken(&oauth2.Token{
+		AccessToken:  "access-token",
+		RefreshToken: "refresh-token",
+		TokenType:    "Bearer",
+		Expiry:       expiry,
+	})
+	c.Assert(err, qt.IsNil)
+
+	fi, err := os.Stat(path)
+	c.Assert(err, qt.IsNil)
+	c.Assert(fi.Mode().Perm(), qt.Equals, os.FileMode(0600))
+
+	out, err := ioutil.ReadFile(path)
+	c.Assert(err, qt.IsNil)
+	c.Assert(strings.Contains(string(out), "access-token"), qt.IsFalse)
+
+	token, err := store.Token()
+	c.Assert(err, qt.IsNil)
+	c.Assert(token.AccessToken, qt.Equals, "access-token")
+	c.Assert(token.RefreshToken, qt.Equals, "refresh-token")
+	c.Assert(token.Expiry.Equal(expiry), qt.IsTrue)
+
+	wrong := newTestPassphraseStore(c, path, "wrong")
+	_, err = wrong.Token()
+	c.Assert(err, qt.Equals, ErrDecrypt)
+
+	c.Assert(store.DeleteToken(), qt.IsNil)
+	c.Assert(store.DeleteToken(), qt.IsNil)
+	_, err = store.Token()
+	c.Assert(err, qt.Equals, ErrTokenNotFound)
+}
+
+func TestEncryptedFileStore_key(t *testing.T) {
+	c := qt.New(t)
+
+	path := filepath.Join(t.TempDir(), "token")
+	key := []byte(strings.Repeat("k", 32))
+
+	store, err := NewKeyFileStore(path, key)
+	c.Assert(err, qt.IsNil)
+	c.Assert(store.SetToken(&oauth2.Token{AccessToken: "access-token"}), qt.IsNil)
+
+	token, err := store.Token()
+	c.Assert(err, qt.IsNil)
+	c.Assert(token.AccessToken, qt.Equals, "access-token")
+
+	other, err := NewKeyFileStore(path, []byte(strings.Repeat("x", 32)))
+	c.Assert(err, qt.IsNil)
+	_, err = other.Token()
+	c.Assert(err, qt.Equals, ErrDecrypt)
+
+	passphraseStore := newTestPassphraseStore(c, path, "passphrase")
+	_, err = passphraseStore.Token()
+	c.Assert(err, qt.ErrorMatches, "token file was encrypted with a key.*")
+}
+
+func TestNewKeyFileStore_invalidKey(t *testing.T) {
+	c := qt.New(t)
+
+	_, err := NewKeyFileStore("token", []byte("short"))
+	c.Assert(err, qt.ErrorMatches, "invalid key size 5, key must be 32 bytes")
+}
+
+func TestMigratePlaintextToken(t *testing.T) {
+	c := qt.New(t)
+
+	dir := t.TempDir()
+	plaintextPath := filepath.Join(dir, "access-token")
+	store := NewMemoryStore()
+
+	migrated, err := MigratePlaintextToken(plaintextPath, store)
+	c.Assert(err, qt.IsNil)
+	c.Assert(migrated, qt.IsFalse)
+
+	err = ioutil.WriteFile(plaintextPath, []byte("pscale_token\n"), 0600)
+	c.Assert(err, qt.IsNil)
+
+	migrated, err = MigratePlaintextToken(plaintextPath, store)
+	c.Assert(err, qt.IsNil)
+	c.Assert(migrated, qt.IsTrue)
+
+	token, err := store.Token()
+	c.Assert(err, qt.IsNil)
+	c.Assert(token.AccessToken, qt.Equals, "pscale_token")
+
+	_, err = os.Stat(plaintextPath)
+	c.Assert(os.IsNotExist(err), qt.IsTrue)
+}
+
+func TestPBKDF2Key(t *testing.T) {
+	c := qt.New(t)
+
+	// known PBKDF2-HMAC-SHA256 test vectors
+	got := pbkdf2Key([]byte("passwd"), []byte("salt"), 1, 64)
+	c.Assert(hex.EncodeToString(got), qt.Equals, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783")
+
+	got = pbkdf2Key([]byte("password"), []byte("salt"), 4096, 32)
+	c.Assert(hex.EncodeToString(got), qt.Equals, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a")
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrTokenNotFound is returned by a TokenStore if no token is stored.
+var ErrTokenNotFound = errors.New("no token found, please login first")
+
+// TokenStore persists OAuth tokens.
+type TokenStore interface {
+	// Token returns the stored token or ErrTokenNotFound.
+	Token() (*oauth2.Token, error)
+
+	// SetToken stores the given token, replacing any existing one.
+	SetToken(*oauth2.Token) error
+
+	// DeleteToken removes the stored token. It doesn't return an error if
+	// no token is stored.
+	DeleteToken() error
+}
+
+// MemoryStore is a TokenStore that keeps the token in memory.
+type MemoryStore struct {
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+var _ TokenStore = &MemoryStore{}
+
+// NewMemoryStore returns an empty in-memory token store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Token returns the stored token.
+func (m *MemoryStore) Token() (*oauth2.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token == nil {
+		return nil, ErrTokenNotFound
+	}
+
+	t := *m.token
+	return &t, nil
+}
+
+// SetToken stores a copy of the given token.
+func (m *MemoryStore) SetToken(token *oauth2.Token) error {
+	if token == nil {
+		return errors.New("missing token")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := *token
+	m.token = &t
+	return nil
+}
+
+// DeleteToken removes the stored token.
+func (m *MemoryStore) DeleteToken() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.token = nil
+	return nil
+}
+
+// refreshingTokenSource is an oauth2.TokenSource that reads the token from a
+// TokenStore. Expired tokens are refreshed with the refresh token and the
+// new token is written back to the store.
+type refreshingTokenSource struct {
+	ctx    context.Context
+	store  TokenStore
+	config *oauth2.Config
+
+	mu sync.Mutex
+}
+
+func (s *refreshingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.store.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Valid() {
+		return token, nil
+	}
+
+	if token.RefreshToken == "" {
+		return nil, errors.New("access token expired, please login again")
+	}
+
+	newToken, err := s.config.TokenSource(s.ctx, token).Token()
+	if err != nil {
+		return nil, fmt.Errorf("error refreshing access token: %s", err)
+	}
+
+	// some servers don't return a new refresh token on refresh
+	if newToken.RefreshToken == "" {
+		newToken.RefreshToken = token.RefreshToken
+	}
+
+	if err := s.store.SetToken(newToken); err != nil {
+		return nil, fmt.Errorf("error storing refreshed access token: %s", err)
+	}
+
+	return newToken, nil
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"golang.org/x/oauth2"
+)
+
+func TestMemoryStore(t *testing.T) {
+	c := qt.New(t)
+
+	store := NewMemoryStore()
+
+	_, err := store.Token()
+	c.Assert(err, qt.Equals, ErrTokenNotFound)
+
+	token := &oauth2.Token{AccessToken: "foo"}
+	c.Assert(store.SetToken(token), qt.IsNil)
+
+	// changing the original must not change the stored token
+	token.AccessToken = "bar"
+
+	got, err := store.Token()
+	c.Assert(err, qt.IsNil)
+	c.Assert(got.AccessToken, qt.Equals, "foo")
+
+	c.Assert(store.DeleteToken(), qt.IsNil)
+	_, err = store.Token()
+	c.Assert(err, qt.Equals, ErrTokenNotFound)
+}
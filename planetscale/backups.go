@@ -20,6 +20,15 @@ type Backup struct {
 	CompletedAt time.Time `json:"completed_at"`
 }
 
+// BackupExport is a short-lived URL to download the data of a completed
+// backup.
+type BackupExport struct {
+	URL       string    `json:"url"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type backupsResponse struct {
 	Backups []*Backup `json:"data"`
 }
@@ -50,6 +59,13 @@ type DeleteBackupRequest struct {
 	Backup       string
 }
 
+type ExportBackupRequest struct {
+	Organization string
+	Database     string
+	Branch       string
+	Backup       string
+}
+
 // BackupsService is an interface for communicating with the PlanetScale
 // backup API endpoint.
 type BackupsService interface {
@@ -59,6 +75,13 @@ type BackupsService interface {
 	Delete(context.Context, *DeleteBackupRequest) error
 }
 
+// BackupExportsService is an interface for exporting the data of backups.
+// It's separate from BackupsService, so existing implementations of
+// BackupsService keep satisfying it.
+type BackupExportsService interface {
+	Export(context.Context, *ExportBackupRequest) (*BackupExport, error)
+}
+
 type backupsService struct {
 	client *Client
 }
@@ -130,6 +153,34 @@ func (d *backupsService) Delete(ctx context.Context, deleteReq *DeleteBackupRequ
 	return err
 }
 
+type backupExportsService struct {
+	client *Client
+}
+
+var _ BackupExportsService = &backupExportsService{}
+
+func NewBackupExportsService(client *Client) *backupExportsService {
+	return &backupExportsService{
+		client: client,
+	}
+}
+
+// Returns a URL to download the data of a completed backup.
+func (d *backupExportsService) Export(ctx context.Context, exportReq *ExportBackupRequest) (*BackupExport, error) {
+	path := fmt.Sprintf("%s/export", backupAPIPath(exportReq.Organization, exportReq.Database, exportReq.Branch, exportReq.Backup))
+	req, err := d.client.newRequest(http.MethodPost, path, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating http request")
+	}
+
+	export := &BackupExport{}
+	if err := d.client.do(ctx, req, &export); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
 func backupsAPIPath(org, db, branch string) string {
 	return fmt.Sprintf("%s/backups", databaseBranchAPIPath(org, db, branch))
 }
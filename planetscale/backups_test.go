@@ -142,3 +142,42 @@ func TestBackups_Get(t *testing.T) {
 	c.Assert(err, qt.IsNil)
 	c.Assert(backup, qt.DeepEquals, want)
 }
+
+func TestBackupExports_Export(t *testing.T) {
+	c := qt.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, qt.Equals, http.MethodPost)
+		c.Assert(r.URL.Path, qt.Equals, "/v1/organizations/my-org/databases/planetscale-go-test-db/branches/my-branch/backups/planetscale-go-test-backup/export")
+
+		w.WriteHeader(200)
+		out := `{"url":"https://exports.example.com/planetscale-go-test-backup?signature=abc","size":1024,"sha256":"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08","expires_at":"2021-01-14T11:19:23.000Z"}`
+		_, err := w.Write([]byte(out))
+		c.Assert(err, qt.IsNil)
+	}))
+
+	client, err := NewClient(WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	org := "my-org"
+	db := "planetscale-go-test-db"
+	branch := "my-branch"
+
+	export, err := client.BackupExports.Export(ctx, &ExportBackupRequest{
+		Organization: org,
+		Database:     db,
+		Branch:       branch,
+		Backup:       testBackup,
+	})
+
+	want := &BackupExport{
+		URL:       "https://exports.example.com/planetscale-go-test-backup?signature=abc",
+		Size:      1024,
+		SHA256:    "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		ExpiresAt: time.Date(2021, time.January, 14, 11, 19, 23, 000, time.UTC),
+	}
+
+	c.Assert(err, qt.IsNil)
+	c.Assert(export, qt.DeepEquals, want)
+}
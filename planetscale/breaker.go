@@ -0,0 +1,253 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerOpenTimeout      = 30 * time.Second
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all requests through.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen rejects all requests with an ErrCircuitOpen error.
+	BreakerOpen
+
+	// BreakerHalfOpen lets a single probe request through. The breaker is
+	// closed if the probe succeeds and opened again if it fails.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig defines the configuration of the circuit breakers of a
+// client. Every endpoint group has its own breaker.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures after which
+	// the breaker opens. Defaults to 5.
+	FailureThreshold int
+
+	// OpenTimeout is how long the breaker stays open before a probe request
+	// is let through. Defaults to 30 seconds.
+	OpenTimeout time.Duration
+
+	// Group returns the endpoint group of a request. Defaults to the API
+	// resource of the request combined with "read" or "write", e.g.
+	// "branches:read" or "deploy-requests:write".
+	Group func(req *http.Request) string
+
+	// IsFailure reports whether the outcome of a request counts as a
+	// failure. Defaults to network errors, timeouts and 5xx responses.
+	IsFailure func(res *http.Response, err error) bool
+
+	// OnStateChange is called whenever the breaker of a group changes its
+	// state. It's called synchronously and must not block.
+	OnStateChange func(group string, from, to BreakerState)
+}
+
+// WithCircuitBreaker configures the client to fail fast with an
+// ErrCircuitOpen error while the API is failing. A nil config uses the
+// defaults.
+func WithCircuitBreaker(cfg *BreakerConfig) ClientOption {
+	return func(c *Client) error {
+		b := &breaker{groups: make(map[string]*breakerGroup), now: time.Now}
+		if cfg != nil {
+			b.cfg = *cfg
+		}
+
+		if b.cfg.FailureThreshold <= 0 {
+			b.cfg.FailureThreshold = defaultBreakerFailureThreshold
+		}
+		if b.cfg.OpenTimeout <= 0 {
+			b.cfg.OpenTimeout = defaultBreakerOpenTimeout
+		}
+		if b.cfg.Group == nil {
+			b.cfg.Group = defaultBreakerGroup
+		}
+		if b.cfg.IsFailure == nil {
+			b.cfg.IsFailure = defaultBreakerIsFailure
+		}
+
+		c.breaker = b
+		return nil
+	}
+}
+
+// BreakerState returns the state of the circuit breaker of the given
+// endpoint group. It returns BreakerClosed if the client has no circuit
+// breaker.
+func (c *Client) BreakerState(group string) BreakerState {
+	if c.breaker == nil {
+		return BreakerClosed
+	}
+
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+
+	g, ok := c.breaker.groups[group]
+	if !ok {
+		return BreakerClosed
+	}
+	return g.state
+}
+
+type breaker struct {
+	cfg BreakerConfig
+	now func() time.Time
+
+	mu     sync.Mutex
+	groups map[string]*breakerGroup
+}
+
+type breakerGroup struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow checks whether the request may be sent. If so, the returned function
+// must be called with the outcome of the request.
+func (b *breaker) allow(req *http.Request) (func(*http.Response, error), error) {
+	group := b.cfg.Group(req)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, ok := b.groups[group]
+	if !ok {
+		g = &breakerGroup{}
+		b.groups[group] = g
+	}
+
+	if g.state == BreakerOpen && b.now().Sub(g.openedAt) >= b.cfg.OpenTimeout {
+		b.setState(group, g, BreakerHalfOpen)
+	}
+
+	probe := false
+	switch g.state {
+	case BreakerOpen:
+		return nil, b.openError(group)
+	case BreakerHalfOpen:
+		if g.probing {
+			return nil, b.openError(group)
+		}
+		g.probing = true
+		probe = true
+	}
+
+	return func(res *http.Response, err error) {
+		b.done(group, g, probe, res, err)
+	}, nil
+}
+
+func (b *breaker) done(group string, g *breakerGroup, probe bool, res *http.Response, err error) {
+	// requests canceled by the caller tell nothing about the API
+	neutral := errors.Is(err, context.Canceled)
+	failure := !neutral && b.cfg.IsFailure(res, err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		g.probing = false
+	}
+
+	switch {
+	case neutral:
+	case failure:
+		g.failures++
+		if g.state == BreakerHalfOpen || (g.state == BreakerClosed && g.failures >= b.cfg.FailureThreshold) {
+			g.openedAt = b.now()
+			b.setState(group, g, BreakerOpen)
+		}
+	default:
+		g.failures = 0
+		if g.state == BreakerHalfOpen {
+			b.setState(group, g, BreakerClosed)
+		}
+	}
+}
+
+func (b *breaker) setState(group string, g *breakerGroup, state BreakerState) {
+	from := g.state
+	g.state = state
+	if state == BreakerClosed {
+		g.failures = 0
+	}
+
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(group, from, state)
+	}
+}
+
+func (b *breaker) openError(group string) error {
+	return &Error{
+		msg:  "circuit breaker for " + group + " is open",
+		Code: ErrCircuitOpen,
+		Meta: map[string]string{
+			"group": group,
+		},
+	}
+}
+
+// breakerResources are the API resources that make up the default endpoint
+// groups.
+var breakerResources = map[string]bool{
+	"organizations":   true,
+	"databases":       true,
+	"branches":        true,
+	"backups":         true,
+	"deploy-requests": true,
+	"service-tokens":  true,
+	"regions":         true,
+}
+
+func defaultBreakerGroup(req *http.Request) string {
+	resource := "other"
+	for _, segment := range strings.Split(req.URL.Path, "/") {
+		if breakerResources[segment] {
+			resource = segment
+		}
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return resource + ":read"
+	default:
+		return resource + ":write"
+	}
+}
+
+func defaultBreakerIsFailure(res *http.Response, err error) bool {
+	if err != nil {
+		// errors created by the client itself, e.g. in read-only mode,
+		// don't indicate a problem with the API
+		var psErr *Error
+		return !errors.As(err, &psErr)
+	}
+
+	return res.StatusCode >= 500
+}
@@ -0,0 +1,160 @@
+package planetscale
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	c := qt.New(t)
+
+	var deployFailing int32 = 1
+	var deployCalls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/deploy-requests") {
+			atomic.AddInt32(&deployCalls, 1)
+			if atomic.LoadInt32(&deployFailing) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte(`{"code":"unavailable","message":"Service Unavailable"}`))
+				return
+			}
+		}
+
+		w.WriteHeader(200)
+		_, _ = w.Write([]byte(`{"name":"main","number":1}`))
+	}))
+	defer ts.Close()
+
+	type change struct {
+		Group    string
+		From, To BreakerState
+	}
+	var changes []change
+
+	client, err := NewClient(WithBaseURL(ts.URL), WithCircuitBreaker(&BreakerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+		OnStateChange: func(group string, from, to BreakerState) {
+			changes = append(changes, change{group, from, to})
+		},
+	}))
+	c.Assert(err, qt.IsNil)
+
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	deploy := func() error {
+		_, err := client.DeployRequests.Deploy(ctx, &PerformDeployRequest{
+			Organization: testOrg,
+			Database:     testDatabase,
+			Number:       1,
+		})
+		return err
+	}
+
+	c.Assert(deploy(), qt.ErrorMatches, "Service Unavailable")
+	c.Assert(deploy(), qt.ErrorMatches, "Service Unavailable")
+
+	const group = "deploy-requests:write"
+	c.Assert(client.BreakerState(group), qt.Equals, BreakerOpen)
+
+	err = deploy()
+	c.Assert(err, qt.ErrorMatches, "circuit breaker for deploy-requests:write is open")
+	c.Assert(err.(*Error).Code, qt.Equals, ErrCircuitOpen)
+	c.Assert(atomic.LoadInt32(&deployCalls), qt.Equals, int32(2))
+
+	// other endpoint groups are not affected
+	_, err = client.DatabaseBranches.Get(ctx, &GetDatabaseBranchRequest{
+		Organization: testOrg,
+		Database:     testDatabase,
+		Branch:       "main",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(client.BreakerState("branches:read"), qt.Equals, BreakerClosed)
+
+	// a failed probe opens the breaker again
+	now = now.Add(time.Minute)
+	c.Assert(deploy(), qt.ErrorMatches, "Service Unavailable")
+	c.Assert(client.BreakerState(group), qt.Equals, BreakerOpen)
+
+	// a successful probe closes the breaker
+	atomic.StoreInt32(&deployFailing, 0)
+	now = now.Add(time.Minute)
+	c.Assert(deploy(), qt.IsNil)
+	c.Assert(client.BreakerState(group), qt.Equals, BreakerClosed)
+
+	c.Assert(changes, qt.DeepEquals, []change{
+		{group, BreakerClosed, BreakerOpen},
+		{group, BreakerOpen, BreakerHalfOpen},
+		{group, BreakerHalfOpen, BreakerOpen},
+		{group, BreakerOpen, BreakerHalfOpen},
+		{group, BreakerHalfOpen, BreakerClosed},
+	})
+}
+
+func TestCircuitBreaker_halfOpenSingleProbe(t *testing.T) {
+	c := qt.New(t)
+
+	b := &breaker{groups: make(map[string]*breakerGroup), now: time.Now}
+	b.cfg = BreakerConfig{
+		FailureThreshold: 1,
+		Group:            defaultBreakerGroup,
+		IsFailure:        defaultBreakerIsFailure,
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://api.planetscale.com/v1/organizations/my-org/databases", nil)
+	c.Assert(err, qt.IsNil)
+
+	done, err := b.allow(req)
+	c.Assert(err, qt.IsNil)
+	done(nil, context.DeadlineExceeded)
+	c.Assert(b.groups["databases:read"].state, qt.Equals, BreakerOpen)
+
+	// the open timeout of zero elapsed immediately
+	probe, err := b.allow(req)
+	c.Assert(err, qt.IsNil)
+
+	_, err = b.allow(req)
+	c.Assert(err, qt.ErrorMatches, "circuit breaker for databases:read is open")
+
+	// canceled requests are neither a success nor a failure
+	probe(nil, context.Canceled)
+	c.Assert(b.groups["databases:read"].state, qt.Equals, BreakerHalfOpen)
+
+	probe, err = b.allow(req)
+	c.Assert(err, qt.IsNil)
+	probe(&http.Response{StatusCode: http.StatusNotFound}, nil)
+	c.Assert(b.groups["databases:read"].state, qt.Equals, BreakerClosed)
+}
+
+func TestDefaultBreakerGroup(t *testing.T) {
+	c := qt.New(t)
+
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodGet, "/v1/organizations", "organizations:read"},
+		{http.MethodGet, "/v1/organizations/my-org/databases/my-db", "databases:read"},
+		{http.MethodGet, "/v1/organizations/my-org/databases/my-db/branches/main/schema", "branches:read"},
+		{http.MethodPost, "/v1/organizations/my-org/databases/my-db/branches/main/create-certificate", "branches:write"},
+		{http.MethodPatch, "/v1/organizations/my-org/databases/my-db/deploy-requests/1/deploy", "deploy-requests:write"},
+		{http.MethodDelete, "/v1/organizations/my-org/service-tokens/abc/access", "service-tokens:write"},
+		{http.MethodGet, "/v2/unknown", "other:read"},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, "https://api.planetscale.com"+tt.path, nil)
+		c.Assert(err, qt.IsNil)
+		c.Assert(defaultBreakerGroup(req), qt.Equals, tt.want, qt.Commentf("%s %s", tt.method, tt.path))
+	}
+}
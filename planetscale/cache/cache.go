@@ -0,0 +1,532 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+	"github.com/planetscale/planetscale-go/planetscale/watch"
+)
+
+// Config defines the configuration of a Cache.
+type Config struct {
+	// Organization is the PlanetScale organization whose databases, branches
+	// and deploy requests are cached.
+	Organization string
+
+	// Client defines a PlanetScale client. Use planetscale.NewClient() to
+	// create a new instance.
+	Client *ps.Client
+
+	// WatchOptions configures the resync interval and error backoff of the
+	// underlying watches.
+	WatchOptions *watch.Options
+}
+
+// Cache is an in-memory, indexed copy of the databases, branches and deploy
+// requests of an organization. It's kept in sync in the background by Run.
+//
+// Reads never block: every update swaps in a new immutable snapshot, so
+// lookups only load a pointer. The returned resources are shared and must not
+// be modified.
+type Cache struct {
+	cfg Config
+
+	snap atomic.Value // *snapshot
+
+	// mu serializes writers and guards the fields below.
+	mu       sync.Mutex
+	watchers map[string]*dbWatcher
+
+	// unsynced counts the watches per database that haven't delivered their
+	// initial state yet. Only databases present at startup are tracked.
+	unsynced    map[string]int
+	dbsSynced   bool
+	synced      chan struct{}
+	closeSynced sync.Once
+}
+
+// snapshot is an immutable view of the cache.
+type snapshot struct {
+	databases        map[string]*ps.Database
+	databasesByState map[string][]*ps.Database
+	dbs              map[string]*dbSnapshot
+}
+
+// dbSnapshot is an immutable view of a single database's resources.
+type dbSnapshot struct {
+	branches         map[string]*ps.DatabaseBranch
+	branchesByParent map[string][]*ps.DatabaseBranch
+	branchesByStatus map[string][]*ps.DatabaseBranch
+
+	deployRequests        map[uint64]*ps.DeployRequest
+	deployRequestsByState map[string][]*ps.DeployRequest
+}
+
+type dbWatcher struct {
+	cancel context.CancelFunc
+}
+
+// New returns a new, empty cache. Call Run to start syncing it.
+func New(cfg *Config) (*Cache, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("planetscale Client is not set")
+	}
+
+	if cfg.Organization == "" {
+		return nil, errors.New("organization is not set")
+	}
+
+	c := &Cache{
+		cfg:      *cfg,
+		watchers: make(map[string]*dbWatcher),
+		unsynced: make(map[string]int),
+		synced:   make(chan struct{}),
+	}
+	c.snap.Store(&snapshot{
+		databases: map[string]*ps.Database{},
+		dbs:       map[string]*dbSnapshot{},
+	})
+
+	return c, nil
+}
+
+// Run keeps the cache in sync until ctx is canceled. It always returns a
+// non-nil error.
+func (c *Cache) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	opts := c.watchOptions()
+	events := watch.Databases(ctx, c.cfg.Client.Databases, &ps.ListDatabasesRequest{
+		Organization: c.cfg.Organization,
+	}, opts)
+
+	for ev := range events {
+		switch ev.Type {
+		case watch.Synced:
+			c.mu.Lock()
+			c.dbsSynced = true
+			c.checkSyncedLocked()
+			c.mu.Unlock()
+		case watch.Added:
+			c.setDatabase(ev.Database)
+			c.startWatchers(ctx, &wg, ev.Database.Name, opts)
+		case watch.Modified:
+			c.setDatabase(ev.Database)
+		case watch.Deleted:
+			c.deleteDatabase(ev.Database.Name)
+		}
+	}
+
+	return ctx.Err()
+}
+
+// WaitForSync blocks until the initial state of all resources was loaded or
+// ctx is canceled.
+func (c *Cache) WaitForSync(ctx context.Context) error {
+	select {
+	case <-c.synced:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HasSynced reports whether the initial state of all resources was loaded.
+func (c *Cache) HasSynced() bool {
+	select {
+	case <-c.synced:
+		return true
+	default:
+		return false
+	}
+}
+
+// Database returns the database with the given name.
+func (c *Cache) Database(name string) (*ps.Database, bool) {
+	db, ok := c.load().databases[name]
+	return db, ok
+}
+
+// Databases returns all databases, sorted by name.
+func (c *Cache) Databases() []*ps.Database {
+	s := c.load()
+
+	dbs := make([]*ps.Database, 0, len(s.databases))
+	for _, db := range s.databases {
+		dbs = append(dbs, db)
+	}
+	sortDatabases(dbs)
+	return dbs
+}
+
+// DatabasesByState returns the databases in the given state, sorted by name.
+func (c *Cache) DatabasesByState(state string) []*ps.Database {
+	return c.load().databasesByState[state]
+}
+
+// Branch returns the branch with the given name of a database.
+func (c *Cache) Branch(database, name string) (*ps.DatabaseBranch, bool) {
+	db, ok := c.load().dbs[database]
+	if !ok {
+		return nil, false
+	}
+
+	b, ok := db.branches[name]
+	return b, ok
+}
+
+// Branches returns all branches of a database, sorted by name.
+func (c *Cache) Branches(database string) []*ps.DatabaseBranch {
+	db, ok := c.load().dbs[database]
+	if !ok {
+		return nil
+	}
+
+	branches := make([]*ps.DatabaseBranch, 0, len(db.branches))
+	for _, b := range db.branches {
+		branches = append(branches, b)
+	}
+	sortBranches(branches)
+	return branches
+}
+
+// BranchesByParent returns the branches of a database that were created from
+// the given parent branch, sorted by name.
+func (c *Cache) BranchesByParent(database, parent string) []*ps.DatabaseBranch {
+	db, ok := c.load().dbs[database]
+	if !ok {
+		return nil
+	}
+
+	return db.branchesByParent[parent]
+}
+
+// BranchesByStatus returns the branches of a database with the given status,
+// sorted by name.
+func (c *Cache) BranchesByStatus(database, status string) []*ps.DatabaseBranch {
+	db, ok := c.load().dbs[database]
+	if !ok {
+		return nil
+	}
+
+	return db.branchesByStatus[status]
+}
+
+// DeployRequest returns the deploy request with the given number of a
+// database.
+func (c *Cache) DeployRequest(database string, number uint64) (*ps.DeployRequest, bool) {
+	db, ok := c.load().dbs[database]
+	if !ok {
+		return nil, false
+	}
+
+	dr, ok := db.deployRequests[number]
+	return dr, ok
+}
+
+// DeployRequests returns all deploy requests of a database, sorted by number.
+func (c *Cache) DeployRequests(database string) []*ps.DeployRequest {
+	db, ok := c.load().dbs[database]
+	if !ok {
+		return nil
+	}
+
+	drs := make([]*ps.DeployRequest, 0, len(db.deployRequests))
+	for _, dr := range db.deployRequests {
+		drs = append(drs, dr)
+	}
+	sortDeployRequests(drs)
+	return drs
+}
+
+// DeployRequestsByState returns the deploy requests of a database in the
+// given state, sorted by number.
+func (c *Cache) DeployRequestsByState(database, state string) []*ps.DeployRequest {
+	db, ok := c.load().dbs[database]
+	if !ok {
+		return nil
+	}
+
+	return db.deployRequestsByState[state]
+}
+
+func (c *Cache) load() *snapshot {
+	return c.snap.Load().(*snapshot)
+}
+
+func (c *Cache) watchOptions() *watch.Options {
+	var opts watch.Options
+	if c.cfg.WatchOptions != nil {
+		opts = *c.cfg.WatchOptions
+	}
+	opts.NotifySynced = true
+	return &opts
+}
+
+// startWatchers starts watching the branches and deploy requests of a
+// database.
+func (c *Cache) startWatchers(ctx context.Context, wg *sync.WaitGroup, database string, opts *watch.Options) {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &dbWatcher{cancel: cancel}
+
+	c.mu.Lock()
+	if old, ok := c.watchers[database]; ok {
+		old.cancel()
+	}
+	c.watchers[database] = w
+	if !c.dbsSynced {
+		c.unsynced[database] = 2
+	}
+	c.mu.Unlock()
+
+	branches := watch.Branches(ctx, c.cfg.Client.DatabaseBranches, &ps.ListDatabaseBranchesRequest{
+		Organization: c.cfg.Organization,
+		Database:     database,
+	}, opts)
+
+	drs := watch.DeployRequests(ctx, c.cfg.Client.DeployRequests, &ps.ListDeployRequestsRequest{
+		Organization: c.cfg.Organization,
+		Database:     database,
+	}, opts)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for ev := range branches {
+			c.handleBranchEvent(w, database, ev)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for ev := range drs {
+			c.handleDeployRequestEvent(w, database, ev)
+		}
+	}()
+}
+
+func (c *Cache) handleBranchEvent(w *dbWatcher, database string, ev watch.BranchEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// ignore events of watchers that were stopped
+	if c.watchers[database] != w {
+		return
+	}
+
+	if ev.Type == watch.Synced {
+		c.markSyncedLocked(database)
+		return
+	}
+
+	s := c.load()
+	db := s.dbs[database].clone()
+
+	branches := make(map[string]*ps.DatabaseBranch, len(db.branches))
+	for name, b := range db.branches {
+		branches[name] = b
+	}
+
+	if ev.Type == watch.Deleted {
+		delete(branches, ev.Branch.Name)
+	} else {
+		branches[ev.Branch.Name] = ev.Branch
+	}
+	db.setBranches(branches)
+
+	c.storeLocked(s.withDB(database, db))
+}
+
+func (c *Cache) handleDeployRequestEvent(w *dbWatcher, database string, ev watch.DeployRequestEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// ignore events of watchers that were stopped
+	if c.watchers[database] != w {
+		return
+	}
+
+	if ev.Type == watch.Synced {
+		c.markSyncedLocked(database)
+		return
+	}
+
+	s := c.load()
+	db := s.dbs[database].clone()
+
+	drs := make(map[uint64]*ps.DeployRequest, len(db.deployRequests))
+	for number, dr := range db.deployRequests {
+		drs[number] = dr
+	}
+
+	if ev.Type == watch.Deleted {
+		delete(drs, ev.DeployRequest.Number)
+	} else {
+		drs[ev.DeployRequest.Number] = ev.DeployRequest
+	}
+	db.setDeployRequests(drs)
+
+	c.storeLocked(s.withDB(database, db))
+}
+
+func (c *Cache) setDatabase(db *ps.Database) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.load()
+
+	databases := make(map[string]*ps.Database, len(s.databases)+1)
+	for name, d := range s.databases {
+		databases[name] = d
+	}
+	databases[db.Name] = db
+
+	next := &snapshot{dbs: s.dbs}
+	next.setDatabases(databases)
+	c.storeLocked(next)
+}
+
+func (c *Cache) deleteDatabase(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if w, ok := c.watchers[name]; ok {
+		w.cancel()
+		delete(c.watchers, name)
+	}
+
+	if _, ok := c.unsynced[name]; ok {
+		delete(c.unsynced, name)
+		c.checkSyncedLocked()
+	}
+
+	s := c.load()
+
+	databases := make(map[string]*ps.Database, len(s.databases))
+	for n, d := range s.databases {
+		if n != name {
+			databases[n] = d
+		}
+	}
+
+	next := s.withDB(name, nil)
+	next.setDatabases(databases)
+	c.storeLocked(next)
+}
+
+func (c *Cache) storeLocked(s *snapshot) {
+	c.snap.Store(s)
+}
+
+func (c *Cache) markSyncedLocked(database string) {
+	n, ok := c.unsynced[database]
+	if !ok {
+		return
+	}
+
+	if n <= 1 {
+		delete(c.unsynced, database)
+	} else {
+		c.unsynced[database] = n - 1
+	}
+	c.checkSyncedLocked()
+}
+
+func (c *Cache) checkSyncedLocked() {
+	if c.dbsSynced && len(c.unsynced) == 0 {
+		c.closeSynced.Do(func() { close(c.synced) })
+	}
+}
+
+// withDB returns a copy of the snapshot with the given database snapshot
+// replaced. A nil db removes the database.
+func (s *snapshot) withDB(name string, db *dbSnapshot) *snapshot {
+	dbs := make(map[string]*dbSnapshot, len(s.dbs)+1)
+	for n, d := range s.dbs {
+		dbs[n] = d
+	}
+
+	if db == nil {
+		delete(dbs, name)
+	} else {
+		dbs[name] = db
+	}
+
+	return &snapshot{
+		databases:        s.databases,
+		databasesByState: s.databasesByState,
+		dbs:              dbs,
+	}
+}
+
+func (s *snapshot) setDatabases(databases map[string]*ps.Database) {
+	s.databases = databases
+	s.databasesByState = make(map[string][]*ps.Database)
+	for _, db := range databases {
+		s.databasesByState[db.State] = append(s.databasesByState[db.State], db)
+	}
+
+	for _, dbs := range s.databasesByState {
+		sortDatabases(dbs)
+	}
+}
+
+// clone returns a shallow copy of the database snapshot. A nil snapshot
+// returns an empty one.
+func (d *dbSnapshot) clone() *dbSnapshot {
+	if d == nil {
+		return &dbSnapshot{}
+	}
+
+	c := *d
+	return &c
+}
+
+func (d *dbSnapshot) setBranches(branches map[string]*ps.DatabaseBranch) {
+	d.branches = branches
+	d.branchesByParent = make(map[string][]*ps.DatabaseBranch)
+	d.branchesByStatus = make(map[string][]*ps.DatabaseBranch)
+	for _, b := range branches {
+		d.branchesByParent[b.ParentBranch] = append(d.branchesByParent[b.ParentBranch], b)
+		d.branchesByStatus[b.Status] = append(d.branchesByStatus[b.Status], b)
+	}
+
+	for _, bs := range d.branchesByParent {
+		sortBranches(bs)
+	}
+	for _, bs := range d.branchesByStatus {
+		sortBranches(bs)
+	}
+}
+
+func (d *dbSnapshot) setDeployRequests(drs map[uint64]*ps.DeployRequest) {
+	d.deployRequests = drs
+	d.deployRequestsByState = make(map[string][]*ps.DeployRequest)
+	for _, dr := range drs {
+		d.deployRequestsByState[dr.State] = append(d.deployRequestsByState[dr.State], dr)
+	}
+
+	for _, dr := range d.deployRequestsByState {
+		sortDeployRequests(dr)
+	}
+}
+
+func sortDatabases(dbs []*ps.Database) {
+	sort.Slice(dbs, func(i, j int) bool { return dbs[i].Name < dbs[j].Name })
+}
+
+func sortBranches(branches []*ps.DatabaseBranch) {
+	sort.Slice(branches, func(i, j int) bool { return branches[i].Name < branches[j].Name })
+}
+
+func sortDeployRequests(drs []*ps.DeployRequest) {
+	sort.Slice(drs, func(i, j int) bool { return drs[i].Number < drs[j].Number })
+}
@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+	"github.com/planetscale/planetscale-go/planetscale/watch"
+)
+
+// fakeAPI is an in-memory backend for the List calls used by the cache.
+type fakeAPI struct {
+	mu       sync.Mutex
+	dbs      []*ps.Database
+	branches map[string][]*ps.DatabaseBranch
+	drs      map[string][]*ps.DeployRequest
+}
+
+type fakeDatabases struct {
+	ps.DatabasesService
+	api *fakeAPI
+}
+
+func (f *fakeDatabases) List(context.Context, *ps.ListDatabasesRequest) ([]*ps.Database, error) {
+	f.api.mu.Lock()
+	defer f.api.mu.Unlock()
+	return f.api.dbs, nil
+}
+
+type fakeBranches struct {
+	ps.DatabaseBranchesService
+	api *fakeAPI
+}
+
+func (f *fakeBranches) List(_ context.Context, listReq *ps.ListDatabaseBranchesRequest) ([]*ps.DatabaseBranch, error) {
+	f.api.mu.Lock()
+	defer f.api.mu.Unlock()
+	return f.api.branches[listReq.Database], nil
+}
+
+type fakeDeployRequests struct {
+	ps.DeployRequestsService
+	api *fakeAPI
+}
+
+func (f *fakeDeployRequests) List(_ context.Context, listReq *ps.ListDeployRequestsRequest) ([]*ps.DeployRequest, error) {
+	f.api.mu.Lock()
+	defer f.api.mu.Unlock()
+	return f.api.drs[listReq.Database], nil
+}
+
+func (f *fakeAPI) update(fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn()
+}
+
+func newTestCache(c *qt.C, api *fakeAPI) *Cache {
+	client, err := ps.NewClient()
+	c.Assert(err, qt.IsNil)
+
+	client.Databases = &fakeDatabases{api: api}
+	client.DatabaseBranches = &fakeBranches{api: api}
+	client.DeployRequests = &fakeDeployRequests{api: api}
+
+	cache, err := New(&Config{
+		Organization: "my-org",
+		Client:       client,
+		WatchOptions: &watch.Options{ResyncInterval: time.Millisecond},
+	})
+	c.Assert(err, qt.IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = cache.Run(ctx)
+	}()
+	c.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return cache
+}
+
+func TestCache(t *testing.T) {
+	c := qt.New(t)
+
+	api := &fakeAPI{
+		dbs: []*ps.Database{
+			{Name: "db-1", State: "ready"},
+			{Name: "db-2", State: "pending"},
+		},
+		branches: map[string][]*ps.DatabaseBranch{
+			"db-1": {
+				{Name: "main", Status: "ready"},
+				{Name: "feature-a", ParentBranch: "main", Status: "ready"},
+				{Name: "feature-b", ParentBranch: "main", Status: "pending"},
+			},
+		},
+		drs: map[string][]*ps.DeployRequest{
+			"db-1": {
+				{Number: 1, Branch: "feature-a", State: "closed"},
+				{Number: 2, Branch: "feature-b", State: "open"},
+			},
+		},
+	}
+
+	cache := newTestCache(c, api)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.Assert(cache.WaitForSync(ctx), qt.IsNil)
+	c.Assert(cache.HasSynced(), qt.IsTrue)
+
+	db, ok := cache.Database("db-1")
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(db.State, qt.Equals, "ready")
+	c.Assert(cache.Databases(), qt.HasLen, 2)
+	c.Assert(names(cache.DatabasesByState("pending")), qt.DeepEquals, []string{"db-2"})
+
+	b, ok := cache.Branch("db-1", "feature-a")
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(b.ParentBranch, qt.Equals, "main")
+
+	_, ok = cache.Branch("db-2", "main")
+	c.Assert(ok, qt.IsFalse)
+
+	c.Assert(branchNames(cache.Branches("db-1")), qt.DeepEquals, []string{"feature-a", "feature-b", "main"})
+	c.Assert(branchNames(cache.BranchesByParent("db-1", "main")), qt.DeepEquals, []string{"feature-a", "feature-b"})
+	c.Assert(branchNames(cache.BranchesByStatus("db-1", "pending")), qt.DeepEquals, []string{"feature-b"})
+
+	dr, ok := cache.DeployRequest("db-1", 2)
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(dr.Branch, qt.Equals, "feature-b")
+	c.Assert(cache.DeployRequests("db-1"), qt.HasLen, 2)
+	c.Assert(cache.DeployRequestsByState("db-1", "open"), qt.DeepEquals, []*ps.DeployRequest{dr})
+
+	// changes are picked up in the background
+	api.update(func() {
+		api.dbs = api.dbs[:1]
+		api.branches["db-1"] = []*ps.DatabaseBranch{
+			{Name: "main", Status: "ready"},
+			{Name: "feature-b", ParentBranch: "main", Status: "ready"},
+		}
+	})
+
+	waitFor(c, func() bool {
+		_, ok := cache.Database("db-2")
+		return !ok && len(cache.BranchesByStatus("db-1", "pending")) == 0
+	})
+
+	c.Assert(branchNames(cache.BranchesByParent("db-1", "main")), qt.DeepEquals, []string{"feature-b"})
+}
+
+func TestNew_missingConfig(t *testing.T) {
+	c := qt.New(t)
+
+	_, err := New(&Config{Organization: "my-org"})
+	c.Assert(err, qt.ErrorMatches, "planetscale Client is not set")
+
+	client, err := ps.NewClient()
+	c.Assert(err, qt.IsNil)
+
+	_, err = New(&Config{Client: client})
+	c.Assert(err, qt.ErrorMatches, "organization is not set")
+}
+
+func waitFor(c *qt.C, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			c.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func names(dbs []*ps.Database) []string {
+	var out []string
+	for _, db := range dbs {
+		out = append(out, db.Name)
+	}
+	return out
+}
+
+func branchNames(branches []*ps.DatabaseBranch) []string {
+	var out []string
+	for _, b := range branches {
+		out = append(out, b.Name)
+	}
+	return out
+}
@@ -0,0 +1,203 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	cacheControlHeader   = "Cache-Control"
+)
+
+// CallOption overrides the client configuration for a single API call. Call
+// options are attached to the context passed to the service methods with
+// WithCallOptions.
+type CallOption func(o *callOptions)
+
+type callOptions struct {
+	timeout        time.Duration
+	header         http.Header
+	idempotencyKey string
+	retryPolicy    *RetryPolicy
+	noCache        bool
+}
+
+type callOptionsKey struct{}
+
+// WithCallOptions returns a copy of ctx that carries the given call options.
+// Options already attached to ctx are kept, unless they are overridden by
+// opts.
+//
+//	ctx := planetscale.WithCallOptions(ctx, planetscale.CallTimeout(5*time.Minute))
+//	dr, err := client.DeployRequests.Deploy(ctx, deployReq)
+func WithCallOptions(ctx context.Context, opts ...CallOption) context.Context {
+	o := callOptionsFromContext(ctx)
+
+	// copy the header so the parent context isn't modified
+	header := make(http.Header, len(o.header))
+	for k, v := range o.header {
+		header[k] = append([]string(nil), v...)
+	}
+	o.header = header
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return context.WithValue(ctx, callOptionsKey{}, o)
+}
+
+func callOptionsFromContext(ctx context.Context) callOptions {
+	o, _ := ctx.Value(callOptionsKey{}).(callOptions)
+	return o
+}
+
+// CallTimeout sets the timeout for the call, including all retries.
+func CallTimeout(d time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = d
+	}
+}
+
+// CallHeader adds an extra HTTP header to the request.
+func CallHeader(key, value string) CallOption {
+	return func(o *callOptions) {
+		o.header.Add(key, value)
+	}
+}
+
+// CallIdempotencyKey sets the idempotency key of the request. Requests with
+// non-idempotent methods, such as POST, are only retried if an idempotency
+// key is set.
+func CallIdempotencyKey(key string) CallOption {
+	return func(o *callOptions) {
+		o.idempotencyKey = key
+	}
+}
+
+// CallRetryPolicy overrides the retry policy of the client for the call. Use
+// NoRetry to disable retries.
+func CallRetryPolicy(policy *RetryPolicy) CallOption {
+	return func(o *callOptions) {
+		o.retryPolicy = policy
+	}
+}
+
+// CallNoCache asks the API and any intermediate caches to not serve a cached
+// response for the call.
+func CallNoCache() CallOption {
+	return func(o *callOptions) {
+		o.noCache = true
+	}
+}
+
+// apply sets the headers defined by the call options on the request.
+func (o callOptions) apply(req *http.Request) {
+	for k, v := range o.header {
+		for _, vv := range v {
+			req.Header.Add(k, vv)
+		}
+	}
+
+	if o.idempotencyKey != "" {
+		req.Header.Set(idempotencyKeyHeader, o.idempotencyKey)
+	}
+
+	if o.noCache {
+		req.Header.Set(cacheControlHeader, "no-cache")
+	}
+}
+
+// RetryPolicy defines if and how failed requests are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	// one. A value of 1 or less disables retries.
+	MaxAttempts int
+
+	// MinBackoff is the time to wait before the first retry. It's doubled
+	// for every subsequent retry.
+	MinBackoff time.Duration
+
+	// MaxBackoff caps the time to wait between retries.
+	MaxBackoff time.Duration
+
+	// ShouldRetry reports whether a request should be retried. If nil,
+	// requests are retried on network errors and on 429, 502, 503 and 504
+	// responses.
+	ShouldRetry func(res *http.Response, err error) bool
+}
+
+// NoRetry is a retry policy that disables retries.
+var NoRetry = &RetryPolicy{MaxAttempts: 1}
+
+func (p *RetryPolicy) shouldRetry(req *http.Request, res *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+
+	// only retry requests that are safe to repeat
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+	default:
+		if req.Header.Get(idempotencyKeyHeader) == "" {
+			return false
+		}
+	}
+
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+
+	// errors created by the client itself are final
+	var psErr *Error
+	if errors.As(err, &psErr) {
+		return false
+	}
+
+	if p.ShouldRetry != nil {
+		return p.ShouldRetry(res, err)
+	}
+
+	if err != nil {
+		return true
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// backoff returns the time to wait before the given retry. The Retry-After
+// header of the response takes precedence if present. Both are capped by
+// MaxBackoff.
+func (p *RetryPolicy) backoff(retry int, res *http.Response) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+	}
+
+	if res != nil {
+		if s, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && s >= 0 {
+			d = time.Duration(s) * time.Second
+		}
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	return d
+}
@@ -0,0 +1,143 @@
+package planetscale
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestCallOptions_headers(t *testing.T) {
+	c := qt.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("X-Foo"), qt.Equals, "bar")
+		c.Assert(r.Header.Get("X-Parent"), qt.Equals, "parent")
+		c.Assert(r.Header.Get("Idempotency-Key"), qt.Equals, "my-key")
+		c.Assert(r.Header.Get("Cache-Control"), qt.Equals, "no-cache")
+		w.WriteHeader(200)
+		_, err := w.Write([]byte(`{}`))
+		c.Assert(err, qt.IsNil)
+	}))
+	t.Cleanup(ts.Close)
+
+	client, err := NewClient(WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx := WithCallOptions(context.Background(), CallHeader("X-Parent", "parent"))
+	ctx = WithCallOptions(ctx,
+		CallHeader("X-Foo", "bar"),
+		CallIdempotencyKey("my-key"),
+		CallNoCache(),
+	)
+
+	_, err = client.Databases.Create(ctx, &CreateDatabaseRequest{
+		Organization: "my-org",
+		Name:         "my-db",
+	})
+	c.Assert(err, qt.IsNil)
+}
+
+func TestCallOptions_timeout(t *testing.T) {
+	c := qt.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.WriteHeader(200)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	client, err := NewClient(WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx := WithCallOptions(context.Background(), CallTimeout(10*time.Millisecond))
+	_, err = client.Databases.Get(ctx, &GetDatabaseRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+	})
+	c.Assert(err, qt.ErrorMatches, ".*context deadline exceeded.*")
+}
+
+func TestCallOptions_retryPolicy(t *testing.T) {
+	c := qt.New(t)
+
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			body, err := ioutil.ReadAll(r.Body)
+			c.Assert(err, qt.IsNil)
+			if r.Method == http.MethodPost {
+				c.Assert(string(body), qt.Contains, `"name":"my-db"`)
+			}
+		}
+
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"code":"unavailable","message":"unavailable"}`))
+			return
+		}
+
+		w.WriteHeader(200)
+		_, _ = w.Write([]byte(`{"name":"my-db"}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	client, err := NewClient(
+		WithBaseURL(ts.URL),
+		WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}),
+	)
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	getReq := &GetDatabaseRequest{Organization: "my-org", Database: "my-db"}
+
+	db, err := client.Databases.Get(ctx, getReq)
+	c.Assert(err, qt.IsNil)
+	c.Assert(db.Name, qt.Equals, "my-db")
+	c.Assert(atomic.LoadInt32(&calls), qt.Equals, int32(3))
+
+	// retries can be disabled per call
+	atomic.StoreInt32(&calls, 0)
+	_, err = client.Databases.Get(WithCallOptions(ctx, CallRetryPolicy(NoRetry)), getReq)
+	c.Assert(err, qt.ErrorMatches, "unavailable")
+	c.Assert(atomic.LoadInt32(&calls), qt.Equals, int32(1))
+
+	// POST requests are only retried with an idempotency key
+	createReq := &CreateDatabaseRequest{Organization: "my-org", Name: "my-db"}
+
+	atomic.StoreInt32(&calls, 0)
+	_, err = client.Databases.Create(ctx, createReq)
+	c.Assert(err, qt.ErrorMatches, "unavailable")
+	c.Assert(atomic.LoadInt32(&calls), qt.Equals, int32(1))
+
+	atomic.StoreInt32(&calls, 0)
+	_, err = client.Databases.Create(WithCallOptions(ctx, CallIdempotencyKey("create-my-db")), createReq)
+	c.Assert(err, qt.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), qt.Equals, int32(3))
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	c := qt.New(t)
+
+	p := &RetryPolicy{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	c.Assert(p.backoff(1, nil), qt.Equals, time.Second)
+	c.Assert(p.backoff(2, nil), qt.Equals, 2*time.Second)
+	c.Assert(p.backoff(3, nil), qt.Equals, 4*time.Second)
+	c.Assert(p.backoff(4, nil), qt.Equals, 5*time.Second)
+
+	res := &http.Response{Header: http.Header{"Retry-After": []string{"3"}}}
+	c.Assert(p.backoff(1, res), qt.Equals, 3*time.Second)
+
+	// the server can't make a call wait longer than MaxBackoff
+	res = &http.Response{Header: http.Header{"Retry-After": []string{"86400"}}}
+	c.Assert(p.backoff(1, res), qt.Equals, 5*time.Second)
+}
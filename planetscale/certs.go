@@ -105,6 +105,13 @@ func (c *certificatesService) Create(ctx context.Context, r *CreateCertificateRe
 		return nil, err
 	}
 
+	if c.client.DryRun() {
+		return nil, &Error{
+			msg:  "certificates can't be created in dry-run mode",
+			Code: ErrInvalid,
+		}
+	}
+
 	caCert, err := parseCert(cr.CertificateChain)
 	if err != nil {
 		return nil, fmt.Errorf("parsing certificate chain failed: %s", err)
@@ -0,0 +1,332 @@
+// Package chaos provides an http.RoundTripper that injects faults into the
+// requests of a PlanetScale client, to test how automation built on top of
+// the client copes with a failing API.
+//
+//	t, err := chaos.New(&chaos.Config{
+//		Seed: 42,
+//		Rules: []*chaos.Rule{
+//			{Path: "/v1/organizations/*/databases", Fault: chaos.ServerError, Probability: 0.2},
+//			{Fault: chaos.Latency, Latency: 500 * time.Millisecond, Probability: 0.5},
+//		},
+//	})
+//	client, err := planetscale.NewClient(
+//		planetscale.WithHTTPClient(&http.Client{Transport: t}),
+//	)
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Fault defines the kind of fault a Rule injects.
+type Fault string
+
+const (
+	Latency        Fault = "latency"         // Request is delayed before it's sent.
+	ServerError    Fault = "server_error"    // Request fails with a 5xx response.
+	MalformedBody  Fault = "malformed_body"  // Response body is truncated.
+	DropConnection Fault = "drop_connection" // Connection is reset.
+	RateLimit      Fault = "rate_limit"      // Request fails with a 429 response.
+)
+
+// Rule injects a fault into the requests it matches.
+type Rule struct {
+	// Method matches the HTTP method of the request. Empty matches all
+	// methods.
+	Method string
+
+	// Path matches the URL path of the request, using the syntax of
+	// path.Match, e.g. "/v1/organizations/*/databases/*/branches". Empty
+	// matches all paths.
+	Path string
+
+	// Fault is the kind of fault to inject.
+	Fault Fault
+
+	// Probability is the chance, greater than 0 and at most 1, that the
+	// fault is injected into a matching request. It must be set: New rejects
+	// rules with a zero probability, which would never inject their fault.
+	Probability float64
+
+	// Times limits how often the fault is injected. Zero means no limit.
+	Times int
+
+	// Latency is the delay injected by a Latency rule.
+	Latency time.Duration
+
+	// StatusCode is the status of the response injected by a ServerError
+	// rule. Defaults to 500.
+	StatusCode int
+
+	// RetryAfter is the value of the Retry-After header of the response
+	// injected by a RateLimit rule. It's rounded up to full seconds and
+	// omitted if zero.
+	RetryAfter time.Duration
+
+	// AfterSend makes a DropConnection rule send the request before the
+	// connection is reset, so the API handles the request but the response
+	// is lost.
+	AfterSend bool
+}
+
+// Injection describes a fault that was injected into a request.
+type Injection struct {
+	Rule   *Rule
+	Method string
+	Path   string
+}
+
+// Config defines the configuration of a Transport.
+type Config struct {
+	// Rules are evaluated in order for every request. Latency rules delay
+	// the request and evaluation continues, the first other rule that
+	// fires ends the evaluation.
+	Rules []*Rule
+
+	// Seed seeds the random number generator that decides whether a rule
+	// fires. The same seed and sequence of requests inject the same faults.
+	Seed int64
+
+	// Transport sends the requests. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// OnInject is called for every injected fault.
+	OnInject func(*Injection)
+}
+
+// Transport is an http.RoundTripper that injects faults into requests
+// according to a set of rules.
+type Transport struct {
+	cfg  Config
+	base http.RoundTripper
+
+	mu     sync.Mutex
+	rng    *rand.Rand
+	counts map[*Rule]int
+	stats  map[Fault]int
+}
+
+var _ http.RoundTripper = &Transport{}
+
+// New returns a new Transport with the given configuration.
+func New(cfg *Config) (*Transport, error) {
+	for i, r := range cfg.Rules {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %s", i, err)
+		}
+	}
+
+	base := cfg.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{
+		cfg:    *cfg,
+		base:   base,
+		rng:    rand.New(rand.NewSource(cfg.Seed)),
+		counts: make(map[*Rule]int),
+		stats:  make(map[Fault]int),
+	}, nil
+}
+
+func (r *Rule) validate() error {
+	switch r.Fault {
+	case Latency, ServerError, MalformedBody, DropConnection, RateLimit:
+	default:
+		return fmt.Errorf("unknown fault %q", r.Fault)
+	}
+
+	if r.Probability == 0 {
+		return fmt.Errorf("probability is not set, the %s fault would never be injected", r.Fault)
+	}
+
+	if r.Probability < 0 || r.Probability > 1 {
+		return fmt.Errorf("probability %v is not between 0 and 1", r.Probability)
+	}
+
+	if r.Path != "" {
+		if _, err := path.Match(r.Path, ""); err != nil {
+			return fmt.Errorf("invalid path pattern %q: %s", r.Path, err)
+		}
+	}
+
+	if r.StatusCode != 0 && (r.StatusCode < 500 || r.StatusCode > 599) {
+		return fmt.Errorf("status code %d is not a 5xx status", r.StatusCode)
+	}
+
+	return nil
+}
+
+// Stats returns how often each kind of fault was injected.
+func (t *Transport) Stats() map[Fault]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make(map[Fault]int, len(t.stats))
+	for k, v := range t.stats {
+		out[k] = v
+	}
+	return out
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var delay time.Duration
+	var fault *Rule
+	for _, r := range t.cfg.Rules {
+		if !t.fire(r, req) {
+			continue
+		}
+
+		if r.Fault == Latency {
+			delay += r.Latency
+			continue
+		}
+
+		fault = r
+		break
+	}
+
+	if delay > 0 {
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+
+	if fault == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	// a RoundTripper must always close the request body, even if the
+	// request isn't sent
+	sent := fault.Fault == MalformedBody || (fault.Fault == DropConnection && fault.AfterSend)
+	if !sent && req.Body != nil {
+		req.Body.Close()
+	}
+
+	switch fault.Fault {
+	case ServerError:
+		status := fault.StatusCode
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		return newResponse(req, status, nil, `{"code":"internal","message":"injected server error"}`), nil
+	case RateLimit:
+		header := http.Header{}
+		if fault.RetryAfter > 0 {
+			secs := (fault.RetryAfter + time.Second - 1) / time.Second
+			header.Set("Retry-After", strconv.Itoa(int(secs)))
+		}
+		return newResponse(req, http.StatusTooManyRequests, header, `{"code":"rate_limited","message":"injected rate limit"}`), nil
+	case DropConnection:
+		if fault.AfterSend {
+			res, err := t.base.RoundTrip(req)
+			if err != nil {
+				return nil, err
+			}
+			res.Body.Close()
+		}
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	case MalformedBody:
+		res, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		// cutting the body in half leaves invalid JSON behind, even
+		// for an empty body
+		body = body[:len(body)/2]
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+		res.ContentLength = int64(len(body))
+		res.Header.Del("Content-Length")
+		return res, nil
+	}
+
+	return nil, fmt.Errorf("unknown fault %q", fault.Fault)
+}
+
+// fire reports whether the rule matches the request and the fault should be
+// injected.
+func (t *Transport) fire(r *Rule, req *http.Request) bool {
+	if r.Method != "" && r.Method != req.Method {
+		return false
+	}
+
+	if r.Path != "" {
+		if ok, _ := path.Match(r.Path, req.URL.Path); !ok {
+			return false
+		}
+	}
+
+	t.mu.Lock()
+	if r.Times > 0 && t.counts[r] >= r.Times {
+		t.mu.Unlock()
+		return false
+	}
+
+	// the roll is taken for every matching request, so the sequence of
+	// faults only depends on the seed and the requests
+	if t.rng.Float64() >= r.Probability {
+		t.mu.Unlock()
+		return false
+	}
+
+	t.counts[r]++
+	t.stats[r.Fault]++
+	t.mu.Unlock()
+
+	if t.cfg.OnInject != nil {
+		t.cfg.OnInject(&Injection{Rule: r, Method: req.Method, Path: req.URL.Path})
+	}
+
+	return true
+}
+
+func newResponse(req *http.Request, status int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", "application/json")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
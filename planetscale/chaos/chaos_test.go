@@ -0,0 +1,169 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+const testOrg = "my-org"
+
+func newTestClient(c *qt.C, cfg *Config, opts ...ps.ClientOption) (*ps.Client, *Transport, *int32) {
+	var received int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+		_, _ = w.Write([]byte(`{"data":[{"name":"my-db"}]}`))
+	}))
+	c.Cleanup(ts.Close)
+
+	tr, err := New(cfg)
+	c.Assert(err, qt.IsNil)
+
+	opts = append([]ps.ClientOption{
+		ps.WithBaseURL(ts.URL),
+		ps.WithHTTPClient(&http.Client{Transport: tr}),
+	}, opts...)
+	client, err := ps.NewClient(opts...)
+	c.Assert(err, qt.IsNil)
+
+	return client, tr, &received
+}
+
+func listDatabases(client *ps.Client) ([]*ps.Database, error) {
+	return client.Databases.List(context.Background(), &ps.ListDatabasesRequest{Organization: testOrg})
+}
+
+func TestTransport_serverError(t *testing.T) {
+	c := qt.New(t)
+
+	var injections []*Injection
+	client, tr, received := newTestClient(c, &Config{
+		Rules: []*Rule{
+			{Path: "/v1/organizations/*/databases", Fault: ServerError, StatusCode: 503, Probability: 1, Times: 2},
+		},
+		OnInject: func(i *Injection) { injections = append(injections, i) },
+	}, ps.WithRetryPolicy(&ps.RetryPolicy{MaxAttempts: 3}))
+
+	dbs, err := listDatabases(client)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dbs, qt.HasLen, 1)
+	c.Assert(atomic.LoadInt32(received), qt.Equals, int32(1))
+	c.Assert(tr.Stats(), qt.DeepEquals, map[Fault]int{ServerError: 2})
+	c.Assert(injections, qt.HasLen, 2)
+	c.Assert(injections[0].Method, qt.Equals, http.MethodGet)
+	c.Assert(injections[0].Path, qt.Equals, "/v1/organizations/my-org/databases")
+}
+
+func TestTransport_malformedBody(t *testing.T) {
+	c := qt.New(t)
+
+	client, _, _ := newTestClient(c, &Config{
+		Rules: []*Rule{{Fault: MalformedBody, Probability: 1}},
+	})
+
+	_, err := listDatabases(client)
+	var psErr *ps.Error
+	c.Assert(errors.As(err, &psErr), qt.IsTrue)
+	c.Assert(psErr.Code, qt.Equals, ps.ErrResponseMalformed)
+}
+
+func TestTransport_dropConnection(t *testing.T) {
+	c := qt.New(t)
+
+	client, _, received := newTestClient(c, &Config{
+		Rules: []*Rule{{Method: http.MethodGet, Fault: DropConnection, Probability: 1, AfterSend: true}},
+	})
+
+	_, err := listDatabases(client)
+	c.Assert(errors.Is(err, syscall.ECONNRESET), qt.IsTrue, qt.Commentf("err: %v", err))
+	c.Assert(atomic.LoadInt32(received), qt.Equals, int32(1))
+}
+
+func TestTransport_rateLimit(t *testing.T) {
+	c := qt.New(t)
+
+	var retryAfter string
+	client, _, _ := newTestClient(c, &Config{
+		Rules: []*Rule{{Fault: RateLimit, RetryAfter: 1500 * time.Millisecond, Probability: 1}},
+	}, ps.WithRetryPolicy(&ps.RetryPolicy{
+		MaxAttempts: 2,
+		ShouldRetry: func(res *http.Response, err error) bool {
+			retryAfter = res.Header.Get("Retry-After")
+			return false
+		},
+	}))
+
+	_, err := listDatabases(client)
+	c.Assert(err, qt.ErrorMatches, "injected rate limit")
+	c.Assert(retryAfter, qt.Equals, "2")
+}
+
+func TestTransport_latency(t *testing.T) {
+	c := qt.New(t)
+
+	client, tr, received := newTestClient(c, &Config{
+		Rules: []*Rule{
+			{Fault: Latency, Latency: time.Minute, Probability: 1},
+			{Method: http.MethodPost, Fault: ServerError, Probability: 1},
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := client.Databases.List(ctx, &ps.ListDatabasesRequest{Organization: testOrg})
+	c.Assert(errors.Is(err, context.DeadlineExceeded), qt.IsTrue, qt.Commentf("err: %v", err))
+	c.Assert(atomic.LoadInt32(received), qt.Equals, int32(0))
+	c.Assert(tr.Stats(), qt.DeepEquals, map[Fault]int{Latency: 1})
+}
+
+func TestTransport_seed(t *testing.T) {
+	c := qt.New(t)
+
+	faults := func(seed int64) []bool {
+		client, _, _ := newTestClient(c, &Config{
+			Seed:  seed,
+			Rules: []*Rule{{Fault: ServerError, Probability: 0.5}},
+		})
+
+		var out []bool
+		for i := 0; i < 20; i++ {
+			_, err := listDatabases(client)
+			out = append(out, err != nil)
+		}
+		return out
+	}
+
+	first := faults(42)
+	c.Assert(faults(42), qt.DeepEquals, first)
+	c.Assert(first, qt.Contains, true)
+	c.Assert(first, qt.Contains, false)
+}
+
+func TestNew_invalidRule(t *testing.T) {
+	c := qt.New(t)
+
+	tests := []struct {
+		rule *Rule
+		err  string
+	}{
+		{&Rule{Fault: "boom"}, `rule 0: unknown fault "boom"`},
+		{&Rule{Fault: Latency}, "rule 0: probability is not set, the latency fault would never be injected"},
+		{&Rule{Fault: Latency, Probability: 2}, "rule 0: probability 2 is not between 0 and 1"},
+		{&Rule{Fault: ServerError, Probability: 1, StatusCode: 404}, "rule 0: status code 404 is not a 5xx status"},
+		{&Rule{Fault: ServerError, Probability: 1, Path: "/v1/["}, `rule 0: invalid path pattern "/v1/\[": .*`},
+	}
+
+	for _, tt := range tests {
+		_, err := New(&Config{Rules: []*Rule{tt.rule}})
+		c.Assert(err, qt.ErrorMatches, tt.err)
+	}
+}
@@ -0,0 +1,271 @@
+// Package chatops provides an HTTP handler for Slack slash commands and
+// interactive buttons to manage deploy requests from chat:
+//
+//	/planetscale list my-db
+//	/planetscale diff my-db 12
+//	/planetscale approve my-db 12 looks good
+//	/planetscale deploy my-db 12
+//	/planetscale cancel my-db 12
+//
+// Requests are verified with the signing secret of the Slack app and every
+// command is checked against a per-user permission mapping.
+package chatops
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+const (
+	signatureHeader = "X-Slack-Signature"
+	timestampHeader = "X-Slack-Request-Timestamp"
+
+	// maxClockSkew is the maximum age of a request, to prevent replays.
+	maxClockSkew = 5 * time.Minute
+
+	maxBodySize = 1 << 20
+)
+
+// Action is an operation users can be permitted to run.
+type Action string
+
+const (
+	ActionList    Action = "list"    // List open deploy requests.
+	ActionDiff    Action = "diff"    // Show the diff of a deploy request.
+	ActionApprove Action = "approve" // Approve a deploy request.
+	ActionDeploy  Action = "deploy"  // Deploy a deploy request.
+	ActionCancel  Action = "cancel"  // Cancel a queued deployment.
+)
+
+// Everyone is the key of Config.Permissions that grants actions to all users.
+const Everyone = "*"
+
+// Config defines the configuration of a Handler.
+type Config struct {
+	// Client defines a PlanetScale client. Use planetscale.NewClient() to
+	// create a new instance.
+	Client *ps.Client
+
+	// Organization is the PlanetScale organization of the databases.
+	Organization string
+
+	// DefaultDatabase is used if a command doesn't name a database.
+	DefaultDatabase string
+
+	// SigningSecret is the signing secret of the Slack app, used to verify
+	// that requests come from Slack.
+	SigningSecret string
+
+	// Permissions maps Slack user IDs to the actions they may run. The
+	// actions of the Everyone key are granted to all users.
+	Permissions map[string][]Action
+
+	// HTTPClient posts the results of interactive buttons to Slack.
+	// Defaults to a client with a clean transport.
+	HTTPClient *http.Client
+}
+
+// Handler is an http.Handler for Slack slash commands and interactive
+// buttons.
+type Handler struct {
+	cfg        Config
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+var _ http.Handler = &Handler{}
+
+// New returns a new Handler with the given configuration.
+func New(cfg *Config) (*Handler, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("planetscale Client is not set")
+	}
+
+	if cfg.Organization == "" {
+		return nil, errors.New("organization is not set")
+	}
+
+	if cfg.SigningSecret == "" {
+		return nil, errors.New("signing secret is not set")
+	}
+
+	h := &Handler{
+		cfg:        *cfg,
+		httpClient: cfg.HTTPClient,
+		now:        time.Now,
+	}
+	if h.httpClient == nil {
+		h.httpClient = cleanhttp.DefaultClient()
+	}
+
+	return h, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "couldn't read request", http.StatusBadRequest)
+		return
+	}
+
+	if err := verify(h.cfg.SigningSecret, r.Header, body, h.now()); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return
+	}
+
+	// interactive buttons send a JSON payload, slash commands send
+	// the command as form fields
+	if payload := form.Get("payload"); payload != "" {
+		h.serveInteraction(r.Context(), w, payload)
+		return
+	}
+
+	res := h.run(r.Context(), form.Get("user_id"), form.Get("user_name"), strings.Fields(form.Get("text")))
+	writeJSON(w, res)
+}
+
+// interaction is the payload of an interactive button.
+type interaction struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+func (h *Handler) serveInteraction(ctx context.Context, w http.ResponseWriter, payload string) {
+	var in interaction
+	if err := json.Unmarshal([]byte(payload), &in); err != nil {
+		http.Error(w, "malformed payload", http.StatusBadRequest)
+		return
+	}
+
+	if in.Type != "block_actions" || len(in.Actions) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// button values are "<database> <number>"
+	a := in.Actions[0]
+	args := append([]string{a.ActionID}, strings.Fields(a.Value)...)
+	res := h.run(ctx, in.User.ID, in.User.Username, args)
+
+	// Slack ignores the response body of interactions, the result is
+	// posted to the response URL instead
+	if in.ResponseURL != "" {
+		if err := h.post(ctx, in.ResponseURL, res); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) post(ctx context.Context, url string, res *response) error {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("posting response: %s", resp.Status)
+	}
+	return nil
+}
+
+// allowed reports whether the user may run the action.
+func (h *Handler) allowed(userID string, action Action) bool {
+	for _, key := range []string{userID, Everyone} {
+		for _, a := range h.cfg.Permissions[key] {
+			if a == action {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verify checks the signature of a request as described in
+// https://api.slack.com/authentication/verifying-requests-from-slack.
+func verify(secret string, header http.Header, body []byte, now time.Time) error {
+	ts := header.Get(timestampHeader)
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid request timestamp")
+	}
+
+	age := now.Sub(time.Unix(sec, 0))
+	if age > maxClockSkew || age < -maxClockSkew {
+		return errors.New("request timestamp is too old")
+	}
+
+	got, err := hex.DecodeString(strings.TrimPrefix(header.Get(signatureHeader), "v0="))
+	if err != nil || len(got) == 0 {
+		return errors.New("missing or invalid signature")
+	}
+
+	if !hmac.Equal(got, sign(secret, ts, body)) {
+		return errors.New("signature doesn't match")
+	}
+
+	return nil
+}
+
+func sign(secret, ts string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
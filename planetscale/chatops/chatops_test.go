@@ -0,0 +1,239 @@
+package chatops
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+const testSecret = "test-signing-secret"
+
+var testNow = time.Unix(1600000000, 0)
+
+func newTestHandler(c *qt.C) (*fakeapi.Server, *ps.Client, *Handler) {
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	_, err = client.DatabaseBranches.Create(ctx, &ps.CreateDatabaseBranchRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Name:         "add-users",
+		ParentBranch: "main",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(api.SetSchema("my-org", "my-db", "add-users", map[string]string{
+		"users": "CREATE TABLE `users` (`id` bigint)",
+	}), qt.IsNil)
+
+	_, err = client.DeployRequests.Create(ctx, &ps.CreateDeployRequestRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "add-users",
+		IntoBranch:   "main",
+	})
+	c.Assert(err, qt.IsNil)
+
+	h, err := New(&Config{
+		Client:        client,
+		Organization:  "my-org",
+		SigningSecret: testSecret,
+		Permissions: map[string][]Action{
+			"U2147483697": {ActionApprove, ActionDeploy, ActionCancel},
+			Everyone:      {ActionList, ActionDiff},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+	h.now = func() time.Time { return testNow }
+
+	return api, client, h
+}
+
+// send sends a signed request with the given body to the handler.
+func send(c *qt.C, h http.Handler, body []byte) *httptest.ResponseRecorder {
+	ts := strconv.FormatInt(testNow.Unix(), 10)
+
+	req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(timestampHeader, ts)
+	req.Header.Set(signatureHeader, "v0="+hex.EncodeToString(sign(testSecret, ts, body)))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func readTestdata(c *qt.C, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	c.Assert(err, qt.IsNil)
+	return data
+}
+
+func decodeResponse(c *qt.C, w *httptest.ResponseRecorder) *response {
+	c.Assert(w.Code, qt.Equals, http.StatusOK, qt.Commentf("body: %s", w.Body))
+	res := &response{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), res), qt.IsNil)
+	return res
+}
+
+func TestHandler_list(t *testing.T) {
+	c := qt.New(t)
+	_, _, h := newTestHandler(c)
+
+	res := decodeResponse(c, send(c, h, readTestdata(c, "command_list.txt")))
+	c.Assert(res.ResponseType, qt.Equals, "ephemeral")
+	c.Assert(res.Text, qt.Equals, "Open deploy requests in my-db:\n#1 add-users → main (ready)")
+	c.Assert(res.Blocks, qt.HasLen, 3)
+	c.Assert(res.Blocks[2]["type"], qt.Equals, "actions")
+	c.Assert(res.Blocks[2]["elements"].([]interface{})[0].(map[string]interface{})["value"], qt.Equals, "my-db 1")
+}
+
+func TestHandler_approve(t *testing.T) {
+	c := qt.New(t)
+	_, client, h := newTestHandler(c)
+
+	res := decodeResponse(c, send(c, h, readTestdata(c, "command_approve.txt")))
+	c.Assert(res.ResponseType, qt.Equals, "in_channel")
+	c.Assert(res.Text, qt.Equals, "@steve approved deploy request #1 of my-db.")
+
+	dr, err := client.DeployRequests.Get(context.Background(), &ps.GetDeployRequestRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Number:       1,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(dr.Approved, qt.IsTrue)
+}
+
+func TestHandler_forbidden(t *testing.T) {
+	c := qt.New(t)
+	api, _, h := newTestHandler(c)
+
+	res := decodeResponse(c, send(c, h, readTestdata(c, "command_deploy_forbidden.txt")))
+	c.Assert(res.ResponseType, qt.Equals, "ephemeral")
+	c.Assert(res.Text, qt.Equals, "You're not allowed to deploy deploy requests.")
+
+	for _, r := range api.Requests() {
+		c.Assert(r, qt.Not(qt.Matches), "POST .*/deploy")
+	}
+}
+
+func TestHandler_interaction(t *testing.T) {
+	c := qt.New(t)
+	_, _, h := newTestHandler(c)
+
+	posted := make(chan *response, 1)
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := &response{}
+		_ = json.NewDecoder(r.Body).Decode(res)
+		posted <- res
+	}))
+	c.Cleanup(slack.Close)
+
+	var payload map[string]interface{}
+	c.Assert(json.Unmarshal(readTestdata(c, "interaction_deploy.json"), &payload), qt.IsNil)
+	payload["response_url"] = slack.URL
+	data, err := json.Marshal(payload)
+	c.Assert(err, qt.IsNil)
+
+	body := url.Values{"payload": {string(data)}}.Encode()
+	w := send(c, h, []byte(body))
+	c.Assert(w.Code, qt.Equals, http.StatusOK)
+
+	res := <-posted
+	c.Assert(res.ResponseType, qt.Equals, "in_channel")
+	c.Assert(res.Text, qt.Equals, "@steve started deploying deploy request #1 of my-db into main.")
+
+	// the deployment is queued and can be cancelled
+	w = send(c, h, []byte(url.Values{
+		"user_id":   {"U2147483697"},
+		"user_name": {"steve"},
+		"text":      {"cancel my-db 1"},
+	}.Encode()))
+	res = decodeResponse(c, w)
+	c.Assert(res.Text, qt.Equals, "@steve cancelled the deployment of deploy request #1 of my-db.")
+}
+
+func TestHandler_commands(t *testing.T) {
+	c := qt.New(t)
+	_, _, h := newTestHandler(c)
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"diff my-db 1", "Schema changes of deploy request #1 of my-db:\n*users*\n```CREATE TABLE `users` (`id` bigint)```"},
+		{"diff my-db", "Invalid command: deploy request number is missing.\n" + usage},
+		{"diff 1", "Invalid command: database is missing.\n" + usage},
+		{"diff my-db abc", "Invalid command: invalid deploy request number \"abc\".\n" + usage},
+		{"diff my-db 42", "Couldn't diff deploy request #42 of my-db: Not Found"},
+		{"drop my-db", "Unknown command `drop`.\n" + usage},
+		{"", usage},
+	}
+
+	for _, tt := range tests {
+		w := send(c, h, []byte(url.Values{"user_id": {"U1"}, "text": {tt.text}}.Encode()))
+		res := decodeResponse(c, w)
+		c.Assert(res.Text, qt.Equals, tt.want, qt.Commentf("command: %q", tt.text))
+	}
+}
+
+func TestHandler_signature(t *testing.T) {
+	c := qt.New(t)
+	_, _, h := newTestHandler(c)
+
+	body := readTestdata(c, "command_list.txt")
+	ts := strconv.FormatInt(testNow.Unix(), 10)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		want      string
+	}{
+		{"missing signature", ts, "", "missing or invalid signature\n"},
+		{"wrong secret", ts, "v0=" + hex.EncodeToString(sign("other-secret", ts, body)), "signature doesn't match\n"},
+		{"replayed", strconv.FormatInt(testNow.Add(-10*time.Minute).Unix(), 10), "", "request timestamp is too old\n"},
+		{"missing timestamp", "", "", "missing or invalid request timestamp\n"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader(body))
+		req.Header.Set(timestampHeader, tt.timestamp)
+		req.Header.Set(signatureHeader, tt.signature)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		c.Assert(w.Code, qt.Equals, http.StatusUnauthorized, qt.Commentf(tt.name))
+		c.Assert(w.Body.String(), qt.Equals, tt.want, qt.Commentf(tt.name))
+	}
+}
+
+func TestVerify_slackExample(t *testing.T) {
+	c := qt.New(t)
+
+	// example from Slack's documentation on verifying requests
+	body := []byte("token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c")
+	header := http.Header{}
+	header.Set(timestampHeader, "1531420618")
+	header.Set(signatureHeader, "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503")
+
+	err := verify("8f742231b10e8888abcd99yyyzzz85a5", header, body, time.Unix(1531420618, 0))
+	c.Assert(err, qt.IsNil)
+}
@@ -0,0 +1,261 @@
+package chatops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+const usage = "Usage:\n" +
+	"`list [database]` lists open deploy requests\n" +
+	"`diff [database] <number>` shows the schema diff of a deploy request\n" +
+	"`approve [database] <number> [comment]` approves a deploy request\n" +
+	"`deploy [database] <number>` deploys a deploy request\n" +
+	"`cancel [database] <number>` cancels a queued deployment"
+
+// response is a Slack message.
+type response struct {
+	ResponseType string                   `json:"response_type"`
+	Text         string                   `json:"text"`
+	Blocks       []map[string]interface{} `json:"blocks,omitempty"`
+}
+
+// ephemeral returns a message only the user who ran the command sees.
+func ephemeral(format string, args ...interface{}) *response {
+	return &response{ResponseType: "ephemeral", Text: fmt.Sprintf(format, args...)}
+}
+
+// inChannel returns a message everyone in the channel sees.
+func inChannel(format string, args ...interface{}) *response {
+	return &response{ResponseType: "in_channel", Text: fmt.Sprintf(format, args...)}
+}
+
+// run runs a command and returns the message to respond with. Errors are
+// reported to the user as messages.
+func (h *Handler) run(ctx context.Context, userID, userName string, args []string) *response {
+	if len(args) == 0 || args[0] == "help" {
+		return ephemeral(usage)
+	}
+
+	action := Action(args[0])
+	switch action {
+	case ActionList, ActionDiff, ActionApprove, ActionDeploy, ActionCancel:
+	default:
+		return ephemeral("Unknown command `%s`.\n%s", args[0], usage)
+	}
+
+	if !h.allowed(userID, action) {
+		return ephemeral("You're not allowed to %s deploy requests.", action)
+	}
+
+	if action == ActionList {
+		db := h.cfg.DefaultDatabase
+		if len(args) > 1 {
+			db = args[1]
+		}
+		if db == "" {
+			return ephemeral(usage)
+		}
+		return h.list(ctx, db)
+	}
+
+	db, number, rest, err := h.parseTarget(args[1:])
+	if err != nil {
+		return ephemeral("Invalid command: %s.\n%s", err, usage)
+	}
+
+	var res *response
+	switch action {
+	case ActionDiff:
+		res, err = h.diff(ctx, db, number)
+	case ActionApprove:
+		res, err = h.approve(ctx, db, number, userName, strings.Join(rest, " "))
+	case ActionDeploy:
+		res, err = h.deploy(ctx, db, number, userName)
+	case ActionCancel:
+		res, err = h.cancel(ctx, db, number, userName)
+	}
+	if err != nil {
+		return ephemeral("Couldn't %s deploy request #%d of %s: %s", action, number, db, err)
+	}
+
+	return res
+}
+
+// parseTarget parses "[database] <number> [rest...]".
+func (h *Handler) parseTarget(args []string) (string, uint64, []string, error) {
+	db := h.cfg.DefaultDatabase
+	if len(args) > 0 {
+		if _, err := strconv.ParseUint(args[0], 10, 64); err != nil {
+			db, args = args[0], args[1:]
+		}
+	}
+
+	if db == "" {
+		return "", 0, nil, errors.New("database is missing")
+	}
+
+	if len(args) == 0 {
+		return "", 0, nil, errors.New("deploy request number is missing")
+	}
+
+	number, err := strconv.ParseUint(strings.TrimPrefix(args[0], "#"), 10, 64)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("invalid deploy request number %q", args[0])
+	}
+
+	return db, number, args[1:], nil
+}
+
+func (h *Handler) list(ctx context.Context, db string) *response {
+	drs, err := h.cfg.Client.DeployRequests.List(ctx, &ps.ListDeployRequestsRequest{
+		Organization: h.cfg.Organization,
+		Database:     db,
+	})
+	if err != nil {
+		return ephemeral("Couldn't list deploy requests of %s: %s", db, err)
+	}
+
+	res := ephemeral("No open deploy requests in %s.", db)
+	for _, dr := range drs {
+		if dr.State != "open" {
+			continue
+		}
+
+		if res.Blocks == nil {
+			res.Text = fmt.Sprintf("Open deploy requests in %s:", db)
+			res.Blocks = append(res.Blocks, section(res.Text))
+		}
+
+		state := "no deployment"
+		if dr.Deployment != nil {
+			state = dr.Deployment.State
+		}
+		approved := ""
+		if dr.Approved {
+			approved = ", approved"
+		}
+
+		res.Text += fmt.Sprintf("\n#%d %s → %s (%s%s)", dr.Number, dr.Branch, dr.IntoBranch, state, approved)
+		res.Blocks = append(res.Blocks,
+			section(fmt.Sprintf("*#%d* `%s` → `%s` (%s%s)", dr.Number, dr.Branch, dr.IntoBranch, state, approved)),
+			buttons(fmt.Sprintf("%s %d", db, dr.Number), ActionDiff, ActionApprove, ActionDeploy),
+		)
+	}
+
+	return res
+}
+
+func (h *Handler) diff(ctx context.Context, db string, number uint64) (*response, error) {
+	diffs, err := h.cfg.Client.DeployRequests.Diff(ctx, &ps.DiffRequest{
+		Organization: h.cfg.Organization,
+		Database:     db,
+		Number:       number,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(diffs) == 0 {
+		return ephemeral("Deploy request #%d of %s has no schema changes.", number, db), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Schema changes of deploy request #%d of %s:", number, db)
+	for _, d := range diffs {
+		fmt.Fprintf(&b, "\n*%s*\n```%s```", d.Name, strings.TrimSpace(d.Raw))
+	}
+
+	return ephemeral("%s", b.String()), nil
+}
+
+func (h *Handler) approve(ctx context.Context, db string, number uint64, userName, comment string) (*response, error) {
+	body := fmt.Sprintf("Approved by @%s in chat", userName)
+	if comment != "" {
+		body += ": " + comment
+	}
+
+	_, err := h.cfg.Client.DeployRequests.CreateReview(ctx, &ps.ReviewDeployRequestRequest{
+		Organization: h.cfg.Organization,
+		Database:     db,
+		Number:       number,
+		CommentText:  body,
+		ReviewAction: ps.ReviewApprove,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return inChannel("@%s approved deploy request #%d of %s.", userName, number, db), nil
+}
+
+func (h *Handler) deploy(ctx context.Context, db string, number uint64, userName string) (*response, error) {
+	dr, err := h.cfg.Client.DeployRequests.Deploy(ctx, &ps.PerformDeployRequest{
+		Organization: h.cfg.Organization,
+		Database:     db,
+		Number:       number,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := inChannel("@%s started deploying deploy request #%d of %s into %s.", userName, number, db, dr.IntoBranch)
+	res.Blocks = []map[string]interface{}{
+		section(res.Text),
+		buttons(fmt.Sprintf("%s %d", db, number), ActionCancel),
+	}
+	return res, nil
+}
+
+func (h *Handler) cancel(ctx context.Context, db string, number uint64, userName string) (*response, error) {
+	_, err := h.cfg.Client.DeployRequests.CancelDeploy(ctx, &ps.CancelDeployRequestRequest{
+		Organization: h.cfg.Organization,
+		Database:     db,
+		Number:       number,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return inChannel("@%s cancelled the deployment of deploy request #%d of %s.", userName, number, db), nil
+}
+
+var buttonLabels = map[Action]string{
+	ActionDiff:    "Diff",
+	ActionApprove: "Approve",
+	ActionDeploy:  "Deploy",
+	ActionCancel:  "Cancel",
+}
+
+func section(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "section",
+		"text": map[string]interface{}{"type": "mrkdwn", "text": text},
+	}
+}
+
+// buttons returns an actions block with a button per action. Clicking a
+// button runs the action with the value as arguments.
+func buttons(value string, actions ...Action) map[string]interface{} {
+	var elements []interface{}
+	for _, a := range actions {
+		elements = append(elements, map[string]interface{}{
+			"type":      "button",
+			"action_id": string(a),
+			"value":     value,
+			"text": map[string]interface{}{
+				"type": "plain_text",
+				"text": buttonLabels[a],
+			},
+		})
+	}
+
+	return map[string]interface{}{
+		"type":     "actions",
+		"elements": elements,
+	}
+}
@@ -0,0 +1,358 @@
+// Package ci provides the steps CI jobs commonly run against PlanetScale for
+// a pull request: creating a preview branch, commenting the schema diff,
+// opening a deploy request and tearing everything down once the pull request
+// is closed.
+//
+//	env, err := ci.LoadEnv()
+//	r, err := ci.New(&ci.Config{
+//		Client:       client,
+//		Organization: "my-org",
+//		Database:     "my-db",
+//		Env:          env,
+//		Output:       ci.NewOutput(env, os.Stdout),
+//		Commenter:    &ci.GitHubCommenter{Token: os.Getenv("GITHUB_TOKEN")},
+//	})
+//	err = r.Run(ctx)
+package ci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+const (
+	defaultBranchPrefix = "pr-"
+	defaultParentBranch = "main"
+
+	// commentMarker identifies the schema diff comment on the pull request.
+	commentMarker = "planetscale-ci:schema-diff"
+)
+
+// Config defines the configuration of a Runner.
+type Config struct {
+	// Client defines a PlanetScale client. Use planetscale.NewClient() to
+	// create a new instance.
+	Client *ps.Client
+
+	// Organization and Database are the PlanetScale database the pull
+	// requests change.
+	Organization string
+	Database     string
+
+	// Env is the pull request the job runs for. Use LoadEnv to read it
+	// from the environment.
+	Env *Env
+
+	// Output publishes outputs and summaries. Use NewOutput to create the
+	// output of the CI system. Outputs are discarded if nil.
+	Output Output
+
+	// Commenter posts the schema diff to the pull request. If nil, the
+	// diff is only added to the job summary.
+	Commenter Commenter
+
+	// BranchPrefix is prefixed to the pull request number to name the
+	// preview branch. Defaults to "pr-".
+	BranchPrefix string
+
+	// ParentBranch is the branch preview branches are created from and
+	// deploy requests are opened against. Defaults to "main".
+	ParentBranch string
+
+	// PollInterval is the interval to check whether a new preview branch is
+	// ready. Defaults to 2 seconds.
+	PollInterval time.Duration
+}
+
+// Runner runs the CI steps for a pull request.
+type Runner struct {
+	cfg Config
+}
+
+// New returns a new Runner with the given configuration.
+func New(cfg *Config) (*Runner, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("planetscale Client is not set")
+	}
+
+	if cfg.Organization == "" {
+		return nil, errors.New("organization is not set")
+	}
+
+	if cfg.Database == "" {
+		return nil, errors.New("database is not set")
+	}
+
+	if cfg.Env == nil {
+		return nil, errors.New("CI environment is not set")
+	}
+
+	r := &Runner{cfg: *cfg}
+	if r.cfg.BranchPrefix == "" {
+		r.cfg.BranchPrefix = defaultBranchPrefix
+	}
+	if r.cfg.ParentBranch == "" {
+		r.cfg.ParentBranch = defaultParentBranch
+	}
+	if r.cfg.Output == nil {
+		r.cfg.Output = discardOutput{}
+	}
+
+	return r, nil
+}
+
+// Branch returns the name of the preview branch of the pull request.
+func (r *Runner) Branch() string {
+	return r.cfg.BranchPrefix + strconv.Itoa(r.cfg.Env.PRNumber)
+}
+
+// Run runs all steps for the pull request. If the pull request was closed,
+// it tears down the preview branch. Otherwise it ensures the preview branch
+// exists, comments its schema diff and, if the schema changed, opens a
+// deploy request.
+func (r *Runner) Run(ctx context.Context) error {
+	if r.cfg.Env.PRNumber == 0 {
+		return errors.New("the job doesn't run for a pull request")
+	}
+
+	if r.cfg.Env.PRClosed {
+		return r.TearDown(ctx)
+	}
+
+	if _, err := r.EnsurePreviewBranch(ctx); err != nil {
+		return err
+	}
+
+	diffs, err := r.CommentSchemaDiff(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	_, err = r.OpenDeployRequest(ctx)
+	return err
+}
+
+// EnsurePreviewBranch creates the preview branch of the pull request, unless
+// it exists already, and waits until it's ready. It sets the "branch"
+// output.
+func (r *Runner) EnsurePreviewBranch(ctx context.Context) (*ps.DatabaseBranch, error) {
+	branch := r.Branch()
+
+	b, err := r.cfg.Client.DatabaseBranches.Get(ctx, &ps.GetDatabaseBranchRequest{
+		Organization: r.cfg.Organization,
+		Database:     r.cfg.Database,
+		Branch:       branch,
+	})
+	if err != nil && !ps.IsNotFound(err) {
+		return nil, err
+	}
+
+	var op *ps.Operation
+	if b == nil {
+		op, err = r.cfg.Client.Operations.CreateBranch(ctx, &ps.CreateDatabaseBranchRequest{
+			Organization: r.cfg.Organization,
+			Database:     r.cfg.Database,
+			Name:         branch,
+			ParentBranch: r.cfg.ParentBranch,
+			Notes:        fmt.Sprintf("Preview branch of %s#%d", r.cfg.Env.Repository, r.cfg.Env.PRNumber),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("creating branch %s: %s", branch, err)
+		}
+	} else {
+		// the branch may have been created by an earlier run that didn't
+		// wait until it's ready, e.g. because it was cancelled
+		op, err = r.resumeCreateBranch(branch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	op.PollInterval = r.cfg.PollInterval
+	if err := op.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("waiting for branch %s: %s", branch, err)
+	}
+
+	res, _ := op.Result()
+	b, _ = res.(*ps.DatabaseBranch)
+
+	if err := r.cfg.Output.Set("branch", branch); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// resumeCreateBranch returns an operation that is done once the existing
+// branch is ready.
+func (r *Runner) resumeCreateBranch(branch string) (*ps.Operation, error) {
+	data, err := json.Marshal(&ps.Operation{
+		Kind:         ps.OperationCreateBranch,
+		Organization: r.cfg.Organization,
+		Database:     r.cfg.Database,
+		Branch:       branch,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.cfg.Client.Operations.Resume(data)
+}
+
+// CommentSchemaDiff renders the schema diff of the preview branch, adds it to
+// the job summary and posts it to the pull request with the Commenter. It
+// sets the "schema_changed" output.
+func (r *Runner) CommentSchemaDiff(ctx context.Context) ([]*ps.Diff, error) {
+	diffs, err := r.cfg.Client.DatabaseBranches.Diff(ctx, &ps.DiffBranchRequest{
+		Organization: r.cfg.Organization,
+		Database:     r.cfg.Database,
+		Branch:       r.Branch(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	body := RenderDiff(r.cfg.Database, r.Branch(), r.cfg.Env.CommitSHA, diffs)
+	if err := r.cfg.Output.Summary(body); err != nil {
+		return nil, err
+	}
+
+	if r.cfg.Commenter != nil {
+		if err := r.cfg.Commenter.Comment(ctx, r.cfg.Env, commentMarker, body); err != nil {
+			return nil, fmt.Errorf("commenting schema diff: %s", err)
+		}
+	}
+
+	if err := r.cfg.Output.Set("schema_changed", strconv.FormatBool(len(diffs) > 0)); err != nil {
+		return nil, err
+	}
+
+	return diffs, nil
+}
+
+// OpenDeployRequest opens a deploy request from the preview branch into the
+// parent branch. An open deploy request of the preview branch is reused, as
+// it always reflects the latest schema of the branch. It sets the
+// "deploy_request_number" and "deploy_request_url" outputs.
+func (r *Runner) OpenDeployRequest(ctx context.Context) (*ps.DeployRequest, error) {
+	dr, err := r.findDeployRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if dr == nil {
+		dr, err = r.cfg.Client.DeployRequests.Create(ctx, &ps.CreateDeployRequestRequest{
+			Organization: r.cfg.Organization,
+			Database:     r.cfg.Database,
+			Branch:       r.Branch(),
+			IntoBranch:   r.cfg.ParentBranch,
+			Notes:        fmt.Sprintf("Schema changes of %s#%d", r.cfg.Env.Repository, r.cfg.Env.PRNumber),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("creating deploy request: %s", err)
+		}
+	}
+
+	if err := r.cfg.Output.Set("deploy_request_number", strconv.FormatUint(dr.Number, 10)); err != nil {
+		return nil, err
+	}
+
+	url := r.cfg.Client.DeployRequestURL(r.cfg.Organization, r.cfg.Database, dr.Number)
+	if err := r.cfg.Output.Set("deploy_request_url", url); err != nil {
+		return nil, err
+	}
+
+	return dr, nil
+}
+
+// TearDown closes the open deploy request of the preview branch and deletes
+// the branch. It succeeds if neither exists.
+func (r *Runner) TearDown(ctx context.Context) error {
+	dr, err := r.findDeployRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	if dr != nil {
+		_, err := r.cfg.Client.DeployRequests.CloseDeploy(ctx, &ps.CloseDeployRequestRequest{
+			Organization: r.cfg.Organization,
+			Database:     r.cfg.Database,
+			Number:       dr.Number,
+		})
+		if err != nil {
+			return fmt.Errorf("closing deploy request %d: %s", dr.Number, err)
+		}
+	}
+
+	err = r.cfg.Client.DatabaseBranches.Delete(ctx, &ps.DeleteDatabaseBranchRequest{
+		Organization: r.cfg.Organization,
+		Database:     r.cfg.Database,
+		Branch:       r.Branch(),
+	})
+	if err != nil && !ps.IsNotFound(err) {
+		return fmt.Errorf("deleting branch %s: %s", r.Branch(), err)
+	}
+
+	return r.cfg.Output.Summary(fmt.Sprintf("Deleted preview branch `%s` of `%s`.", r.Branch(), r.cfg.Database))
+}
+
+// findDeployRequest returns the open deploy request from the preview branch
+// into the parent branch, or nil if there is none.
+func (r *Runner) findDeployRequest(ctx context.Context) (*ps.DeployRequest, error) {
+	drs, err := r.cfg.Client.DeployRequests.List(ctx, &ps.ListDeployRequestsRequest{
+		Organization: r.cfg.Organization,
+		Database:     r.cfg.Database,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dr := range drs {
+		if dr.Branch == r.Branch() && dr.IntoBranch == r.cfg.ParentBranch && dr.State == "open" {
+			return dr, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// RenderDiff renders the schema diff of a branch as Markdown.
+func RenderDiff(database, branch, commit string, diffs []*ps.Diff) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "### Schema changes of `%s/%s`\n\n", database, branch)
+	if commit != "" {
+		fmt.Fprintf(&b, "As of commit %s.\n\n", commit)
+	}
+
+	if len(diffs) == 0 {
+		b.WriteString("No schema changes.\n")
+		return b.String()
+	}
+
+	sorted := append([]*ps.Diff(nil), diffs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	for _, d := range sorted {
+		fmt.Fprintf(&b, "#### `%s`\n\n```sql\n%s\n```\n\n", d.Name, strings.TrimSpace(d.Raw))
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+type discardOutput struct{}
+
+func (discardOutput) Set(name, value string) error  { return nil }
+func (discardOutput) Summary(markdown string) error { return nil }
@@ -0,0 +1,259 @@
+package ci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+const usersTable = "CREATE TABLE `users` (\n  `id` bigint NOT NULL\n)"
+
+type recordingOutput struct {
+	outputs   map[string]string
+	summaries []string
+}
+
+func (o *recordingOutput) Set(name, value string) error {
+	o.outputs[name] = value
+	return nil
+}
+
+func (o *recordingOutput) Summary(markdown string) error {
+	o.summaries = append(o.summaries, markdown)
+	return nil
+}
+
+// fakeGitHub stores the comments of a single pull request.
+type fakeGitHub struct {
+	mu       sync.Mutex
+	comments []*githubComment
+	auth     string
+
+	// pageSize paginates the comments if it's set.
+	pageSize int
+}
+
+func (g *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.auth = r.Header.Get("Authorization")
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/owner/repo/issues/42/comments":
+		comments := g.comments
+		if g.pageSize > 0 {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			if page < 1 {
+				page = 1
+			}
+
+			start := (page - 1) * g.pageSize
+			if start > len(comments) {
+				start = len(comments)
+			}
+			comments = comments[start:]
+			if len(comments) > g.pageSize {
+				comments = comments[:g.pageSize]
+				next := *r.URL
+				next.Scheme, next.Host = "http", r.Host
+				next.RawQuery = fmt.Sprintf("page=%d", page+1)
+				w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+			}
+		}
+		_ = json.NewEncoder(w).Encode(comments)
+	case r.Method == http.MethodPost && r.URL.Path == "/repos/owner/repo/issues/42/comments":
+		c := &githubComment{}
+		_ = json.NewDecoder(r.Body).Decode(c)
+		c.ID = int64(len(g.comments) + 1)
+		g.comments = append(g.comments, c)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(c)
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/repos/owner/repo/issues/comments/"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/repos/owner/repo/issues/comments/"), 10, 64)
+		for _, c := range g.comments {
+			if c.ID == id {
+				_ = json.NewDecoder(r.Body).Decode(c)
+				c.ID = id
+				_ = json.NewEncoder(w).Encode(c)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRunner(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL), ps.WithDashboardURL("https://app.planetscale.com/"))
+	c.Assert(err, qt.IsNil)
+
+	gh := &fakeGitHub{}
+	ghServer := httptest.NewServer(gh)
+	c.Cleanup(ghServer.Close)
+
+	env := &Env{
+		Provider:   GitHubActions,
+		Repository: "owner/repo",
+		PRNumber:   42,
+		Branch:     "add-users",
+		CommitSHA:  "abc123",
+	}
+	out := &recordingOutput{outputs: make(map[string]string)}
+
+	r, err := New(&Config{
+		Client:       client,
+		Organization: "my-org",
+		Database:     "my-db",
+		Env:          env,
+		Output:       out,
+		Commenter:    &GitHubCommenter{Token: "gh-token", BaseURL: ghServer.URL},
+		PollInterval: time.Millisecond,
+	})
+	c.Assert(err, qt.IsNil)
+
+	// the first run creates the branch, which has no changes yet
+	c.Assert(r.Run(ctx), qt.IsNil)
+	c.Assert(out.outputs, qt.DeepEquals, map[string]string{
+		"branch":         "pr-42",
+		"schema_changed": "false",
+	})
+	c.Assert(gh.comments, qt.HasLen, 1)
+	c.Assert(gh.comments[0].Body, qt.Equals, "<!-- planetscale-ci:schema-diff -->\n"+
+		"### Schema changes of `my-db/pr-42`\n\nAs of commit abc123.\n\nNo schema changes.\n")
+	c.Assert(gh.auth, qt.Equals, "Bearer gh-token")
+
+	// the schema changes on the branch, the second run opens a deploy
+	// request and updates the comment
+	c.Assert(api.SetSchema("my-org", "my-db", "pr-42", map[string]string{"users": usersTable}), qt.IsNil)
+	env.CommitSHA = "def456"
+
+	c.Assert(r.Run(ctx), qt.IsNil)
+	c.Assert(out.outputs, qt.DeepEquals, map[string]string{
+		"branch":                "pr-42",
+		"schema_changed":        "true",
+		"deploy_request_number": "1",
+		"deploy_request_url":    "https://app.planetscale.com/my-org/my-db/deploy-requests/1",
+	})
+	c.Assert(gh.comments, qt.HasLen, 1)
+	c.Assert(gh.comments[0].Body, qt.Equals, "<!-- planetscale-ci:schema-diff -->\n"+
+		"### Schema changes of `my-db/pr-42`\n\nAs of commit def456.\n\n"+
+		"#### `users`\n\n```sql\n"+usersTable+"\n```\n")
+
+	// the third run reuses the open deploy request
+	c.Assert(r.Run(ctx), qt.IsNil)
+	c.Assert(out.outputs["deploy_request_number"], qt.Equals, "1")
+
+	// closing the pull request tears everything down
+	env.PRClosed = true
+	c.Assert(r.Run(ctx), qt.IsNil)
+
+	dr, err := client.DeployRequests.Get(ctx, &ps.GetDeployRequestRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Number:       1,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(dr.State, qt.Equals, "closed")
+
+	_, err = client.DatabaseBranches.Get(ctx, &ps.GetDatabaseBranchRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "pr-42",
+	})
+	c.Assert(ps.IsNotFound(err), qt.IsTrue)
+
+	// tearing down twice is fine
+	c.Assert(r.Run(ctx), qt.IsNil)
+	c.Assert(out.summaries[len(out.summaries)-1], qt.Equals, "Deleted preview branch `pr-42` of `my-db`.")
+}
+
+func TestRunner_EnsurePreviewBranch_existing(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	// an earlier run created the branch, but it isn't ready yet
+	_, err = client.DatabaseBranches.Create(ctx, &ps.CreateDatabaseBranchRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Name:         "pr-42",
+		ParentBranch: "main",
+	})
+	c.Assert(err, qt.IsNil)
+
+	r, err := New(&Config{
+		Client:       client,
+		Organization: "my-org",
+		Database:     "my-db",
+		Env:          &Env{Provider: Generic, Repository: "owner/repo", PRNumber: 42},
+		PollInterval: time.Millisecond,
+	})
+	c.Assert(err, qt.IsNil)
+
+	b, err := r.EnsurePreviewBranch(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(b.Name, qt.Equals, "pr-42")
+	c.Assert(b.Status, qt.Equals, "ready")
+
+	// the branch was polled until it was ready
+	var polls int
+	for _, req := range api.Requests() {
+		if req == "GET /v1/organizations/my-org/databases/my-db/branches/pr-42/status" {
+			polls++
+		}
+	}
+	c.Assert(polls, qt.Equals, 2)
+}
+
+func TestRunner_notPullRequest(t *testing.T) {
+	c := qt.New(t)
+
+	client, err := ps.NewClient()
+	c.Assert(err, qt.IsNil)
+
+	r, err := New(&Config{
+		Client:       client,
+		Organization: "my-org",
+		Database:     "my-db",
+		Env:          &Env{Provider: Generic, Branch: "main"},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(r.Run(context.Background()), qt.ErrorMatches, "the job doesn't run for a pull request")
+}
+
+func TestNew_missingConfig(t *testing.T) {
+	c := qt.New(t)
+
+	client, err := ps.NewClient()
+	c.Assert(err, qt.IsNil)
+
+	_, err = New(&Config{Organization: "my-org", Database: "my-db", Env: &Env{}})
+	c.Assert(err, qt.ErrorMatches, "planetscale Client is not set")
+
+	_, err = New(&Config{Client: client, Organization: "my-org", Database: "my-db"})
+	c.Assert(err, qt.ErrorMatches, "CI environment is not set")
+}
@@ -0,0 +1,147 @@
+package ci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+const defaultGitHubAPIURL = "https://api.github.com"
+
+// Commenter posts a comment to the pull request of a CI job.
+type Commenter interface {
+	// Comment posts body to the pull request. Comments with the same
+	// marker replace each other, so repeated runs don't add a new comment
+	// every time.
+	Comment(ctx context.Context, env *Env, marker, body string) error
+}
+
+// GitHubCommenter posts comments to GitHub pull requests.
+type GitHubCommenter struct {
+	// Token is a GitHub token that can write pull request comments, e.g.
+	// the GITHUB_TOKEN of the workflow.
+	Token string
+
+	// BaseURL is the URL of the GitHub API. Defaults to
+	// https://api.github.com.
+	BaseURL string
+
+	// HTTPClient sends the requests. Defaults to a client with a clean
+	// transport.
+	HTTPClient *http.Client
+}
+
+var _ Commenter = &GitHubCommenter{}
+
+type githubComment struct {
+	ID   int64  `json:"id,omitempty"`
+	Body string `json:"body"`
+}
+
+// Comment implements Commenter.
+func (g *GitHubCommenter) Comment(ctx context.Context, env *Env, marker, body string) error {
+	if env.Repository == "" || env.PRNumber == 0 {
+		return fmt.Errorf("can't comment, the job doesn't run for a pull request")
+	}
+
+	tag := fmt.Sprintf("<!-- %s -->", marker)
+	body = tag + "\n" + body
+
+	// the existing comment can be on any page of a busy pull request
+	next := g.url(fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=100", env.Repository, env.PRNumber))
+	for next != "" {
+		var comments []*githubComment
+		header, err := g.do(ctx, http.MethodGet, next, nil, &comments)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range comments {
+			if strings.HasPrefix(c.Body, tag) {
+				url := g.url(fmt.Sprintf("/repos/%s/issues/comments/%d", env.Repository, c.ID))
+				_, err := g.do(ctx, http.MethodPatch, url, &githubComment{Body: body}, nil)
+				return err
+			}
+		}
+
+		next = nextPage(header.Get("Link"))
+	}
+
+	url := g.url(fmt.Sprintf("/repos/%s/issues/%d/comments", env.Repository, env.PRNumber))
+	_, err := g.do(ctx, http.MethodPost, url, &githubComment{Body: body}, nil)
+	return err
+}
+
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextPage returns the URL of the next page from the Link header of a list
+// response, or an empty string if it's the last page.
+func nextPage(link string) string {
+	if m := nextLink.FindStringSubmatch(link); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// url returns the URL of an API path.
+func (g *GitHubCommenter) url(path string) string {
+	baseURL := g.BaseURL
+	if baseURL == "" {
+		baseURL = defaultGitHubAPIURL
+	}
+	return strings.TrimSuffix(baseURL, "/") + path
+}
+
+// do sends a request to url and decodes the response into out. It returns
+// the header of the response.
+func (g *GitHubCommenter) do(ctx context.Context, method, url string, in, out interface{}) (http.Header, error) {
+	client := g.HTTPClient
+	if client == nil {
+		client = cleanhttp.DefaultClient()
+	}
+
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 300 {
+		return nil, fmt.Errorf("github: %s %s: %s: %s", method, url, res.Status, strings.TrimSpace(string(data)))
+	}
+
+	if out == nil {
+		return res.Header, nil
+	}
+	return res.Header, json.Unmarshal(data, out)
+}
@@ -0,0 +1,47 @@
+package ci
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestGitHubCommenter_paginated(t *testing.T) {
+	c := qt.New(t)
+
+	gh := &fakeGitHub{pageSize: 2}
+	for i := 1; i <= 5; i++ {
+		gh.comments = append(gh.comments, &githubComment{ID: int64(i), Body: fmt.Sprintf("comment %d", i)})
+	}
+	ts := httptest.NewServer(gh)
+	defer ts.Close()
+
+	env := &Env{Repository: "owner/repo", PRNumber: 42}
+	g := &GitHubCommenter{BaseURL: ts.URL}
+
+	ctx := context.Background()
+	c.Assert(g.Comment(ctx, env, "marker", "first"), qt.IsNil)
+	c.Assert(gh.comments, qt.HasLen, 6)
+
+	// the comment is on the last page, which is only found by following the
+	// links to the next pages
+	c.Assert(g.Comment(ctx, env, "marker", "second"), qt.IsNil)
+	c.Assert(gh.comments, qt.HasLen, 6)
+	c.Assert(gh.comments[5].Body, qt.Equals, "<!-- marker -->\nsecond")
+	c.Assert(gh.comments[0].Body, qt.Equals, "comment 1")
+}
+
+func TestNextPage(t *testing.T) {
+	c := qt.New(t)
+
+	link := `<https://api.github.com/repositories/1/issues/42/comments?per_page=100&page=2>; rel="next", ` +
+		`<https://api.github.com/repositories/1/issues/42/comments?per_page=100&page=3>; rel="last"`
+	c.Assert(nextPage(link), qt.Equals, "https://api.github.com/repositories/1/issues/42/comments?per_page=100&page=2")
+
+	link = `<https://api.github.com/repositories/1/issues/42/comments?per_page=100&page=1>; rel="prev"`
+	c.Assert(nextPage(link), qt.Equals, "")
+	c.Assert(nextPage(""), qt.Equals, "")
+}
@@ -0,0 +1,194 @@
+package ci
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Provider defines the CI system a job runs in.
+type Provider string
+
+const (
+	GitHubActions Provider = "github_actions" // GitHub Actions.
+	GitLabCI      Provider = "gitlab_ci"      // GitLab CI/CD.
+	Buildkite     Provider = "buildkite"      // Buildkite.
+	Generic       Provider = "generic"        // Unknown CI system, configured with PLANETSCALE_CI_* variables.
+)
+
+// Env describes the pull request a CI job runs for.
+type Env struct {
+	Provider Provider
+
+	// Repository is the repository of the pull request, e.g. "owner/repo".
+	Repository string
+
+	// PRNumber is the number of the pull request, or merge request on
+	// GitLab. It's zero if the job doesn't run for a pull request.
+	PRNumber int
+
+	// Branch is the git branch of the pull request.
+	Branch string
+
+	// BaseBranch is the git branch the pull request is merged into.
+	BaseBranch string
+
+	// CommitSHA is the commit the job runs for.
+	CommitSHA string
+
+	// PRClosed reports whether the job was triggered by closing the pull
+	// request. It's only detected on GitHub Actions and with the generic
+	// PLANETSCALE_CI_PR_CLOSED variable.
+	PRClosed bool
+}
+
+var githubPullRef = regexp.MustCompile(`^refs/pull/(\d+)/`)
+
+// LoadEnv reads the environment variables of the CI system the process runs
+// in.
+func LoadEnv() (*Env, error) {
+	return loadEnv(os.Getenv)
+}
+
+func loadEnv(getenv func(string) string) (*Env, error) {
+	var (
+		env *Env
+		err error
+	)
+
+	switch {
+	case getenv("GITHUB_ACTIONS") == "true":
+		env, err = loadGitHubEnv(getenv)
+	case getenv("GITLAB_CI") == "true":
+		env = &Env{
+			Provider:   GitLabCI,
+			Repository: getenv("CI_PROJECT_PATH"),
+			Branch:     getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME"),
+			BaseBranch: getenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME"),
+			CommitSHA:  getenv("CI_COMMIT_SHA"),
+		}
+		// merge request variables are only set in merge request pipelines
+		if env.Branch == "" {
+			env.Branch = getenv("CI_COMMIT_REF_NAME")
+		}
+		env.PRNumber, err = parseNumber("CI_MERGE_REQUEST_IID", getenv("CI_MERGE_REQUEST_IID"))
+	case getenv("BUILDKITE") == "true":
+		env = &Env{
+			Provider:   Buildkite,
+			Repository: repoPath(getenv("BUILDKITE_REPO")),
+			Branch:     getenv("BUILDKITE_BRANCH"),
+			BaseBranch: getenv("BUILDKITE_PULL_REQUEST_BASE_BRANCH"),
+			CommitSHA:  getenv("BUILDKITE_COMMIT"),
+		}
+		// BUILDKITE_PULL_REQUEST is "false" for builds of a branch
+		if pr := getenv("BUILDKITE_PULL_REQUEST"); pr != "false" {
+			env.PRNumber, err = parseNumber("BUILDKITE_PULL_REQUEST", pr)
+		}
+	default:
+		env = &Env{
+			Provider:   Generic,
+			Repository: getenv("PLANETSCALE_CI_REPOSITORY"),
+			Branch:     getenv("PLANETSCALE_CI_BRANCH"),
+			BaseBranch: getenv("PLANETSCALE_CI_BASE_BRANCH"),
+			CommitSHA:  getenv("PLANETSCALE_CI_COMMIT_SHA"),
+			PRClosed:   getenv("PLANETSCALE_CI_PR_CLOSED") == "true",
+		}
+		env.PRNumber, err = parseNumber("PLANETSCALE_CI_PR_NUMBER", getenv("PLANETSCALE_CI_PR_NUMBER"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+func loadGitHubEnv(getenv func(string) string) (*Env, error) {
+	env := &Env{
+		Provider:   GitHubActions,
+		Repository: getenv("GITHUB_REPOSITORY"),
+		Branch:     getenv("GITHUB_HEAD_REF"),
+		BaseBranch: getenv("GITHUB_BASE_REF"),
+		CommitSHA:  getenv("GITHUB_SHA"),
+	}
+
+	// GITHUB_HEAD_REF is only set for pull request events
+	if env.Branch == "" {
+		env.Branch = getenv("GITHUB_REF_NAME")
+	}
+
+	if m := githubPullRef.FindStringSubmatch(getenv("GITHUB_REF")); m != nil {
+		env.PRNumber, _ = strconv.Atoi(m[1])
+	}
+
+	// the event payload is the only place that tells why the workflow
+	// was triggered, and it has the pull request number for events that
+	// don't run on the pull request's ref, e.g. "closed"
+	path := getenv("GITHUB_EVENT_PATH")
+	if path == "" {
+		return env, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading GitHub event: %s", err)
+	}
+
+	var event struct {
+		Action      string `json:"action"`
+		PullRequest *struct {
+			Number int `json:"number"`
+			Head   struct {
+				Ref string `json:"ref"`
+				SHA string `json:"sha"`
+			} `json:"head"`
+			Base struct {
+				Ref string `json:"ref"`
+			} `json:"base"`
+		} `json:"pull_request"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("parsing GitHub event: %s", err)
+	}
+
+	if pr := event.PullRequest; pr != nil {
+		env.PRNumber = pr.Number
+		env.Branch = pr.Head.Ref
+		env.BaseBranch = pr.Base.Ref
+		// GITHUB_SHA is the merge commit for pull request events
+		env.CommitSHA = pr.Head.SHA
+		env.PRClosed = event.Action == "closed"
+	}
+
+	return env, nil
+}
+
+// repoPath returns the "owner/repo" path of a git remote URL, such as
+// "git@github.com:owner/repo.git" or "https://github.com/owner/repo.git".
+func repoPath(remote string) string {
+	path := remote
+	if u, err := url.Parse(remote); err == nil && u.Host != "" {
+		path = u.Path
+	} else if i := strings.Index(remote, ":"); i >= 0 {
+		// scp-like syntax of ssh remotes
+		path = remote[i+1:]
+	}
+
+	return strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+}
+
+func parseNumber(name, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %s", name, value, err)
+	}
+	return n, nil
+}
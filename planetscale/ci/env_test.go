@@ -0,0 +1,143 @@
+package ci
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func getenv(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestLoadEnv_github(t *testing.T) {
+	c := qt.New(t)
+
+	event := filepath.Join(c.TempDir(), "event.json")
+	err := ioutil.WriteFile(event, []byte(`{
+		"action": "closed",
+		"pull_request": {
+			"number": 42,
+			"head": {"ref": "add-users", "sha": "abc123"},
+			"base": {"ref": "main"}
+		}
+	}`), 0600)
+	c.Assert(err, qt.IsNil)
+
+	env, err := loadEnv(getenv(map[string]string{
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_REPOSITORY": "owner/repo",
+		"GITHUB_REF":        "refs/heads/main",
+		"GITHUB_REF_NAME":   "main",
+		"GITHUB_SHA":        "merge-sha",
+		"GITHUB_EVENT_PATH": event,
+	}))
+	c.Assert(err, qt.IsNil)
+	c.Assert(env, qt.DeepEquals, &Env{
+		Provider:   GitHubActions,
+		Repository: "owner/repo",
+		PRNumber:   42,
+		Branch:     "add-users",
+		BaseBranch: "main",
+		CommitSHA:  "abc123",
+		PRClosed:   true,
+	})
+}
+
+func TestLoadEnv_githubWithoutEvent(t *testing.T) {
+	c := qt.New(t)
+
+	env, err := loadEnv(getenv(map[string]string{
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_REPOSITORY": "owner/repo",
+		"GITHUB_REF":        "refs/pull/7/merge",
+		"GITHUB_HEAD_REF":   "add-users",
+		"GITHUB_BASE_REF":   "main",
+		"GITHUB_SHA":        "merge-sha",
+	}))
+	c.Assert(err, qt.IsNil)
+	c.Assert(env, qt.DeepEquals, &Env{
+		Provider:   GitHubActions,
+		Repository: "owner/repo",
+		PRNumber:   7,
+		Branch:     "add-users",
+		BaseBranch: "main",
+		CommitSHA:  "merge-sha",
+	})
+}
+
+func TestLoadEnv_gitlab(t *testing.T) {
+	c := qt.New(t)
+
+	env, err := loadEnv(getenv(map[string]string{
+		"GITLAB_CI":                           "true",
+		"CI_PROJECT_PATH":                     "group/project",
+		"CI_MERGE_REQUEST_IID":                "3",
+		"CI_MERGE_REQUEST_SOURCE_BRANCH_NAME": "add-users",
+		"CI_MERGE_REQUEST_TARGET_BRANCH_NAME": "main",
+		"CI_COMMIT_SHA":                       "abc123",
+		"CI_COMMIT_REF_NAME":                  "ignored",
+	}))
+	c.Assert(err, qt.IsNil)
+	c.Assert(env, qt.DeepEquals, &Env{
+		Provider:   GitLabCI,
+		Repository: "group/project",
+		PRNumber:   3,
+		Branch:     "add-users",
+		BaseBranch: "main",
+		CommitSHA:  "abc123",
+	})
+}
+
+func TestLoadEnv_buildkite(t *testing.T) {
+	c := qt.New(t)
+
+	env, err := loadEnv(getenv(map[string]string{
+		"BUILDKITE":              "true",
+		"BUILDKITE_REPO":         "git@github.com:owner/repo.git",
+		"BUILDKITE_BRANCH":       "main",
+		"BUILDKITE_COMMIT":       "abc123",
+		"BUILDKITE_PULL_REQUEST": "false",
+	}))
+	c.Assert(err, qt.IsNil)
+	c.Assert(env.Provider, qt.Equals, Buildkite)
+	c.Assert(env.Repository, qt.Equals, "owner/repo")
+	c.Assert(env.PRNumber, qt.Equals, 0)
+	c.Assert(env.Branch, qt.Equals, "main")
+}
+
+func TestRepoPath(t *testing.T) {
+	c := qt.New(t)
+
+	for _, remote := range []string{
+		"git@github.com:owner/repo.git",
+		"git@github.com:owner/repo",
+		"https://github.com/owner/repo.git",
+		"ssh://git@github.com/owner/repo.git",
+		"owner/repo",
+	} {
+		c.Assert(repoPath(remote), qt.Equals, "owner/repo", qt.Commentf(remote))
+	}
+}
+
+func TestLoadEnv_generic(t *testing.T) {
+	c := qt.New(t)
+
+	env, err := loadEnv(getenv(map[string]string{
+		"PLANETSCALE_CI_PR_NUMBER": "12",
+		"PLANETSCALE_CI_BRANCH":    "add-users",
+		"PLANETSCALE_CI_PR_CLOSED": "true",
+	}))
+	c.Assert(err, qt.IsNil)
+	c.Assert(env, qt.DeepEquals, &Env{
+		Provider: Generic,
+		PRNumber: 12,
+		Branch:   "add-users",
+		PRClosed: true,
+	})
+
+	_, err = loadEnv(getenv(map[string]string{"PLANETSCALE_CI_PR_NUMBER": "twelve"}))
+	c.Assert(err, qt.ErrorMatches, `invalid PLANETSCALE_CI_PR_NUMBER "twelve": .*`)
+}
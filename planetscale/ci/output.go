@@ -0,0 +1,101 @@
+package ci
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Output publishes the results of the steps in the format of the CI system.
+type Output interface {
+	// Set sets an output that later steps of the CI job can read.
+	Set(name, value string) error
+
+	// Summary adds Markdown to the summary of the CI job.
+	Summary(markdown string) error
+}
+
+// NewOutput returns the output for the CI system of env. On GitHub Actions
+// outputs and summaries are written to the files of the GITHUB_OUTPUT and
+// GITHUB_STEP_SUMMARY variables. Everywhere else outputs are written to w
+// in dotenv format, e.g. to be used as a GitLab dotenv report, and
+// summaries are written to os.Stderr.
+func NewOutput(env *Env, w io.Writer) Output {
+	if env.Provider == GitHubActions {
+		return &githubOutput{
+			outputPath:  os.Getenv("GITHUB_OUTPUT"),
+			summaryPath: os.Getenv("GITHUB_STEP_SUMMARY"),
+		}
+	}
+
+	return &dotenvOutput{w: w, summary: os.Stderr}
+}
+
+type githubOutput struct {
+	outputPath  string
+	summaryPath string
+}
+
+func (o *githubOutput) Set(name, value string) error {
+	if o.outputPath == "" {
+		return nil
+	}
+
+	// multi-line values need a delimiter that doesn't occur in the value
+	line := fmt.Sprintf("%s=%s\n", name, value)
+	if strings.ContainsAny(value, "\r\n") {
+		delim := "ghadelimiter_" + randomHex()
+		line = fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delim, value, delim)
+	}
+
+	return appendFile(o.outputPath, line)
+}
+
+func (o *githubOutput) Summary(markdown string) error {
+	if o.summaryPath == "" {
+		return nil
+	}
+
+	return appendFile(o.summaryPath, markdown+"\n")
+}
+
+type dotenvOutput struct {
+	w       io.Writer
+	summary io.Writer
+}
+
+func (o *dotenvOutput) Set(name, value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("output %s: multi-line values are not supported", name)
+	}
+
+	_, err := fmt.Fprintf(o.w, "%s=%s\n", name, value)
+	return err
+}
+
+func (o *dotenvOutput) Summary(markdown string) error {
+	_, err := fmt.Fprintln(o.summary, markdown)
+	return err
+}
+
+func appendFile(path, s string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(s); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func randomHex() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
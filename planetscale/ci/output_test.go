@@ -0,0 +1,49 @@
+package ci
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestGitHubOutput(t *testing.T) {
+	c := qt.New(t)
+
+	dir := c.TempDir()
+	o := &githubOutput{
+		outputPath:  filepath.Join(dir, "output"),
+		summaryPath: filepath.Join(dir, "summary"),
+	}
+
+	c.Assert(o.Set("branch", "pr-42"), qt.IsNil)
+	c.Assert(o.Set("diff", "line 1\nline 2"), qt.IsNil)
+	c.Assert(o.Summary("### Schema changes"), qt.IsNil)
+
+	out, err := ioutil.ReadFile(o.outputPath)
+	c.Assert(err, qt.IsNil)
+	c.Assert(regexp.MustCompile(`^branch=pr-42\n`+
+		`diff<<(ghadelimiter_[0-9a-f]+)\nline 1\nline 2\n(ghadelimiter_[0-9a-f]+)\n$`).Match(out), qt.IsTrue,
+		qt.Commentf("output: %s", out))
+
+	summary, err := ioutil.ReadFile(o.summaryPath)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(summary), qt.Equals, "### Schema changes\n")
+}
+
+func TestDotenvOutput(t *testing.T) {
+	c := qt.New(t)
+
+	var out, summary bytes.Buffer
+	o := &dotenvOutput{w: &out, summary: &summary}
+
+	c.Assert(o.Set("branch", "pr-42"), qt.IsNil)
+	c.Assert(o.Set("diff", "line 1\nline 2"), qt.ErrorMatches, "output diff: multi-line values are not supported")
+	c.Assert(o.Summary("### Schema changes"), qt.IsNil)
+
+	c.Assert(out.String(), qt.Equals, "branch=pr-42\n")
+	c.Assert(summary.String(), qt.Equals, "### Schema changes\n")
+}
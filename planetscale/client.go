@@ -5,9 +5,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/hashicorp/go-cleanhttp"
 	"golang.org/x/oauth2"
@@ -28,6 +30,8 @@ const (
 	ErrNotFound          ErrorCode = "not_found"          // Resource not found.
 	ErrRetry             ErrorCode = "retry"              // Operation should be retried.
 	ErrResponseMalformed ErrorCode = "response_malformed" // Response body is malformed.
+	ErrOperationFailed   ErrorCode = "operation_failed"   // Long-running operation finished unsuccessfully.
+	ErrCircuitOpen       ErrorCode = "circuit_open"       // Request rejected by an open circuit breaker.
 )
 
 // Client encapsulates a client that talks to the PlanetScale API
@@ -38,7 +42,32 @@ type Client struct {
 	// base URL for the API
 	baseURL *url.URL
 
+	// dashboardURL is the URL of the web app. It's derived from baseURL
+	// unless the client is created with WithDashboardURL.
+	dashboardURL *url.URL
+
+	// retryPolicy is the default retry policy. It can be overridden per
+	// call with CallRetryPolicy.
+	retryPolicy *RetryPolicy
+
+	// dryRun records mutating requests instead of sending them. It's nil
+	// unless the client is created with WithDryRun.
+	dryRun *dryRunPlan
+
+	// readOnly rejects all mutating requests at the transport.
+	readOnly bool
+
+	// breaker fails requests fast while the API is failing.
+	breaker *breaker
+
+	// hedger hedges slow GET requests.
+	hedger *hedger
+
+	// requestHook is called after every API call.
+	requestHook func(*RequestInfo)
+
 	Backups          BackupsService
+	BackupExports    BackupExportsService
 	Databases        DatabasesService
 	Certificates     CertificatesService
 	DatabaseBranches DatabaseBranchesService
@@ -46,6 +75,7 @@ type Client struct {
 	Regions          RegionsService
 	DeployRequests   DeployRequestsService
 	ServiceTokens    ServiceTokenService
+	Operations       OperationsService
 }
 
 // ClientOption provides a variadic option for configuring the client
@@ -72,6 +102,19 @@ func WithAccessToken(token string) ClientOption {
 		}
 
 		tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+		return WithTokenSource(tokenSource)(c)
+	}
+}
+
+// WithTokenSource configures a client to authenticate with the tokens
+// returned by the given token source. It can be used to plug in tokens
+// obtained via an OAuth flow, such as the device flow implemented by the auth
+// package.
+func WithTokenSource(tokenSource oauth2.TokenSource) ClientOption {
+	return func(c *Client) error {
+		if tokenSource == nil {
+			return errors.New("missing token source")
+		}
 
 		// make sure we use our own HTTP client
 		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, c.client)
@@ -112,6 +155,15 @@ func WithHTTPClient(client *http.Client) ClientOption {
 	}
 }
 
+// WithRetryPolicy configures the client to retry failed requests with the
+// given policy. By default requests are not retried.
+func WithRetryPolicy(policy *RetryPolicy) ClientOption {
+	return func(c *Client) error {
+		c.retryPolicy = policy
+		return nil
+	}
+}
+
 // NewClient instantiates an instance of the PlanetScale API client.
 func NewClient(opts ...ClientOption) (*Client, error) {
 	baseURL, err := url.Parse(DefaultBaseURL)
@@ -131,7 +183,20 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 		}
 	}
 
+	// wrap the transport last, so it's applied to the final HTTP client
+	if c.readOnly {
+		c.enforceReadOnly()
+	}
+
+	c.initServices()
+
+	return c, nil
+}
+
+// initServices sets the services of the client to their defaults.
+func (c *Client) initServices() {
 	c.Backups = &backupsService{client: c}
+	c.BackupExports = &backupExportsService{client: c}
 	c.Databases = &databasesService{client: c}
 	c.Certificates = &certificatesService{client: c}
 	c.DatabaseBranches = &databaseBranchesService{client: c}
@@ -139,20 +204,135 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 	c.Regions = &regionsService{client: c}
 	c.DeployRequests = &deployRequestsService{client: c}
 	c.ServiceTokens = &serviceTokenService{client: c}
-
-	return c, nil
+	c.Operations = &operationsService{client: c}
 }
 
 // do makes an HTTP request and populates the given struct v from the response.
+// Call options attached to ctx with WithCallOptions are honored.
 func (c *Client) do(ctx context.Context, req *http.Request, v interface{}) error {
+	requestID, ok := RequestIDFromContext(ctx)
+	if !ok {
+		requestID = newRequestID()
+	}
+	req.Header.Set(RequestIDHeader, requestID)
+
+	start := time.Now()
+	res, err := c.doRequest(ctx, req, v)
+
+	info := &RequestInfo{
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		RequestID: requestID,
+		Start:     start,
+		Duration:  time.Since(start),
+		Err:       err,
+	}
+	if res != nil {
+		info.StatusCode = res.StatusCode
+		info.ServerRequestID = res.Header.Get(RequestIDHeader)
+	}
+
+	var psErr *Error
+	if errors.As(err, &psErr) {
+		psErr.RequestID = info.RequestID
+		psErr.ServerRequestID = info.ServerRequestID
+	}
+
+	if c.requestHook != nil {
+		c.requestHook(info)
+	}
+
+	return err
+}
+
+// doRequest sends the request and populates v from the response. The
+// returned response, if any, is the one v was populated from; its body is
+// already closed.
+func (c *Client) doRequest(ctx context.Context, req *http.Request, v interface{}) (*http.Response, error) {
+	opts := callOptionsFromContext(ctx)
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+	opts.apply(req)
+
+	if c.dryRun != nil && req.Method != http.MethodGet {
+		return nil, c.dryRun.plan(req, v)
+	}
+
+	policy := c.retryPolicy
+	if opts.retryPolicy != nil {
+		policy = opts.retryPolicy
+	}
+
 	req = req.WithContext(ctx)
-	res, err := c.client.Do(req)
+
+	var done func(*http.Response, error)
+	if c.breaker != nil {
+		var err error
+		done, err = c.breaker.allow(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := c.send(req, policy)
+	if done != nil {
+		done(res, err)
+	}
 	if err != nil {
-		return err
+		// errors of our own transports, such as the read-only transport,
+		// are returned as is instead of wrapped in a *url.Error
+		var psErr *Error
+		if errors.As(err, &psErr) {
+			return nil, psErr
+		}
+		return nil, err
 	}
 	defer res.Body.Close()
 
-	return c.handleResponse(ctx, res, v)
+	return res, c.handleResponse(ctx, res, v)
+}
+
+// send sends the request and retries it according to the given policy.
+func (c *Client) send(req *http.Request, policy *RetryPolicy) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := c.roundTrip(req)
+		if policy == nil || attempt >= policy.MaxAttempts || !policy.shouldRetry(req, res, err) {
+			return res, err
+		}
+
+		wait := policy.backoff(attempt, res)
+		if res != nil {
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// roundTrip sends a single request, hedging it if enabled.
+func (c *Client) roundTrip(req *http.Request) (*http.Response, error) {
+	if c.hedger != nil && req.Method == http.MethodGet {
+		return c.hedger.do(c.client, req)
+	}
+	return c.client.Do(req)
 }
 
 // handleResponse makes an HTTP request and populates the given struct v from
@@ -304,7 +484,21 @@ type Error struct {
 	// example, if the Code is "ErrResponseMalformed", the map will be: ["body"]
 	// = "body of the response"
 	Meta map[string]string
+
+	// RequestID is the ID the client sent with the request.
+	RequestID string
+
+	// ServerRequestID is the request ID returned by the API, if any. Please
+	// include it when contacting PlanetScale support.
+	ServerRequestID string
 }
 
 // Error returns the string representation of the error.
 func (e *Error) Error() string { return e.msg }
+
+// IsNotFound reports whether err is an *Error with the ErrNotFound code, e.g.
+// because the requested resource doesn't exist.
+func IsNotFound(err error) bool {
+	var psErr *Error
+	return errors.As(err, &psErr) && psErr.Code == ErrNotFound
+}
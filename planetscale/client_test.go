@@ -2,6 +2,8 @@ package planetscale
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -113,3 +115,15 @@ func TestDo(t *testing.T) {
 		})
 	}
 }
+
+func TestIsNotFound(t *testing.T) {
+	c := qt.New(t)
+
+	err := &Error{msg: "Not Found", Code: ErrNotFound}
+	c.Assert(IsNotFound(err), qt.IsTrue)
+	c.Assert(IsNotFound(fmt.Errorf("fetching database: %w", err)), qt.IsTrue)
+
+	c.Assert(IsNotFound(&Error{msg: "Forbidden", Code: ErrPermission}), qt.IsFalse)
+	c.Assert(IsNotFound(errors.New("not found")), qt.IsFalse)
+	c.Assert(IsNotFound(nil), qt.IsFalse)
+}
@@ -0,0 +1,536 @@
+// Package clone copies a database into a new database, in the same or
+// another organization. The new database gets the branches of the source
+// database, the schema of every branch and, optionally, its data:
+//
+//	c, err := clone.New(&clone.Config{
+//		Source:             client,
+//		SourceOrganization: "my-org",
+//		SourceDatabase:     "my-db",
+//		TargetOrganization: "customer-staging",
+//		TargetDatabase:     "my-db-acme",
+//		CopyData:           true,
+//		Store:              clone.NewFileStore("clone-state.json"),
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	err = c.Run(ctx)
+//
+// Every finished step is recorded in the Store. If a clone fails, running it
+// again with the same Store resumes after the last finished step.
+package clone
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+	"github.com/planetscale/planetscale-go/planetscale/dbutil"
+)
+
+const (
+	defaultBranch    = "main"
+	defaultBatchSize = 500
+)
+
+// ConnectFunc opens a MySQL connection to a database branch.
+type ConnectFunc func(ctx context.Context, client *ps.Client, org, database, branch string) (*sql.DB, error)
+
+// Step is a step of a clone.
+type Step string
+
+const (
+	StepCreateDatabase Step = "create_database" // Target database is created.
+	StepCreateBranch   Step = "create_branch"   // Branch is created.
+	StepApplySchema    Step = "apply_schema"    // Schema of a branch is applied.
+	StepCopyData       Step = "copy_data"       // Rows of a table are copied.
+)
+
+// Progress reports the progress of a clone.
+type Progress struct {
+	Step   Step
+	Branch string
+	Table  string
+
+	// Rows is the number of copied rows, for StepCopyData.
+	Rows int
+
+	// Skipped is true if the step finished in an earlier run.
+	Skipped bool
+}
+
+// Config defines the configuration of a Cloner.
+type Config struct {
+	// Source is the client of the source database. Use
+	// planetscale.NewClient() to create a new instance.
+	Source *ps.Client
+
+	// SourceOrganization and SourceDatabase are the database to clone.
+	SourceOrganization string
+	SourceDatabase     string
+
+	// Target is the client of the target database, if it's in an
+	// organization the source client can't access. Defaults to Source.
+	Target *ps.Client
+
+	// TargetOrganization is the organization to create the clone in.
+	// Defaults to SourceOrganization.
+	TargetOrganization string
+
+	// TargetDatabase is the name of the new database.
+	TargetDatabase string
+
+	// Region is the region of the new database. Defaults to the region of
+	// the source database.
+	Region string
+
+	// CopyData copies the rows of every table after the schema is applied.
+	CopyData bool
+
+	// BatchSize is the number of rows inserted per statement. Defaults to
+	// 500, and is lowered for tables with too many columns to insert
+	// BatchSize rows with one statement.
+	BatchSize int
+
+	// Connect opens the MySQL connections to apply schemas and copy data.
+	// Defaults to dbutil.Dial.
+	Connect ConnectFunc
+
+	// Store persists the finished steps. Defaults to an in-memory store,
+	// so a failed clone can only be resumed by the same Cloner.
+	Store Store
+
+	// OnProgress is called after every step.
+	OnProgress func(*Progress)
+
+	// PollInterval is the interval to check whether the new database and
+	// branches are ready. Defaults to 2 seconds.
+	PollInterval time.Duration
+}
+
+// Cloner clones a database.
+type Cloner struct {
+	cfg Config
+}
+
+// New returns a new Cloner with the given configuration.
+func New(cfg *Config) (*Cloner, error) {
+	if cfg.Source == nil {
+		return nil, errors.New("planetscale Client is not set")
+	}
+
+	if cfg.SourceOrganization == "" {
+		return nil, errors.New("source organization is not set")
+	}
+
+	if cfg.SourceDatabase == "" {
+		return nil, errors.New("source database is not set")
+	}
+
+	if cfg.TargetDatabase == "" {
+		return nil, errors.New("target database is not set")
+	}
+
+	c := &Cloner{cfg: *cfg}
+	if c.cfg.Target == nil {
+		c.cfg.Target = c.cfg.Source
+	}
+	if c.cfg.TargetOrganization == "" {
+		c.cfg.TargetOrganization = c.cfg.SourceOrganization
+	}
+	if c.cfg.TargetOrganization == c.cfg.SourceOrganization && c.cfg.TargetDatabase == c.cfg.SourceDatabase {
+		return nil, errors.New("target database is the source database")
+	}
+	if c.cfg.BatchSize <= 0 {
+		c.cfg.BatchSize = defaultBatchSize
+	}
+	if c.cfg.Connect == nil {
+		c.cfg.Connect = dial
+	}
+	if c.cfg.Store == nil {
+		c.cfg.Store = &memoryStore{}
+	}
+
+	return c, nil
+}
+
+// Run clones the database. It creates the target database, creates the
+// branches of the source database with parents before their children,
+// applies the schema of every branch and, if enabled, copies the data.
+// Steps that finished in an earlier run are skipped.
+func (c *Cloner) Run(ctx context.Context) error {
+	state, err := c.cfg.Store.Load()
+	if err != nil {
+		return fmt.Errorf("loading clone state: %s", err)
+	}
+
+	branches, err := c.sourceBranches(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := c.createDatabase(ctx, state); err != nil {
+		return err
+	}
+
+	for _, b := range branches {
+		if err := c.createBranch(ctx, state, b); err != nil {
+			return err
+		}
+
+		if err := c.applySchema(ctx, state, b.Name); err != nil {
+			return err
+		}
+	}
+
+	if !c.cfg.CopyData {
+		return nil
+	}
+
+	for _, b := range branches {
+		if err := c.copyData(ctx, state, b.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sourceBranches returns the branches of the source database, parents
+// before their children.
+func (c *Cloner) sourceBranches(ctx context.Context) ([]*ps.DatabaseBranch, error) {
+	branches, err := c.cfg.Source.DatabaseBranches.List(ctx, &ps.ListDatabaseBranchesRequest{
+		Organization: c.cfg.SourceOrganization,
+		Database:     c.cfg.SourceDatabase,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing branches of %s: %s", c.cfg.SourceDatabase, err)
+	}
+
+	byName := make(map[string]*ps.DatabaseBranch, len(branches))
+	for _, b := range branches {
+		byName[b.Name] = b
+	}
+
+	sort.Slice(branches, func(i, j int) bool {
+		return branches[i].Name < branches[j].Name
+	})
+
+	var (
+		ordered []*ps.DatabaseBranch
+		visited = make(map[string]bool)
+	)
+
+	var visit func(b *ps.DatabaseBranch)
+	visit = func(b *ps.DatabaseBranch) {
+		if visited[b.Name] {
+			return
+		}
+		visited[b.Name] = true
+
+		if parent, ok := byName[b.ParentBranch]; ok {
+			visit(parent)
+		}
+		ordered = append(ordered, b)
+	}
+
+	// the default branch exists in every new database, create it first
+	if b, ok := byName[defaultBranch]; ok {
+		visit(b)
+	}
+	for _, b := range branches {
+		visit(b)
+	}
+
+	return ordered, nil
+}
+
+func (c *Cloner) createDatabase(ctx context.Context, state *State) error {
+	if state.DatabaseCreated {
+		c.progress(&Progress{Step: StepCreateDatabase, Skipped: true})
+		return nil
+	}
+
+	_, err := c.cfg.Target.Databases.Get(ctx, &ps.GetDatabaseRequest{
+		Organization: c.cfg.TargetOrganization,
+		Database:     c.cfg.TargetDatabase,
+	})
+	if err != nil && !ps.IsNotFound(err) {
+		return err
+	}
+
+	// an existing database is only cloned into if an earlier run created
+	// it and failed before it was ready
+	if err == nil && !state.DatabaseCreating {
+		return fmt.Errorf("database %s already exists in %s", c.cfg.TargetDatabase, c.cfg.TargetOrganization)
+	}
+
+	var op *ps.Operation
+	if err == nil {
+		op, err = c.resumeCreateDatabase()
+		if err != nil {
+			return err
+		}
+	} else {
+		region := c.cfg.Region
+		if region == "" {
+			src, err := c.cfg.Source.Databases.Get(ctx, &ps.GetDatabaseRequest{
+				Organization: c.cfg.SourceOrganization,
+				Database:     c.cfg.SourceDatabase,
+			})
+			if err != nil {
+				return err
+			}
+			region = src.Region.Slug
+		}
+
+		// saved before the database is created, so the database isn't
+		// mistaken for a foreign one if the run fails before it's ready
+		state.DatabaseCreating = true
+		if err := c.save(state); err != nil {
+			return err
+		}
+
+		op, err = c.cfg.Target.Operations.CreateDatabase(ctx, &ps.CreateDatabaseRequest{
+			Organization: c.cfg.TargetOrganization,
+			Name:         c.cfg.TargetDatabase,
+			Notes:        fmt.Sprintf("Clone of %s/%s", c.cfg.SourceOrganization, c.cfg.SourceDatabase),
+			Region:       region,
+		})
+		if err != nil {
+			return fmt.Errorf("creating database %s: %s", c.cfg.TargetDatabase, err)
+		}
+	}
+
+	op.PollInterval = c.cfg.PollInterval
+	if err := op.Wait(ctx); err != nil {
+		return fmt.Errorf("waiting for database %s: %s", c.cfg.TargetDatabase, err)
+	}
+
+	state.DatabaseCreated = true
+	if err := c.save(state); err != nil {
+		return err
+	}
+
+	c.progress(&Progress{Step: StepCreateDatabase})
+	return nil
+}
+
+// resumeCreateDatabase returns an operation that is done once the existing
+// target database is ready.
+func (c *Cloner) resumeCreateDatabase() (*ps.Operation, error) {
+	data, err := json.Marshal(&ps.Operation{
+		Kind:         ps.OperationCreateDatabase,
+		Organization: c.cfg.TargetOrganization,
+		Database:     c.cfg.TargetDatabase,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.cfg.Target.Operations.Resume(data)
+}
+
+func (c *Cloner) createBranch(ctx context.Context, state *State, b *ps.DatabaseBranch) error {
+	bs := state.branch(b.Name)
+	if bs.Created {
+		c.progress(&Progress{Step: StepCreateBranch, Branch: b.Name, Skipped: true})
+		return nil
+	}
+
+	_, err := c.cfg.Target.DatabaseBranches.Get(ctx, &ps.GetDatabaseBranchRequest{
+		Organization: c.cfg.TargetOrganization,
+		Database:     c.cfg.TargetDatabase,
+		Branch:       b.Name,
+	})
+	if err != nil && !ps.IsNotFound(err) {
+		return err
+	}
+
+	// the branch exists if it's the default branch or if an earlier run
+	// failed before saving the state
+	if err != nil {
+		// branches are created after their parents, parents that don't
+		// exist anymore are replaced by the default branch
+		parent := b.ParentBranch
+		if p, ok := state.Branches[parent]; !ok || !p.Created {
+			parent = defaultBranch
+		}
+
+		op, err := c.cfg.Target.Operations.CreateBranch(ctx, &ps.CreateDatabaseBranchRequest{
+			Organization: c.cfg.TargetOrganization,
+			Database:     c.cfg.TargetDatabase,
+			Name:         b.Name,
+			ParentBranch: parent,
+			Notes:        b.Notes,
+		})
+		if err != nil {
+			return fmt.Errorf("creating branch %s: %s", b.Name, err)
+		}
+
+		op.PollInterval = c.cfg.PollInterval
+		if err := op.Wait(ctx); err != nil {
+			return fmt.Errorf("waiting for branch %s: %s", b.Name, err)
+		}
+	}
+
+	bs.Created = true
+	if err := c.save(state); err != nil {
+		return err
+	}
+
+	c.progress(&Progress{Step: StepCreateBranch, Branch: b.Name})
+	return nil
+}
+
+// applySchema makes the schema of the target branch match the schema of the
+// source branch. Tables that differ are dropped and created again, which is
+// fine as data is copied after all schemas are applied.
+func (c *Cloner) applySchema(ctx context.Context, state *State, branch string) error {
+	bs := state.branch(branch)
+	if bs.SchemaApplied {
+		c.progress(&Progress{Step: StepApplySchema, Branch: branch, Skipped: true})
+		return nil
+	}
+
+	want, err := schema(ctx, c.cfg.Source, c.cfg.SourceOrganization, c.cfg.SourceDatabase, branch)
+	if err != nil {
+		return err
+	}
+
+	current, err := schema(ctx, c.cfg.Target, c.cfg.TargetOrganization, c.cfg.TargetDatabase, branch)
+	if err != nil {
+		return err
+	}
+
+	if stmts := schemaStatements(current, want); len(stmts) > 0 {
+		db, err := c.cfg.Connect(ctx, c.cfg.Target, c.cfg.TargetOrganization, c.cfg.TargetDatabase, branch)
+		if err != nil {
+			return fmt.Errorf("connecting to branch %s: %s", branch, err)
+		}
+		defer db.Close()
+
+		for _, stmt := range stmts {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("applying schema of branch %s: %s", branch, err)
+			}
+		}
+	}
+
+	bs.SchemaApplied = true
+	if err := c.save(state); err != nil {
+		return err
+	}
+
+	c.progress(&Progress{Step: StepApplySchema, Branch: branch})
+	return nil
+}
+
+// copyData copies the rows of every table of a branch that wasn't copied in
+// an earlier run.
+func (c *Cloner) copyData(ctx context.Context, state *State, branch string) error {
+	bs := state.branch(branch)
+
+	tables, err := schema(ctx, c.cfg.Source, c.cfg.SourceOrganization, c.cfg.SourceDatabase, branch)
+	if err != nil {
+		return err
+	}
+
+	var src, dst *sql.DB
+	defer func() {
+		if src != nil {
+			src.Close()
+		}
+		if dst != nil {
+			dst.Close()
+		}
+	}()
+
+	for _, table := range sortedKeys(tables) {
+		if bs.Tables[table] {
+			c.progress(&Progress{Step: StepCopyData, Branch: branch, Table: table, Skipped: true})
+			continue
+		}
+
+		if src == nil {
+			src, err = c.cfg.Connect(ctx, c.cfg.Source, c.cfg.SourceOrganization, c.cfg.SourceDatabase, branch)
+			if err != nil {
+				return fmt.Errorf("connecting to source branch %s: %s", branch, err)
+			}
+
+			dst, err = c.cfg.Connect(ctx, c.cfg.Target, c.cfg.TargetOrganization, c.cfg.TargetDatabase, branch)
+			if err != nil {
+				return fmt.Errorf("connecting to branch %s: %s", branch, err)
+			}
+		}
+
+		n, err := CopyRows(ctx, src, dst, table, c.cfg.BatchSize)
+		if err != nil {
+			return fmt.Errorf("copying table %s of branch %s: %s", table, branch, err)
+		}
+
+		bs.Tables[table] = true
+		if err := c.save(state); err != nil {
+			return err
+		}
+
+		c.progress(&Progress{Step: StepCopyData, Branch: branch, Table: table, Rows: n})
+	}
+
+	return nil
+}
+
+func (c *Cloner) save(state *State) error {
+	if err := c.cfg.Store.Save(state); err != nil {
+		return fmt.Errorf("saving clone state: %s", err)
+	}
+	return nil
+}
+
+func (c *Cloner) progress(p *Progress) {
+	if c.cfg.OnProgress != nil {
+		c.cfg.OnProgress(p)
+	}
+}
+
+// schema returns the CREATE TABLE statements of a branch by table name.
+func schema(ctx context.Context, client *ps.Client, org, database, branch string) (map[string]string, error) {
+	diffs, err := client.DatabaseBranches.Schema(ctx, &ps.BranchSchemaRequest{
+		Organization: org,
+		Database:     database,
+		Branch:       branch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetching schema of %s/%s: %s", database, branch, err)
+	}
+
+	tables := make(map[string]string, len(diffs))
+	for _, d := range diffs {
+		tables[d.Name] = d.Raw
+	}
+	return tables, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func dial(ctx context.Context, client *ps.Client, org, database, branch string) (*sql.DB, error) {
+	return dbutil.Dial(ctx, &dbutil.DialConfig{
+		Organization: org,
+		Database:     database,
+		Branch:       branch,
+		Client:       client,
+	})
+}
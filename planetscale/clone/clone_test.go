@@ -0,0 +1,436 @@
+package clone
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	"github.com/planetscale/planetscale-go/internal/mysqltest"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+var testSchemas = map[string]map[string]string{
+	"main": {
+		"users": "CREATE TABLE `users` (`id` bigint)",
+	},
+	"dev": {
+		"users": "CREATE TABLE `users` (`id` bigint, `email` varchar(255))",
+		"posts": "CREATE TABLE `posts` (`id` bigint)",
+	},
+	"add-comments": {
+		"users":    "CREATE TABLE `users` (`id` bigint, `email` varchar(255))",
+		"posts":    "CREATE TABLE `posts` (`id` bigint)",
+		"comments": "CREATE TABLE `comments` (`id` bigint)",
+	},
+}
+
+func newTestClient(c *qt.C, opts ...ps.ClientOption) (*fakeapi.Server, *ps.Client) {
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+
+	client, err := ps.NewClient(append([]ps.ClientOption{ps.WithBaseURL(ts.URL)}, opts...)...)
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	for _, b := range []struct{ name, parent string }{
+		{"dev", "main"},
+		{"add-comments", "dev"},
+	} {
+		_, err := client.DatabaseBranches.Create(ctx, &ps.CreateDatabaseBranchRequest{
+			Organization: "my-org",
+			Database:     "my-db",
+			Name:         b.name,
+			ParentBranch: b.parent,
+		})
+		c.Assert(err, qt.IsNil)
+	}
+
+	for branch, tables := range testSchemas {
+		c.Assert(api.SetSchema("my-org", "my-db", branch, tables), qt.IsNil)
+	}
+
+	return api, client
+}
+
+func testConfig(client *ps.Client, connect ConnectFunc) *Config {
+	return &Config{
+		Source:             client,
+		SourceOrganization: "my-org",
+		SourceDatabase:     "my-db",
+		TargetOrganization: "staging",
+		TargetDatabase:     "my-db-acme",
+		Connect:            connect,
+		PollInterval:       time.Millisecond,
+	}
+}
+
+func TestRun(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	api, client := newTestClient(c)
+
+	var steps []string
+	cfg := testConfig(client, (&schemaDriver{api: api}).connect)
+	cfg.OnProgress = func(p *Progress) {
+		steps = append(steps, string(p.Step)+" "+p.Branch)
+	}
+
+	cl, err := New(cfg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(cl.Run(ctx), qt.IsNil)
+
+	c.Assert(steps, qt.DeepEquals, []string{
+		"create_database ",
+		"create_branch main",
+		"apply_schema main",
+		"create_branch dev",
+		"apply_schema dev",
+		"create_branch add-comments",
+		"apply_schema add-comments",
+	})
+
+	branches, err := client.DatabaseBranches.List(ctx, &ps.ListDatabaseBranchesRequest{
+		Organization: "staging",
+		Database:     "my-db-acme",
+	})
+	c.Assert(err, qt.IsNil)
+
+	parents := make(map[string]string)
+	for _, b := range branches {
+		parents[b.Name] = b.ParentBranch
+	}
+	c.Assert(parents, qt.DeepEquals, map[string]string{
+		"main":         "",
+		"dev":          "main",
+		"add-comments": "dev",
+	})
+
+	for branch, want := range testSchemas {
+		got, err := api.Schema("staging", "my-db-acme", branch)
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.DeepEquals, want, qt.Commentf("branch %s", branch))
+	}
+}
+
+func TestRun_resume(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	api, client := newTestClient(c)
+
+	// the first statement on the dev branch fails once
+	d := &schemaDriver{api: api, failBranch: "dev"}
+
+	var skipped []string
+	cfg := testConfig(client, d.connect)
+	cfg.Store = NewFileStore(filepath.Join(c.TempDir(), "state.json"))
+	cfg.OnProgress = func(p *Progress) {
+		if p.Skipped {
+			skipped = append(skipped, string(p.Step)+" "+p.Branch)
+		}
+	}
+
+	cl, err := New(cfg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(cl.Run(ctx), qt.ErrorMatches, "applying schema of branch dev: connection reset")
+
+	state, err := cfg.Store.Load()
+	c.Assert(err, qt.IsNil)
+	c.Assert(state.DatabaseCreated, qt.IsTrue)
+	c.Assert(state.Branches["main"].SchemaApplied, qt.IsTrue)
+	c.Assert(state.Branches["dev"].Created, qt.IsTrue)
+	c.Assert(state.Branches["dev"].SchemaApplied, qt.IsFalse)
+
+	// a new Cloner with the same store resumes the clone
+	cl, err = New(cfg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(cl.Run(ctx), qt.IsNil)
+
+	c.Assert(skipped, qt.DeepEquals, []string{
+		"create_database ",
+		"create_branch main",
+		"apply_schema main",
+		"create_branch dev",
+	})
+
+	for branch, want := range testSchemas {
+		got, err := api.Schema("staging", "my-db-acme", branch)
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.DeepEquals, want, qt.Commentf("branch %s", branch))
+	}
+}
+
+// failWaitTransport fails the first poll of the target database after it
+// was created.
+type failWaitTransport struct {
+	mu      sync.Mutex
+	created bool
+	failed  bool
+}
+
+func (t *failWaitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	const path = "/v1/organizations/staging/databases"
+
+	t.mu.Lock()
+	fail := false
+	switch {
+	case req.Method == http.MethodPost && req.URL.Path == path:
+		t.created = true
+	case req.Method == http.MethodGet && req.URL.Path == path+"/my-db-acme" && t.created && !t.failed:
+		t.failed, fail = true, true
+	}
+	t.mu.Unlock()
+
+	if fail {
+		return nil, errors.New("connection reset")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRun_resumeCreateDatabase(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	api, client := newTestClient(c, ps.WithHTTPClient(&http.Client{Transport: &failWaitTransport{}}))
+
+	cfg := testConfig(client, (&schemaDriver{api: api}).connect)
+	cfg.Store = NewFileStore(filepath.Join(c.TempDir(), "state.json"))
+
+	// the database is created, but waiting until it's ready fails
+	cl, err := New(cfg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(cl.Run(ctx), qt.ErrorMatches, "waiting for database my-db-acme: .*connection reset")
+
+	state, err := cfg.Store.Load()
+	c.Assert(err, qt.IsNil)
+	c.Assert(state.DatabaseCreating, qt.IsTrue)
+	c.Assert(state.DatabaseCreated, qt.IsFalse)
+
+	// the existing database is the clone's own, so the clone resumes
+	cl, err = New(cfg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(cl.Run(ctx), qt.IsNil)
+
+	for branch, want := range testSchemas {
+		got, err := api.Schema("staging", "my-db-acme", branch)
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.DeepEquals, want, qt.Commentf("branch %s", branch))
+	}
+}
+
+func TestRun_targetExists(t *testing.T) {
+	c := qt.New(t)
+	api, client := newTestClient(c)
+	api.CreateDatabase("staging", "my-db-acme")
+
+	cl, err := New(testConfig(client, (&schemaDriver{api: api}).connect))
+	c.Assert(err, qt.IsNil)
+
+	err = cl.Run(context.Background())
+	c.Assert(err, qt.ErrorMatches, "database my-db-acme already exists in staging")
+}
+
+func TestRun_mysql(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	connect := mysqltest.Connect(t)
+	_, client := newTestClient(c)
+
+	for branch, tables := range testSchemas {
+		src, err := connect(ctx, client, "my-org", "my-db", branch)
+		c.Assert(err, qt.IsNil)
+		for _, stmt := range tables {
+			_, err := src.Exec(stmt)
+			c.Assert(err, qt.IsNil)
+		}
+		_, err = src.Exec("INSERT INTO users (id) VALUES (1), (2), (3)")
+		c.Assert(err, qt.IsNil)
+		src.Close()
+	}
+
+	var copied int
+	cfg := testConfig(client, connect)
+	cfg.CopyData = true
+	cfg.BatchSize = 2
+	cfg.OnProgress = func(p *Progress) {
+		if p.Step == StepCopyData {
+			copied += p.Rows
+		}
+	}
+
+	cl, err := New(cfg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(cl.Run(ctx), qt.IsNil)
+
+	// 3 users on each of the 3 branches
+	c.Assert(copied, qt.Equals, 9)
+
+	dst, err := connect(ctx, client, "staging", "my-db-acme", "dev")
+	c.Assert(err, qt.IsNil)
+	defer dst.Close()
+
+	var count int
+	c.Assert(dst.QueryRow("SELECT COUNT(*) FROM users").Scan(&count), qt.IsNil)
+	c.Assert(count, qt.Equals, 3)
+}
+
+func TestNew(t *testing.T) {
+	c := qt.New(t)
+	_, client := newTestClient(c)
+
+	tests := []struct {
+		name string
+		cfg  *Config
+		want string
+	}{
+		{"no client", &Config{}, "planetscale Client is not set"},
+		{"no target", &Config{Source: client, SourceOrganization: "my-org", SourceDatabase: "my-db"}, "target database is not set"},
+		{"same database", &Config{Source: client, SourceOrganization: "my-org", SourceDatabase: "my-db", TargetDatabase: "my-db"}, "target database is the source database"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(tt.cfg)
+		c.Assert(err, qt.ErrorMatches, tt.want, qt.Commentf(tt.name))
+	}
+}
+
+func TestSchemaStatements(t *testing.T) {
+	c := qt.New(t)
+
+	current := map[string]string{
+		"users": "CREATE TABLE `users` (`id` bigint)",
+		"posts": "CREATE TABLE `posts` (`id` bigint)",
+		"old":   "CREATE TABLE `old` (`id` bigint)",
+	}
+	want := map[string]string{
+		"users":    "CREATE TABLE `users` (`id` bigint)",
+		"posts":    "CREATE TABLE `posts` (`id` bigint, `title` text)",
+		"comments": "CREATE TABLE `comments` (`id` bigint)",
+	}
+
+	c.Assert(schemaStatements(current, want), qt.DeepEquals, []string{
+		"DROP TABLE IF EXISTS `old`",
+		"CREATE TABLE `comments` (`id` bigint)",
+		"DROP TABLE IF EXISTS `posts`",
+		"CREATE TABLE `posts` (`id` bigint, `title` text)",
+	})
+	c.Assert(schemaStatements(want, want), qt.HasLen, 0)
+}
+
+func TestCopyRows_generatedColumns(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	connect := mysqltest.Connect(t)
+	_, client := newTestClient(c)
+
+	const schema = "CREATE TABLE `items` (`id` bigint PRIMARY KEY, `price` int, `quantity` int, " +
+		"`total` int AS (`price` * `quantity`) STORED, `label` varchar(32) AS (CONCAT('item ', `id`)) VIRTUAL)"
+
+	src, err := connect(ctx, client, "my-org", "my-db", "main")
+	c.Assert(err, qt.IsNil)
+	defer src.Close()
+	dst, err := connect(ctx, client, "staging", "my-db-acme", "main")
+	c.Assert(err, qt.IsNil)
+	defer dst.Close()
+
+	for _, db := range []*sql.DB{src, dst} {
+		_, err := db.Exec(schema)
+		c.Assert(err, qt.IsNil)
+	}
+	_, err = src.Exec("INSERT INTO items (id, price, quantity) VALUES (1, 10, 2), (2, 5, 3), (3, 7, 1)")
+	c.Assert(err, qt.IsNil)
+
+	n, err := CopyRows(ctx, src, dst, "items", 2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(n, qt.Equals, 3)
+
+	var total int
+	var label string
+	c.Assert(dst.QueryRow("SELECT total, label FROM items WHERE id = 2").Scan(&total, &label), qt.IsNil)
+	c.Assert(total, qt.Equals, 15)
+	c.Assert(label, qt.Equals, "item 2")
+}
+
+func TestBatchRows(t *testing.T) {
+	c := qt.New(t)
+
+	c.Assert(batchRows(500, 10), qt.Equals, 500)
+	c.Assert(batchRows(500, 200), qt.Equals, 327)
+	c.Assert(batchRows(500, 4096), qt.Equals, 15)
+}
+
+var (
+	createTable = regexp.MustCompile("^CREATE TABLE `([^`]+)`")
+	dropTable   = regexp.MustCompile("^DROP TABLE IF EXISTS `([^`]+)`$")
+)
+
+// schemaDriver is a database/sql driver that applies CREATE TABLE and DROP
+// TABLE statements to the branch schemas of a fake API.
+type schemaDriver struct {
+	api *fakeapi.Server
+
+	// failBranch is the branch whose first statement fails.
+	failBranch string
+
+	mu     sync.Mutex
+	failed bool
+}
+
+func (d *schemaDriver) connect(_ context.Context, _ *ps.Client, org, database, branch string) (*sql.DB, error) {
+	return sql.OpenDB(&schemaConnector{d: d, org: org, database: database, branch: branch}), nil
+}
+
+func (d *schemaDriver) exec(org, database, branch, query string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if branch == d.failBranch && !d.failed {
+		d.failed = true
+		return errors.New("connection reset")
+	}
+
+	tables, err := d.api.Schema(org, database, branch)
+	if err != nil {
+		return err
+	}
+
+	if m := createTable.FindStringSubmatch(query); m != nil {
+		tables[m[1]] = query
+	} else if m := dropTable.FindStringSubmatch(query); m != nil {
+		delete(tables, m[1])
+	} else {
+		return errors.New("unsupported statement: " + query)
+	}
+
+	return d.api.SetSchema(org, database, branch, tables)
+}
+
+type schemaConnector struct {
+	d                     *schemaDriver
+	org, database, branch string
+}
+
+func (c *schemaConnector) Connect(context.Context) (driver.Conn, error) { return &schemaConn{c}, nil }
+func (c *schemaConnector) Driver() driver.Driver                        { return nil }
+
+type schemaConn struct {
+	c *schemaConnector
+}
+
+func (c *schemaConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.c.d.exec(c.c.org, c.c.database, c.c.branch, query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (c *schemaConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *schemaConn) Close() error                        { return nil }
+func (c *schemaConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
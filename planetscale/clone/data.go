@@ -0,0 +1,189 @@
+package clone
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// schemaStatements returns the statements that turn the schema current into the
+// schema want. Both map table names to their CREATE TABLE statement.
+func schemaStatements(current, want map[string]string) []string {
+	var stmts []string
+	for _, name := range sortedKeys(current) {
+		if _, ok := want[name]; !ok {
+			stmts = append(stmts, "DROP TABLE IF EXISTS "+quote(name))
+		}
+	}
+
+	for _, name := range sortedKeys(want) {
+		cur, ok := current[name]
+		if ok && cur == want[name] {
+			continue
+		}
+		if ok {
+			stmts = append(stmts, "DROP TABLE IF EXISTS "+quote(name))
+		}
+		stmts = append(stmts, want[name])
+	}
+
+	return stmts
+}
+
+// maxPlaceholders is the maximum number of placeholders MySQL accepts in a
+// prepared statement.
+const maxPlaceholders = 65535
+
+// CopyRows exports all rows of a table from src and imports them into dst,
+// up to batchSize rows per INSERT statement. The table must exist in dst.
+// Rows already in dst are deleted first, so a partially copied table can be
+// copied again. It returns the number of copied rows.
+//
+// The rows are read in a read-only transaction with a consistent snapshot,
+// so rows written to src during the copy don't leave a mix of old and new
+// data. Generated columns aren't copied, MySQL computes them in dst.
+func CopyRows(ctx context.Context, src, dst *sql.DB, table string, batchSize int) (int, error) {
+	if _, err := dst.ExecContext(ctx, "DELETE FROM "+quote(table)); err != nil {
+		return 0, err
+	}
+
+	conn, err := src.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		return 0, err
+	}
+	if _, err := conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY"); err != nil {
+		return 0, err
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "ROLLBACK")
+	}()
+
+	columns, err := insertableColumns(ctx, conn, table)
+	if err != nil {
+		return 0, err
+	}
+
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quote(col)
+	}
+	list := strings.Join(quoted, ", ")
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quote(table), list)
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	batchSize = batchRows(batchSize, len(columns))
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s", list, quote(table)))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	raw := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(raw))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+
+	var (
+		args  []interface{}
+		batch int
+		total int
+	)
+
+	flush := func() error {
+		if batch == 0 {
+			return nil
+		}
+
+		stmt := prefix + strings.TrimSuffix(strings.Repeat(placeholders+", ", batch), ", ")
+		if _, err := dst.ExecContext(ctx, stmt, args...); err != nil {
+			return err
+		}
+
+		total += batch
+		args, batch = args[:0], 0
+		return nil
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return total, err
+		}
+
+		// RawBytes are only valid until the next call to Next
+		for _, v := range raw {
+			if v == nil {
+				args = append(args, nil)
+			} else {
+				args = append(args, append([]byte(nil), v...))
+			}
+		}
+
+		batch++
+		if batch >= batchSize {
+			if err := flush(); err != nil {
+				return total, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return total, err
+	}
+
+	return total, flush()
+}
+
+// insertableColumns returns the columns of a table that can be inserted
+// into, in the order of the table.
+func insertableColumns(ctx context.Context, conn *sql.Conn, table string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT COLUMN_NAME, EXTRA FROM information_schema.COLUMNS "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name, extra string
+		if err := rows.Scan(&name, &extra); err != nil {
+			return nil, err
+		}
+
+		// EXTRA is "VIRTUAL GENERATED" or "STORED GENERATED" for generated
+		// columns, but also "DEFAULT_GENERATED" for columns with an
+		// expression as default value, which are copied
+		if strings.Contains(extra, "VIRTUAL GENERATED") || strings.Contains(extra, "STORED GENERATED") {
+			continue
+		}
+		columns = append(columns, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s has no columns to copy", table)
+	}
+	return columns, nil
+}
+
+// batchRows returns the number of rows per INSERT statement, which is
+// batchSize unless the statement would have more placeholders than MySQL
+// accepts.
+func batchRows(batchSize, columns int) int {
+	if max := maxPlaceholders / columns; batchSize > max {
+		return max
+	}
+	return batchSize
+}
+
+func quote(ident string) string {
+	return "`" + strings.Replace(ident, "`", "``", -1) + "`"
+}
@@ -0,0 +1,138 @@
+package clone
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// State records the steps of a clone that finished. A clone that failed
+// resumes after the last finished step when it's run again with the same
+// state.
+type State struct {
+	// DatabaseCreating is set before the target database is created, so a
+	// database created by a failed run is recognized as the clone's own.
+	DatabaseCreating bool `json:"database_creating,omitempty"`
+
+	DatabaseCreated bool                    `json:"database_created"`
+	Branches        map[string]*BranchState `json:"branches"`
+}
+
+// BranchState records the finished steps of a single branch.
+type BranchState struct {
+	Created       bool `json:"created"`
+	SchemaApplied bool `json:"schema_applied"`
+
+	// Tables are the tables whose rows were copied.
+	Tables map[string]bool `json:"tables,omitempty"`
+}
+
+func (s *State) branch(name string) *BranchState {
+	if s.Branches == nil {
+		s.Branches = make(map[string]*BranchState)
+	}
+
+	b, ok := s.Branches[name]
+	if !ok {
+		b = &BranchState{}
+		s.Branches[name] = b
+	}
+	if b.Tables == nil {
+		b.Tables = make(map[string]bool)
+	}
+	return b
+}
+
+// Store persists the state of a clone.
+type Store interface {
+	// Load returns the saved state, or an empty state if none was saved.
+	Load() (*State, error)
+
+	// Save saves the state.
+	Save(*State) error
+}
+
+// NewFileStore returns a Store that saves the state as JSON to the given
+// file.
+func NewFileStore(path string) Store {
+	return &fileStore{path: path}
+}
+
+type fileStore struct {
+	path string
+}
+
+func (f *fileStore) Load() (*State, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &State{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("malformed clone state %s: %s", f.path, err)
+	}
+	return s, nil
+}
+
+func (f *fileStore) Save(s *State) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so a crash doesn't leave a
+	// truncated state behind
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// memoryStore keeps the state in memory, so a clone can only be resumed by
+// the same Cloner.
+type memoryStore struct {
+	mu    sync.Mutex
+	state []byte
+}
+
+func (m *memoryStore) Load() (*State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := &State{}
+	if m.state == nil {
+		return s, nil
+	}
+	return s, json.Unmarshal(m.state, s)
+}
+
+func (m *memoryStore) Save(s *State) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.state = data
+	m.mu.Unlock()
+	return nil
+}
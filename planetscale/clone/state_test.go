@@ -0,0 +1,43 @@
+package clone
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestFileStore(t *testing.T) {
+	c := qt.New(t)
+	path := filepath.Join(c.TempDir(), "state.json")
+	store := NewFileStore(path)
+
+	// a missing file is an empty state
+	state, err := store.Load()
+	c.Assert(err, qt.IsNil)
+	c.Assert(state, qt.DeepEquals, &State{})
+
+	state.DatabaseCreated = true
+	state.branch("main").Created = true
+	state.branch("main").Tables["users"] = true
+	c.Assert(store.Save(state), qt.IsNil)
+
+	got, err := NewFileStore(path).Load()
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.DeepEquals, state)
+
+	// no temporary files are left behind
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	c.Assert(err, qt.IsNil)
+	c.Assert(files, qt.HasLen, 1)
+}
+
+func TestFileStore_malformed(t *testing.T) {
+	c := qt.New(t)
+	path := filepath.Join(c.TempDir(), "state.json")
+	c.Assert(ioutil.WriteFile(path, []byte("{"), 0600), qt.IsNil)
+
+	_, err := NewFileStore(path).Load()
+	c.Assert(err, qt.ErrorMatches, "malformed clone state .*state.json: unexpected end of JSON input")
+}
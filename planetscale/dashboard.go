@@ -0,0 +1,43 @@
+package planetscale
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// WithDashboardURL overrides the URL of the PlanetScale web app, which links
+// such as DeployRequestURL point to. By default it's derived from the base
+// URL of the API: "https://api.planetscale.com/" becomes
+// "https://app.planetscale.com/", and other base URLs are used as they are.
+func WithDashboardURL(dashboardURL string) ClientOption {
+	return func(c *Client) error {
+		parsedURL, err := url.Parse(dashboardURL)
+		if err != nil {
+			return err
+		}
+
+		c.dashboardURL = parsedURL
+		return nil
+	}
+}
+
+// DeployRequestURL returns the URL of a deploy request in the PlanetScale
+// web app.
+func (c *Client) DeployRequestURL(org, database string, number uint64) string {
+	path := fmt.Sprintf("%s/%s/deploy-requests/%d", org, database, number)
+	return c.dashboard().ResolveReference(&url.URL{Path: path}).String()
+}
+
+// dashboard returns the URL of the web app.
+func (c *Client) dashboard() *url.URL {
+	if c.dashboardURL != nil {
+		return c.dashboardURL
+	}
+
+	u := &url.URL{Scheme: c.baseURL.Scheme, Host: c.baseURL.Host, Path: "/"}
+	if strings.HasPrefix(u.Host, "api.") {
+		u.Host = "app." + strings.TrimPrefix(u.Host, "api.")
+	}
+	return u
+}
@@ -0,0 +1,31 @@
+package planetscale
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestClient_DeployRequestURL(t *testing.T) {
+	c := qt.New(t)
+
+	tests := []struct {
+		name string
+		opts []ClientOption
+		want string
+	}{
+		{"default", nil, "https://app.planetscale.com/my-org/my-db/deploy-requests/7"},
+		{"api host", []ClientOption{WithBaseURL("https://api.example.com/")}, "https://app.example.com/my-org/my-db/deploy-requests/7"},
+		{"other host", []ClientOption{WithBaseURL("http://127.0.0.1:8080/")}, "http://127.0.0.1:8080/my-org/my-db/deploy-requests/7"},
+		{"dashboard URL", []ClientOption{WithBaseURL("http://127.0.0.1:8080/"), WithDashboardURL("https://ps.example.com/")}, "https://ps.example.com/my-org/my-db/deploy-requests/7"},
+	}
+
+	for _, tt := range tests {
+		client, err := NewClient(tt.opts...)
+		c.Assert(err, qt.IsNil)
+		c.Assert(client.DeployRequestURL("my-org", "my-db", 7), qt.Equals, tt.want, qt.Commentf(tt.name))
+
+		// the read-only view links to the same app
+		c.Assert(client.ReadOnly().DeployRequestURL("my-org", "my-db", 7), qt.Equals, tt.want, qt.Commentf(tt.name))
+	}
+}
@@ -50,6 +50,7 @@ type Database struct {
 	Name      string    `json:"name"`
 	Notes     string    `json:"notes"`
 	Region    Region    `json:"region"`
+	State     string    `json:"state"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -61,22 +61,29 @@ func Dial(ctx context.Context, cfg *DialConfig) (*sql.DB, error) {
 		return nil, err
 	}
 
+	mysqlCfg := mysqlConfig(cfg, remoteAddr, key)
+	db, err := sql.Open("mysql", mysqlCfg.FormatDSN())
+	if err == nil {
+		err = db.PingContext(ctx)
+	}
+
+	return db, err
+}
+
+// mysqlConfig returns the MySQL driver configuration to connect to remoteAddr
+// with the TLS configuration registered as tlsKey.
+func mysqlConfig(cfg *DialConfig, remoteAddr, tlsKey string) *mysql.Config {
 	mysqlCfg := mysql.NewConfig()
-	if mysqlCfg != nil {
+	if cfg.MySQLConfig != nil {
 		// shallow-copy to avoid modifying user data
 		*mysqlCfg = *cfg.MySQLConfig
 	}
 	mysqlCfg.Addr = remoteAddr
 	mysqlCfg.Net = "tcp"
-	mysqlCfg.TLSConfig = key
+	mysqlCfg.TLSConfig = tlsKey
 	mysqlCfg.ParseTime = true
 
-	db, err := sql.Open("mysql", mysqlCfg.FormatDSN())
-	if err == nil {
-		err = db.PingContext(ctx)
-	}
-
-	return db, err
+	return mysqlCfg
 }
 
 // createTLSConfig is an internal function that returns the remote address and
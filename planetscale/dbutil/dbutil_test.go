@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	qt "github.com/frankban/quicktest"
+	"github.com/go-sql-driver/mysql"
 	"github.com/planetscale/planetscale-go/planetscale"
 )
 
@@ -155,6 +156,29 @@ func TestCreateTLSConfig(t *testing.T) {
 	c.Assert(ct.Subject.CommonName, qt.Equals, "org-foo/db-foo/branch-foo")
 }
 
+func TestMySQLConfig(t *testing.T) {
+	c := qt.New(t)
+
+	// the MySQL configuration is optional
+	cfg := mysqlConfig(&DialConfig{}, "db.example.com:3306", "planetscale")
+	c.Assert(cfg.Addr, qt.Equals, "db.example.com:3306")
+	c.Assert(cfg.Net, qt.Equals, "tcp")
+	c.Assert(cfg.TLSConfig, qt.Equals, "planetscale")
+	c.Assert(cfg.ParseTime, qt.IsTrue)
+
+	userCfg := mysql.NewConfig()
+	userCfg.DBName = "my-db"
+	userCfg.Addr = "127.0.0.1:3306"
+
+	cfg = mysqlConfig(&DialConfig{MySQLConfig: userCfg}, "db.example.com:3306", "planetscale")
+	c.Assert(cfg.DBName, qt.Equals, "my-db")
+	c.Assert(cfg.Addr, qt.Equals, "db.example.com:3306")
+
+	// the user's configuration isn't modified
+	c.Assert(userCfg.Addr, qt.Equals, "127.0.0.1:3306")
+	c.Assert(userCfg.TLSConfig, qt.Equals, "")
+}
+
 type fakeCertService struct {
 	createFn        func(context.Context, *planetscale.CreateCertificateRequest) (*planetscale.Cert, error)
 	createFnInvoked bool
@@ -128,6 +128,103 @@ type DeployRequest struct {
 	ClosedAt  *time.Time `json:"closed_at"`
 }
 
+// DeploymentOutcome classifies the state of a deploy request's deployment.
+type DeploymentOutcome int
+
+const (
+	// DeploymentPending means the deploy request can still be deployed, or
+	// its deployment is in progress.
+	DeploymentPending DeploymentOutcome = iota
+
+	// DeploymentDeployed means the schema changes were deployed. A deployment
+	// that can still be reverted counts as deployed.
+	DeploymentDeployed
+
+	// DeploymentNoChanges means there were no schema changes to deploy.
+	DeploymentNoChanges
+
+	// DeploymentFailed means the deployment failed.
+	DeploymentFailed
+
+	// DeploymentCancelled means the deployment was cancelled.
+	DeploymentCancelled
+
+	// DeploymentReverted means the deployment was reverted, or reverting it
+	// failed.
+	DeploymentReverted
+
+	// DeploymentNotDeployable means the schema changes can't be deployed.
+	DeploymentNotDeployable
+
+	// DeploymentClosed means the deploy request was closed without being
+	// deployed.
+	DeploymentClosed
+)
+
+func (o DeploymentOutcome) String() string {
+	switch o {
+	case DeploymentDeployed:
+		return "deployed"
+	case DeploymentNoChanges:
+		return "no changes"
+	case DeploymentFailed:
+		return "failed"
+	case DeploymentCancelled:
+		return "cancelled"
+	case DeploymentReverted:
+		return "reverted"
+	case DeploymentNotDeployable:
+		return "not deployable"
+	case DeploymentClosed:
+		return "closed"
+	default:
+		return "pending"
+	}
+}
+
+// Done reports whether the outcome is final.
+func (o DeploymentOutcome) Done() bool {
+	return o != DeploymentPending
+}
+
+// Succeeded reports whether the deploy request was deployed, including
+// deploy requests without changes.
+func (o DeploymentOutcome) Succeeded() bool {
+	return o == DeploymentDeployed || o == DeploymentNoChanges
+}
+
+// ClassifyDeployment returns the outcome of a deploy request's deployment.
+// Unknown deployment states are treated as pending.
+func ClassifyDeployment(dr *DeployRequest) DeploymentOutcome {
+	outcome := DeploymentPending
+	if dr.Deployment != nil {
+		switch dr.Deployment.State {
+		case "complete", "complete_pending_revert":
+			outcome = DeploymentDeployed
+		case "no_changes":
+			outcome = DeploymentNoChanges
+		case "complete_error", "error", "failed":
+			outcome = DeploymentFailed
+		case "complete_cancel", "cancelled":
+			outcome = DeploymentCancelled
+		case "complete_revert", "complete_revert_error":
+			outcome = DeploymentReverted
+		case "ready":
+			if !dr.Deployment.Deployable {
+				outcome = DeploymentNotDeployable
+			}
+		}
+	}
+
+	// a deploy request that was closed before it was deployed will never be
+	// deployed
+	if outcome == DeploymentPending && dr.State == "closed" {
+		outcome = DeploymentClosed
+	}
+
+	return outcome
+}
+
 type CancelDeployRequestRequest struct {
 	Organization string `json:"-"`
 	Database     string `json:"-"`
@@ -282,3 +282,33 @@ func TestDeployRequests_List(t *testing.T) {
 	c.Assert(err, qt.IsNil)
 	c.Assert(requests, qt.DeepEquals, want)
 }
+
+func TestClassifyDeployment(t *testing.T) {
+	c := qt.New(t)
+
+	tests := []struct {
+		state      string
+		deployment *Deployment
+		want       DeploymentOutcome
+	}{
+		{"open", nil, DeploymentPending},
+		{"open", &Deployment{State: "pending"}, DeploymentPending},
+		{"open", &Deployment{State: "ready", Deployable: true}, DeploymentPending},
+		{"open", &Deployment{State: "ready"}, DeploymentNotDeployable},
+		{"open", &Deployment{State: "in_progress"}, DeploymentPending},
+		{"open", &Deployment{State: "complete_pending_revert"}, DeploymentDeployed},
+		{"closed", &Deployment{State: "complete"}, DeploymentDeployed},
+		{"closed", &Deployment{State: "no_changes"}, DeploymentNoChanges},
+		{"open", &Deployment{State: "error"}, DeploymentFailed},
+		{"open", &Deployment{State: "complete_cancel"}, DeploymentCancelled},
+		{"closed", &Deployment{State: "complete_revert"}, DeploymentReverted},
+		{"closed", &Deployment{State: "complete_revert_error"}, DeploymentReverted},
+		{"closed", &Deployment{State: "ready", Deployable: true}, DeploymentClosed},
+		{"closed", nil, DeploymentClosed},
+	}
+
+	for _, tt := range tests {
+		got := ClassifyDeployment(&DeployRequest{State: tt.state, Deployment: tt.deployment})
+		c.Assert(got, qt.Equals, tt.want, qt.Commentf("%s %+v", tt.state, tt.deployment))
+	}
+}
@@ -0,0 +1,269 @@
+// Package drift detects changes to the schema of a branch that weren't made
+// through deploy requests, e.g. by ad-hoc tools connected to production:
+//
+//	expected, err := schema.ReadFile("schema.json")
+//	if err != nil {
+//		return err
+//	}
+//
+//	d, err := drift.New(&drift.Config{
+//		Client:       client,
+//		Organization: "my-org",
+//		Database:     "my-db",
+//		Branch:       "main",
+//		Expected:     expected,
+//		OnDrift: func(r *drift.Report) {
+//			log.Print(r)
+//		},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	err = d.Run(ctx)
+//
+// Instead of a recorded snapshot, a branch can also be compared against
+// another branch with Config.CompareBranch.
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+	"github.com/planetscale/planetscale-go/planetscale/schema"
+)
+
+const defaultInterval = 5 * time.Minute
+
+// FindingKind defines how a table drifted from the expected schema.
+type FindingKind string
+
+const (
+	Unexpected FindingKind = "unexpected" // Table exists, but isn't expected.
+	Missing    FindingKind = "missing"    // Table is expected, but doesn't exist.
+	Modified   FindingKind = "modified"   // Table definition differs.
+)
+
+// Finding is a table that drifted from the expected schema.
+type Finding struct {
+	Table string      `json:"table"`
+	Kind  FindingKind `json:"kind"`
+
+	// Expected and Actual are the expected and the live CREATE TABLE
+	// statement. They are empty if the table doesn't exist.
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// Report is the result of a check.
+type Report struct {
+	Organization string `json:"organization"`
+	Database     string `json:"database"`
+	Branch       string `json:"branch"`
+
+	// Baseline describes the expected schema, either "snapshot" or the
+	// name of the branch compared against.
+	Baseline string `json:"baseline"`
+
+	ExpectedVersion string `json:"expected_version"`
+	ActualVersion   string `json:"actual_version"`
+
+	Findings  []*Finding `json:"findings"`
+	CheckedAt time.Time  `json:"checked_at"`
+}
+
+// Drifted reports whether the branch drifted from the expected schema.
+func (r *Report) Drifted() bool {
+	return len(r.Findings) > 0
+}
+
+// String returns a summary of the report, suitable for alerts.
+func (r *Report) String() string {
+	if !r.Drifted() {
+		return fmt.Sprintf("Schema of %s/%s matches %s.", r.Database, r.Branch, r.Baseline)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Schema of %s/%s drifted from %s (version %s, expected %s):",
+		r.Database, r.Branch, r.Baseline, r.ActualVersion, r.ExpectedVersion)
+	for _, f := range r.Findings {
+		fmt.Fprintf(&b, "\n- %s: %s", f.Table, f.Kind)
+	}
+	return b.String()
+}
+
+// Config defines the configuration of a Detector.
+type Config struct {
+	// Client defines a PlanetScale client. Use planetscale.NewClient() to
+	// create a new instance.
+	Client *ps.Client
+
+	// Organization, Database and Branch are the branch to check.
+	Organization string
+	Database     string
+	Branch       string
+
+	// Expected is the expected schema, e.g. recorded with
+	// schema.Snapshot.WriteFile after the last deployment.
+	Expected *schema.Snapshot
+
+	// CompareBranch is a branch of the same database with the expected
+	// schema. Exactly one of Expected and CompareBranch must be set.
+	CompareBranch string
+
+	// Interval is the interval between two checks of Run. Defaults to 5
+	// minutes.
+	Interval time.Duration
+
+	// OnDrift is called by Run when drift is detected and whenever the
+	// drifted schema changes again.
+	OnDrift func(*Report)
+
+	// OnResolved is called by Run when a drifted branch matches the
+	// expected schema again.
+	OnResolved func(*Report)
+
+	// OnError is called with the errors of Run.
+	OnError func(error)
+}
+
+// Detector compares the live schema of a branch against an expected schema.
+type Detector struct {
+	cfg Config
+}
+
+// New returns a new Detector with the given configuration.
+func New(cfg *Config) (*Detector, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("planetscale Client is not set")
+	}
+
+	if cfg.Organization == "" {
+		return nil, errors.New("organization is not set")
+	}
+
+	if cfg.Database == "" {
+		return nil, errors.New("database is not set")
+	}
+
+	if cfg.Branch == "" {
+		return nil, errors.New("branch is not set")
+	}
+
+	if (cfg.Expected == nil) == (cfg.CompareBranch == "") {
+		return nil, errors.New("exactly one of expected snapshot and compare branch must be set")
+	}
+
+	d := &Detector{cfg: *cfg}
+	if d.cfg.Interval <= 0 {
+		d.cfg.Interval = defaultInterval
+	}
+
+	return d, nil
+}
+
+// Check refreshes the schema of the branch and compares it against the
+// expected schema once.
+func (d *Detector) Check(ctx context.Context) (*Report, error) {
+	actual, err := d.liveSchema(ctx, d.cfg.Branch)
+	if err != nil {
+		return nil, err
+	}
+
+	expected, baseline := d.cfg.Expected, "snapshot"
+	if d.cfg.CompareBranch != "" {
+		expected, err = d.liveSchema(ctx, d.cfg.CompareBranch)
+		if err != nil {
+			return nil, err
+		}
+		baseline = d.cfg.CompareBranch
+	}
+
+	r := &Report{
+		Organization:    d.cfg.Organization,
+		Database:        d.cfg.Database,
+		Branch:          d.cfg.Branch,
+		Baseline:        baseline,
+		ExpectedVersion: expected.Version(),
+		ActualVersion:   actual.Version(),
+		CheckedAt:       actual.TakenAt,
+	}
+
+	for _, c := range schema.Compare(expected, actual) {
+		f := &Finding{Table: c.Table, Expected: c.From, Actual: c.To}
+		switch c.Kind {
+		case schema.TableAdded:
+			f.Kind = Unexpected
+		case schema.TableRemoved:
+			f.Kind = Missing
+		default:
+			f.Kind = Modified
+		}
+		r.Findings = append(r.Findings, f)
+	}
+
+	return r, nil
+}
+
+// Run checks the branch every interval until ctx is canceled. Alerts are
+// only sent when the state of the drift changes, so a drifted branch
+// doesn't alert on every check.
+func (d *Detector) Run(ctx context.Context) error {
+	var last *Report
+
+	for {
+		r, err := d.Check(ctx)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if d.cfg.OnError != nil {
+				d.cfg.OnError(err)
+			}
+		case r.Drifted():
+			if last == nil || !last.Drifted() || last.ActualVersion != r.ActualVersion || last.ExpectedVersion != r.ExpectedVersion {
+				if d.cfg.OnDrift != nil {
+					d.cfg.OnDrift(r)
+				}
+			}
+			last = r
+		default:
+			if last != nil && last.Drifted() && d.cfg.OnResolved != nil {
+				d.cfg.OnResolved(r)
+			}
+			last = r
+		}
+
+		timer := time.NewTimer(d.cfg.Interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// liveSchema refreshes the schema of a branch, so changes made outside of
+// PlanetScale are picked up, and takes a snapshot of it.
+func (d *Detector) liveSchema(ctx context.Context, branch string) (*schema.Snapshot, error) {
+	err := d.cfg.Client.DatabaseBranches.RefreshSchema(ctx, &ps.RefreshSchemaRequest{
+		Organization: d.cfg.Organization,
+		Database:     d.cfg.Database,
+		Branch:       branch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("refreshing schema of %s: %s", branch, err)
+	}
+
+	snap, err := schema.Take(ctx, d.cfg.Client, d.cfg.Organization, d.cfg.Database, branch)
+	if err != nil {
+		return nil, fmt.Errorf("fetching schema of %s: %s", branch, err)
+	}
+	return snap, nil
+}
@@ -0,0 +1,199 @@
+package drift
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+	"github.com/planetscale/planetscale-go/planetscale/schema"
+)
+
+var expectedTables = map[string]string{
+	"users": "CREATE TABLE `users` (`id` bigint)",
+	"posts": "CREATE TABLE `posts` (`id` bigint)",
+}
+
+func newTestClient(c *qt.C) (*fakeapi.Server, *ps.Client) {
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+	c.Assert(api.SetSchema("my-org", "my-db", "main", expectedTables), qt.IsNil)
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	return api, client
+}
+
+func TestCheck(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	api, client := newTestClient(c)
+
+	d, err := New(&Config{
+		Client:       client,
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "main",
+		Expected:     &schema.Snapshot{Tables: expectedTables},
+	})
+	c.Assert(err, qt.IsNil)
+
+	r, err := d.Check(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(r.Drifted(), qt.IsFalse)
+	c.Assert(r.ActualVersion, qt.Equals, r.ExpectedVersion)
+	c.Assert(r.String(), qt.Equals, "Schema of my-db/main matches snapshot.")
+
+	c.Assert(api.SetSchema("my-org", "my-db", "main", map[string]string{
+		"users": "CREATE TABLE `users` (`id` bigint, `tmp` int)",
+		"debug": "CREATE TABLE `debug` (`id` bigint)",
+	}), qt.IsNil)
+
+	r, err = d.Check(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(r.Drifted(), qt.IsTrue)
+	c.Assert(r.Findings, qt.DeepEquals, []*Finding{
+		{Table: "debug", Kind: Unexpected, Actual: "CREATE TABLE `debug` (`id` bigint)"},
+		{Table: "posts", Kind: Missing, Expected: "CREATE TABLE `posts` (`id` bigint)"},
+		{Table: "users", Kind: Modified, Expected: "CREATE TABLE `users` (`id` bigint)", Actual: "CREATE TABLE `users` (`id` bigint, `tmp` int)"},
+	})
+	c.Assert(r.String(), qt.Matches, `Schema of my-db/main drifted from snapshot \(version [0-9a-f]+, expected [0-9a-f]+\):
+- debug: unexpected
+- posts: missing
+- users: modified`)
+
+	// the schema is refreshed before it's fetched
+	var refreshed bool
+	for _, req := range api.Requests() {
+		if req == "POST /v1/organizations/my-org/databases/my-db/branches/main/refresh-schema" {
+			refreshed = true
+		}
+	}
+	c.Assert(refreshed, qt.IsTrue)
+}
+
+func TestCheck_compareBranch(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	api, client := newTestClient(c)
+
+	_, err := client.DatabaseBranches.Create(ctx, &ps.CreateDatabaseBranchRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Name:         "replica",
+		ParentBranch: "main",
+	})
+	c.Assert(err, qt.IsNil)
+
+	d, err := New(&Config{
+		Client:        client,
+		Organization:  "my-org",
+		Database:      "my-db",
+		Branch:        "replica",
+		CompareBranch: "main",
+	})
+	c.Assert(err, qt.IsNil)
+
+	r, err := d.Check(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(r.Drifted(), qt.IsFalse)
+
+	c.Assert(api.SetSchema("my-org", "my-db", "replica", map[string]string{
+		"users": expectedTables["users"],
+	}), qt.IsNil)
+
+	r, err = d.Check(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(r.Baseline, qt.Equals, "main")
+	c.Assert(r.Findings, qt.DeepEquals, []*Finding{
+		{Table: "posts", Kind: Missing, Expected: expectedTables["posts"]},
+	})
+}
+
+func TestRun(t *testing.T) {
+	c := qt.New(t)
+	api, client := newTestClient(c)
+
+	var (
+		mu     sync.Mutex
+		alerts []string
+	)
+	record := func(kind string) func(*Report) {
+		return func(r *Report) {
+			mu.Lock()
+			defer mu.Unlock()
+			alerts = append(alerts, kind)
+		}
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(alerts)
+	}
+
+	d, err := New(&Config{
+		Client:       client,
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "main",
+		Expected:     &schema.Snapshot{Tables: expectedTables},
+		Interval:     time.Millisecond,
+		OnDrift:      record("drift"),
+		OnResolved:   record("resolved"),
+		OnError:      func(err error) { c.Errorf("unexpected error: %s", err) },
+	})
+	c.Assert(err, qt.IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- d.Run(ctx) }()
+
+	waitFor := func(n int) {
+		for start := time.Now(); count() < n; time.Sleep(time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				c.Fatalf("got %d alerts, want %d", count(), n)
+			}
+		}
+	}
+
+	c.Assert(api.SetSchema("my-org", "my-db", "main", map[string]string{}), qt.IsNil)
+	waitFor(1)
+
+	// the drift doesn't alert again until it changes
+	time.Sleep(20 * time.Millisecond)
+	c.Assert(count(), qt.Equals, 1)
+
+	c.Assert(api.SetSchema("my-org", "my-db", "main", expectedTables), qt.IsNil)
+	waitFor(2)
+
+	cancel()
+	c.Assert(<-done, qt.Equals, context.Canceled)
+	c.Assert(alerts, qt.DeepEquals, []string{"drift", "resolved"})
+}
+
+func TestNew(t *testing.T) {
+	c := qt.New(t)
+	_, client := newTestClient(c)
+
+	_, err := New(&Config{
+		Client:       client,
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "main",
+	})
+	c.Assert(err, qt.ErrorMatches, "exactly one of expected snapshot and compare branch must be set")
+
+	_, err = New(&Config{
+		Client:        client,
+		Organization:  "my-org",
+		Database:      "my-db",
+		Branch:        "main",
+		CompareBranch: "dev",
+		Expected:      &schema.Snapshot{},
+	})
+	c.Assert(err, qt.ErrorMatches, "exactly one of expected snapshot and compare branch must be set")
+}
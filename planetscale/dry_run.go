@@ -0,0 +1,99 @@
+package planetscale
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// PlannedRequest is a mutating request that was not sent to the API because
+// the client is in dry-run mode.
+type PlannedRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// dryRunPlan records the requests of a client in dry-run mode.
+type dryRunPlan struct {
+	mu       sync.Mutex
+	requests []*PlannedRequest
+}
+
+// WithDryRun configures the client to not send any mutating (non-GET)
+// requests. Instead, the request is recorded in the plan returned by
+// DryRunPlan and the call returns a result synthesized from the request body.
+// GET requests are sent as usual.
+//
+// Synthesized results only contain the fields that are part of the request,
+// such as the name of a new database. Certificates can't be synthesized, so
+// CertificatesService.Create returns an error in dry-run mode.
+func WithDryRun() ClientOption {
+	return func(c *Client) error {
+		c.dryRun = &dryRunPlan{}
+		return nil
+	}
+}
+
+// DryRun reports whether the client is in dry-run mode.
+func (c *Client) DryRun() bool {
+	return c.dryRun != nil
+}
+
+// DryRunPlan returns the requests that would have been sent so far, in
+// order. It returns nil if the client is not in dry-run mode.
+func (c *Client) DryRunPlan() []*PlannedRequest {
+	if c.dryRun == nil {
+		return nil
+	}
+
+	c.dryRun.mu.Lock()
+	defer c.dryRun.mu.Unlock()
+
+	plan := make([]*PlannedRequest, len(c.dryRun.requests))
+	copy(plan, c.dryRun.requests)
+	return plan
+}
+
+// plan records the request and populates v with the request body.
+func (p *dryRunPlan) plan(req *http.Request, v interface{}) error {
+	planned := &PlannedRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		out, err := ioutil.ReadAll(body)
+		if err != nil {
+			return err
+		}
+
+		if out = bytes.TrimSpace(out); len(out) > 0 {
+			planned.Body = json.RawMessage(out)
+		}
+	}
+
+	p.mu.Lock()
+	p.requests = append(p.requests, planned)
+	p.mu.Unlock()
+
+	if v == nil || planned.Body == nil {
+		return nil
+	}
+
+	// The request and response types share most of their field names, e.g.
+	// "name" or "branch". Fields that differ in type are left empty.
+	err := json.Unmarshal(planned.Body, &v)
+	if _, ok := err.(*json.UnmarshalTypeError); ok {
+		return nil
+	}
+	return err
+}
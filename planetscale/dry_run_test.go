@@ -0,0 +1,97 @@
+package planetscale
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDryRun(t *testing.T) {
+	c := qt.New(t)
+
+	var sent []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method+" "+r.URL.Path)
+		w.WriteHeader(200)
+		_, err := w.Write([]byte(`{"name":"planetscale-go-test-db","state":"ready"}`))
+		c.Assert(err, qt.IsNil)
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(WithBaseURL(ts.URL), WithDryRun())
+	c.Assert(err, qt.IsNil)
+	c.Assert(client.DryRun(), qt.IsTrue)
+
+	ctx := context.Background()
+
+	db, err := client.Databases.Create(ctx, &CreateDatabaseRequest{
+		Organization: testOrg,
+		Name:         testDatabase,
+		Notes:        "This is a test DB created from the planetscale-go API library",
+		Region:       "us-east",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(db, qt.DeepEquals, &Database{
+		Name:  testDatabase,
+		Notes: "This is a test DB created from the planetscale-go API library",
+	})
+
+	err = client.Databases.Delete(ctx, &DeleteDatabaseRequest{
+		Organization: testOrg,
+		Database:     testDatabase,
+	})
+	c.Assert(err, qt.IsNil)
+
+	// GET requests are sent
+	db, err = client.Databases.Get(ctx, &GetDatabaseRequest{
+		Organization: testOrg,
+		Database:     testDatabase,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(db.State, qt.Equals, "ready")
+
+	c.Assert(sent, qt.DeepEquals, []string{"GET /v1/organizations/my-org/databases/planetscale-go-test-db"})
+
+	plan := client.DryRunPlan()
+	c.Assert(plan, qt.HasLen, 2)
+	c.Assert(plan[0].Method, qt.Equals, http.MethodPost)
+	c.Assert(plan[0].Path, qt.Equals, "/v1/organizations/my-org/databases")
+	c.Assert(string(plan[0].Body), qt.Equals, `{"Organization":"my-org","name":"planetscale-go-test-db","notes":"This is a test DB created from the planetscale-go API library","region":"us-east"}`)
+	c.Assert(plan[1], qt.DeepEquals, &PlannedRequest{
+		Method: http.MethodDelete,
+		Path:   "/v1/organizations/my-org/databases/planetscale-go-test-db",
+	})
+}
+
+func TestDryRun_certificates(t *testing.T) {
+	c := qt.New(t)
+
+	client, err := NewClient(WithDryRun())
+	c.Assert(err, qt.IsNil)
+
+	pkey, err := rsa.GenerateKey(rand.Reader, 1024)
+	c.Assert(err, qt.IsNil)
+
+	_, err = client.Certificates.Create(context.Background(), &CreateCertificateRequest{
+		Organization: testOrg,
+		DatabaseName: testDatabase,
+		Branch:       "main",
+		PrivateKey:   pkey,
+	})
+	c.Assert(err, qt.ErrorMatches, "certificates can't be created in dry-run mode")
+	c.Assert(client.DryRunPlan(), qt.HasLen, 1)
+}
+
+func TestDryRunPlan_disabled(t *testing.T) {
+	c := qt.New(t)
+
+	client, err := NewClient()
+	c.Assert(err, qt.IsNil)
+	c.Assert(client.DryRun(), qt.IsFalse)
+	c.Assert(client.DryRunPlan(), qt.IsNil)
+}
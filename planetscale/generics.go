@@ -0,0 +1,213 @@
+//go:build go1.21
+// +build go1.21
+
+package planetscale
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ListResponse is the envelope of the list endpoints of the API.
+type ListResponse[T any] struct {
+	Type     string  `json:"type"`
+	NextPage *string `json:"next_page"`
+	PrevPage *string `json:"prev_page"`
+	Data     []T     `json:"data"`
+}
+
+// GetList fetches the list endpoint at the given API path, e.g.
+// "v1/organizations/my-org/databases", and returns the decoded items. It can
+// be used for list endpoints that have no service method yet.
+func GetList[T any](ctx context.Context, c *Client, path string) ([]T, error) {
+	req, err := c.newRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request for list %s: %s", path, err)
+	}
+
+	res := &ListResponse[T]{}
+	if err := c.do(ctx, req, res); err != nil {
+		return nil, err
+	}
+
+	return res.Data, nil
+}
+
+// Iterator iterates over the items returned by a list function. The list
+// function is called lazily on the first call to Next.
+//
+//	it := planetscale.Iterate(func(ctx context.Context) ([]*planetscale.Database, error) {
+//		return client.Databases.List(ctx, listReq)
+//	})
+//	for it.Next(ctx) {
+//		fmt.Println(it.Value().Name)
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type Iterator[T any] struct {
+	list func(context.Context) ([]T, error)
+
+	fetched bool
+	items   []T
+	pos     int
+	err     error
+}
+
+// Iterate returns an iterator over the items returned by list.
+func Iterate[T any](list func(context.Context) ([]T, error)) *Iterator[T] {
+	return &Iterator[T]{list: list, pos: -1}
+}
+
+// Next advances the iterator to the next item. It returns false if there are
+// no more items or the list function failed.
+func (it *Iterator[T]) Next(ctx context.Context) bool {
+	if !it.fetched {
+		it.fetched = true
+		it.items, it.err = it.list(ctx)
+	}
+
+	if it.err != nil || it.pos+1 >= len(it.items) {
+		return false
+	}
+
+	it.pos++
+	return true
+}
+
+// Value returns the current item.
+func (it *Iterator[T]) Value() T {
+	if it.pos < 0 || it.pos >= len(it.items) {
+		var zero T
+		return zero
+	}
+	return it.items[it.pos]
+}
+
+// Err returns the error of the list function, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// Waiter polls a resource until a condition is met.
+type Waiter[T any] struct {
+	// Get fetches the current state of the resource.
+	Get func(context.Context) (T, error)
+
+	// Done reports whether waiting is over. A non-nil error stops waiting
+	// and is returned by Wait, e.g. if the resource ended up in a failed
+	// state.
+	Done func(T) (bool, error)
+
+	// Interval is the time between two calls to Get. It defaults to 2
+	// seconds.
+	Interval time.Duration
+}
+
+// Wait calls Get until Done reports true or ctx is done. It returns the last
+// state of the resource.
+func (w *Waiter[T]) Wait(ctx context.Context) (T, error) {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = defaultOperationPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		v, err := w.Get(ctx)
+		if err != nil {
+			return v, err
+		}
+
+		done, err := w.Done(v)
+		if done || err != nil {
+			return v, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return v, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitOperation waits for the operation to finish and returns its typed
+// result. T must match the operation kind, e.g. *Database for an
+// OperationCreateDatabase.
+func WaitOperation[T any](ctx context.Context, op *Operation) (T, error) {
+	var zero T
+	if err := op.Wait(ctx); err != nil {
+		return zero, err
+	}
+
+	result, err := op.Result()
+	if result == nil {
+		return zero, err
+	}
+
+	v, ok := result.(T)
+	if !ok {
+		return zero, fmt.Errorf("result of %s operation is %T, not %T", op.Kind, result, zero)
+	}
+
+	return v, err
+}
+
+// Result is the outcome of a single call of a batch.
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// Batch calls fn for every input with at most concurrency calls in
+// parallel. The results are in the same order as the inputs. A concurrency of
+// zero or less runs all calls in parallel.
+func Batch[In, Out any](ctx context.Context, inputs []In, concurrency int, fn func(context.Context, In) (Out, error)) []Result[Out] {
+	if concurrency <= 0 || concurrency > len(inputs) {
+		concurrency = len(inputs)
+	}
+
+	results := make([]Result[Out], len(inputs))
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, in := range inputs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, in In) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := ctx.Err(); err != nil {
+				results[i].Err = err
+				return
+			}
+
+			results[i].Value, results[i].Err = fn(ctx, in)
+		}(i, in)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// Collect returns the values of the results. It returns the first error if any
+// of the calls failed.
+func Collect[T any](results []Result[T]) ([]T, error) {
+	values := make([]T, 0, len(results))
+	for _, r := range results {
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		values = append(values, r.Value)
+	}
+	return values, nil
+}
@@ -0,0 +1,148 @@
+//go:build go1.21
+// +build go1.21
+
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestGetList(t *testing.T) {
+	c := qt.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Path, qt.Equals, "/v1/organizations/my-org/databases/my-db/branches")
+		w.WriteHeader(200)
+		out := `{"type":"list","next_page":null,"prev_page":null,"data":[{"name":"main"},{"name":"dev","parent_branch":"main"}]}`
+		_, err := w.Write([]byte(out))
+		c.Assert(err, qt.IsNil)
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	branches, err := GetList[*DatabaseBranch](context.Background(), client, databaseBranchesAPIPath(testOrg, "my-db"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(branches, qt.DeepEquals, []*DatabaseBranch{
+		{Name: "main"},
+		{Name: "dev", ParentBranch: "main"},
+	})
+}
+
+func TestIterator(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	calls := 0
+	it := Iterate(func(context.Context) ([]*Database, error) {
+		calls++
+		return []*Database{{Name: "db-1"}, {Name: "db-2"}}, nil
+	})
+
+	var names []string
+	for it.Next(ctx) {
+		names = append(names, it.Value().Name)
+	}
+	c.Assert(it.Err(), qt.IsNil)
+	c.Assert(names, qt.DeepEquals, []string{"db-1", "db-2"})
+	c.Assert(it.Next(ctx), qt.IsFalse)
+	c.Assert(calls, qt.Equals, 1)
+
+	it = Iterate(func(context.Context) ([]*Database, error) {
+		return nil, errors.New("api unavailable")
+	})
+	c.Assert(it.Next(ctx), qt.IsFalse)
+	c.Assert(it.Value(), qt.IsNil)
+	c.Assert(it.Err(), qt.ErrorMatches, "api unavailable")
+}
+
+func TestWaiter(t *testing.T) {
+	c := qt.New(t)
+
+	states := []string{"pending", "pending", "ready"}
+	w := &Waiter[*Database]{
+		Get: func(context.Context) (*Database, error) {
+			db := &Database{Name: testDatabase, State: states[0]}
+			states = states[1:]
+			return db, nil
+		},
+		Done: func(db *Database) (bool, error) {
+			return db.State == "ready", nil
+		},
+		Interval: time.Millisecond,
+	}
+
+	db, err := w.Wait(context.Background())
+	c.Assert(err, qt.IsNil)
+	c.Assert(db.State, qt.Equals, "ready")
+
+	w.Get = func(context.Context) (*Database, error) {
+		return &Database{State: "pending"}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = w.Wait(ctx)
+	c.Assert(err, qt.Equals, context.DeadlineExceeded)
+}
+
+func TestWaitOperation(t *testing.T) {
+	c := qt.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		_, err := w.Write([]byte(`{"name":"planetscale-go-test-db","state":"ready"}`))
+		c.Assert(err, qt.IsNil)
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	op, err := client.Operations.CreateDatabase(ctx, &CreateDatabaseRequest{
+		Organization: testOrg,
+		Name:         testDatabase,
+	})
+	c.Assert(err, qt.IsNil)
+
+	db, err := WaitOperation[*Database](ctx, op)
+	c.Assert(err, qt.IsNil)
+	c.Assert(db.State, qt.Equals, "ready")
+
+	_, err = WaitOperation[*Backup](ctx, op)
+	c.Assert(err, qt.ErrorMatches, `result of create_database operation is \*planetscale.Database, not \*planetscale.Backup`)
+}
+
+func TestBatch(t *testing.T) {
+	c := qt.New(t)
+
+	inputs := []string{"db-1", "db-2", "db-3", "db-4"}
+	results := Batch(context.Background(), inputs, 2, func(_ context.Context, name string) (*Database, error) {
+		if name == "db-3" {
+			return nil, fmt.Errorf("%s not found", name)
+		}
+		return &Database{Name: name}, nil
+	})
+
+	c.Assert(results, qt.HasLen, 4)
+	c.Assert(results[0].Value.Name, qt.Equals, "db-1")
+	c.Assert(results[1].Value.Name, qt.Equals, "db-2")
+	c.Assert(results[2].Err, qt.ErrorMatches, "db-3 not found")
+	c.Assert(results[3].Value.Name, qt.Equals, "db-4")
+
+	_, err := Collect(results)
+	c.Assert(err, qt.ErrorMatches, "db-3 not found")
+
+	values, err := Collect(results[:2])
+	c.Assert(err, qt.IsNil)
+	c.Assert(values, qt.HasLen, 2)
+}
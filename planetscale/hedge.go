@@ -0,0 +1,291 @@
+package planetscale
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHedgePercentile   = 0.95
+	defaultHedgeMinSamples   = 20
+	defaultHedgeWindowSize   = 200
+	defaultHedgeMaxExtraLoad = 0.1
+
+	// hedgeBudgetBurst is the maximum number of hedges that can be sent in
+	// a row after a quiet period.
+	hedgeBudgetBurst = 10
+)
+
+// HedgeConfig defines how GET requests are hedged. If no response arrives
+// within the hedge delay, a second identical request is sent and the first
+// successful response is used.
+type HedgeConfig struct {
+	// Percentile of the recent response latencies that is used as the hedge
+	// delay, e.g. 0.95 hedges the slowest 5% of requests. Defaults to 0.95.
+	Percentile float64
+
+	// MinDelay and MaxDelay bound the hedge delay. MaxDelay is the delay
+	// after which a request is always hedged, e.g. a latency SLO. If zero,
+	// the delay isn't bounded.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+
+	// MinSamples is the number of latencies that are needed before the
+	// percentile is used. Until then, requests are only hedged after
+	// MaxDelay. Defaults to 20.
+	MinSamples int
+
+	// WindowSize is the number of most recent latencies the percentile is
+	// computed from. Defaults to 200.
+	WindowSize int
+
+	// MaxExtraLoad caps the hedged requests as a fraction of all GET
+	// requests, e.g. 0.1 allows at most 10% extra requests. Defaults to 0.1.
+	MaxExtraLoad float64
+
+	// OnResult is called after every GET request with its outcome. It can
+	// be used to export metrics. It's called synchronously and must not
+	// block.
+	OnResult func(HedgeResult)
+}
+
+// HedgeResult describes the outcome of a single, possibly hedged, GET
+// request.
+type HedgeResult struct {
+	// Path is the URL path of the request.
+	Path string
+
+	// Delay is the hedge delay that was used for the request. It's zero if
+	// there were not enough samples yet and MaxDelay isn't set, in which case
+	// the request isn't hedged.
+	Delay time.Duration
+
+	// Latency is the time until the response that was used arrived.
+	Latency time.Duration
+
+	// Hedged reports whether a second request was sent.
+	Hedged bool
+
+	// HedgeWon reports whether the response of the second request was
+	// used.
+	HedgeWon bool
+
+	// Throttled reports whether a second request was due, but not sent
+	// because MaxExtraLoad was reached.
+	Throttled bool
+}
+
+// WithHedging configures the client to hedge GET requests. A nil config uses
+// the defaults.
+func WithHedging(cfg *HedgeConfig) ClientOption {
+	return func(c *Client) error {
+		h := &hedger{}
+		if cfg != nil {
+			h.cfg = *cfg
+		}
+
+		if h.cfg.Percentile <= 0 || h.cfg.Percentile >= 1 {
+			h.cfg.Percentile = defaultHedgePercentile
+		}
+		if h.cfg.MinSamples <= 0 {
+			h.cfg.MinSamples = defaultHedgeMinSamples
+		}
+		if h.cfg.WindowSize <= 0 {
+			h.cfg.WindowSize = defaultHedgeWindowSize
+		}
+		if h.cfg.MaxExtraLoad <= 0 {
+			h.cfg.MaxExtraLoad = defaultHedgeMaxExtraLoad
+		}
+
+		h.latencies = make([]time.Duration, 0, h.cfg.WindowSize)
+		h.budget = hedgeBudgetBurst
+
+		c.hedger = h
+		return nil
+	}
+}
+
+type hedger struct {
+	cfg HedgeConfig
+
+	mu        sync.Mutex
+	latencies []time.Duration // ring buffer of the recent latencies
+	next      int
+	budget    float64
+}
+
+type hedgeAttempt struct {
+	res   *http.Response
+	err   error
+	index int // 0 for the original request, 1 for the hedge
+}
+
+// do sends the GET request and hedges it if there's no response within the
+// hedge delay.
+func (h *hedger) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	result := HedgeResult{Path: req.URL.Path}
+
+	delay, ok := h.delay()
+	result.Delay = delay
+
+	h.mu.Lock()
+	h.budget += h.cfg.MaxExtraLoad
+	if h.budget > hedgeBudgetBurst {
+		h.budget = hedgeBudgetBurst
+	}
+	h.mu.Unlock()
+
+	attempts := make(chan *hedgeAttempt, 2)
+	var cancels []context.CancelFunc
+	send := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			res, err := client.Do(req.Clone(ctx))
+			attempts <- &hedgeAttempt{res: res, err: err, index: index}
+		}()
+	}
+	discard := func(a *hedgeAttempt) {
+		cancels[a.index]()
+		if a.res != nil {
+			a.res.Body.Close()
+		}
+	}
+
+	send()
+	inflight := 1
+
+	var timer <-chan time.Time
+	if ok {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	for {
+		select {
+		case <-timer:
+			timer = nil
+			if !h.spend() {
+				result.Throttled = true
+				continue
+			}
+
+			result.Hedged = true
+			send()
+			inflight++
+		case a := <-attempts:
+			inflight--
+
+			// wait for the other request if this one failed
+			if !hedgeSucceeded(a) && inflight > 0 {
+				discard(a)
+				continue
+			}
+
+			// cancel and discard the requests that are still in flight
+			for i, cancel := range cancels {
+				if i != a.index {
+					cancel()
+				}
+			}
+			go func(n int) {
+				for i := 0; i < n; i++ {
+					discard(<-attempts)
+				}
+			}(inflight)
+
+			result.Latency = time.Since(start)
+			result.HedgeWon = a.index == 1
+			if hedgeSucceeded(a) {
+				h.observe(result.Latency)
+			}
+			if h.cfg.OnResult != nil {
+				h.cfg.OnResult(result)
+			}
+
+			if a.err != nil {
+				cancels[a.index]()
+				return nil, a.err
+			}
+
+			a.res.Body = &cancelOnClose{ReadCloser: a.res.Body, cancel: cancels[a.index]}
+			return a.res, nil
+		}
+	}
+}
+
+// delay returns the hedge delay. It reports false if requests shouldn't be
+// hedged at all.
+func (h *hedger) delay() (time.Duration, bool) {
+	h.mu.Lock()
+	if len(h.latencies) < h.cfg.MinSamples {
+		h.mu.Unlock()
+		return h.cfg.MaxDelay, h.cfg.MaxDelay > 0
+	}
+
+	sorted := make([]time.Duration, len(h.latencies))
+	copy(sorted, h.latencies)
+	h.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	d := sorted[int(float64(len(sorted)-1)*h.cfg.Percentile)]
+
+	if d < h.cfg.MinDelay {
+		d = h.cfg.MinDelay
+	}
+	if h.cfg.MaxDelay > 0 && d > h.cfg.MaxDelay {
+		d = h.cfg.MaxDelay
+	}
+
+	return d, true
+}
+
+// spend takes a hedge from the budget. It reports false if the budget is
+// exhausted.
+func (h *hedger) spend() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.budget < 1 {
+		return false
+	}
+	h.budget--
+	return true
+}
+
+func (h *hedger) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.latencies) < h.cfg.WindowSize {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % h.cfg.WindowSize
+}
+
+func hedgeSucceeded(a *hedgeAttempt) bool {
+	return a.err == nil && a.res.StatusCode < 500
+}
+
+// cancelOnClose cancels the context of a request once its response body is
+// closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
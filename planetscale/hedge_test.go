@@ -0,0 +1,160 @@
+package planetscale
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestHedging(t *testing.T) {
+	c := qt.New(t)
+
+	var calls int32
+	canceled := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first request hangs until it's canceled
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-r.Context().Done()
+			close(canceled)
+			return
+		}
+
+		w.WriteHeader(200)
+		_, _ = w.Write([]byte(`{"name":"planetscale-go-test-db"}`))
+	}))
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var results []HedgeResult
+	client, err := NewClient(WithBaseURL(ts.URL), WithHedging(&HedgeConfig{
+		MaxDelay: 10 * time.Millisecond,
+		OnResult: func(r HedgeResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, r)
+		},
+	}))
+	c.Assert(err, qt.IsNil)
+
+	db, err := client.Databases.Get(context.Background(), &GetDatabaseRequest{
+		Organization: testOrg,
+		Database:     testDatabase,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(db.Name, qt.Equals, testDatabase)
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		c.Fatal("slow request was not canceled")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(results, qt.HasLen, 1)
+	c.Assert(results[0].Path, qt.Equals, "/v1/organizations/my-org/databases/planetscale-go-test-db")
+	c.Assert(results[0].Delay, qt.Equals, 10*time.Millisecond)
+	c.Assert(results[0].Hedged, qt.IsTrue)
+	c.Assert(results[0].HedgeWon, qt.IsTrue)
+	c.Assert(results[0].Throttled, qt.IsFalse)
+}
+
+func TestHedging_throttled(t *testing.T) {
+	c := qt.New(t)
+
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(200)
+		_, _ = w.Write([]byte(`{"name":"planetscale-go-test-db"}`))
+	}))
+	defer ts.Close()
+
+	var result HedgeResult
+	client, err := NewClient(WithBaseURL(ts.URL), WithHedging(&HedgeConfig{
+		MaxDelay:     time.Millisecond,
+		MaxExtraLoad: 0.01,
+		OnResult:     func(r HedgeResult) { result = r },
+	}))
+	c.Assert(err, qt.IsNil)
+	client.hedger.budget = 0
+
+	_, err = client.Databases.Get(context.Background(), &GetDatabaseRequest{
+		Organization: testOrg,
+		Database:     testDatabase,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), qt.Equals, int32(1))
+	c.Assert(result.Hedged, qt.IsFalse)
+	c.Assert(result.Throttled, qt.IsTrue)
+}
+
+func TestHedging_mutatingRequestsNotHedged(t *testing.T) {
+	c := qt.New(t)
+
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(200)
+		_, _ = w.Write([]byte(`{"name":"planetscale-go-test-db"}`))
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(WithBaseURL(ts.URL), WithHedging(&HedgeConfig{
+		MaxDelay: time.Millisecond,
+	}))
+	c.Assert(err, qt.IsNil)
+
+	_, err = client.Databases.Create(context.Background(), &CreateDatabaseRequest{
+		Organization: testOrg,
+		Name:         testDatabase,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), qt.Equals, int32(1))
+}
+
+func TestHedger_delay(t *testing.T) {
+	c := qt.New(t)
+
+	client, err := NewClient(WithHedging(&HedgeConfig{
+		Percentile: 0.9,
+		MinSamples: 10,
+		WindowSize: 10,
+		MinDelay:   2 * time.Millisecond,
+		MaxDelay:   50 * time.Millisecond,
+	}))
+	c.Assert(err, qt.IsNil)
+	h := client.hedger
+
+	// not enough samples yet
+	d, ok := h.delay()
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(d, qt.Equals, 50*time.Millisecond)
+
+	for i := 1; i <= 10; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	d, _ = h.delay()
+	c.Assert(d, qt.Equals, 9*time.Millisecond)
+
+	// old samples are replaced
+	for i := 0; i < 10; i++ {
+		h.observe(time.Second)
+	}
+	d, _ = h.delay()
+	c.Assert(d, qt.Equals, 50*time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		h.observe(time.Microsecond)
+	}
+	d, _ = h.delay()
+	c.Assert(d, qt.Equals, 2*time.Millisecond)
+}
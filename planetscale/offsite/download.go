@@ -0,0 +1,216 @@
+package offsite
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+const (
+	defaultMaxRetries = 5
+	defaultRetryDelay = time.Second
+)
+
+// Downloader downloads backup exports to local files.
+type Downloader struct {
+	// HTTPClient is used to download exports. Defaults to
+	// cleanhttp.DefaultClient().
+	HTTPClient *http.Client
+
+	// MaxRetries is the number of times an interrupted download is resumed.
+	// Defaults to 5.
+	MaxRetries int
+
+	// RetryDelay is the time to wait before resuming a download. Defaults
+	// to 1 second.
+	RetryDelay time.Duration
+}
+
+// statusError is returned for unexpected response status codes.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d", e.code)
+}
+
+// Download downloads an export to path. The data is written to path with a
+// ".part" suffix, which is renamed to path once the size and the SHA-256
+// checksum of the data match the export. Interrupted downloads are resumed
+// with range requests, both within a call and across calls: an existing
+// ".part" file is continued instead of downloaded again. If path already
+// holds the data of the export, it's kept and nothing is downloaded.
+func (d *Downloader) Download(ctx context.Context, export *ps.BackupExport, path string) error {
+	if ok, err := downloaded(export, path); err != nil || ok {
+		return err
+	}
+
+	part := path + ".part"
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// hash the data of an earlier attempt, which leaves f at its end
+	h := sha256.New()
+	offset, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if offset > export.Size {
+		if offset, err = restart(f, h); err != nil {
+			return err
+		}
+	}
+
+	maxRetries := d.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+	retryDelay := d.RetryDelay
+	if retryDelay <= 0 {
+		retryDelay = defaultRetryDelay
+	}
+
+	for attempt := 0; offset < export.Size; attempt++ {
+		offset, err = d.fetch(ctx, export.URL, offset, f, h)
+		if err == nil {
+			break
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// client errors such as an expired URL won't go away
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.code < 500 {
+			return fmt.Errorf("downloading backup: %w", err)
+		}
+
+		if attempt == maxRetries {
+			return fmt.Errorf("downloading backup: giving up after %d attempts: %w", attempt+1, err)
+		}
+
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if offset != export.Size {
+		return fmt.Errorf("downloaded %d bytes, expected %d", offset, export.Size)
+	}
+
+	if export.SHA256 != "" {
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != export.SHA256 {
+			// the data is corrupt, so don't resume from it
+			f.Close()
+			os.Remove(part)
+			return fmt.Errorf("checksum mismatch: got %s, expected %s", sum, export.SHA256)
+		}
+	}
+
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(part, path)
+}
+
+// downloaded reports whether path holds the data of export, e.g. because an
+// earlier call downloaded it.
+func downloaded(export *ps.BackupExport, path string) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if fi.Size() != export.Size {
+		return false, nil
+	}
+
+	if export.SHA256 == "" {
+		return true, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, err
+	}
+	return hex.EncodeToString(h.Sum(nil)) == export.SHA256, nil
+}
+
+// fetch downloads the data of url from offset, appending it to f and h. It
+// returns the new offset, which is set even if the download fails midway.
+func (d *Downloader) fetch(ctx context.Context, url string, offset int64, f *os.File, h hash.Hash) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return offset, err
+	}
+	req = req.WithContext(ctx)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	client := d.HTTPClient
+	if client == nil {
+		client = cleanhttp.DefaultClient()
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return offset, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// the server ignored the range, so start over
+		if offset > 0 {
+			if offset, err = restart(f, h); err != nil {
+				return offset, err
+			}
+		}
+	default:
+		return offset, &statusError{code: resp.StatusCode}
+	}
+
+	n, err := io.Copy(io.MultiWriter(f, h), resp.Body)
+	return offset + n, err
+}
+
+// restart discards the data downloaded so far.
+func restart(f *os.File, h hash.Hash) (int64, error) {
+	h.Reset()
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return 0, err
+}
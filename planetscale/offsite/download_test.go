@@ -0,0 +1,243 @@
+package offsite
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+var testSchema = map[string]string{
+	"users": "CREATE TABLE `users` (`id` bigint, `email` varchar(255))",
+	"posts": "CREATE TABLE `posts` (`id` bigint, `title` text)",
+}
+
+// newTestBackup creates a completed backup of the main branch of my-db.
+func newTestBackup(c *qt.C) (*fakeapi.Server, *ps.Client, *ps.Backup) {
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+	c.Assert(api.SetSchema("my-org", "my-db", "main", testSchema), qt.IsNil)
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	backup, err := client.Backups.Create(ctx, &ps.CreateBackupRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "main",
+	})
+	c.Assert(err, qt.IsNil)
+
+	// backups of the fake API complete once they're fetched
+	for i := 0; i < 2; i++ {
+		backup, err = client.Backups.Get(ctx, &ps.GetBackupRequest{
+			Organization: "my-org",
+			Database:     "my-db",
+			Branch:       "main",
+			Backup:       backup.Name,
+		})
+		c.Assert(err, qt.IsNil)
+	}
+	c.Assert(backup.State, qt.Equals, "success")
+
+	return api, client, backup
+}
+
+func newTestExport(c *qt.C) (*fakeapi.Server, *ps.BackupExport, []byte) {
+	api, client, backup := newTestBackup(c)
+
+	export, err := client.BackupExports.Export(context.Background(), &ps.ExportBackupRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "main",
+		Backup:       backup.Name,
+	})
+	c.Assert(err, qt.IsNil)
+
+	data, err := api.BackupData("my-org", "my-db", "main", backup.Name)
+	c.Assert(err, qt.IsNil)
+	c.Assert(export.Size, qt.Equals, int64(len(data)))
+
+	return api, export, data
+}
+
+func TestDownload(t *testing.T) {
+	c := qt.New(t)
+	_, export, want := newTestExport(c)
+	path := filepath.Join(c.TempDir(), "backup")
+
+	d := &Downloader{}
+	c.Assert(d.Download(context.Background(), export, path), qt.IsNil)
+
+	got, err := ioutil.ReadFile(path)
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.DeepEquals, want)
+
+	_, err = os.Stat(path + ".part")
+	c.Assert(os.IsNotExist(err), qt.IsTrue)
+}
+
+func TestDownload_resume(t *testing.T) {
+	c := qt.New(t)
+	api, export, want := newTestExport(c)
+	path := filepath.Join(c.TempDir(), "backup")
+
+	// the first response is cut off and the download resumed
+	api.InterruptExport(1000)
+
+	d := &Downloader{RetryDelay: time.Millisecond}
+	c.Assert(d.Download(context.Background(), export, path), qt.IsNil)
+
+	got, err := ioutil.ReadFile(path)
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.DeepEquals, want)
+
+	downloads := 0
+	for _, r := range api.Requests() {
+		if strings.HasPrefix(r, "GET /exports/") {
+			downloads++
+		}
+	}
+	c.Assert(downloads, qt.Equals, 2)
+}
+
+func TestDownload_resumePartFile(t *testing.T) {
+	c := qt.New(t)
+	var ranges []string
+	want := bytes.Repeat([]byte("backup data\n"), 100)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "backup", time.Time{}, bytes.NewReader(want))
+	}))
+	defer ts.Close()
+
+	export := &ps.BackupExport{URL: ts.URL, Size: int64(len(want)), SHA256: sha256Hex(want)}
+
+	// a previous call downloaded the first 500 bytes
+	path := filepath.Join(c.TempDir(), "backup")
+	c.Assert(ioutil.WriteFile(path+".part", want[:500], 0600), qt.IsNil)
+
+	d := &Downloader{}
+	c.Assert(d.Download(context.Background(), export, path), qt.IsNil)
+	c.Assert(ranges, qt.DeepEquals, []string{"bytes=500-"})
+
+	got, err := ioutil.ReadFile(path)
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.DeepEquals, want)
+}
+
+func TestDownload_completed(t *testing.T) {
+	c := qt.New(t)
+	requests := 0
+	want := bytes.Repeat([]byte("backup data\n"), 100)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write(want)
+	}))
+	defer ts.Close()
+
+	export := &ps.BackupExport{URL: ts.URL, Size: int64(len(want)), SHA256: sha256Hex(want)}
+
+	// a previous call downloaded the whole backup
+	path := filepath.Join(c.TempDir(), "backup")
+	c.Assert(ioutil.WriteFile(path, want, 0600), qt.IsNil)
+
+	d := &Downloader{}
+	c.Assert(d.Download(context.Background(), export, path), qt.IsNil)
+	c.Assert(requests, qt.Equals, 0)
+
+	// a file with other data is replaced
+	c.Assert(ioutil.WriteFile(path, bytes.ToUpper(want), 0600), qt.IsNil)
+	c.Assert(d.Download(context.Background(), export, path), qt.IsNil)
+	c.Assert(requests, qt.Equals, 1)
+
+	got, err := ioutil.ReadFile(path)
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.DeepEquals, want)
+}
+
+func TestDownload_rangeIgnored(t *testing.T) {
+	c := qt.New(t)
+	want := bytes.Repeat([]byte("backup data\n"), 100)
+
+	// the server always sends the whole file
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(want)
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(c.TempDir(), "backup")
+	c.Assert(ioutil.WriteFile(path+".part", want[:500], 0600), qt.IsNil)
+
+	d := &Downloader{}
+	export := &ps.BackupExport{URL: ts.URL, Size: int64(len(want)), SHA256: sha256Hex(want)}
+	c.Assert(d.Download(context.Background(), export, path), qt.IsNil)
+
+	got, err := ioutil.ReadFile(path)
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.DeepEquals, want)
+}
+
+func TestDownload_checksumMismatch(t *testing.T) {
+	c := qt.New(t)
+	_, export, _ := newTestExport(c)
+	path := filepath.Join(c.TempDir(), "backup")
+
+	export.SHA256 = sha256Hex([]byte("something else"))
+
+	d := &Downloader{}
+	err := d.Download(context.Background(), export, path)
+	c.Assert(err, qt.ErrorMatches, "checksum mismatch: got [0-9a-f]{64}, expected "+export.SHA256)
+
+	// corrupt data isn't kept
+	for _, p := range []string{path, path + ".part"} {
+		_, err = os.Stat(p)
+		c.Assert(os.IsNotExist(err), qt.IsTrue)
+	}
+}
+
+func TestDownload_expired(t *testing.T) {
+	c := qt.New(t)
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	d := &Downloader{RetryDelay: time.Millisecond}
+	export := &ps.BackupExport{URL: ts.URL, Size: 100}
+	err := d.Download(context.Background(), export, filepath.Join(c.TempDir(), "backup"))
+	c.Assert(err, qt.ErrorMatches, "downloading backup: unexpected status 403")
+
+	// client errors aren't retried
+	c.Assert(requests, qt.Equals, 1)
+}
+
+func TestDownload_giveUp(t *testing.T) {
+	c := qt.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	d := &Downloader{MaxRetries: 2, RetryDelay: time.Millisecond}
+	export := &ps.BackupExport{URL: ts.URL, Size: 100}
+	err := d.Download(context.Background(), export, filepath.Join(c.TempDir(), "backup"))
+	c.Assert(err, qt.ErrorMatches, "downloading backup: giving up after 3 attempts: unexpected status 503")
+}
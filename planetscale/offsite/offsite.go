@@ -0,0 +1,181 @@
+// Package offsite copies completed backups of a database branch to object
+// storage outside of PlanetScale:
+//
+//	uploader, err := offsite.NewS3Uploader(&offsite.S3Config{
+//		Endpoint:        "https://s3.eu-west-1.amazonaws.com",
+//		Region:          "eu-west-1",
+//		Bucket:          "my-backups",
+//		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+//		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	c, err := offsite.New(&offsite.Config{
+//		Client:       client,
+//		Organization: "my-org",
+//		Database:     "my-db",
+//		Branch:       "main",
+//		Uploader:     uploader,
+//		Dir:          "/var/lib/backups",
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	res, err := c.Copy(ctx, backup.Name)
+//
+// A backup is exported, downloaded to a local directory and verified
+// against its checksum before it's uploaded. Downloads are resumed and a
+// downloaded backup is kept until it's uploaded, so a failed Copy can be
+// retried without downloading the whole backup again.
+package offsite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+// Config defines the configuration of a Copier.
+type Config struct {
+	// Client defines a PlanetScale client. Use planetscale.NewClient() to
+	// create a new instance.
+	Client *ps.Client
+
+	// Organization, Database and Branch are the branch whose backups are
+	// copied.
+	Organization string
+	Database     string
+	Branch       string
+
+	// Uploader uploads the backups.
+	Uploader Uploader
+
+	// Dir is the directory backups are downloaded to before they're
+	// uploaded. Defaults to os.TempDir().
+	Dir string
+
+	// Prefix is prepended to the object keys, which are
+	// <organization>/<database>/<branch>/<backup> otherwise.
+	Prefix string
+
+	// Downloader downloads the exports. Defaults to a Downloader with the
+	// default settings.
+	Downloader *Downloader
+}
+
+// Result describes a copied backup.
+type Result struct {
+	Backup string
+	Key    string
+	Size   int64
+	SHA256 string
+}
+
+// Copier copies backups to object storage.
+type Copier struct {
+	cfg Config
+}
+
+// New returns a new Copier with the given configuration.
+func New(cfg *Config) (*Copier, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("planetscale Client is not set")
+	}
+
+	if cfg.Organization == "" {
+		return nil, errors.New("organization is not set")
+	}
+
+	if cfg.Database == "" {
+		return nil, errors.New("database is not set")
+	}
+
+	if cfg.Branch == "" {
+		return nil, errors.New("branch is not set")
+	}
+
+	if cfg.Uploader == nil {
+		return nil, errors.New("uploader is not set")
+	}
+
+	c := &Copier{cfg: *cfg}
+	if c.cfg.Dir == "" {
+		c.cfg.Dir = os.TempDir()
+	}
+	if c.cfg.Downloader == nil {
+		c.cfg.Downloader = &Downloader{}
+	}
+
+	return c, nil
+}
+
+// Copy copies a completed backup to object storage. The local copy is
+// removed once it's uploaded, and reused by the next call if the upload
+// fails.
+func (c *Copier) Copy(ctx context.Context, backup string) (*Result, error) {
+	b, err := c.cfg.Client.Backups.Get(ctx, &ps.GetBackupRequest{
+		Organization: c.cfg.Organization,
+		Database:     c.cfg.Database,
+		Branch:       c.cfg.Branch,
+		Backup:       backup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetching backup %s: %w", backup, err)
+	}
+
+	if b.State != "success" {
+		return nil, fmt.Errorf("backup %s is not completed, its state is %q", backup, b.State)
+	}
+
+	export, err := c.cfg.Client.BackupExports.Export(ctx, &ps.ExportBackupRequest{
+		Organization: c.cfg.Organization,
+		Database:     c.cfg.Database,
+		Branch:       c.cfg.Branch,
+		Backup:       backup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("exporting backup %s: %w", backup, err)
+	}
+
+	path := filepath.Join(c.cfg.Dir, fmt.Sprintf("%s-%s-%s-%s.backup", c.cfg.Organization, c.cfg.Database, c.cfg.Branch, backup))
+	if err := c.cfg.Downloader.Download(ctx, export, path); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res := &Result{
+		Backup: backup,
+		Key:    c.cfg.Prefix + fmt.Sprintf("%s/%s/%s/%s", c.cfg.Organization, c.cfg.Database, c.cfg.Branch, backup),
+		Size:   export.Size,
+		SHA256: export.SHA256,
+	}
+
+	err = c.cfg.Uploader.Upload(ctx, &Object{
+		Key:    res.Key,
+		Body:   f,
+		Size:   res.Size,
+		SHA256: res.SHA256,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("uploading backup %s: %w", backup, err)
+	}
+
+	f.Close()
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,182 @@
+package offsite
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+func TestCopy(t *testing.T) {
+	c := qt.New(t)
+	api, client, backup := newTestBackup(c)
+	store, uploader := newTestUploader(c, 1024)
+	dir := c.TempDir()
+
+	cp, err := New(&Config{
+		Client:       client,
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "main",
+		Uploader:     uploader,
+		Dir:          dir,
+		Prefix:       "planetscale/",
+	})
+	c.Assert(err, qt.IsNil)
+
+	res, err := cp.Copy(context.Background(), backup.Name)
+	c.Assert(err, qt.IsNil)
+
+	want, err := api.BackupData("my-org", "my-db", "main", backup.Name)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res, qt.DeepEquals, &Result{
+		Backup: backup.Name,
+		Key:    "planetscale/my-org/my-db/main/" + backup.Name,
+		Size:   int64(len(want)),
+		SHA256: sha256Hex(want),
+	})
+
+	got, ok := store.Object("backups", res.Key)
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(got, qt.DeepEquals, want)
+
+	// the local copy was removed
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, qt.IsNil)
+	c.Assert(files, qt.HasLen, 0)
+}
+
+func TestCopy_retryUpload(t *testing.T) {
+	c := qt.New(t)
+	api, client, backup := newTestBackup(c)
+	store, uploader := newTestUploader(c, 10)
+	dir := c.TempDir()
+
+	cp, err := New(&Config{
+		Client:       client,
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "main",
+		Uploader:     uploader,
+		Dir:          dir,
+	})
+	c.Assert(err, qt.IsNil)
+
+	store.FailPart(2)
+	_, err = cp.Copy(context.Background(), backup.Name)
+	c.Assert(err, qt.ErrorMatches, `uploading backup `+backup.Name+`: uploading part 2: s3: InternalError: .*`)
+
+	// the downloaded backup is kept for the next attempt
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, qt.IsNil)
+	c.Assert(files, qt.HasLen, 1)
+
+	store.FailPart(0)
+	res, err := cp.Copy(context.Background(), backup.Name)
+	c.Assert(err, qt.IsNil)
+
+	want, err := api.BackupData("my-org", "my-db", "main", backup.Name)
+	c.Assert(err, qt.IsNil)
+	got, ok := store.Object("backups", res.Key)
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(got, qt.DeepEquals, want)
+
+	// the backup was downloaded once
+	downloads := 0
+	for _, r := range api.Requests() {
+		if strings.HasPrefix(r, "GET /exports/") {
+			downloads++
+		}
+	}
+	c.Assert(downloads, qt.Equals, 1)
+
+	files, err = ioutil.ReadDir(dir)
+	c.Assert(err, qt.IsNil)
+	c.Assert(files, qt.HasLen, 0)
+}
+
+// uploaderFunc is an Uploader implemented by a function.
+type uploaderFunc func(ctx context.Context, obj *Object) error
+
+func (f uploaderFunc) Upload(ctx context.Context, obj *Object) error {
+	return f(ctx, obj)
+}
+
+func TestCopy_uploadError(t *testing.T) {
+	c := qt.New(t)
+	_, client, backup := newTestBackup(c)
+	errUpload := errors.New("upload failed")
+
+	cp, err := New(&Config{
+		Client:       client,
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "main",
+		Uploader: uploaderFunc(func(ctx context.Context, obj *Object) error {
+			return errUpload
+		}),
+		Dir: c.TempDir(),
+	})
+	c.Assert(err, qt.IsNil)
+
+	_, err = cp.Copy(context.Background(), backup.Name)
+	c.Assert(errors.Is(err, errUpload), qt.IsTrue)
+}
+
+func TestCopy_notCompleted(t *testing.T) {
+	c := qt.New(t)
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	backup, err := client.Backups.Create(context.Background(), &ps.CreateBackupRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "main",
+	})
+	c.Assert(err, qt.IsNil)
+
+	_, uploader := newTestUploader(c, 0)
+	cp, err := New(&Config{
+		Client:       client,
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "main",
+		Uploader:     uploader,
+		Dir:          c.TempDir(),
+	})
+	c.Assert(err, qt.IsNil)
+
+	_, err = cp.Copy(context.Background(), backup.Name)
+	c.Assert(err, qt.ErrorMatches, `backup `+backup.Name+` is not completed, its state is "pending"`)
+}
+
+func TestNew(t *testing.T) {
+	c := qt.New(t)
+	client, err := ps.NewClient()
+	c.Assert(err, qt.IsNil)
+
+	tests := []struct {
+		name string
+		cfg  *Config
+		want string
+	}{
+		{"no client", &Config{}, "planetscale Client is not set"},
+		{"no organization", &Config{Client: client}, "organization is not set"},
+		{"no database", &Config{Client: client, Organization: "my-org"}, "database is not set"},
+		{"no branch", &Config{Client: client, Organization: "my-org", Database: "my-db"}, "branch is not set"},
+		{"no uploader", &Config{Client: client, Organization: "my-org", Database: "my-db", Branch: "main"}, "uploader is not set"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(tt.cfg)
+		c.Assert(err, qt.ErrorMatches, tt.want, qt.Commentf(tt.name))
+	}
+}
@@ -0,0 +1,378 @@
+package offsite
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+const (
+	defaultRegion   = "us-east-1"
+	defaultPartSize = 64 << 20
+)
+
+// S3Config defines the configuration of an S3Uploader.
+type S3Config struct {
+	// Endpoint is the URL of the store, e.g.
+	// "https://s3.eu-west-1.amazonaws.com" or "http://127.0.0.1:9000".
+	Endpoint string
+
+	// Region is the region requests are signed for. Defaults to
+	// "us-east-1", which is also what most S3-compatible stores expect.
+	Region string
+
+	// Bucket is the bucket objects are uploaded to.
+	Bucket string
+
+	// AccessKeyID and SecretAccessKey are the credentials requests are
+	// signed with.
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// PartSize is the size of the parts of multipart uploads. Objects up to
+	// PartSize are uploaded with a single request. S3 requires parts of at
+	// least 5 MiB. Defaults to 64 MiB.
+	PartSize int64
+
+	// HTTPClient defaults to cleanhttp.DefaultClient().
+	HTTPClient *http.Client
+}
+
+// S3Uploader uploads objects to S3 and S3-compatible stores such as MinIO.
+// Requests are signed with AWS Signature Version 4, including the checksum
+// of the data, so the store rejects data that was corrupted on the way.
+// Objects are addressed path-style, i.e. as <endpoint>/<bucket>/<key>.
+type S3Uploader struct {
+	cfg      S3Config
+	endpoint *url.URL
+	now      func() time.Time
+}
+
+var _ Uploader = &S3Uploader{}
+
+// NewS3Uploader returns a new S3Uploader with the given configuration.
+func NewS3Uploader(cfg *S3Config) (*S3Uploader, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("endpoint is not set")
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+
+	if cfg.Bucket == "" {
+		return nil, errors.New("bucket is not set")
+	}
+
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("credentials are not set")
+	}
+
+	u := &S3Uploader{cfg: *cfg, endpoint: endpoint, now: time.Now}
+	if u.cfg.Region == "" {
+		u.cfg.Region = defaultRegion
+	}
+	if u.cfg.PartSize <= 0 {
+		u.cfg.PartSize = defaultPartSize
+	}
+	if u.cfg.HTTPClient == nil {
+		u.cfg.HTTPClient = cleanhttp.DefaultClient()
+	}
+
+	return u, nil
+}
+
+// Upload uploads an object. Objects larger than PartSize are uploaded in
+// parts; a failed multipart upload is aborted so its parts don't linger in
+// the bucket.
+func (u *S3Uploader) Upload(ctx context.Context, obj *Object) error {
+	if obj.Size <= u.cfg.PartSize {
+		if _, err := obj.Body.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		payloadHash := obj.SHA256
+		if payloadHash == "" {
+			payloadHash = unsignedPayload
+		}
+
+		_, err := u.do(ctx, http.MethodPut, obj.Key, nil, io.LimitReader(obj.Body, obj.Size), obj.Size, payloadHash)
+		return err
+	}
+
+	uploadID, err := u.createMultipartUpload(ctx, obj.Key)
+	if err != nil {
+		return err
+	}
+
+	if err := u.uploadParts(ctx, obj, uploadID); err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		query := url.Values{"uploadId": {uploadID}}
+		_, _ = u.do(ctx, http.MethodDelete, obj.Key, query, nil, 0, emptySHA256)
+		return err
+	}
+
+	return nil
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (u *S3Uploader) createMultipartUpload(ctx context.Context, key string) (string, error) {
+	resp, err := u.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, 0, emptySHA256)
+	if err != nil {
+		return "", err
+	}
+
+	var res initiateMultipartUploadResult
+	if err := xml.Unmarshal(resp.body, &res); err != nil {
+		return "", fmt.Errorf("s3: malformed response: %w", err)
+	}
+	if res.UploadID == "" {
+		return "", errors.New("s3: no upload ID in response")
+	}
+	return res.UploadID, nil
+}
+
+func (u *S3Uploader) uploadParts(ctx context.Context, obj *Object, uploadID string) error {
+	var complete completeMultipartUpload
+	for offset, n := int64(0), 1; offset < obj.Size; offset, n = offset+u.cfg.PartSize, n+1 {
+		size := obj.Size - offset
+		if size > u.cfg.PartSize {
+			size = u.cfg.PartSize
+		}
+
+		// the part is read twice: to sign its checksum and to send it
+		h := sha256.New()
+		if _, err := obj.Body.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(h, io.LimitReader(obj.Body, size)); err != nil {
+			return err
+		}
+		if _, err := obj.Body.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+
+		query := url.Values{
+			"partNumber": {strconv.Itoa(n)},
+			"uploadId":   {uploadID},
+		}
+		resp, err := u.do(ctx, http.MethodPut, obj.Key, query, io.LimitReader(obj.Body, size), size, hex.EncodeToString(h.Sum(nil)))
+		if err != nil {
+			return fmt.Errorf("uploading part %d: %w", n, err)
+		}
+
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: n, ETag: resp.header.Get("ETag")})
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(body)
+	query := url.Values{"uploadId": {uploadID}}
+	resp, err := u.do(ctx, http.MethodPost, obj.Key, query, bytes.NewReader(body), int64(len(body)), hex.EncodeToString(sum[:]))
+	if err != nil {
+		return fmt.Errorf("completing upload: %w", err)
+	}
+
+	// completing an upload can fail after the response status was sent
+	if err := parseError(resp.body); err != nil {
+		return fmt.Errorf("completing upload: %w", err)
+	}
+	return nil
+}
+
+type s3Response struct {
+	header http.Header
+	body   []byte
+}
+
+// do sends a signed request for an object of the bucket.
+func (u *S3Uploader) do(ctx context.Context, method, key string, query url.Values, body io.Reader, size int64, payloadHash string) (*s3Response, error) {
+	ref := *u.endpoint
+	ref.Path = strings.TrimSuffix(ref.Path, "/") + "/" + u.cfg.Bucket + "/" + key
+	ref.RawPath = escapePath(ref.Path)
+	ref.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, ref.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+
+	signV4(req, payloadHash, u.cfg.AccessKeyID, u.cfg.SecretAccessKey, u.cfg.Region, u.now())
+
+	resp, err := u.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		if err := parseError(data); err != nil {
+			return nil, fmt.Errorf("%w (status %d)", err, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("s3: unexpected status %d", resp.StatusCode)
+	}
+
+	return &s3Response{header: resp.Header, body: data}, nil
+}
+
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string
+	Message string
+}
+
+// parseError returns the error of an S3 error response, or nil if body
+// isn't one.
+func parseError(body []byte) error {
+	var e s3Error
+	if err := xml.Unmarshal(body, &e); err != nil || e.Code == "" {
+		return nil
+	}
+	return fmt.Errorf("s3: %s: %s", e.Code, e.Message)
+}
+
+const (
+	signAlgorithm = "AWS4-HMAC-SHA256"
+	timeFormat    = "20060102T150405Z"
+
+	// emptySHA256 is the SHA-256 checksum of an empty body.
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// unsignedPayload is signed instead of the checksum if it's unknown.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// signV4 signs a request with AWS Signature Version 4. The host and all
+// headers set on the request are signed.
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func signV4(req *http.Request, payloadHash, accessKeyID, secretAccessKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(timeFormat)
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := signAlgorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes a query string the way it's signed: sorted by key,
+// with keys and values escaped like paths.
+func canonicalQuery(query url.Values) string {
+	var parts []string
+	for k, vs := range query {
+		for _, v := range vs {
+			parts = append(parts, escape(k, false)+"="+escape(v, false))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+func escapePath(path string) string {
+	return escape(path, true)
+}
+
+// escape percent-encodes all bytes of s except unreserved characters, and
+// slashes if keepSlash is set.
+func escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
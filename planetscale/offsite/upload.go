@@ -0,0 +1,28 @@
+package offsite
+
+import (
+	"context"
+	"io"
+)
+
+// Object is the data uploaded to object storage.
+type Object struct {
+	// Key is the name of the object.
+	Key string
+
+	// Body is the data of the object. Uploaders may read it more than once,
+	// e.g. to hash parts of it before uploading them.
+	Body io.ReadSeeker
+
+	// Size is the length of Body in bytes.
+	Size int64
+
+	// SHA256 is the hex encoded SHA-256 checksum of Body.
+	SHA256 string
+}
+
+// Uploader uploads objects to object storage. S3Uploader uploads to S3 and
+// S3-compatible stores.
+type Uploader interface {
+	Upload(ctx context.Context, obj *Object) error
+}
@@ -0,0 +1,352 @@
+package planetscale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultOperationPollInterval = 2 * time.Second
+
+// OperationKind defines the kind of long-running work an Operation tracks.
+type OperationKind string
+
+const (
+	OperationCreateDatabase OperationKind = "create_database" // Database is being created.
+	OperationCreateBranch   OperationKind = "create_branch"   // Database branch is being created.
+	OperationCreateBackup   OperationKind = "create_backup"   // Backup is being taken.
+	OperationDeploy         OperationKind = "deploy"          // Deploy request is being deployed.
+)
+
+// OperationsService is an interface for starting long-running actions and
+// tracking them with an Operation handle.
+type OperationsService interface {
+	CreateDatabase(context.Context, *CreateDatabaseRequest) (*Operation, error)
+	CreateBranch(context.Context, *CreateDatabaseBranchRequest) (*Operation, error)
+	CreateBackup(context.Context, *CreateBackupRequest) (*Operation, error)
+	Deploy(context.Context, *PerformDeployRequest) (*Operation, error)
+	Resume(data []byte) (*Operation, error)
+}
+
+// Operation is a handle to long-running work on the PlanetScale side, such as
+// creating a database or deploying a deploy request. An Operation can be
+// serialized with json.Marshal and resumed in another process with
+// OperationsService.Resume.
+type Operation struct {
+	Kind         OperationKind `json:"kind"`
+	Organization string        `json:"organization"`
+	Database     string        `json:"database"`
+	Branch       string        `json:"branch,omitempty"`
+	Backup       string        `json:"backup,omitempty"`
+	Number       uint64        `json:"number,omitempty"`
+
+	// PollInterval is the interval Wait uses to poll the operation. It
+	// defaults to 2 seconds.
+	PollInterval time.Duration `json:"-"`
+
+	client *Client
+
+	mu     sync.Mutex
+	done   bool
+	result interface{}
+	err    error
+}
+
+// Done reports whether the operation finished, successfully or not.
+func (o *Operation) Done() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.done
+}
+
+// Result returns the latest state of the resource the operation works on and
+// the error the operation failed with, if any. The result is one of
+// *Database, *DatabaseBranch, *Backup or *DeployRequest, depending on the
+// operation kind.
+func (o *Operation) Result() (interface{}, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.result, o.err
+}
+
+// Poll fetches the current state of the operation once. The returned error is
+// only non-nil if the state couldn't be fetched. Use Result to check if the
+// operation itself failed.
+func (o *Operation) Poll(ctx context.Context) error {
+	if o.client == nil {
+		return errors.New("operation is not attached to a client, use OperationsService.Resume")
+	}
+
+	if o.Done() {
+		return nil
+	}
+
+	var (
+		res pollResult
+		err error
+	)
+
+	switch o.Kind {
+	case OperationCreateDatabase:
+		res, err = o.pollDatabase(ctx)
+	case OperationCreateBranch:
+		res, err = o.pollBranch(ctx)
+	case OperationCreateBackup:
+		res, err = o.pollBackup(ctx)
+	case OperationDeploy:
+		res, err = o.pollDeploy(ctx)
+	default:
+		return fmt.Errorf("unknown operation kind %q", o.Kind)
+	}
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if res.result != nil {
+		o.result = res.result
+	}
+	o.done = res.done
+	o.err = res.err
+	return nil
+}
+
+// Wait polls the operation until it's done or the context is canceled. It
+// returns the error the operation failed with, if any.
+func (o *Operation) Wait(ctx context.Context) error {
+	interval := o.PollInterval
+	if interval <= 0 {
+		interval = defaultOperationPollInterval
+	}
+
+	for {
+		if err := o.Poll(ctx); err != nil {
+			return err
+		}
+
+		if o.Done() {
+			_, err := o.Result()
+			return err
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// pollResult is the state of an operation after a single poll.
+type pollResult struct {
+	result interface{}
+	done   bool
+
+	// err is the error the operation failed with.
+	err error
+}
+
+func (o *Operation) pollDatabase(ctx context.Context) (pollResult, error) {
+	db, err := o.client.Databases.Get(ctx, &GetDatabaseRequest{
+		Organization: o.Organization,
+		Database:     o.Database,
+	})
+	if err != nil {
+		return pollResult{}, err
+	}
+
+	// the state may be missing, so only an explicit ready state is done
+	switch db.State {
+	case "ready":
+		return pollResult{result: db, done: true}, nil
+	case "failed", "error":
+		return pollResult{result: db, done: true, err: &Error{
+			msg:  fmt.Sprintf("database %s finished with state %q", db.Name, db.State),
+			Code: ErrOperationFailed,
+		}}, nil
+	}
+
+	return pollResult{result: db}, nil
+}
+
+func (o *Operation) pollBranch(ctx context.Context) (pollResult, error) {
+	status, err := o.client.DatabaseBranches.GetStatus(ctx, &GetDatabaseBranchStatusRequest{
+		Organization: o.Organization,
+		Database:     o.Database,
+		Branch:       o.Branch,
+	})
+	if err != nil {
+		return pollResult{}, err
+	}
+
+	if !status.Ready {
+		return pollResult{}, nil
+	}
+
+	branch, err := o.client.DatabaseBranches.Get(ctx, &GetDatabaseBranchRequest{
+		Organization: o.Organization,
+		Database:     o.Database,
+		Branch:       o.Branch,
+	})
+	if err != nil {
+		return pollResult{}, err
+	}
+
+	return pollResult{result: branch, done: true}, nil
+}
+
+func (o *Operation) pollBackup(ctx context.Context) (pollResult, error) {
+	backup, err := o.client.Backups.Get(ctx, &GetBackupRequest{
+		Organization: o.Organization,
+		Database:     o.Database,
+		Branch:       o.Branch,
+		Backup:       o.Backup,
+	})
+	if err != nil {
+		return pollResult{}, err
+	}
+
+	switch backup.State {
+	case "success":
+		return pollResult{result: backup, done: true}, nil
+	case "failed", "canceled":
+		return pollResult{result: backup, done: true, err: &Error{
+			msg:  fmt.Sprintf("backup %s finished with state %q", backup.Name, backup.State),
+			Code: ErrOperationFailed,
+		}}, nil
+	}
+
+	return pollResult{result: backup}, nil
+}
+
+func (o *Operation) pollDeploy(ctx context.Context) (pollResult, error) {
+	dr, err := o.client.DeployRequests.Get(ctx, &GetDeployRequestRequest{
+		Organization: o.Organization,
+		Database:     o.Database,
+		Number:       o.Number,
+	})
+	if err != nil {
+		return pollResult{}, err
+	}
+
+	switch outcome := ClassifyDeployment(dr); {
+	case !outcome.Done():
+		return pollResult{result: dr}, nil
+	case outcome.Succeeded():
+		return pollResult{result: dr, done: true}, nil
+	default:
+		return pollResult{result: dr, done: true, err: &Error{
+			msg:  fmt.Sprintf("deploy request %d was not deployed: %s", dr.Number, outcome),
+			Code: ErrOperationFailed,
+		}}, nil
+	}
+}
+
+type operationsService struct {
+	client *Client
+}
+
+var _ OperationsService = &operationsService{}
+
+func NewOperationsService(client *Client) *operationsService {
+	return &operationsService{
+		client: client,
+	}
+}
+
+// CreateDatabase creates a new database and returns an operation that is done
+// once the database is ready.
+func (o *operationsService) CreateDatabase(ctx context.Context, createReq *CreateDatabaseRequest) (*Operation, error) {
+	db, err := o.client.Databases.Create(ctx, createReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.newOperation(&Operation{
+		Kind:         OperationCreateDatabase,
+		Organization: createReq.Organization,
+		Database:     db.Name,
+	}, db), nil
+}
+
+// CreateBranch creates a new database branch and returns an operation that
+// is done once the branch is ready.
+func (o *operationsService) CreateBranch(ctx context.Context, createReq *CreateDatabaseBranchRequest) (*Operation, error) {
+	branch, err := o.client.DatabaseBranches.Create(ctx, createReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.newOperation(&Operation{
+		Kind:         OperationCreateBranch,
+		Organization: createReq.Organization,
+		Database:     createReq.Database,
+		Branch:       branch.Name,
+	}, branch), nil
+}
+
+// CreateBackup creates a new backup and returns an operation that is done
+// once the backup finished.
+func (o *operationsService) CreateBackup(ctx context.Context, createReq *CreateBackupRequest) (*Operation, error) {
+	backup, err := o.client.Backups.Create(ctx, createReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.newOperation(&Operation{
+		Kind:         OperationCreateBackup,
+		Organization: createReq.Organization,
+		Database:     createReq.Database,
+		Branch:       createReq.Branch,
+		Backup:       backup.Name,
+	}, backup), nil
+}
+
+// Deploy deploys a deploy request and returns an operation that is done once
+// the deployment finished.
+func (o *operationsService) Deploy(ctx context.Context, deployReq *PerformDeployRequest) (*Operation, error) {
+	dr, err := o.client.DeployRequests.Deploy(ctx, deployReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.newOperation(&Operation{
+		Kind:         OperationDeploy,
+		Organization: deployReq.Organization,
+		Database:     deployReq.Database,
+		Number:       deployReq.Number,
+	}, dr), nil
+}
+
+// Resume returns the operation serialized in data, attached to the client.
+func (o *operationsService) Resume(data []byte) (*Operation, error) {
+	op := &Operation{}
+	if err := json.Unmarshal(data, op); err != nil {
+		return nil, errors.Wrap(err, "error decoding operation")
+	}
+
+	switch op.Kind {
+	case OperationCreateDatabase, OperationCreateBranch, OperationCreateBackup, OperationDeploy:
+	default:
+		return nil, fmt.Errorf("unknown operation kind %q", op.Kind)
+	}
+
+	op.client = o.client
+	return op, nil
+}
+
+func (o *operationsService) newOperation(op *Operation, result interface{}) *Operation {
+	op.client = o.client
+	op.result = result
+	return op
+}
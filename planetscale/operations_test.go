@@ -0,0 +1,254 @@
+package planetscale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestOperations_Deploy(t *testing.T) {
+	c := qt.New(t)
+
+	var polls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := "queued"
+		switch {
+		case r.Method == http.MethodPost:
+			c.Assert(r.URL.Path, qt.Equals, "/v1/organizations/my-org/databases/my-db/deploy-requests/1337/deploy")
+		case atomic.AddInt32(&polls, 1) >= 3:
+			state = "complete"
+		default:
+			state = "in_progress"
+		}
+
+		w.WriteHeader(200)
+		_, err := fmt.Fprintf(w, `{"id": "test-deploy-request-id", "number": 1337, "deployment": {"state": %q}}`, state)
+		c.Assert(err, qt.IsNil)
+	}))
+	t.Cleanup(ts.Close)
+
+	client, err := NewClient(WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	op, err := client.Operations.Deploy(ctx, &PerformDeployRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Number:       1337,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(op.Done(), qt.IsFalse)
+
+	result, err := op.Result()
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.(*DeployRequest).Deployment.State, qt.Equals, "queued")
+
+	op.PollInterval = time.Millisecond
+	c.Assert(op.Wait(ctx), qt.IsNil)
+	c.Assert(op.Done(), qt.IsTrue)
+	c.Assert(atomic.LoadInt32(&polls), qt.Equals, int32(3))
+
+	result, err = op.Result()
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.(*DeployRequest).Deployment.State, qt.Equals, "complete")
+}
+
+func TestOperations_Deploy_reverted(t *testing.T) {
+	c := qt.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := "complete_revert"
+		if r.Method == http.MethodPost {
+			state = "queued"
+		}
+
+		w.WriteHeader(200)
+		_, err := fmt.Fprintf(w, `{"number": 1337, "state": "closed", "deployment": {"state": %q}}`, state)
+		c.Assert(err, qt.IsNil)
+	}))
+	t.Cleanup(ts.Close)
+
+	client, err := NewClient(WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	op, err := client.Operations.Deploy(ctx, &PerformDeployRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Number:       1337,
+	})
+	c.Assert(err, qt.IsNil)
+
+	// reverted deployments are final and don't keep Wait polling
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	op.PollInterval = time.Millisecond
+	err = op.Wait(ctx)
+	c.Assert(err, qt.ErrorMatches, `deploy request 1337 was not deployed: reverted`)
+	c.Assert(err.(*Error).Code, qt.Equals, ErrOperationFailed)
+	c.Assert(op.Done(), qt.IsTrue)
+}
+
+func TestOperations_CreateBackup_failed(t *testing.T) {
+	c := qt.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := "failed"
+		if r.Method == http.MethodPost {
+			state = "pending"
+		}
+
+		w.WriteHeader(200)
+		_, err := fmt.Fprintf(w, `{"name": "my-backup", "state": %q}`, state)
+		c.Assert(err, qt.IsNil)
+	}))
+	t.Cleanup(ts.Close)
+
+	client, err := NewClient(WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	op, err := client.Operations.CreateBackup(ctx, &CreateBackupRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "my-branch",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(op.Backup, qt.Equals, "my-backup")
+
+	op.PollInterval = time.Millisecond
+	err = op.Wait(ctx)
+	c.Assert(err, qt.ErrorMatches, `backup my-backup finished with state "failed"`)
+	c.Assert(err.(*Error).Code, qt.Equals, ErrOperationFailed)
+	c.Assert(op.Done(), qt.IsTrue)
+}
+
+func TestOperations_CreateDatabase_noState(t *testing.T) {
+	c := qt.New(t)
+	var polls int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+
+		// the state is only sent once the database is ready
+		if r.Method == http.MethodGet && atomic.AddInt32(&polls, 1) == 3 {
+			_, _ = w.Write([]byte(`{"name": "my-db", "state": "ready"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"name": "my-db"}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	client, err := NewClient(WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	op, err := client.Operations.CreateDatabase(ctx, &CreateDatabaseRequest{
+		Organization: "my-org",
+		Name:         "my-db",
+	})
+	c.Assert(err, qt.IsNil)
+
+	op.PollInterval = time.Millisecond
+	c.Assert(op.Wait(ctx), qt.IsNil)
+	c.Assert(atomic.LoadInt32(&polls), qt.Equals, int32(3))
+
+	result, err := op.Result()
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.(*Database).State, qt.Equals, "ready")
+}
+
+func TestOperations_CreateDatabase_failed(t *testing.T) {
+	c := qt.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := "failed"
+		if r.Method == http.MethodPost {
+			state = "pending"
+		}
+
+		w.WriteHeader(200)
+		_, _ = fmt.Fprintf(w, `{"name": "my-db", "state": %q}`, state)
+	}))
+	t.Cleanup(ts.Close)
+
+	client, err := NewClient(WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	op, err := client.Operations.CreateDatabase(ctx, &CreateDatabaseRequest{
+		Organization: "my-org",
+		Name:         "my-db",
+	})
+	c.Assert(err, qt.IsNil)
+
+	op.PollInterval = time.Millisecond
+	err = op.Wait(ctx)
+	c.Assert(err, qt.ErrorMatches, `database my-db finished with state "failed"`)
+	c.Assert(err.(*Error).Code, qt.Equals, ErrOperationFailed)
+}
+
+func TestOperations_Resume(t *testing.T) {
+	c := qt.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		switch r.URL.Path {
+		case "/v1/organizations/my-org/databases/my-db/branches":
+			_, _ = w.Write([]byte(`{"name": "my-branch"}`))
+		case "/v1/organizations/my-org/databases/my-db/branches/my-branch/status":
+			_, _ = w.Write([]byte(`{"ready": true}`))
+		case "/v1/organizations/my-org/databases/my-db/branches/my-branch":
+			_, _ = w.Write([]byte(`{"name": "my-branch", "parent_branch": "main"}`))
+		default:
+			c.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	client, err := NewClient(WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	op, err := client.Operations.CreateBranch(ctx, &CreateDatabaseBranchRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Name:         "my-branch",
+		ParentBranch: "main",
+	})
+	c.Assert(err, qt.IsNil)
+
+	data, err := json.Marshal(op)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(data), qt.Equals, `{"kind":"create_branch","organization":"my-org","database":"my-db","branch":"my-branch"}`)
+
+	resumed, err := client.Operations.Resume(data)
+	c.Assert(err, qt.IsNil)
+	c.Assert(resumed.Wait(ctx), qt.IsNil)
+
+	result, err := resumed.Result()
+	c.Assert(err, qt.IsNil)
+	c.Assert(result, qt.DeepEquals, &DatabaseBranch{Name: "my-branch", ParentBranch: "main"})
+
+	_, err = client.Operations.Resume([]byte(`{"kind":"unknown"}`))
+	c.Assert(err, qt.ErrorMatches, `unknown operation kind "unknown"`)
+}
+
+func TestOperation_notAttached(t *testing.T) {
+	c := qt.New(t)
+
+	op := &Operation{}
+	err := json.Unmarshal([]byte(`{"kind":"create_database","organization":"my-org","database":"my-db"}`), op)
+	c.Assert(err, qt.IsNil)
+
+	err = op.Poll(context.Background())
+	c.Assert(err, qt.ErrorMatches, "operation is not attached to a client.*")
+}
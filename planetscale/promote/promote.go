@@ -0,0 +1,372 @@
+// Package promote promotes schema changes through an ordered list of
+// branches, such as dev → staging → main:
+//
+//	p, err := promote.New(&promote.Config{
+//		Client:       client,
+//		Organization: "my-org",
+//		Database:     "my-db",
+//		Stages:       []string{"dev", "staging", "main"},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	// open a deploy request from dev into staging and deploy it
+//	dr, err := p.Promote(ctx, "dev")
+//	if err != nil {
+//		return err
+//	}
+//	_, err = p.Deploy(ctx, dr.Number)
+//
+// Deploy requests are only opened and deployed from one stage into the next.
+// A stage can only be promoted once its schema was deployed into it by the
+// pipeline, so every change reaches the last stage through all stages before
+// it. The schema version of each promotion is recorded in the notes of its
+// deploy request.
+package promote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+	"github.com/planetscale/planetscale-go/planetscale/schema"
+)
+
+// versionPrefix marks the schema version in the notes of deploy requests
+// opened by a pipeline.
+const versionPrefix = "planetscale-promote-version: "
+
+var versionNote = regexp.MustCompile(`(?m)^` + versionPrefix + `([0-9a-f]+)$`)
+
+// Config defines the configuration of a Pipeline.
+type Config struct {
+	// Client defines a PlanetScale client. Use planetscale.NewClient() to
+	// create a new instance.
+	Client *ps.Client
+
+	// Organization and Database are the database whose branches form the
+	// pipeline.
+	Organization string
+	Database     string
+
+	// Stages are the branches changes are promoted through, in order. The
+	// first stage is where changes are made, e.g. "dev", the last stage is
+	// usually the production branch.
+	Stages []string
+
+	// PollInterval is the interval to check whether a deployment finished.
+	// Defaults to 2 seconds.
+	PollInterval time.Duration
+}
+
+// Stage is the state of a stage of the pipeline.
+type Stage struct {
+	Branch string
+
+	// Snapshot is the current schema of the branch.
+	Snapshot *schema.Snapshot
+
+	// Version is the version of the current schema.
+	Version string
+
+	// Promoted is the version last deployed into the stage by the
+	// pipeline. It's empty for the first stage and stages nothing was
+	// deployed into yet.
+	Promoted string
+
+	// Changes are the changes of the previous stage that weren't deployed
+	// into this stage yet.
+	Changes []*schema.Change
+
+	// Open is the open deploy request of the pipeline into this stage, if
+	// any.
+	Open *ps.DeployRequest
+}
+
+// Pipeline promotes schema changes through the stages of a database.
+type Pipeline struct {
+	cfg Config
+}
+
+// New returns a new Pipeline with the given configuration.
+func New(cfg *Config) (*Pipeline, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("planetscale Client is not set")
+	}
+
+	if cfg.Organization == "" {
+		return nil, errors.New("organization is not set")
+	}
+
+	if cfg.Database == "" {
+		return nil, errors.New("database is not set")
+	}
+
+	if len(cfg.Stages) < 2 {
+		return nil, errors.New("a pipeline needs at least two stages")
+	}
+
+	seen := make(map[string]bool)
+	for _, s := range cfg.Stages {
+		if s == "" {
+			return nil, errors.New("stage branch is empty")
+		}
+		if seen[s] {
+			return nil, fmt.Errorf("stage %s is listed more than once", s)
+		}
+		seen[s] = true
+	}
+
+	return &Pipeline{cfg: *cfg}, nil
+}
+
+// Status returns the state of every stage, in order.
+func (p *Pipeline) Status(ctx context.Context) ([]*Stage, error) {
+	drs, err := p.deployRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stages := make([]*Stage, len(p.cfg.Stages))
+	for i, branch := range p.cfg.Stages {
+		snap, err := p.snapshot(ctx, branch)
+		if err != nil {
+			return nil, err
+		}
+
+		s := &Stage{
+			Branch:   branch,
+			Snapshot: snap,
+			Version:  snap.Version(),
+			Promoted: promotedVersion(drs, branch),
+			Open:     openDeployRequest(drs, p.previous(branch), branch),
+		}
+		if i > 0 {
+			s.Changes = schema.Compare(snap, stages[i-1].Snapshot)
+		}
+		stages[i] = s
+	}
+
+	return stages, nil
+}
+
+// Promote opens a deploy request from the given stage into the next stage,
+// with the current schema version of the stage in its notes. An open deploy
+// request of the pipeline with the same version is returned as is, one with
+// an outdated version is closed and replaced.
+func (p *Pipeline) Promote(ctx context.Context, branch string) (*ps.DeployRequest, error) {
+	next := p.next(branch)
+	if next == "" {
+		return nil, p.stageError(branch, "can't be promoted, it's the last stage")
+	}
+
+	drs, err := p.deployRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snap, err := p.snapshot(ctx, branch)
+	if err != nil {
+		return nil, err
+	}
+	version := snap.Version()
+
+	if err := p.checkPromoted(drs, branch, version); err != nil {
+		return nil, err
+	}
+
+	if dr := openDeployRequest(drs, branch, next); dr != nil {
+		if noteVersion(dr.Notes) == version {
+			return dr, nil
+		}
+
+		_, err := p.cfg.Client.DeployRequests.CloseDeploy(ctx, &ps.CloseDeployRequestRequest{
+			Organization: p.cfg.Organization,
+			Database:     p.cfg.Database,
+			Number:       dr.Number,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("closing outdated deploy request #%d: %s", dr.Number, err)
+		}
+	}
+
+	return p.cfg.Client.DeployRequests.Create(ctx, &ps.CreateDeployRequestRequest{
+		Organization: p.cfg.Organization,
+		Database:     p.cfg.Database,
+		Branch:       branch,
+		IntoBranch:   next,
+		Notes:        fmt.Sprintf("Promote %s into %s.\n\n%s%s", branch, next, versionPrefix, version),
+	})
+}
+
+// Deploy deploys a deploy request opened by Promote and waits until the
+// deployment finished. It refuses deploy requests that skip a stage, whose
+// branch changed since they were opened, or whose branch wasn't deployed
+// into by the pipeline.
+func (p *Pipeline) Deploy(ctx context.Context, number uint64) (*ps.DeployRequest, error) {
+	dr, err := p.cfg.Client.DeployRequests.Get(ctx, &ps.GetDeployRequestRequest{
+		Organization: p.cfg.Organization,
+		Database:     p.cfg.Database,
+		Number:       number,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if p.index(dr.IntoBranch) < 0 {
+		return nil, fmt.Errorf("deploy request #%d deploys into %s, which isn't a stage of the pipeline", number, dr.IntoBranch)
+	}
+
+	if prev := p.previous(dr.IntoBranch); dr.Branch != prev {
+		return nil, fmt.Errorf("deploy request #%d deploys %s into %s, but changes must be deployed from %s", number, dr.Branch, dr.IntoBranch, prev)
+	}
+
+	version := noteVersion(dr.Notes)
+	if version == "" {
+		return nil, fmt.Errorf("deploy request #%d wasn't opened by the pipeline", number)
+	}
+
+	snap, err := p.snapshot(ctx, dr.Branch)
+	if err != nil {
+		return nil, err
+	}
+	if current := snap.Version(); current != version {
+		return nil, fmt.Errorf("%s changed since deploy request #%d was opened (version %s, was %s), promote it again", dr.Branch, number, current, version)
+	}
+
+	drs, err := p.deployRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkPromoted(drs, dr.Branch, version); err != nil {
+		return nil, err
+	}
+
+	op, err := p.cfg.Client.Operations.Deploy(ctx, &ps.PerformDeployRequest{
+		Organization: p.cfg.Organization,
+		Database:     p.cfg.Database,
+		Number:       number,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	op.PollInterval = p.cfg.PollInterval
+	if err := op.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	res, _ := op.Result()
+	dr, _ = res.(*ps.DeployRequest)
+	return dr, nil
+}
+
+// checkPromoted returns an error if a stage other than the first has a
+// schema version that wasn't deployed into it by the pipeline.
+func (p *Pipeline) checkPromoted(drs []*ps.DeployRequest, branch, version string) error {
+	if p.index(branch) == 0 {
+		return nil
+	}
+
+	promoted := promotedVersion(drs, branch)
+	if promoted == "" {
+		return p.stageError(branch, "has no changes deployed by the pipeline yet, promote %s first", p.previous(branch))
+	}
+	if promoted != version {
+		return p.stageError(branch, "is at version %s, but the pipeline deployed version %s into it", version, promoted)
+	}
+
+	return nil
+}
+
+func (p *Pipeline) stageError(branch, format string, args ...interface{}) error {
+	if p.index(branch) < 0 {
+		return fmt.Errorf("%s isn't a stage of the pipeline", branch)
+	}
+	return fmt.Errorf("stage %s "+format, append([]interface{}{branch}, args...)...)
+}
+
+func (p *Pipeline) snapshot(ctx context.Context, branch string) (*schema.Snapshot, error) {
+	snap, err := schema.Take(ctx, p.cfg.Client, p.cfg.Organization, p.cfg.Database, branch)
+	if err != nil {
+		return nil, fmt.Errorf("fetching schema of %s: %s", branch, err)
+	}
+	return snap, nil
+}
+
+func (p *Pipeline) deployRequests(ctx context.Context) ([]*ps.DeployRequest, error) {
+	drs, err := p.cfg.Client.DeployRequests.List(ctx, &ps.ListDeployRequestsRequest{
+		Organization: p.cfg.Organization,
+		Database:     p.cfg.Database,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing deploy requests: %s", err)
+	}
+	return drs, nil
+}
+
+func (p *Pipeline) index(branch string) int {
+	for i, s := range p.cfg.Stages {
+		if s == branch {
+			return i
+		}
+	}
+	return -1
+}
+
+// previous returns the stage before branch, or "" if there is none.
+func (p *Pipeline) previous(branch string) string {
+	if i := p.index(branch); i > 0 {
+		return p.cfg.Stages[i-1]
+	}
+	return ""
+}
+
+// next returns the stage after branch, or "" if there is none.
+func (p *Pipeline) next(branch string) string {
+	if i := p.index(branch); i >= 0 && i < len(p.cfg.Stages)-1 {
+		return p.cfg.Stages[i+1]
+	}
+	return ""
+}
+
+// promotedVersion returns the version of the latest deploy request of a
+// pipeline that was deployed into branch.
+func promotedVersion(drs []*ps.DeployRequest, branch string) string {
+	var latest *ps.DeployRequest
+	for _, dr := range drs {
+		if dr.IntoBranch != branch || noteVersion(dr.Notes) == "" || !ps.ClassifyDeployment(dr).Succeeded() {
+			continue
+		}
+		if latest == nil || dr.Number > latest.Number {
+			latest = dr
+		}
+	}
+
+	if latest == nil {
+		return ""
+	}
+	return noteVersion(latest.Notes)
+}
+
+// openDeployRequest returns the open deploy request of a pipeline from branch
+// into next.
+func openDeployRequest(drs []*ps.DeployRequest, branch, next string) *ps.DeployRequest {
+	for _, dr := range drs {
+		if dr.State == "open" && dr.Branch == branch && dr.IntoBranch == next && noteVersion(dr.Notes) != "" {
+			return dr
+		}
+	}
+	return nil
+}
+
+func noteVersion(notes string) string {
+	if m := versionNote.FindStringSubmatch(notes); m != nil {
+		return m[1]
+	}
+	return ""
+}
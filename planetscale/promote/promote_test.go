@@ -0,0 +1,219 @@
+package promote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+func newTestPipeline(c *qt.C) (*fakeapi.Server, *ps.Client, *Pipeline) {
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	for _, b := range []string{"staging", "dev"} {
+		_, err := client.DatabaseBranches.Create(ctx, &ps.CreateDatabaseBranchRequest{
+			Organization: "my-org",
+			Database:     "my-db",
+			Name:         b,
+			ParentBranch: "main",
+		})
+		c.Assert(err, qt.IsNil)
+	}
+
+	c.Assert(api.SetSchema("my-org", "my-db", "dev", map[string]string{
+		"users": "CREATE TABLE `users` (`id` bigint)",
+	}), qt.IsNil)
+
+	p, err := New(&Config{
+		Client:       client,
+		Organization: "my-org",
+		Database:     "my-db",
+		Stages:       []string{"dev", "staging", "main"},
+		PollInterval: time.Millisecond,
+	})
+	c.Assert(err, qt.IsNil)
+
+	return api, client, p
+}
+
+func TestPipeline(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	api, _, p := newTestPipeline(c)
+
+	// main can't be promoted into before staging
+	_, err := p.Promote(ctx, "staging")
+	c.Assert(err, qt.ErrorMatches, "stage staging has no changes deployed by the pipeline yet, promote dev first")
+
+	dr, err := p.Promote(ctx, "dev")
+	c.Assert(err, qt.IsNil)
+	c.Assert(dr.Branch, qt.Equals, "dev")
+	c.Assert(dr.IntoBranch, qt.Equals, "staging")
+
+	// promoting again returns the open deploy request
+	again, err := p.Promote(ctx, "dev")
+	c.Assert(err, qt.IsNil)
+	c.Assert(again.Number, qt.Equals, dr.Number)
+
+	stages, err := p.Status(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(stages, qt.HasLen, 3)
+	c.Assert(stages[1].Open.Number, qt.Equals, dr.Number)
+	c.Assert(stages[1].Changes, qt.HasLen, 1)
+	c.Assert(stages[1].Promoted, qt.Equals, "")
+	devVersion := stages[0].Version
+
+	deployed, err := p.Deploy(ctx, dr.Number)
+	c.Assert(err, qt.IsNil)
+	c.Assert(deployed.Deployment.State, qt.Equals, "complete")
+
+	staging, err := api.Schema("my-org", "my-db", "staging")
+	c.Assert(err, qt.IsNil)
+	c.Assert(staging, qt.HasLen, 1)
+
+	dr, err = p.Promote(ctx, "staging")
+	c.Assert(err, qt.IsNil)
+	c.Assert(dr.IntoBranch, qt.Equals, "main")
+
+	_, err = p.Deploy(ctx, dr.Number)
+	c.Assert(err, qt.IsNil)
+
+	stages, err = p.Status(ctx)
+	c.Assert(err, qt.IsNil)
+	for _, s := range stages {
+		c.Assert(s.Version, qt.Equals, devVersion, qt.Commentf("stage %s", s.Branch))
+		c.Assert(s.Changes, qt.HasLen, 0)
+		c.Assert(s.Open, qt.IsNil)
+	}
+	c.Assert(stages[1].Promoted, qt.Equals, devVersion)
+	c.Assert(stages[2].Promoted, qt.Equals, devVersion)
+
+	_, err = p.Promote(ctx, "main")
+	c.Assert(err, qt.ErrorMatches, "stage main can't be promoted, it's the last stage")
+}
+
+func TestPipeline_outdated(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	api, client, p := newTestPipeline(c)
+
+	dr, err := p.Promote(ctx, "dev")
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(api.SetSchema("my-org", "my-db", "dev", map[string]string{
+		"users": "CREATE TABLE `users` (`id` bigint, `email` text)",
+	}), qt.IsNil)
+
+	_, err = p.Deploy(ctx, dr.Number)
+	c.Assert(err, qt.ErrorMatches, `dev changed since deploy request #1 was opened \(version [0-9a-f]+, was [0-9a-f]+\), promote it again`)
+
+	// promoting again replaces the outdated deploy request
+	replaced, err := p.Promote(ctx, "dev")
+	c.Assert(err, qt.IsNil)
+	c.Assert(replaced.Number, qt.Equals, uint64(2))
+
+	old, err := client.DeployRequests.Get(ctx, &ps.GetDeployRequestRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Number:       dr.Number,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(old.State, qt.Equals, "closed")
+
+	_, err = p.Deploy(ctx, replaced.Number)
+	c.Assert(err, qt.IsNil)
+}
+
+func TestPipeline_skippedStage(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	api, client, p := newTestPipeline(c)
+
+	// a deploy request straight from dev into main
+	dr, err := client.DeployRequests.Create(ctx, &ps.CreateDeployRequestRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "dev",
+		IntoBranch:   "main",
+		Notes:        versionPrefix + "0123456789ab",
+	})
+	c.Assert(err, qt.IsNil)
+
+	_, err = p.Deploy(ctx, dr.Number)
+	c.Assert(err, qt.ErrorMatches, "deploy request #1 deploys dev into main, but changes must be deployed from staging")
+
+	_, err = client.DeployRequests.CloseDeploy(ctx, &ps.CloseDeployRequestRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Number:       dr.Number,
+	})
+	c.Assert(err, qt.IsNil)
+
+	// staging changed outside of the pipeline
+	dr, err = p.Promote(ctx, "dev")
+	c.Assert(err, qt.IsNil)
+	_, err = p.Deploy(ctx, dr.Number)
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(api.SetSchema("my-org", "my-db", "staging", map[string]string{
+		"hotfix": "CREATE TABLE `hotfix` (`id` bigint)",
+	}), qt.IsNil)
+
+	_, err = p.Promote(ctx, "staging")
+	c.Assert(err, qt.ErrorMatches, "stage staging is at version [0-9a-f]+, but the pipeline deployed version [0-9a-f]+ into it")
+}
+
+func TestPromotedVersion(t *testing.T) {
+	c := qt.New(t)
+
+	dr := func(number uint64, version, state string) *ps.DeployRequest {
+		return &ps.DeployRequest{
+			Number:     number,
+			IntoBranch: "main",
+			State:      "closed",
+			Notes:      versionPrefix + version,
+			Deployment: &ps.Deployment{State: state},
+		}
+	}
+
+	// deployments that can still be reverted count as deployed
+	drs := []*ps.DeployRequest{dr(1, "aaaa", "complete"), dr(2, "bbbb", "complete_pending_revert")}
+	c.Assert(promotedVersion(drs, "main"), qt.Equals, "bbbb")
+
+	drs = append(drs, dr(3, "cccc", "complete_revert"), dr(4, "dddd", "complete_error"))
+	c.Assert(promotedVersion(drs, "main"), qt.Equals, "bbbb")
+	c.Assert(promotedVersion(drs, "staging"), qt.Equals, "")
+}
+
+func TestNew(t *testing.T) {
+	c := qt.New(t)
+	_, client, _ := newTestPipeline(c)
+
+	tests := []struct {
+		name   string
+		stages []string
+		want   string
+	}{
+		{"single stage", []string{"main"}, "a pipeline needs at least two stages"},
+		{"duplicate stage", []string{"dev", "main", "dev"}, "stage dev is listed more than once"},
+		{"empty stage", []string{"dev", ""}, "stage branch is empty"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(&Config{
+			Client:       client,
+			Organization: "my-org",
+			Database:     "my-db",
+			Stages:       tt.stages,
+		})
+		c.Assert(err, qt.ErrorMatches, tt.want, qt.Commentf(tt.name))
+	}
+}
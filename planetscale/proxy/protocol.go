@@ -0,0 +1,515 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// The subset of the MySQL client/server protocol the proxy speaks, see
+// https://dev.mysql.com/doc/internals/en/client-server-protocol.html.
+
+const (
+	maxPacketSize = 1<<24 - 1
+
+	// defaultMaxAllowedPacket is the default of MySQL's max_allowed_packet.
+	defaultMaxAllowedPacket = 64 << 20
+
+	serverVersion    = "8.0.0-planetscale-proxy"
+	nativePassword   = "mysql_native_password"
+	utf8mb4GeneralCI = 45
+	binaryCollation  = 63
+)
+
+// Capability flags.
+const (
+	clientLongPassword     uint32 = 1 << 0
+	clientFoundRows        uint32 = 1 << 1
+	clientLongFlag         uint32 = 1 << 2
+	clientConnectWithDB    uint32 = 1 << 3
+	clientProtocol41       uint32 = 1 << 9
+	clientSSL              uint32 = 1 << 11
+	clientTransactions     uint32 = 1 << 13
+	clientSecureConnection uint32 = 1 << 15
+	clientMultiResults     uint32 = 1 << 17
+	clientPluginAuth       uint32 = 1 << 19
+	clientConnectAttrs     uint32 = 1 << 20
+	clientPluginAuthLenenc uint32 = 1 << 21
+
+	serverCapabilities = clientLongPassword | clientFoundRows | clientLongFlag |
+		clientConnectWithDB | clientProtocol41 | clientTransactions |
+		clientSecureConnection | clientMultiResults | clientPluginAuth |
+		clientConnectAttrs | clientPluginAuthLenenc
+)
+
+// Status flags.
+const (
+	statusInTrans    uint16 = 1 << 0
+	statusAutocommit uint16 = 1 << 1
+)
+
+// Commands.
+const (
+	comQuit            byte = 0x01
+	comInitDB          byte = 0x02
+	comQuery           byte = 0x03
+	comPing            byte = 0x0e
+	comStmtPrepare     byte = 0x16
+	comResetConnection byte = 0x1f
+)
+
+// Error codes sent to clients.
+const (
+	erTooManyConnections uint16 = 1040
+	erHandshake          uint16 = 1043
+	erAccessDenied       uint16 = 1045
+	erUnknownCommand     uint16 = 1047
+	erNetPacketTooLarge  uint16 = 1153
+	erUnknownError       uint16 = 1105
+	crServerLost         uint16 = 2013
+
+	defaultSQLState            = "HY000"
+	tooManyConnectionsSQLState = "08004"
+	commLinkSQLState           = "08S01"
+	accessDeniedSQLState       = "28000"
+)
+
+// errPacketTooLarge is returned for packets larger than the maximum payload
+// size of a packetConn.
+var errPacketTooLarge = errors.New("packet too large")
+
+// packetConn reads and writes MySQL packets.
+type packetConn struct {
+	r   *bufio.Reader
+	w   *bufio.Writer
+	seq byte
+
+	// maxPayload is the maximum size of a payload read, including the
+	// packets it was split into. Zero means no limit.
+	maxPayload int
+}
+
+func newPacketConn(conn net.Conn) *packetConn {
+	return &packetConn{
+		r: bufio.NewReader(conn),
+		w: bufio.NewWriter(conn),
+	}
+}
+
+// readPacket reads a packet, joining packets that were split because they
+// exceed the maximum packet size.
+func (c *packetConn) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(c.r, header[:]); err != nil {
+			return nil, err
+		}
+
+		size := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		if header[3] != c.seq {
+			return nil, fmt.Errorf("packet out of order: got sequence %d, want %d", header[3], c.seq)
+		}
+		c.seq++
+
+		// check the size before reading, so a client can't make the proxy
+		// allocate arbitrary amounts of memory
+		if c.maxPayload > 0 && len(payload)+size > c.maxPayload {
+			return nil, errPacketTooLarge
+		}
+
+		start := len(payload)
+		payload = append(payload, make([]byte, size)...)
+		if _, err := io.ReadFull(c.r, payload[start:]); err != nil {
+			return nil, err
+		}
+
+		if size < maxPacketSize {
+			return payload, nil
+		}
+	}
+}
+
+// writePacket buffers a packet, splitting it if it exceeds the maximum
+// packet size. Call flush to send buffered packets.
+func (c *packetConn) writePacket(payload []byte) error {
+	for {
+		size := len(payload)
+		if size > maxPacketSize {
+			size = maxPacketSize
+		}
+
+		header := [4]byte{byte(size), byte(size >> 8), byte(size >> 16), c.seq}
+		c.seq++
+		if _, err := c.w.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := c.w.Write(payload[:size]); err != nil {
+			return err
+		}
+
+		payload = payload[size:]
+		if size < maxPacketSize {
+			return nil
+		}
+	}
+}
+
+func (c *packetConn) flush() error {
+	return c.w.Flush()
+}
+
+// resetSeq resets the sequence number at the start of a command.
+func (c *packetConn) resetSeq() {
+	c.seq = 0
+}
+
+func (c *packetConn) writeOK(affectedRows, lastInsertID uint64, status uint16) error {
+	p := []byte{0x00}
+	p = appendLenencInt(p, affectedRows)
+	p = appendLenencInt(p, lastInsertID)
+	p = appendUint16(p, status)
+	p = appendUint16(p, 0) // warnings
+	return c.writePacket(p)
+}
+
+func (c *packetConn) writeEOF(status uint16) error {
+	p := []byte{0xfe}
+	p = appendUint16(p, 0) // warnings
+	p = appendUint16(p, status)
+	return c.writePacket(p)
+}
+
+func (c *packetConn) writeError(code uint16, sqlState, msg string) error {
+	p := []byte{0xff}
+	p = appendUint16(p, code)
+	p = append(p, '#')
+	p = append(p, sqlState...)
+	p = append(p, msg...)
+	return c.writePacket(p)
+}
+
+// handshake is the initial handshake packet of the server.
+type handshake struct {
+	connID uint32
+	salt   []byte
+}
+
+func newHandshake(connID uint32) (*handshake, error) {
+	// the salt must not contain NUL bytes
+	salt := make([]byte, 20)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	for i := range salt {
+		salt[i] = salt[i]%94 + 33
+	}
+
+	return &handshake{connID: connID, salt: salt}, nil
+}
+
+func (h *handshake) packet() []byte {
+	p := []byte{10} // protocol version
+	p = append(p, serverVersion...)
+	p = append(p, 0)
+	p = appendUint32(p, h.connID)
+	p = append(p, h.salt[:8]...)
+	p = append(p, 0) // filler
+	p = appendUint16(p, uint16(serverCapabilities&0xffff))
+	p = append(p, utf8mb4GeneralCI)
+	p = appendUint16(p, statusAutocommit)
+	p = appendUint16(p, uint16(serverCapabilities>>16))
+	p = append(p, byte(len(h.salt)+1))
+	p = append(p, make([]byte, 10)...) // reserved
+	p = append(p, h.salt[8:]...)
+	p = append(p, 0)
+	p = append(p, nativePassword...)
+	return append(p, 0)
+}
+
+// handshakeResponse is the response of a client to the handshake.
+type handshakeResponse struct {
+	capabilities uint32
+	user         string
+	authResponse []byte
+	database     string
+	authPlugin   string
+}
+
+var errMalformedPacket = errors.New("malformed packet")
+
+func parseHandshakeResponse(p []byte) (*handshakeResponse, error) {
+	if len(p) < 32 {
+		return nil, errMalformedPacket
+	}
+
+	r := &handshakeResponse{capabilities: binary.LittleEndian.Uint32(p)}
+	if r.capabilities&clientProtocol41 == 0 {
+		return nil, errors.New("client doesn't support protocol 4.1")
+	}
+	if r.capabilities&clientSSL != 0 {
+		return nil, errors.New("client requires TLS, which the proxy doesn't support")
+	}
+	p = p[32:] // capabilities, max packet size, charset, reserved
+
+	user, p, ok := readNulString(p)
+	if !ok {
+		return nil, errMalformedPacket
+	}
+	r.user = user
+
+	switch {
+	case r.capabilities&clientPluginAuthLenenc != 0:
+		n, rest, ok := readLenencInt(p)
+		if !ok || uint64(len(rest)) < n {
+			return nil, errMalformedPacket
+		}
+		r.authResponse, p = rest[:n], rest[n:]
+	case r.capabilities&clientSecureConnection != 0:
+		if len(p) < 1 || len(p) < 1+int(p[0]) {
+			return nil, errMalformedPacket
+		}
+		r.authResponse, p = p[1:1+int(p[0])], p[1+int(p[0]):]
+	default:
+		var auth string
+		auth, p, ok = readNulString(p)
+		if !ok {
+			return nil, errMalformedPacket
+		}
+		r.authResponse = []byte(auth)
+	}
+
+	if r.capabilities&clientConnectWithDB != 0 && len(p) > 0 {
+		r.database, p, _ = readNulString(p)
+	}
+
+	if r.capabilities&clientPluginAuth != 0 && len(p) > 0 {
+		r.authPlugin, _, _ = readNulString(p)
+	}
+
+	return r, nil
+}
+
+// authSwitchRequest asks the client to authenticate with
+// mysql_native_password instead.
+func authSwitchRequest(salt []byte) []byte {
+	p := []byte{0xfe}
+	p = append(p, nativePassword...)
+	p = append(p, 0)
+	p = append(p, salt...)
+	return append(p, 0)
+}
+
+// checkNativePassword verifies a mysql_native_password auth response, which
+// is SHA1(password) XOR SHA1(salt + SHA1(SHA1(password))).
+func checkNativePassword(password string, salt, authResponse []byte) bool {
+	if password == "" {
+		return len(authResponse) == 0
+	}
+
+	stage1 := sha1.Sum([]byte(password))
+	stage2 := sha1.Sum(stage1[:])
+
+	h := sha1.New()
+	h.Write(salt)
+	h.Write(stage2[:])
+	want := h.Sum(nil)
+	for i := range want {
+		want[i] ^= stage1[i]
+	}
+
+	return subtle.ConstantTimeCompare(want, authResponse) == 1
+}
+
+// columnDefinition encodes a column of a result set.
+func columnDefinition(ct *sql.ColumnType) []byte {
+	typ, flags, charset := columnType(ct)
+
+	length, ok := ct.Length()
+	if !ok || length > 1<<32-1 {
+		length = 0
+	}
+
+	decimals := byte(0)
+	if _, scale, ok := ct.DecimalSize(); ok {
+		decimals = byte(scale)
+	}
+
+	p := appendLenencString(nil, "def")
+	p = appendLenencString(p, "") // schema
+	p = appendLenencString(p, "") // table
+	p = appendLenencString(p, "") // original table
+	p = appendLenencString(p, ct.Name())
+	p = appendLenencString(p, ct.Name())
+	p = append(p, 0x0c) // length of the fixed fields
+	p = appendUint16(p, charset)
+	p = appendUint32(p, uint32(length))
+	p = append(p, typ)
+	p = appendUint16(p, flags)
+	p = append(p, decimals)
+	return append(p, 0, 0) // filler
+}
+
+// Column flags.
+const (
+	notNullFlag  uint16 = 1 << 0
+	binaryFlag   uint16 = 1 << 7
+	unsignedFlag uint16 = 1 << 5
+)
+
+// columnTypes maps the database type names reported by the MySQL driver to
+// MySQL column types.
+var columnTypes = map[string]byte{
+	"DECIMAL":    0xf6,
+	"TINYINT":    0x01,
+	"SMALLINT":   0x02,
+	"INT":        0x03,
+	"FLOAT":      0x04,
+	"DOUBLE":     0x05,
+	"NULL":       0x06,
+	"TIMESTAMP":  0x07,
+	"BIGINT":     0x08,
+	"MEDIUMINT":  0x09,
+	"DATE":       0x0a,
+	"TIME":       0x0b,
+	"DATETIME":   0x0c,
+	"YEAR":       0x0d,
+	"BIT":        0x10,
+	"JSON":       0xf5,
+	"ENUM":       0xf7,
+	"SET":        0xf8,
+	"TINYBLOB":   0xf9,
+	"TINYTEXT":   0xf9,
+	"MEDIUMBLOB": 0xfa,
+	"MEDIUMTEXT": 0xfa,
+	"LONGBLOB":   0xfb,
+	"LONGTEXT":   0xfb,
+	"BLOB":       0xfc,
+	"TEXT":       0xfc,
+	"VARCHAR":    0xfd,
+	"VARBINARY":  0xfd,
+	"CHAR":       0xfe,
+	"BINARY":     0xfe,
+	"GEOMETRY":   0xff,
+}
+
+const varStringType = 0xfd
+
+func columnType(ct *sql.ColumnType) (typ byte, flags uint16, charset uint16) {
+	name := strings.ToUpper(ct.DatabaseTypeName())
+	if strings.HasPrefix(name, "UNSIGNED ") {
+		name = strings.TrimPrefix(name, "UNSIGNED ")
+		flags |= unsignedFlag
+	}
+
+	typ, ok := columnTypes[name]
+	if !ok {
+		typ = varStringType
+	}
+
+	charset = utf8mb4GeneralCI
+	switch name {
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		flags |= binaryFlag
+		charset = binaryCollation
+	case "TEXT", "TINYTEXT", "MEDIUMTEXT", "LONGTEXT", "VARCHAR", "CHAR", "ENUM", "SET", "JSON":
+	default:
+		if typ != varStringType {
+			// numbers and temporal types
+			charset = binaryCollation
+		}
+	}
+
+	if nullable, ok := ct.Nullable(); ok && !nullable {
+		flags |= notNullFlag
+	}
+
+	return typ, flags, charset
+}
+
+// textRow encodes a row of a result set in the text protocol.
+func textRow(p []byte, values []sql.RawBytes) []byte {
+	for _, v := range values {
+		if v == nil {
+			p = append(p, 0xfb)
+			continue
+		}
+		p = appendLenencInt(p, uint64(len(v)))
+		p = append(p, v...)
+	}
+	return p
+}
+
+func appendUint16(p []byte, v uint16) []byte {
+	return append(p, byte(v), byte(v>>8))
+}
+
+func appendUint32(p []byte, v uint32) []byte {
+	return append(p, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendLenencInt(p []byte, v uint64) []byte {
+	switch {
+	case v < 251:
+		return append(p, byte(v))
+	case v < 1<<16:
+		return append(p, 0xfc, byte(v), byte(v>>8))
+	case v < 1<<24:
+		return append(p, 0xfd, byte(v), byte(v>>8), byte(v>>16))
+	}
+
+	p = append(p, 0xfe)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return append(p, b[:]...)
+}
+
+func appendLenencString(p []byte, s string) []byte {
+	p = appendLenencInt(p, uint64(len(s)))
+	return append(p, s...)
+}
+
+func readLenencInt(p []byte) (uint64, []byte, bool) {
+	if len(p) == 0 {
+		return 0, nil, false
+	}
+
+	var n int
+	switch p[0] {
+	case 0xfc:
+		n = 2
+	case 0xfd:
+		n = 3
+	case 0xfe:
+		n = 8
+	default:
+		return uint64(p[0]), p[1:], true
+	}
+
+	if len(p) < 1+n {
+		return 0, nil, false
+	}
+
+	var v uint64
+	for i := n; i > 0; i-- {
+		v = v<<8 | uint64(p[i])
+	}
+	return v, p[1+n:], true
+}
+
+func readNulString(p []byte) (string, []byte, bool) {
+	i := bytes.IndexByte(p, 0)
+	if i < 0 {
+		return "", nil, false
+	}
+	return string(p[:i]), p[i+1:], true
+}
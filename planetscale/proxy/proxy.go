@@ -0,0 +1,351 @@
+// Package proxy provides a local MySQL proxy that multiplexes many client
+// connections onto a small pool of connections to a PlanetScale branch:
+//
+//	p, err := proxy.New(&proxy.Config{
+//		Client:       client,
+//		Organization: "my-org",
+//		Database:     "my-db",
+//		Branch:       "main",
+//		MaxConns:     10,
+//		Addr:         "127.0.0.1:3306",
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	err = p.ListenAndServe(ctx)
+//
+// Branch connections are pooled per transaction: a client only holds a
+// branch connection while it runs a statement or a transaction. Statements
+// that change the state of the session, such as SET or LOCK TABLES, pin the
+// branch connection to the client until it disconnects, after which the
+// connection is closed instead of being reused.
+//
+// Outside of a transaction, consecutive statements of a client may run on
+// different branch connections. Functions that return the result of the
+// previous statement of the connection, such as LAST_INSERT_ID(),
+// FOUND_ROWS() and ROW_COUNT(), therefore return the values of another
+// client's statement. Use the last insert ID and the number of affected
+// rows returned with the statement itself, e.g. by sql.Result, or run both
+// statements in a transaction.
+//
+// Clients must authenticate with mysql_native_password and without TLS,
+// which limits the proxy to local sockets. Prepared statements aren't
+// supported, clients must interpolate parameters themselves, e.g. with
+// interpolateParams=true for github.com/go-sql-driver/mysql.
+package proxy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+	"github.com/planetscale/planetscale-go/planetscale/dbutil"
+)
+
+const (
+	defaultMaxConns       = 10
+	defaultMaxClientConns = 1000
+	defaultAcquireTimeout = 10 * time.Second
+	defaultNetwork        = "tcp"
+	defaultAddr           = "127.0.0.1:3306"
+)
+
+// ConnectFunc opens the pool of connections to a database branch.
+type ConnectFunc func(ctx context.Context, client *ps.Client, org, database, branch string) (*sql.DB, error)
+
+// Config defines the configuration of a Proxy.
+type Config struct {
+	// Client defines a PlanetScale client. Use planetscale.NewClient() to
+	// create a new instance.
+	Client *ps.Client
+
+	// Organization, Database and Branch are the branch to proxy.
+	Organization string
+	Database     string
+	Branch       string
+
+	// Connect opens the pool of branch connections. Defaults to
+	// dbutil.Dial.
+	Connect ConnectFunc
+
+	// User and Password are the credentials clients authenticate with. Any
+	// user name is accepted if User is empty.
+	User     string
+	Password string
+
+	// MaxConns is the maximum number of branch connections. Defaults to
+	// 10.
+	MaxConns int
+
+	// MaxIdleConns is the maximum number of idle branch connections.
+	// Defaults to MaxConns.
+	MaxIdleConns int
+
+	// MaxClientConns is the maximum number of client connections. Clients
+	// beyond the limit are rejected with a "Too many connections" error.
+	// Defaults to 1000.
+	MaxClientConns int
+
+	// AcquireTimeout is the maximum time a statement waits for a free
+	// branch connection. Defaults to 10 seconds.
+	AcquireTimeout time.Duration
+
+	// MaxAllowedPacket is the maximum size of a packet sent by a client,
+	// like MySQL's max_allowed_packet. Clients sending larger packets are
+	// disconnected. Defaults to 64 MiB.
+	MaxAllowedPacket int
+
+	// Network and Addr are the address ListenAndServe listens on, e.g.
+	// "unix" and "/tmp/mysql.sock". Defaults to "tcp" and
+	// "127.0.0.1:3306".
+	Network string
+	Addr    string
+}
+
+// Stats are the statistics of a Proxy.
+type Stats struct {
+	// ClientConns is the number of connected clients.
+	ClientConns int
+
+	// TotalClientConns is the number of clients that connected since the
+	// proxy started, RejectedClientConns the number of them that were
+	// rejected because of MaxClientConns, and AuthFailures the number of
+	// them that failed to authenticate.
+	TotalClientConns    uint64
+	RejectedClientConns uint64
+	AuthFailures        uint64
+
+	// Transactions is the number of clients in a transaction.
+	Transactions int
+
+	// PinnedSessions is the number of clients with a pinned branch
+	// connection.
+	PinnedSessions int
+
+	// Queries is the number of statements sent to the branch.
+	Queries uint64
+
+	// AcquireTimeouts is the number of statements that failed because no
+	// branch connection became free within AcquireTimeout.
+	AcquireTimeouts uint64
+
+	// BranchConns are the statistics of the pool of branch connections.
+	BranchConns sql.DBStats
+}
+
+// Proxy is a MySQL proxy for a database branch.
+type Proxy struct {
+	cfg Config
+
+	mu       sync.Mutex
+	db       *sql.DB
+	sessions map[*session]struct{}
+	nextID   uint32
+	stats    Stats
+	wg       sync.WaitGroup
+}
+
+// New returns a new Proxy with the given configuration.
+func New(cfg *Config) (*Proxy, error) {
+	if cfg.Client == nil && cfg.Connect == nil {
+		return nil, errors.New("planetscale Client is not set")
+	}
+
+	if cfg.Organization == "" {
+		return nil, errors.New("organization is not set")
+	}
+
+	if cfg.Database == "" {
+		return nil, errors.New("database is not set")
+	}
+
+	if cfg.Branch == "" {
+		return nil, errors.New("branch is not set")
+	}
+
+	p := &Proxy{
+		cfg:      *cfg,
+		sessions: make(map[*session]struct{}),
+	}
+	if p.cfg.Connect == nil {
+		p.cfg.Connect = dial
+	}
+	if p.cfg.MaxConns <= 0 {
+		p.cfg.MaxConns = defaultMaxConns
+	}
+	if p.cfg.MaxIdleConns <= 0 || p.cfg.MaxIdleConns > p.cfg.MaxConns {
+		p.cfg.MaxIdleConns = p.cfg.MaxConns
+	}
+	if p.cfg.MaxClientConns <= 0 {
+		p.cfg.MaxClientConns = defaultMaxClientConns
+	}
+	if p.cfg.AcquireTimeout <= 0 {
+		p.cfg.AcquireTimeout = defaultAcquireTimeout
+	}
+	if p.cfg.MaxAllowedPacket <= 0 {
+		p.cfg.MaxAllowedPacket = defaultMaxAllowedPacket
+	}
+	if p.cfg.Network == "" {
+		p.cfg.Network = defaultNetwork
+	}
+	if p.cfg.Addr == "" {
+		p.cfg.Addr = defaultAddr
+	}
+
+	return p, nil
+}
+
+// ListenAndServe listens on the configured address and serves clients until
+// ctx is canceled.
+func (p *Proxy) ListenAndServe(ctx context.Context) error {
+	l, err := net.Listen(p.cfg.Network, p.cfg.Addr)
+	if err != nil {
+		return err
+	}
+
+	return p.Serve(ctx, l)
+}
+
+// Serve opens the pool of branch connections and serves the clients of l
+// until ctx is canceled. It closes l, all client connections and the pool
+// before it returns.
+func (p *Proxy) Serve(ctx context.Context, l net.Listener) error {
+	db, err := p.cfg.Connect(ctx, p.cfg.Client, p.cfg.Organization, p.cfg.Database, p.cfg.Branch)
+	if err != nil {
+		l.Close()
+		return err
+	}
+	db.SetMaxOpenConns(p.cfg.MaxConns)
+	db.SetMaxIdleConns(p.cfg.MaxIdleConns)
+
+	p.mu.Lock()
+	p.db = db
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	defer func() {
+		p.mu.Lock()
+		for s := range p.sessions {
+			s.conn.Close()
+		}
+		p.mu.Unlock()
+
+		p.wg.Wait()
+		db.Close()
+	}()
+
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// back off on temporary errors such as running out of file
+			// descriptors
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay < time.Second {
+					delay *= 2
+				}
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+
+		p.accept(ctx, conn)
+	}
+}
+
+// Stats returns the statistics of the proxy.
+func (p *Proxy) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.stats
+	s.ClientConns = len(p.sessions)
+	for sess := range p.sessions {
+		if sess.inTx {
+			s.Transactions++
+		}
+		if sess.pinned {
+			s.PinnedSessions++
+		}
+	}
+	if p.db != nil {
+		s.BranchConns = p.db.Stats()
+	}
+	return s
+}
+
+// accept starts serving a client, unless there are too many clients.
+func (p *Proxy) accept(ctx context.Context, conn net.Conn) {
+	p.mu.Lock()
+	p.stats.TotalClientConns++
+	if len(p.sessions) >= p.cfg.MaxClientConns {
+		p.stats.RejectedClientConns++
+		p.mu.Unlock()
+
+		// MySQL rejects clients with an error instead of the handshake
+		pc := newPacketConn(conn)
+		_ = pc.writeError(erTooManyConnections, tooManyConnectionsSQLState, "Too many connections")
+		_ = pc.flush()
+		conn.Close()
+		return
+	}
+
+	p.nextID++
+	s := &session{
+		p:    p,
+		conn: conn,
+		pc:   newPacketConn(conn),
+		id:   p.nextID,
+		db:   p.db,
+	}
+	s.pc.maxPayload = p.cfg.MaxAllowedPacket
+	p.sessions[s] = struct{}{}
+	p.wg.Add(1)
+	p.mu.Unlock()
+
+	go func() {
+		defer p.wg.Done()
+		s.serve(ctx)
+
+		p.mu.Lock()
+		delete(p.sessions, s)
+		p.mu.Unlock()
+	}()
+}
+
+// count increments a counter of the stats.
+func (p *Proxy) count(counter *uint64) {
+	p.mu.Lock()
+	*counter++
+	p.mu.Unlock()
+}
+
+func dial(ctx context.Context, client *ps.Client, org, database, branch string) (*sql.DB, error) {
+	return dbutil.Dial(ctx, &dbutil.DialConfig{
+		Organization: org,
+		Database:     database,
+		Branch:       branch,
+		Client:       client,
+	})
+}
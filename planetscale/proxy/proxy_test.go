@@ -0,0 +1,511 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/go-sql-driver/mysql"
+	"github.com/planetscale/planetscale-go/internal/mysqltest"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+// backend is a fake branch. Every connection has an ID, which is returned
+// by SELECT CONNECTION_ID().
+type backend struct {
+	mu     sync.Mutex
+	nextID int64
+	closed int
+	log    []string
+}
+
+func (b *backend) connect(ctx context.Context, client *ps.Client, org, database, branch string) (*sql.DB, error) {
+	return sql.OpenDB(b), nil
+}
+
+func (b *backend) Connect(context.Context) (driver.Conn, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	return &backendConn{b: b, id: b.nextID}, nil
+}
+
+func (b *backend) Driver() driver.Driver { return nil }
+
+// statements returns the statements sent to the branch as "id: statement".
+func (b *backend) statements() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.log...)
+}
+
+func (b *backend) closedConns() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+type backendConn struct {
+	b  *backend
+	id int64
+}
+
+func (c *backendConn) record(q string) {
+	c.b.mu.Lock()
+	c.b.log = append(c.b.log, fmt.Sprintf("%d: %s", c.id, q))
+	c.b.mu.Unlock()
+}
+
+func (c *backendConn) QueryContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Rows, error) {
+	c.record(q)
+
+	switch q {
+	case "SELECT id, name FROM users":
+		return &backendRows{
+			cols:  []string{"id", "name"},
+			types: []string{"BIGINT", "VARCHAR"},
+			rows:  [][]driver.Value{{int64(1), "ana"}, {int64(2), nil}},
+		}, nil
+	case "SELECT CONNECTION_ID()":
+		return &backendRows{
+			cols:  []string{"CONNECTION_ID()"},
+			types: []string{"UNSIGNED BIGINT"},
+			rows:  [][]driver.Value{{c.id}},
+		}, nil
+	case "SELECT * FROM missing":
+		return nil, &mysql.MySQLError{Number: 1146, Message: "Table 'my-db.missing' doesn't exist"}
+	}
+
+	return nil, errors.New("connection reset")
+}
+
+func (c *backendConn) ExecContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Result, error) {
+	c.record(q)
+	if q == "INSERT INTO users (name) VALUES ('bob'), ('eve')" {
+		return backendResult{affected: 2, lastInsertID: 7}, nil
+	}
+	return backendResult{}, nil
+}
+
+func (c *backendConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *backendConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c *backendConn) Close() error {
+	c.b.mu.Lock()
+	c.b.closed++
+	c.b.mu.Unlock()
+	return nil
+}
+
+type backendRows struct {
+	cols  []string
+	types []string
+	rows  [][]driver.Value
+}
+
+func (r *backendRows) Columns() []string { return r.cols }
+func (r *backendRows) Close() error      { return nil }
+
+func (r *backendRows) ColumnTypeDatabaseTypeName(i int) string { return r.types[i] }
+
+func (r *backendRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+type backendResult struct {
+	affected, lastInsertID int64
+}
+
+func (r backendResult) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r backendResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+// startProxy serves a proxy on a random port until the test finishes.
+func startProxy(c *qt.C, cfg *Config) (*Proxy, string) {
+	cfg.Organization = "my-org"
+	cfg.Database = "my-db"
+	cfg.Branch = "main"
+	cfg.User = "app"
+	cfg.Password = "secret"
+
+	p, err := New(cfg)
+	c.Assert(err, qt.IsNil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Serve(ctx, l)
+	}()
+
+	c.Cleanup(func() {
+		cancel()
+		c.Check(<-done, qt.Equals, context.Canceled)
+	})
+
+	return p, l.Addr().String()
+}
+
+// openClient opens a client database of the proxy.
+func openClient(c *qt.C, addr, password string) *sql.DB {
+	db, err := sql.Open("mysql", fmt.Sprintf("app:%s@tcp(%s)/my-db?interpolateParams=true", password, addr))
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(func() { db.Close() })
+	return db
+}
+
+func waitFor(c *qt.C, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			c.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestProxy_query(t *testing.T) {
+	c := qt.New(t)
+	b := &backend{}
+	p, addr := startProxy(c, &Config{Connect: b.connect})
+	db := openClient(c, addr, "secret")
+
+	rows, err := db.Query("SELECT id, name FROM users")
+	c.Assert(err, qt.IsNil)
+
+	types, err := rows.ColumnTypes()
+	c.Assert(err, qt.IsNil)
+	c.Assert(types[0].DatabaseTypeName(), qt.Equals, "BIGINT")
+	c.Assert(types[1].DatabaseTypeName(), qt.Equals, "VARCHAR")
+
+	var got []string
+	for rows.Next() {
+		var id int64
+		var name sql.NullString
+		c.Assert(rows.Scan(&id, &name), qt.IsNil)
+		got = append(got, fmt.Sprintf("%d %v", id, name))
+	}
+	c.Assert(rows.Err(), qt.IsNil)
+	c.Assert(got, qt.DeepEquals, []string{"1 {ana true}", "2 { false}"})
+
+	res, err := db.Exec("INSERT INTO users (name) VALUES (?), (?)", "bob", "eve")
+	c.Assert(err, qt.IsNil)
+	affected, err := res.RowsAffected()
+	c.Assert(err, qt.IsNil)
+	c.Assert(affected, qt.Equals, int64(2))
+	id, err := res.LastInsertId()
+	c.Assert(err, qt.IsNil)
+	c.Assert(id, qt.Equals, int64(7))
+
+	// MySQL errors are relayed
+	_, err = db.Query("SELECT * FROM missing")
+	var myErr *mysql.MySQLError
+	c.Assert(errors.As(err, &myErr), qt.IsTrue)
+	c.Assert(myErr.Number, qt.Equals, uint16(1146))
+	c.Assert(myErr.Message, qt.Equals, "Table 'my-db.missing' doesn't exist")
+
+	// other errors discard the branch connection
+	_, err = db.Query("SELECT broken")
+	c.Assert(errors.As(err, &myErr), qt.IsTrue)
+	c.Assert(myErr.Number, qt.Equals, crServerLost)
+	c.Assert(b.closedConns(), qt.Equals, 1)
+
+	// SET NAMES is answered by the proxy
+	_, err = db.Exec("SET NAMES utf8mb4")
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(b.statements(), qt.DeepEquals, []string{
+		"1: SELECT id, name FROM users",
+		"1: INSERT INTO users (name) VALUES ('bob'), ('eve')",
+		"1: SELECT * FROM missing",
+		"1: SELECT broken",
+	})
+
+	stats := p.Stats()
+	c.Assert(stats.Queries, qt.Equals, uint64(4))
+	c.Assert(stats.TotalClientConns, qt.Equals, uint64(1))
+	c.Assert(stats.BranchConns.InUse, qt.Equals, 0)
+}
+
+func TestProxy_multiplex(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	b := &backend{}
+	p, addr := startProxy(c, &Config{Connect: b.connect, MaxConns: 1})
+	db := openClient(c, addr, "secret")
+
+	// both clients share the single branch connection
+	for i := 0; i < 2; i++ {
+		conn, err := db.Conn(ctx)
+		c.Assert(err, qt.IsNil)
+		defer conn.Close()
+
+		var id int64
+		c.Assert(conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&id), qt.IsNil)
+		c.Assert(id, qt.Equals, int64(1))
+	}
+
+	stats := p.Stats()
+	c.Assert(stats.ClientConns, qt.Equals, 2)
+	c.Assert(stats.BranchConns.OpenConnections, qt.Equals, 1)
+}
+
+func TestProxy_transaction(t *testing.T) {
+	c := qt.New(t)
+	b := &backend{}
+	p, addr := startProxy(c, &Config{
+		Connect:        b.connect,
+		MaxConns:       1,
+		AcquireTimeout: 50 * time.Millisecond,
+	})
+	db := openClient(c, addr, "secret")
+
+	tx, err := db.Begin()
+	c.Assert(err, qt.IsNil)
+	_, err = tx.Exec("INSERT INTO users (name) VALUES (?), (?)", "bob", "eve")
+	c.Assert(err, qt.IsNil)
+
+	stats := p.Stats()
+	c.Assert(stats.Transactions, qt.Equals, 1)
+	c.Assert(stats.BranchConns.InUse, qt.Equals, 1)
+
+	// the transaction holds the only branch connection
+	_, err = db.Exec("INSERT INTO users (name) VALUES (?), (?)", "bob", "eve")
+	c.Assert(err, qt.ErrorMatches, ".*timed out waiting for a branch connection")
+	c.Assert(p.Stats().AcquireTimeouts, qt.Equals, uint64(1))
+
+	c.Assert(tx.Commit(), qt.IsNil)
+
+	stats = p.Stats()
+	c.Assert(stats.Transactions, qt.Equals, 0)
+	c.Assert(stats.BranchConns.InUse, qt.Equals, 0)
+
+	_, err = db.Exec("INSERT INTO users (name) VALUES (?), (?)", "bob", "eve")
+	c.Assert(err, qt.IsNil)
+
+	// transactions of disconnected clients are rolled back
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, qt.IsNil)
+	_, err = conn.ExecContext(context.Background(), "START TRANSACTION")
+	c.Assert(err, qt.IsNil)
+	c.Assert(p.Stats().Transactions, qt.Equals, 1)
+	_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	waitFor(c, func() bool { return p.Stats().Transactions == 0 })
+
+	c.Assert(b.statements(), qt.DeepEquals, []string{
+		"1: START TRANSACTION",
+		"1: INSERT INTO users (name) VALUES ('bob'), ('eve')",
+		"1: COMMIT",
+		"1: INSERT INTO users (name) VALUES ('bob'), ('eve')",
+		"1: START TRANSACTION",
+		"1: ROLLBACK",
+	})
+	c.Assert(b.closedConns(), qt.Equals, 0)
+}
+
+func TestProxy_pinned(t *testing.T) {
+	c := qt.New(t)
+	b := &backend{}
+	p, addr := startProxy(c, &Config{Connect: b.connect})
+	db := openClient(c, addr, "secret")
+
+	_, err := db.Exec("SET @user_id = 42")
+	c.Assert(err, qt.IsNil)
+
+	stats := p.Stats()
+	c.Assert(stats.PinnedSessions, qt.Equals, 1)
+	c.Assert(stats.BranchConns.InUse, qt.Equals, 1)
+
+	// the session state of pinned connections can't be reset, so they are
+	// closed when the client disconnects
+	c.Assert(db.Close(), qt.IsNil)
+	waitFor(c, func() bool { return b.closedConns() == 1 })
+	c.Assert(p.Stats().PinnedSessions, qt.Equals, 0)
+}
+
+func TestProxy_auth(t *testing.T) {
+	c := qt.New(t)
+	b := &backend{}
+	p, addr := startProxy(c, &Config{Connect: b.connect})
+
+	err := openClient(c, addr, "wrong").Ping()
+	var myErr *mysql.MySQLError
+	c.Assert(errors.As(err, &myErr), qt.IsTrue)
+	c.Assert(myErr.Number, qt.Equals, erAccessDenied)
+	c.Assert(p.Stats().AuthFailures, qt.Equals, uint64(1))
+}
+
+func TestProxy_maxClientConns(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	b := &backend{}
+	p, addr := startProxy(c, &Config{Connect: b.connect, MaxClientConns: 1})
+
+	conn, err := openClient(c, addr, "secret").Conn(ctx)
+	c.Assert(err, qt.IsNil)
+	defer conn.Close()
+
+	err = openClient(c, addr, "secret").Ping()
+	var myErr *mysql.MySQLError
+	c.Assert(errors.As(err, &myErr), qt.IsTrue)
+	c.Assert(myErr.Number, qt.Equals, erTooManyConnections)
+
+	stats := p.Stats()
+	c.Assert(stats.ClientConns, qt.Equals, 1)
+	c.Assert(stats.RejectedClientConns, qt.Equals, uint64(1))
+}
+
+func TestProxy_maxAllowedPacket(t *testing.T) {
+	c := qt.New(t)
+	b := &backend{}
+	_, addr := startProxy(c, &Config{Connect: b.connect, MaxAllowedPacket: 1024})
+	db := openClient(c, addr, "secret")
+
+	_, err := db.Exec("INSERT INTO users (name) VALUES (?)", strings.Repeat("a", 2048))
+	var myErr *mysql.MySQLError
+	c.Assert(errors.As(err, &myErr), qt.IsTrue)
+	c.Assert(myErr.Number, qt.Equals, erNetPacketTooLarge)
+	c.Assert(b.statements(), qt.HasLen, 0)
+
+	// smaller packets are fine
+	_, err = db.Exec("INSERT INTO users (name) VALUES ('bob'), ('eve')")
+	c.Assert(err, qt.IsNil)
+}
+
+func TestPacketConn_readPacketTooLarge(t *testing.T) {
+	c := qt.New(t)
+
+	// a payload split into a full packet and a second one; only the
+	// headers are sent, the data is never read
+	var data []byte
+	data = append(data, 0xff, 0xff, 0xff, 0)
+	data = append(data, make([]byte, maxPacketSize)...)
+	data = append(data, 0xff, 0xff, 0xff, 1)
+
+	pc := &packetConn{r: bufio.NewReader(bytes.NewReader(data)), maxPayload: maxPacketSize + 100}
+	_, err := pc.readPacket()
+	c.Assert(err, qt.Equals, errPacketTooLarge)
+}
+
+func TestProxy_preparedStatements(t *testing.T) {
+	c := qt.New(t)
+	b := &backend{}
+	_, addr := startProxy(c, &Config{Connect: b.connect})
+
+	db, err := sql.Open("mysql", fmt.Sprintf("app:secret@tcp(%s)/my-db", addr))
+	c.Assert(err, qt.IsNil)
+	defer db.Close()
+
+	_, err = db.Exec("INSERT INTO users (name) VALUES (?)", "bob")
+	c.Assert(err, qt.ErrorMatches, ".*prepared statements aren't supported, interpolate parameters on the client instead")
+}
+
+func TestProxy_mysql(t *testing.T) {
+	c := qt.New(t)
+	_, addr := startProxy(c, &Config{Connect: mysqltest.Connect(t), MaxConns: 2})
+	db := openClient(c, addr, "secret")
+
+	_, err := db.Exec("CREATE TABLE users (id bigint unsigned NOT NULL AUTO_INCREMENT PRIMARY KEY, name varchar(255))")
+	c.Assert(err, qt.IsNil)
+
+	tx, err := db.Begin()
+	c.Assert(err, qt.IsNil)
+	res, err := tx.Exec("INSERT INTO users (name) VALUES (?), (?)", "ana", nil)
+	c.Assert(err, qt.IsNil)
+	affected, err := res.RowsAffected()
+	c.Assert(err, qt.IsNil)
+	c.Assert(affected, qt.Equals, int64(2))
+	c.Assert(tx.Rollback(), qt.IsNil)
+
+	_, err = db.Exec("INSERT INTO users (name) VALUES (?), (?)", "ana", nil)
+	c.Assert(err, qt.IsNil)
+
+	var got []string
+	rows, err := db.Query("SELECT id, name FROM users ORDER BY id")
+	c.Assert(err, qt.IsNil)
+	for rows.Next() {
+		var id uint64
+		var name sql.NullString
+		c.Assert(rows.Scan(&id, &name), qt.IsNil)
+		got = append(got, fmt.Sprintf("%d %v", id, name))
+	}
+	c.Assert(rows.Err(), qt.IsNil)
+	c.Assert(got, qt.DeepEquals, []string{"3 {ana true}", "4 { false}"})
+
+	_, err = db.Query("SELECT * FROM missing")
+	var myErr *mysql.MySQLError
+	c.Assert(errors.As(err, &myErr), qt.IsTrue)
+	c.Assert(myErr.Number, qt.Equals, uint16(1146))
+}
+
+func TestClassify(t *testing.T) {
+	c := qt.New(t)
+
+	tests := []struct {
+		query string
+		want  queryKind
+	}{
+		{"SELECT 1", kindRows},
+		{"  /* app */ select * from users", kindRows},
+		{"-- comment\nSHOW TABLES", kindRows},
+		{"(SELECT 1) UNION (SELECT 2)", kindRows},
+		{"INSERT INTO users VALUES (1)", kindExec},
+		{"BEGIN", kindBegin},
+		{"start transaction read only", kindBegin},
+		{"COMMIT", kindEnd},
+		{"ROLLBACK;", kindEnd},
+		{"ROLLBACK TO SAVEPOINT a", kindExec},
+		{"SET NAMES utf8mb4", kindSetNames},
+		{"SET CHARACTER SET utf8mb4", kindSetNames},
+		{"SET @a = 1", kindPin},
+		{"SET SESSION sql_mode = ''", kindPin},
+		{"LOCK TABLES users WRITE", kindPin},
+		{"CREATE TEMPORARY TABLE t (id int)", kindPin},
+		{"CREATE TABLE t (id int)", kindExec},
+		{"SELECT GET_LOCK('a', 10)", kindPin},
+		{"SELECT @a := 1", kindPin},
+	}
+
+	for _, tt := range tests {
+		c.Assert(classify(tt.query), qt.Equals, tt.want, qt.Commentf(tt.query))
+	}
+}
+
+func TestNew(t *testing.T) {
+	c := qt.New(t)
+	client, err := ps.NewClient()
+	c.Assert(err, qt.IsNil)
+
+	tests := []struct {
+		name string
+		cfg  *Config
+		want string
+	}{
+		{"no client", &Config{}, "planetscale Client is not set"},
+		{"no organization", &Config{Client: client}, "organization is not set"},
+		{"no database", &Config{Client: client, Organization: "my-org"}, "database is not set"},
+		{"no branch", &Config{Client: client, Organization: "my-org", Database: "my-db"}, "branch is not set"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(tt.cfg)
+		c.Assert(err, qt.ErrorMatches, tt.want, qt.Commentf(tt.name))
+	}
+}
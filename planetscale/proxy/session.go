@@ -0,0 +1,436 @@
+package proxy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// rollbackTimeout is the maximum time to roll back the open transaction of
+// a client that disconnected.
+const rollbackTimeout = 5 * time.Second
+
+var errAcquireTimeout = errors.New("timed out waiting for a branch connection")
+
+// session serves a client connection.
+type session struct {
+	p    *Proxy
+	conn net.Conn
+	pc   *packetConn
+	id   uint32
+	db   *sql.DB
+
+	// branch is the branch connection held by the session, if any.
+	branch *sql.Conn
+
+	// inTx and pinned are only written by the session, with p.mu held so
+	// Stats can read them.
+	inTx   bool
+	pinned bool
+}
+
+func (s *session) serve(ctx context.Context) {
+	defer s.conn.Close()
+	defer s.reset()
+
+	if err := s.handshake(); err != nil {
+		return
+	}
+
+	for {
+		s.pc.resetSeq()
+		p, err := s.readPacket()
+		if err != nil || len(p) == 0 {
+			return
+		}
+
+		quit, err := s.dispatch(ctx, p)
+		if err != nil || quit {
+			return
+		}
+
+		if err := s.pc.flush(); err != nil {
+			return
+		}
+	}
+}
+
+// handshake authenticates the client.
+func (s *session) handshake() error {
+	h, err := newHandshake(s.id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.pc.writePacket(h.packet()); err != nil {
+		return err
+	}
+	if err := s.pc.flush(); err != nil {
+		return err
+	}
+
+	p, err := s.readPacket()
+	if err != nil {
+		return err
+	}
+
+	resp, err := parseHandshakeResponse(p)
+	if err != nil {
+		_ = s.pc.writeError(erHandshake, commLinkSQLState, err.Error())
+		_ = s.pc.flush()
+		return err
+	}
+
+	auth := resp.authResponse
+	if resp.authPlugin != "" && resp.authPlugin != nativePassword {
+		if err := s.pc.writePacket(authSwitchRequest(h.salt)); err != nil {
+			return err
+		}
+		if err := s.pc.flush(); err != nil {
+			return err
+		}
+
+		auth, err = s.readPacket()
+		if err != nil {
+			return err
+		}
+	}
+
+	user := s.p.cfg.User
+	if (user != "" && resp.user != user) || !checkNativePassword(s.p.cfg.Password, h.salt, auth) {
+		s.p.count(&s.p.stats.AuthFailures)
+		_ = s.pc.writeError(erAccessDenied, accessDeniedSQLState,
+			fmt.Sprintf("Access denied for user '%s'", resp.user))
+		_ = s.pc.flush()
+		return errors.New("access denied")
+	}
+
+	if err := s.pc.writeOK(0, 0, s.status()); err != nil {
+		return err
+	}
+	return s.pc.flush()
+}
+
+// readPacket reads a packet of the client. Packets larger than
+// MaxAllowedPacket are answered with an error like MySQL does, and the
+// client is disconnected.
+func (s *session) readPacket() ([]byte, error) {
+	p, err := s.pc.readPacket()
+	if errors.Is(err, errPacketTooLarge) {
+		_ = s.pc.writeError(erNetPacketTooLarge, commLinkSQLState, "Got a packet bigger than 'max_allowed_packet' bytes")
+		_ = s.pc.flush()
+	}
+	return p, err
+}
+
+// dispatch runs a command of the client. It reports whether the client
+// quit.
+func (s *session) dispatch(ctx context.Context, p []byte) (bool, error) {
+	switch p[0] {
+	case comQuit:
+		return true, nil
+	case comPing, comInitDB:
+		// the proxy serves a single branch, so any database is accepted
+		return false, s.pc.writeOK(0, 0, s.status())
+	case comResetConnection:
+		s.reset()
+		return false, s.pc.writeOK(0, 0, s.status())
+	case comQuery:
+		return false, s.query(ctx, string(p[1:]))
+	case comStmtPrepare:
+		return false, s.pc.writeError(erUnknownCommand, commLinkSQLState,
+			"prepared statements aren't supported, interpolate parameters on the client instead")
+	}
+
+	return false, s.pc.writeError(erUnknownCommand, commLinkSQLState,
+		fmt.Sprintf("command 0x%02x isn't supported", p[0]))
+}
+
+// query runs a statement on a branch connection and relays the result.
+func (s *session) query(ctx context.Context, q string) error {
+	kind := classify(q)
+
+	switch {
+	case kind == kindSetNames:
+		// branch connections always use utf8mb4
+		return s.pc.writeOK(0, 0, s.status())
+	case kind == kindEnd && s.branch == nil:
+		// there's no transaction to end
+		return s.pc.writeOK(0, 0, s.status())
+	}
+
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		if errors.Is(err, errAcquireTimeout) {
+			return s.pc.writeError(erUnknownError, defaultSQLState, err.Error())
+		}
+		return s.backendError(err)
+	}
+	defer s.releaseIdle()
+
+	s.p.count(&s.p.stats.Queries)
+
+	if kind == kindRows {
+		return s.queryRows(ctx, conn, q)
+	}
+
+	res, err := conn.ExecContext(ctx, q)
+	if err != nil {
+		return s.backendError(err)
+	}
+
+	switch kind {
+	case kindBegin:
+		s.setState(true, s.pinned)
+	case kindEnd:
+		s.setState(false, s.pinned)
+	case kindPin:
+		s.setState(s.inTx, true)
+	}
+
+	affected, _ := res.RowsAffected()
+	lastInsertID, _ := res.LastInsertId()
+	return s.pc.writeOK(uint64(affected), uint64(lastInsertID), s.status())
+}
+
+// queryRows relays the result set of a statement.
+func (s *session) queryRows(ctx context.Context, conn *sql.Conn, q string) error {
+	rows, err := conn.QueryContext(ctx, q)
+	if err != nil {
+		return s.backendError(err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return s.backendError(err)
+	}
+
+	if err := s.pc.writePacket(appendLenencInt(nil, uint64(len(cols)))); err != nil {
+		return err
+	}
+	for _, col := range cols {
+		if err := s.pc.writePacket(columnDefinition(col)); err != nil {
+			return err
+		}
+	}
+	if err := s.pc.writeEOF(s.status()); err != nil {
+		return err
+	}
+
+	values := make([]sql.RawBytes, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	var buf []byte
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return s.backendError(err)
+		}
+
+		buf = textRow(buf[:0], values)
+		if err := s.pc.writePacket(buf); err != nil {
+			return err
+		}
+	}
+
+	// an error packet may replace the final EOF packet of a result set
+	if err := rows.Err(); err != nil {
+		return s.backendError(err)
+	}
+
+	return s.pc.writeEOF(s.status())
+}
+
+// backendError relays an error of the branch connection to the client.
+// Errors other than MySQL errors leave the branch connection in an unknown
+// state, so it's discarded.
+func (s *session) backendError(err error) error {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return s.pc.writeError(myErr.Number, defaultSQLState, myErr.Message)
+	}
+
+	s.release(true)
+	return s.pc.writeError(crServerLost, defaultSQLState,
+		fmt.Sprintf("Lost connection to branch: %s", err))
+}
+
+// acquire returns the branch connection of the session, taking one from the
+// pool if it doesn't hold one.
+func (s *session) acquire(ctx context.Context) (*sql.Conn, error) {
+	if s.branch != nil {
+		return s.branch, nil
+	}
+
+	actx, cancel := context.WithTimeout(ctx, s.p.cfg.AcquireTimeout)
+	defer cancel()
+
+	conn, err := s.db.Conn(actx)
+	if err != nil {
+		if ctx.Err() == nil && actx.Err() == context.DeadlineExceeded {
+			s.p.count(&s.p.stats.AcquireTimeouts)
+			return nil, errAcquireTimeout
+		}
+		return nil, err
+	}
+
+	s.branch = conn
+	return conn, nil
+}
+
+// releaseIdle returns the branch connection to the pool unless the session
+// is in a transaction or pinned.
+func (s *session) releaseIdle() {
+	if !s.inTx && !s.pinned {
+		s.release(false)
+	}
+}
+
+// release returns the branch connection to the pool, or closes it if
+// discard is set.
+func (s *session) release(discard bool) {
+	if s.branch == nil {
+		return
+	}
+
+	if discard {
+		// returning driver.ErrBadConn makes database/sql close the
+		// connection instead of reusing it
+		_ = s.branch.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	s.branch.Close()
+	s.branch = nil
+	s.setState(false, false)
+}
+
+// reset ends the transaction of the session and releases its branch
+// connection, e.g. after the client disconnected.
+func (s *session) reset() {
+	switch {
+	case s.pinned:
+		// the session state of the connection can't be restored
+		s.release(true)
+	case s.inTx:
+		ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+		defer cancel()
+
+		_, err := s.branch.ExecContext(ctx, "ROLLBACK")
+		s.release(err != nil)
+	default:
+		s.release(false)
+	}
+}
+
+func (s *session) setState(inTx, pinned bool) {
+	s.p.mu.Lock()
+	s.inTx = inTx
+	s.pinned = pinned
+	s.p.mu.Unlock()
+}
+
+func (s *session) status() uint16 {
+	if s.inTx {
+		return statusAutocommit | statusInTrans
+	}
+	return statusAutocommit
+}
+
+// queryKind defines how a statement affects the session.
+type queryKind int
+
+const (
+	kindExec     queryKind = iota // Statement without a result set.
+	kindRows                      // Statement with a result set.
+	kindBegin                     // Starts a transaction.
+	kindEnd                       // Ends a transaction.
+	kindSetNames                  // Sets the character set of the connection.
+	kindPin                       // Changes the session state, which pins the connection.
+)
+
+// classify returns the kind of a statement.
+func classify(q string) queryKind {
+	q = strings.ToUpper(trimComments(q))
+
+	// named locks and user variables belong to the session
+	if strings.Contains(q, "GET_LOCK(") || strings.Contains(q, ":=") {
+		return kindPin
+	}
+
+	fields := strings.Fields(strings.TrimLeft(q, "("))
+	if len(fields) == 0 {
+		return kindExec
+	}
+	for i := range fields {
+		fields[i] = strings.TrimRight(fields[i], ";")
+	}
+	second := ""
+	if len(fields) > 1 {
+		second = fields[1]
+	}
+
+	switch fields[0] {
+	case "SELECT", "SHOW", "DESC", "DESCRIBE", "EXPLAIN", "WITH", "VALUES", "TABLE":
+		return kindRows
+	case "BEGIN":
+		return kindBegin
+	case "START":
+		if second == "TRANSACTION" {
+			return kindBegin
+		}
+	case "COMMIT":
+		return kindEnd
+	case "ROLLBACK":
+		if second == "TO" {
+			// rolls back to a savepoint, the transaction stays open
+			return kindExec
+		}
+		return kindEnd
+	case "SET":
+		if second == "NAMES" || second == "CHARSET" || (second == "CHARACTER" && len(fields) > 2 && fields[2] == "SET") {
+			return kindSetNames
+		}
+		return kindPin
+	case "LOCK", "PREPARE", "XA", "USE", "HANDLER":
+		return kindPin
+	case "CREATE":
+		if second == "TEMPORARY" {
+			return kindPin
+		}
+	}
+
+	return kindExec
+}
+
+// trimComments removes whitespace and comments at the start of a statement.
+func trimComments(q string) string {
+	for {
+		q = strings.TrimSpace(q)
+
+		switch {
+		case strings.HasPrefix(q, "/*"):
+			end := strings.Index(q, "*/")
+			if end < 0 {
+				return ""
+			}
+			q = q[end+2:]
+		case strings.HasPrefix(q, "--"), strings.HasPrefix(q, "#"):
+			end := strings.IndexByte(q, '\n')
+			if end < 0 {
+				return ""
+			}
+			q = q[end+1:]
+		default:
+			return q
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package planetscale
+
+import (
+	"net/http"
+)
+
+// WithReadOnly configures the client to reject all mutating (non-GET)
+// requests. The requests are rejected by the HTTP transport before they are
+// sent, and the call returns an *Error with the code ErrPermission.
+func WithReadOnly() ClientOption {
+	return func(c *Client) error {
+		c.readOnly = true
+		return nil
+	}
+}
+
+// ReadOnly returns a read-only view of the client. The view shares the
+// configuration of c, but rejects mutating requests like a client created
+// with WithReadOnly. c itself is not modified.
+//
+// The services of the view are the default services; services of c that were
+// replaced, e.g. by a decorator, are not carried over.
+func (c *Client) ReadOnly() *Client {
+	view := &Client{
+		client:       c.client,
+		baseURL:      c.baseURL,
+		dashboardURL: c.dashboardURL,
+		retryPolicy:  c.retryPolicy,
+		dryRun:       c.dryRun,
+		breaker:      c.breaker,
+		hedger:       c.hedger,
+		requestHook:  c.requestHook,
+		readOnly:     true,
+	}
+
+	view.enforceReadOnly()
+	view.initServices()
+	return view
+}
+
+// enforceReadOnly wraps the transport of the HTTP client so it rejects
+// mutating requests. The HTTP client is copied, as it might be shared.
+func (c *Client) enforceReadOnly() {
+	if _, ok := c.client.Transport.(*readOnlyTransport); ok {
+		return
+	}
+
+	hc := *c.client
+	hc.Transport = &readOnlyTransport{rt: hc.Transport}
+	c.client = &hc
+}
+
+type readOnlyTransport struct {
+	rt http.RoundTripper
+}
+
+func (t *readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+
+		return nil, &Error{
+			msg:  req.Method + " " + req.URL.Path + " is not allowed, the client is read-only",
+			Code: ErrPermission,
+			Meta: map[string]string{
+				"method": req.Method,
+				"path":   req.URL.Path,
+			},
+		}
+	}
+
+	rt := t.rt
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return rt.RoundTrip(req)
+}
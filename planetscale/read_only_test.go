@@ -0,0 +1,99 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestReadOnly(t *testing.T) {
+	c := qt.New(t)
+
+	var sent []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method+" "+r.URL.Path)
+		w.WriteHeader(200)
+		_, err := w.Write([]byte(`{"name":"planetscale-go-test-db"}`))
+		c.Assert(err, qt.IsNil)
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(
+		WithReadOnly(),
+		WithBaseURL(ts.URL),
+		WithAccessToken("my-token"),
+		WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}),
+	)
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+
+	_, err = client.Databases.Get(ctx, &GetDatabaseRequest{
+		Organization: testOrg,
+		Database:     testDatabase,
+	})
+	c.Assert(err, qt.IsNil)
+
+	err = client.Databases.Delete(ctx, &DeleteDatabaseRequest{
+		Organization: testOrg,
+		Database:     testDatabase,
+	})
+	c.Assert(err, qt.ErrorMatches, "DELETE /v1/organizations/my-org/databases/planetscale-go-test-db is not allowed, the client is read-only")
+
+	var psErr *Error
+	c.Assert(errors.As(err, &psErr), qt.IsTrue)
+	c.Assert(psErr.Code, qt.Equals, ErrPermission)
+	c.Assert(psErr.Meta["method"], qt.Equals, http.MethodDelete)
+
+	c.Assert(sent, qt.DeepEquals, []string{"GET /v1/organizations/my-org/databases/planetscale-go-test-db"})
+}
+
+func TestClient_ReadOnly(t *testing.T) {
+	c := qt.New(t)
+
+	var sent []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method+" "+r.URL.Path)
+		w.WriteHeader(200)
+		_, err := w.Write([]byte(`{"name":"planetscale-go-test-db"}`))
+		c.Assert(err, qt.IsNil)
+	}))
+	defer ts.Close()
+
+	hc := &http.Client{}
+	client, err := NewClient(WithBaseURL(ts.URL), WithHTTPClient(hc))
+	c.Assert(err, qt.IsNil)
+
+	view := client.ReadOnly()
+	ctx := context.Background()
+
+	_, err = view.Databases.Create(ctx, &CreateDatabaseRequest{
+		Organization: testOrg,
+		Name:         testDatabase,
+	})
+	c.Assert(err, qt.ErrorMatches, "POST /v1/organizations/my-org/databases is not allowed, the client is read-only")
+
+	_, err = view.Databases.Get(ctx, &GetDatabaseRequest{
+		Organization: testOrg,
+		Database:     testDatabase,
+	})
+	c.Assert(err, qt.IsNil)
+
+	// the original client and its HTTP client are not affected
+	c.Assert(hc.Transport, qt.IsNil)
+	_, err = client.Databases.Create(ctx, &CreateDatabaseRequest{
+		Organization: testOrg,
+		Name:         testDatabase,
+	})
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(sent, qt.DeepEquals, []string{
+		"GET /v1/organizations/my-org/databases/planetscale-go-test-db",
+		"POST /v1/organizations/my-org/databases",
+	})
+}
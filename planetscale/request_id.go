@@ -0,0 +1,68 @@
+package planetscale
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// RequestIDHeader is the HTTP header the request ID is sent in. The API
+// returns its own request ID in the same header of the response.
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx that carries the given request ID. API
+// calls made with the context send it instead of a generated one, which
+// allows correlating them with the caller's own logs.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID attached to ctx with
+// WithRequestID.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// RequestInfo describes a finished API call. It's passed to the hook
+// configured with WithRequestHook.
+type RequestInfo struct {
+	Method string
+	Path   string
+
+	// RequestID is the ID the client sent with the request.
+	RequestID string
+
+	// ServerRequestID is the request ID returned by the API, if any.
+	ServerRequestID string
+
+	// StatusCode is the HTTP status code of the response. It's zero if no
+	// response was received, e.g. because of a network error or because
+	// the client is in dry-run mode.
+	StatusCode int
+
+	Start    time.Time
+	Duration time.Duration
+
+	// Err is the error returned by the call, if any.
+	Err error
+}
+
+// WithRequestHook configures the client to call hook after every API call,
+// e.g. to log it or to record a tracing span. It's called synchronously.
+func WithRequestHook(hook func(*RequestInfo)) ClientOption {
+	return func(c *Client) error {
+		c.requestHook = hook
+		return nil
+	}
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,85 @@
+package planetscale
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestRequestID(t *testing.T) {
+	c := qt.New(t)
+
+	var received []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, "server-id")
+		w.WriteHeader(http.StatusNotFound)
+		_, err := w.Write([]byte(`{"code":"not_found","message":"Not Found"}`))
+		c.Assert(err, qt.IsNil)
+	}))
+	defer ts.Close()
+
+	var infos []*RequestInfo
+	client, err := NewClient(WithBaseURL(ts.URL), WithRequestHook(func(info *RequestInfo) {
+		infos = append(infos, info)
+	}))
+	c.Assert(err, qt.IsNil)
+
+	ctx := WithRequestID(context.Background(), "my-request")
+	_, err = client.DeployRequests.Deploy(ctx, &PerformDeployRequest{
+		Organization: testOrg,
+		Database:     testDatabase,
+		Number:       1,
+	})
+
+	var psErr *Error
+	c.Assert(errors.As(err, &psErr), qt.IsTrue)
+	c.Assert(psErr.Code, qt.Equals, ErrNotFound)
+	c.Assert(psErr.RequestID, qt.Equals, "my-request")
+	c.Assert(psErr.ServerRequestID, qt.Equals, "server-id")
+
+	// without a request ID in the context, one is generated
+	_, err = client.Databases.Get(context.Background(), &GetDatabaseRequest{
+		Organization: testOrg,
+		Database:     testDatabase,
+	})
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	c.Assert(received, qt.HasLen, 2)
+	c.Assert(received[0], qt.Equals, "my-request")
+	c.Assert(received[1], qt.Matches, "[0-9a-f]{32}")
+
+	c.Assert(infos, qt.HasLen, 2)
+	c.Assert(infos[0].Method, qt.Equals, http.MethodPost)
+	c.Assert(infos[0].Path, qt.Equals, "/v1/organizations/my-org/databases/planetscale-go-test-db/deploy-requests/1/deploy")
+	c.Assert(infos[0].RequestID, qt.Equals, "my-request")
+	c.Assert(infos[0].ServerRequestID, qt.Equals, "server-id")
+	c.Assert(infos[0].StatusCode, qt.Equals, http.StatusNotFound)
+	c.Assert(infos[0].Err, qt.Equals, error(psErr))
+	c.Assert(infos[1].RequestID, qt.Equals, received[1])
+}
+
+func TestRequestID_clientError(t *testing.T) {
+	c := qt.New(t)
+
+	var info *RequestInfo
+	client, err := NewClient(WithReadOnly(), WithRequestHook(func(i *RequestInfo) { info = i }))
+	c.Assert(err, qt.IsNil)
+
+	ctx := WithRequestID(context.Background(), "my-request")
+	err = client.Databases.Delete(ctx, &DeleteDatabaseRequest{
+		Organization: testOrg,
+		Database:     testDatabase,
+	})
+
+	var psErr *Error
+	c.Assert(errors.As(err, &psErr), qt.IsTrue)
+	c.Assert(psErr.Code, qt.Equals, ErrPermission)
+	c.Assert(psErr.RequestID, qt.Equals, "my-request")
+	c.Assert(psErr.ServerRequestID, qt.Equals, "")
+	c.Assert(info.StatusCode, qt.Equals, 0)
+}
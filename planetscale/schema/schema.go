@@ -0,0 +1,184 @@
+// Package schema takes snapshots of the schema of database branches, to
+// version and compare them:
+//
+//	snap, err := schema.Take(ctx, client, "my-org", "my-db", "main")
+//	if err != nil {
+//		return err
+//	}
+//
+//	fmt.Println(snap.Version())
+//	for _, c := range schema.Compare(expected, snap) {
+//		fmt.Printf("%s: %s\n", c.Table, c.Kind)
+//	}
+package schema
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+// Snapshot is the schema of a branch at a point in time.
+type Snapshot struct {
+	Organization string `json:"organization"`
+	Database     string `json:"database"`
+	Branch       string `json:"branch"`
+
+	// Tables maps table names to their CREATE TABLE statement.
+	Tables map[string]string `json:"tables"`
+
+	TakenAt time.Time `json:"taken_at"`
+}
+
+// Take takes a snapshot of the schema of a branch, as returned by
+// DatabaseBranches.Schema.
+func Take(ctx context.Context, client *ps.Client, org, database, branch string) (*Snapshot, error) {
+	diffs, err := client.DatabaseBranches.Schema(ctx, &ps.BranchSchemaRequest{
+		Organization: org,
+		Database:     database,
+		Branch:       branch,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		Organization: org,
+		Database:     database,
+		Branch:       branch,
+		Tables:       make(map[string]string, len(diffs)),
+		TakenAt:      time.Now().UTC(),
+	}
+	for _, d := range diffs {
+		s.Tables[d.Name] = d.Raw
+	}
+
+	return s, nil
+}
+
+// ReadFile reads a snapshot written with WriteFile.
+func ReadFile(path string) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("malformed schema snapshot %s: %s", path, err)
+	}
+	return s, nil
+}
+
+// WriteFile writes the snapshot as JSON to the given file.
+func (s *Snapshot) WriteFile(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Version returns a short hash of the tables of the snapshot. Snapshots with
+// the same tables have the same version, regardless of the branch they were
+// taken of and of the auto-increment counters of their tables.
+func (s *Snapshot) Version() string {
+	h := sha256.New()
+	for _, name := range s.TableNames() {
+		fmt.Fprintf(h, "%s\x00%s\x00", name, normalize(s.Tables[name]))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// TableNames returns the sorted names of the tables of the snapshot.
+func (s *Snapshot) TableNames() []string {
+	names := make([]string, 0, len(s.Tables))
+	for name := range s.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ChangeKind defines how a table changed between two snapshots.
+type ChangeKind string
+
+const (
+	TableAdded    ChangeKind = "added"    // Table only exists in the newer snapshot.
+	TableRemoved  ChangeKind = "removed"  // Table only exists in the older snapshot.
+	TableModified ChangeKind = "modified" // Table definition differs.
+)
+
+// Change is a table that differs between two snapshots.
+type Change struct {
+	Table string
+	Kind  ChangeKind
+
+	// From and To are the CREATE TABLE statements of the table in the
+	// older and newer snapshot. They are empty if the table doesn't exist
+	// in that snapshot.
+	From string
+	To   string
+}
+
+// Compare returns the tables that differ between the snapshots from and to,
+// sorted by table name. Differences in auto-increment counters and
+// whitespace are ignored.
+func Compare(from, to *Snapshot) []*Change {
+	names := make(map[string]bool)
+	for name := range from.Tables {
+		names[name] = true
+	}
+	for name := range to.Tables {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var changes []*Change
+	for _, name := range sorted {
+		f, inFrom := from.Tables[name]
+		t, inTo := to.Tables[name]
+
+		c := &Change{Table: name, From: f, To: t}
+		switch {
+		case !inFrom:
+			c.Kind = TableAdded
+		case !inTo:
+			c.Kind = TableRemoved
+		case normalize(f) != normalize(t):
+			c.Kind = TableModified
+		default:
+			continue
+		}
+		changes = append(changes, c)
+	}
+
+	return changes
+}
+
+var (
+	autoIncrement = regexp.MustCompile(`(?i)\s+AUTO_INCREMENT=\d+`)
+	whitespace    = regexp.MustCompile(`\s+`)
+)
+
+// normalize removes the parts of a CREATE TABLE statement that change
+// without a schema change.
+func normalize(stmt string) string {
+	stmt = autoIncrement.ReplaceAllString(stmt, "")
+	return strings.TrimSpace(whitespace.ReplaceAllString(stmt, " "))
+}
@@ -0,0 +1,94 @@
+package schema
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+func TestTake(t *testing.T) {
+	c := qt.New(t)
+
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+	c.Assert(api.SetSchema("my-org", "my-db", "main", map[string]string{
+		"users": "CREATE TABLE `users` (`id` bigint)",
+	}), qt.IsNil)
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	snap, err := Take(context.Background(), client, "my-org", "my-db", "main")
+	c.Assert(err, qt.IsNil)
+	c.Assert(snap.Branch, qt.Equals, "main")
+	c.Assert(snap.Tables, qt.DeepEquals, map[string]string{
+		"users": "CREATE TABLE `users` (`id` bigint)",
+	})
+	c.Assert(snap.TakenAt.IsZero(), qt.IsFalse)
+
+	_, err = Take(context.Background(), client, "my-org", "my-db", "missing")
+	c.Assert(err, qt.ErrorMatches, "Not Found")
+}
+
+func TestVersion(t *testing.T) {
+	c := qt.New(t)
+
+	a := &Snapshot{Branch: "main", Tables: map[string]string{
+		"users": "CREATE TABLE `users` (\n  `id` bigint\n) AUTO_INCREMENT=12",
+		"posts": "CREATE TABLE `posts` (`id` bigint)",
+	}}
+	b := &Snapshot{Branch: "dev", Tables: map[string]string{
+		"posts": "CREATE TABLE `posts` (`id` bigint)",
+		"users": "CREATE TABLE `users` ( `id` bigint ) AUTO_INCREMENT=99",
+	}}
+	c.Assert(a.Version(), qt.HasLen, 12)
+	c.Assert(a.Version(), qt.Equals, b.Version())
+
+	b.Tables["users"] = "CREATE TABLE `users` (`id` bigint, `email` text)"
+	c.Assert(a.Version(), qt.Not(qt.Equals), b.Version())
+
+	c.Assert((&Snapshot{}).Version(), qt.Not(qt.Equals), a.Version())
+}
+
+func TestCompare(t *testing.T) {
+	c := qt.New(t)
+
+	from := &Snapshot{Tables: map[string]string{
+		"users": "CREATE TABLE `users` (`id` bigint) AUTO_INCREMENT=3",
+		"posts": "CREATE TABLE `posts` (`id` bigint)",
+		"old":   "CREATE TABLE `old` (`id` bigint)",
+	}}
+	to := &Snapshot{Tables: map[string]string{
+		"users":    "CREATE TABLE `users` (`id` bigint) AUTO_INCREMENT=7",
+		"posts":    "CREATE TABLE `posts` (`id` bigint, `title` text)",
+		"comments": "CREATE TABLE `comments` (`id` bigint)",
+	}}
+
+	c.Assert(Compare(from, to), qt.DeepEquals, []*Change{
+		{Table: "comments", Kind: TableAdded, To: "CREATE TABLE `comments` (`id` bigint)"},
+		{Table: "old", Kind: TableRemoved, From: "CREATE TABLE `old` (`id` bigint)"},
+		{Table: "posts", Kind: TableModified, From: "CREATE TABLE `posts` (`id` bigint)", To: "CREATE TABLE `posts` (`id` bigint, `title` text)"},
+	})
+	c.Assert(Compare(from, from), qt.HasLen, 0)
+}
+
+func TestWriteFile(t *testing.T) {
+	c := qt.New(t)
+	path := filepath.Join(c.TempDir(), "schema.json")
+
+	snap := &Snapshot{
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "main",
+		Tables:       map[string]string{"users": "CREATE TABLE `users` (`id` bigint)"},
+	}
+	c.Assert(snap.WriteFile(path), qt.IsNil)
+
+	got, err := ReadFile(path)
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.DeepEquals, snap)
+}
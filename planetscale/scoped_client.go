@@ -0,0 +1,170 @@
+package planetscale
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// scopedTokenDeleteTimeout bounds the deletion of a scoped service token,
+// which can't use the context of the job as it might be canceled already.
+const scopedTokenDeleteTimeout = 30 * time.Second
+
+// ScopedAccess grants a scoped service token accesses to a database.
+type ScopedAccess struct {
+	Database string
+	Accesses []string
+}
+
+// ScopedClientRequest encapsulates the request for creating a client with a
+// temporary service token.
+type ScopedClientRequest struct {
+	Organization string
+
+	// Accesses are the only accesses granted to the service token.
+	Accesses []ScopedAccess
+}
+
+// ScopedClient is a Client authenticated with a temporary service token. The
+// token is deleted when the context passed to NewScopedClient ends or Close
+// is called, whichever happens first.
+type ScopedClient struct {
+	*Client
+
+	// Token is the temporary service token.
+	Token *ServiceToken
+
+	parent       *Client
+	organization string
+
+	once sync.Once
+	stop chan struct{}
+	err  error
+}
+
+// NewScopedClient creates a service token with exactly the given accesses and
+// returns a client authenticated with it. The client shares the
+// configuration of c, such as the base URL, the retry policy and the HTTP
+// client with its transport and timeout, but not c's credentials.
+//
+// The token is deleted with c when ctx ends or ScopedClient.Close is called.
+// If the accesses can't be granted, the token is deleted right away.
+func (c *Client) NewScopedClient(ctx context.Context, scopedReq *ScopedClientRequest) (*ScopedClient, error) {
+	if scopedReq.Organization == "" {
+		return nil, errors.New("organization is not set")
+	}
+
+	if len(scopedReq.Accesses) == 0 {
+		return nil, errors.New("no accesses are set")
+	}
+
+	if c.dryRun != nil {
+		return nil, errors.New("a dry-run client can't create scoped clients")
+	}
+
+	token, err := c.ServiceTokens.Create(ctx, &CreateServiceTokenRequest{
+		Organization: scopedReq.Organization,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ScopedClient{
+		Token:        token,
+		parent:       c,
+		organization: scopedReq.Organization,
+		stop:         make(chan struct{}),
+	}
+
+	for _, a := range scopedReq.Accesses {
+		_, err := c.ServiceTokens.AddAccess(ctx, &AddServiceTokenAccessRequest{
+			Organization: scopedReq.Organization,
+			ID:           token.ID,
+			Database:     a.Database,
+			Accesses:     a.Accesses,
+		})
+		if err != nil {
+			_ = s.Close()
+			return nil, errors.Wrapf(err, "granting access to database %s", a.Database)
+		}
+	}
+
+	// the HTTP client of c is copied as WithServiceToken modifies it
+	hc := *c.client
+	hc.Transport = unauthenticatedTransport(hc.Transport)
+
+	client := &Client{
+		client:       &hc,
+		baseURL:      c.baseURL,
+		dashboardURL: c.dashboardURL,
+		retryPolicy:  c.retryPolicy,
+		breaker:      c.breaker,
+		hedger:       c.hedger,
+		requestHook:  c.requestHook,
+		readOnly:     c.readOnly,
+	}
+	if err := WithServiceToken(token.ID, token.Token)(client); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	if client.readOnly {
+		client.enforceReadOnly()
+	}
+	client.initServices()
+	s.Client = client
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = s.Close()
+		case <-s.stop:
+		}
+	}()
+
+	return s, nil
+}
+
+// unauthenticatedTransport returns rt without the layers added by the
+// authentication and read-only options of a Client.
+func unauthenticatedTransport(rt http.RoundTripper) http.RoundTripper {
+	for {
+		switch t := rt.(type) {
+		case *serviceTokenTransport:
+			rt = t.rt
+		case *oauth2.Transport:
+			rt = t.Base
+		case *readOnlyTransport:
+			rt = t.rt
+		case nil:
+			return http.DefaultTransport
+		default:
+			return rt
+		}
+	}
+}
+
+// Close deletes the service token. It's safe to call Close multiple times,
+// every call returns the result of the first.
+func (s *ScopedClient) Close() error {
+	s.once.Do(func() {
+		close(s.stop)
+
+		ctx, cancel := context.WithTimeout(context.Background(), scopedTokenDeleteTimeout)
+		defer cancel()
+
+		err := s.parent.ServiceTokens.Delete(ctx, &DeleteServiceTokenRequest{
+			Organization: s.organization,
+			ID:           s.Token.ID,
+		})
+
+		if err != nil && !IsNotFound(err) {
+			s.err = errors.Wrapf(err, "deleting service token %s", s.Token.ID)
+		}
+	})
+
+	return s.err
+}
@@ -0,0 +1,215 @@
+package planetscale
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// scopedTokenServer fakes the service token endpoints and records the
+// requests it receives.
+type scopedTokenServer struct {
+	mu       sync.Mutex
+	requests []string
+	auth     []string
+
+	// failAccess fails requests to grant access.
+	failAccess bool
+}
+
+func (s *scopedTokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, strings.TrimSpace(r.Method+" "+r.URL.Path+" "+string(body)))
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+	failAccess := s.failAccess
+	s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/organizations/my-org/service-tokens":
+		_, _ = w.Write([]byte(`{"id":"scoped-id","type":"ServiceToken","token":"scoped-secret"}`))
+	case r.Method == http.MethodPost && failAccess:
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"code":"forbidden","message":"access denied"}`))
+	case r.Method == http.MethodPost:
+		_, _ = w.Write([]byte(`{"type":"list","data":[]}`))
+	case r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		_, _ = w.Write([]byte(`{"type":"list","data":[]}`))
+	}
+}
+
+func (s *scopedTokenServer) Requests() ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...), append([]string(nil), s.auth...)
+}
+
+func TestScopedClient(t *testing.T) {
+	c := qt.New(t)
+
+	srv := &scopedTokenServer{}
+	ts := httptest.NewServer(srv)
+	c.Cleanup(ts.Close)
+
+	client, err := NewClient(WithBaseURL(ts.URL), WithAccessToken("parent-token"))
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	scoped, err := client.NewScopedClient(ctx, &ScopedClientRequest{
+		Organization: testOrg,
+		Accesses: []ScopedAccess{
+			{Database: "my-db", Accesses: []string{"read_branch", "connect_branch"}},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(scoped.Token.ID, qt.Equals, "scoped-id")
+
+	_, err = scoped.Databases.List(ctx, &ListDatabasesRequest{Organization: testOrg})
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(scoped.Close(), qt.IsNil)
+	c.Assert(scoped.Close(), qt.IsNil)
+
+	requests, auth := srv.Requests()
+	c.Assert(requests, qt.DeepEquals, []string{
+		"POST /v1/organizations/my-org/service-tokens",
+		`POST /v1/organizations/my-org/service-tokens/scoped-id/access {"database":"my-db","access":["read_branch","connect_branch"]}`,
+		"GET /v1/organizations/my-org/databases",
+		"DELETE /v1/organizations/my-org/service-tokens/scoped-id",
+	})
+	c.Assert(auth, qt.DeepEquals, []string{
+		"Bearer parent-token",
+		"Bearer parent-token",
+		"scoped-id:scoped-secret",
+		"Bearer parent-token",
+	})
+}
+
+// countingTransport counts the requests it sends.
+type countingTransport struct {
+	mu       sync.Mutex
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.requests++
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestScopedClient_httpClient(t *testing.T) {
+	c := qt.New(t)
+
+	srv := &scopedTokenServer{}
+	ts := httptest.NewServer(srv)
+	c.Cleanup(ts.Close)
+
+	transport := &countingTransport{}
+	client, err := NewClient(
+		WithBaseURL(ts.URL),
+		WithHTTPClient(&http.Client{Transport: transport, Timeout: time.Minute}),
+		WithServiceToken("parent-id", "parent-secret"),
+	)
+	c.Assert(err, qt.IsNil)
+
+	ctx := context.Background()
+	scoped, err := client.NewScopedClient(ctx, &ScopedClientRequest{
+		Organization: testOrg,
+		Accesses:     []ScopedAccess{{Database: "my-db", Accesses: []string{"read_branch"}}},
+	})
+	c.Assert(err, qt.IsNil)
+	defer scoped.Close()
+
+	_, err = scoped.Databases.List(ctx, &ListDatabasesRequest{Organization: testOrg})
+	c.Assert(err, qt.IsNil)
+
+	// the scoped client uses the transport and timeout of the parent, but
+	// only sends its own token
+	c.Assert(scoped.client.Timeout, qt.Equals, time.Minute)
+	c.Assert(transport.requests, qt.Equals, 3)
+
+	_, auth := srv.Requests()
+	c.Assert(auth[len(auth)-1], qt.Equals, "scoped-id:scoped-secret")
+
+	// the parent is left unchanged
+	_, err = client.Databases.List(ctx, &ListDatabasesRequest{Organization: testOrg})
+	c.Assert(err, qt.IsNil)
+	_, auth = srv.Requests()
+	c.Assert(auth[len(auth)-1], qt.Equals, "parent-id:parent-secret")
+}
+
+func TestScopedClient_contextDone(t *testing.T) {
+	c := qt.New(t)
+
+	srv := &scopedTokenServer{}
+	ts := httptest.NewServer(srv)
+	c.Cleanup(ts.Close)
+
+	client, err := NewClient(WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = client.NewScopedClient(ctx, &ScopedClientRequest{
+		Organization: testOrg,
+		Accesses:     []ScopedAccess{{Database: "my-db", Accesses: []string{"read_branch"}}},
+	})
+	c.Assert(err, qt.IsNil)
+
+	cancel()
+
+	deleted := func() bool {
+		requests, _ := srv.Requests()
+		return requests[len(requests)-1] == "DELETE /v1/organizations/my-org/service-tokens/scoped-id"
+	}
+	for start := time.Now(); !deleted(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			c.Fatal("service token wasn't deleted after the context ended")
+		}
+	}
+}
+
+func TestScopedClient_accessFails(t *testing.T) {
+	c := qt.New(t)
+
+	srv := &scopedTokenServer{failAccess: true}
+	ts := httptest.NewServer(srv)
+	c.Cleanup(ts.Close)
+
+	client, err := NewClient(WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	_, err = client.NewScopedClient(context.Background(), &ScopedClientRequest{
+		Organization: testOrg,
+		Accesses:     []ScopedAccess{{Database: "my-db", Accesses: []string{"delete_database"}}},
+	})
+	c.Assert(err, qt.ErrorMatches, "granting access to database my-db: access denied")
+
+	// the token is deleted right away
+	requests, _ := srv.Requests()
+	c.Assert(requests[len(requests)-1], qt.Equals, "DELETE /v1/organizations/my-org/service-tokens/scoped-id")
+}
+
+func TestScopedClient_invalidRequest(t *testing.T) {
+	c := qt.New(t)
+
+	client, err := NewClient()
+	c.Assert(err, qt.IsNil)
+
+	_, err = client.NewScopedClient(context.Background(), &ScopedClientRequest{Organization: testOrg})
+	c.Assert(err, qt.ErrorMatches, "no accesses are set")
+
+	_, err = client.NewScopedClient(context.Background(), &ScopedClientRequest{})
+	c.Assert(err, qt.ErrorMatches, "organization is not set")
+}
@@ -131,6 +131,7 @@ type DeleteServiceTokenAccessRequest struct {
 
 type ServiceToken struct {
 	ID    string `json:"id"`
+	Name  string `json:"name"`
 	Type  string `json:"type"`
 	Token string `json:"token"`
 }
@@ -44,7 +44,7 @@ func TestServiceTokens_List(t *testing.T) {
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
-		out := `{"type":"list","next_page":null,"prev_page":null,"data":[{"id":"txhc257pxjuc","type":"ServiceToken","token":null}]}`
+		out := `{"type":"list","next_page":null,"prev_page":null,"data":[{"id":"txhc257pxjuc","name":"ci-deployer","type":"ServiceToken","token":null}]}`
 		_, err := w.Write([]byte(out))
 		c.Assert(err, qt.IsNil)
 	}))
@@ -60,6 +60,7 @@ func TestServiceTokens_List(t *testing.T) {
 	want := []*ServiceToken{
 		{
 			ID:   "txhc257pxjuc",
+			Name: "ci-deployer",
 			Type: "ServiceToken",
 		},
 	}
@@ -0,0 +1,146 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+	"github.com/planetscale/planetscale-go/planetscale/watch"
+)
+
+// Config defines the configuration of a Bridge.
+type Config struct {
+	// Client defines a PlanetScale client. Use planetscale.NewClient() to
+	// create a new instance.
+	Client *ps.Client
+
+	// Organization and Database are the database whose deploy requests are
+	// mirrored.
+	Organization string
+	Database     string
+
+	// Reporter delivers the statuses.
+	Reporter Reporter
+
+	// Context identifies the statuses on the code host. Defaults to
+	// DefaultContext.
+	Context string
+
+	// CommitSHA returns the commit a deploy request belongs to, e.g. by
+	// looking up the pull request of its branch. Deploy requests without a
+	// commit aren't reported by Run.
+	CommitSHA func(ctx context.Context, dr *ps.DeployRequest) (string, error)
+
+	// WatchOptions configures the resync interval and error backoff of Run.
+	WatchOptions *watch.Options
+
+	// OnError is called with the errors of Run.
+	OnError func(error)
+}
+
+// Bridge reports the state of deploy requests to a Reporter. Statuses are
+// only reported when they change.
+type Bridge struct {
+	cfg Config
+
+	mu   sync.Mutex
+	last map[uint64]Status
+}
+
+// New returns a new Bridge with the given configuration.
+func New(cfg *Config) (*Bridge, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("planetscale Client is not set")
+	}
+
+	if cfg.Organization == "" {
+		return nil, errors.New("organization is not set")
+	}
+
+	if cfg.Database == "" {
+		return nil, errors.New("database is not set")
+	}
+
+	if cfg.Reporter == nil {
+		return nil, errors.New("reporter is not set")
+	}
+
+	b := &Bridge{
+		cfg:  *cfg,
+		last: make(map[uint64]Status),
+	}
+	if b.cfg.Context == "" {
+		b.cfg.Context = DefaultContext
+	}
+
+	return b, nil
+}
+
+// Report fetches the deploy request with the given number and reports its
+// status for the given commit, unless the same status was reported before.
+func (b *Bridge) Report(ctx context.Context, number uint64, commitSHA string) (*Status, error) {
+	dr, err := b.cfg.Client.DeployRequests.Get(ctx, &ps.GetDeployRequestRequest{
+		Organization: b.cfg.Organization,
+		Database:     b.cfg.Database,
+		Number:       number,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b.report(ctx, dr, commitSHA)
+}
+
+// Run watches the deploy requests of the database and reports every status
+// change until ctx is canceled. The commit of a deploy request is looked up
+// with Config.CommitSHA.
+func (b *Bridge) Run(ctx context.Context) error {
+	if b.cfg.CommitSHA == nil {
+		return errors.New("CommitSHA is not set")
+	}
+
+	events := watch.DeployRequests(ctx, b.cfg.Client.DeployRequests, &ps.ListDeployRequestsRequest{
+		Organization: b.cfg.Organization,
+		Database:     b.cfg.Database,
+	}, b.cfg.WatchOptions)
+
+	for ev := range events {
+		if ev.Type != watch.Added && ev.Type != watch.Modified {
+			continue
+		}
+
+		sha, err := b.cfg.CommitSHA(ctx, ev.DeployRequest)
+		if err == nil && sha != "" {
+			_, err = b.report(ctx, ev.DeployRequest, sha)
+		}
+		if err != nil && b.cfg.OnError != nil {
+			b.cfg.OnError(err)
+		}
+	}
+
+	return ctx.Err()
+}
+
+func (b *Bridge) report(ctx context.Context, dr *ps.DeployRequest, commitSHA string) (*Status, error) {
+	s := FromDeployRequest(b.cfg.Client, b.cfg.Organization, b.cfg.Database, dr)
+	s.Context = b.cfg.Context
+	s.CommitSHA = commitSHA
+
+	b.mu.Lock()
+	last, ok := b.last[dr.Number]
+	b.mu.Unlock()
+	if ok && last == *s {
+		return s, nil
+	}
+
+	if err := b.cfg.Reporter.Report(ctx, s); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.last[dr.Number] = *s
+	b.mu.Unlock()
+
+	return s, nil
+}
@@ -0,0 +1,190 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+	"github.com/planetscale/planetscale-go/planetscale/watch"
+)
+
+// statusServer records the statuses posted to it.
+type statusServer struct {
+	mu       sync.Mutex
+	paths    []string
+	statuses []*Status
+	auth     string
+	posted   chan *Status
+}
+
+func newStatusServer(c *qt.C) (*statusServer, *httptest.Server) {
+	s := &statusServer{posted: make(chan *Status, 100)}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := &Status{}
+		if err := json.NewDecoder(r.Body).Decode(st); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		s.paths = append(s.paths, r.URL.Path)
+		s.statuses = append(s.statuses, st)
+		s.auth = r.Header.Get("Authorization")
+		s.mu.Unlock()
+
+		s.posted <- st
+		w.WriteHeader(http.StatusCreated)
+	}))
+	c.Cleanup(ts.Close)
+	return s, ts
+}
+
+func newTestBridge(c *qt.C, cfg *Config) (*fakeapi.Server, *ps.Client, *Bridge) {
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL), ps.WithDashboardURL("https://app.planetscale.com/"))
+	c.Assert(err, qt.IsNil)
+
+	_, err = client.DatabaseBranches.Create(context.Background(), &ps.CreateDatabaseBranchRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Name:         "dev",
+		ParentBranch: "main",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(api.SetSchema("my-org", "my-db", "dev", map[string]string{"users": "CREATE TABLE `users` (`id` bigint)"}), qt.IsNil)
+
+	cfg.Client = client
+	cfg.Organization = "my-org"
+	cfg.Database = "my-db"
+	b, err := New(cfg)
+	c.Assert(err, qt.IsNil)
+
+	return api, client, b
+}
+
+func createDeployRequest(c *qt.C, client *ps.Client) *ps.DeployRequest {
+	dr, err := client.DeployRequests.Create(context.Background(), &ps.CreateDeployRequestRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Branch:       "dev",
+		IntoBranch:   "main",
+	})
+	c.Assert(err, qt.IsNil)
+	return dr
+}
+
+func TestBridge_Report(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	srv, ts := newStatusServer(c)
+	_, client, b := newTestBridge(c, &Config{
+		Reporter: &HTTPPoster{
+			URL:    ts.URL + "/repos/owner/repo/statuses/{sha}",
+			Header: http.Header{"Authorization": {"Bearer token"}},
+		},
+	})
+
+	dr := createDeployRequest(c, client)
+
+	s, err := b.Report(ctx, dr.Number, "abc123")
+	c.Assert(err, qt.IsNil)
+	c.Assert(s.State, qt.Equals, Pending)
+
+	// unchanged statuses aren't posted again
+	_, err = b.Report(ctx, dr.Number, "abc123")
+	c.Assert(err, qt.IsNil)
+
+	_, err = client.DeployRequests.Deploy(ctx, &ps.PerformDeployRequest{
+		Organization: "my-org",
+		Database:     "my-db",
+		Number:       dr.Number,
+	})
+	c.Assert(err, qt.IsNil)
+
+	// the fake finishes the deployment after the first Get
+	s, err = b.Report(ctx, dr.Number, "abc123")
+	c.Assert(err, qt.IsNil)
+	c.Assert(s.State, qt.Equals, Pending)
+
+	s, err = b.Report(ctx, dr.Number, "abc123")
+	c.Assert(err, qt.IsNil)
+	c.Assert(s.State, qt.Equals, Success)
+
+	c.Assert(srv.paths, qt.DeepEquals, []string{
+		"/repos/owner/repo/statuses/abc123",
+		"/repos/owner/repo/statuses/abc123",
+		"/repos/owner/repo/statuses/abc123",
+	})
+	c.Assert(srv.auth, qt.Equals, "Bearer token")
+	c.Assert(srv.statuses[0], qt.DeepEquals, &Status{
+		State:               Pending,
+		Context:             DefaultContext,
+		Description:         "Waiting for approval",
+		TargetURL:           "https://app.planetscale.com/my-org/my-db/deploy-requests/1",
+		CommitSHA:           "abc123",
+		DeployRequestNumber: 1,
+		DeploymentState:     "ready",
+	})
+	c.Assert(srv.statuses[1].Description, qt.Equals, "Deploying into main")
+	c.Assert(srv.statuses[2].Description, qt.Equals, "Deployed into main")
+}
+
+func TestBridge_Run(t *testing.T) {
+	c := qt.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv, ts := newStatusServer(c)
+	api, client, b := newTestBridge(c, &Config{
+		Reporter: &HTTPPoster{URL: ts.URL},
+		Context:  "schema",
+		CommitSHA: func(ctx context.Context, dr *ps.DeployRequest) (string, error) {
+			return "sha-" + dr.Branch, nil
+		},
+		WatchOptions: &watch.Options{ResyncInterval: time.Millisecond},
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+
+	dr := createDeployRequest(c, client)
+	st := <-srv.posted
+	c.Assert(st.State, qt.Equals, Pending)
+	c.Assert(st.Context, qt.Equals, "schema")
+	c.Assert(st.CommitSHA, qt.Equals, "sha-dev")
+
+	c.Assert(api.SetDeploymentState("my-org", "my-db", dr.Number, "complete_error"), qt.IsNil)
+	st = <-srv.posted
+	c.Assert(st.State, qt.Equals, Failure)
+	c.Assert(st.Description, qt.Equals, "Deployment failed")
+
+	cancel()
+	c.Assert(<-done, qt.Equals, context.Canceled)
+}
+
+func TestHTTPPoster_error(t *testing.T) {
+	c := qt.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad credentials", http.StatusUnauthorized)
+	}))
+	c.Cleanup(ts.Close)
+
+	p := &HTTPPoster{URL: ts.URL + "/statuses/{sha}"}
+
+	err := p.Report(context.Background(), &Status{CommitSHA: "abc123"})
+	c.Assert(err, qt.ErrorMatches, "posting status: 401 Unauthorized: bad credentials")
+
+	err = p.Report(context.Background(), &Status{DeployRequestNumber: 3})
+	c.Assert(err, qt.ErrorMatches, "status of deploy request 3 has no commit SHA")
+}
@@ -0,0 +1,100 @@
+package status
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// Reporter delivers statuses to a code host.
+type Reporter interface {
+	Report(ctx context.Context, s *Status) error
+}
+
+// ReporterFunc is an adapter to use a function as a Reporter.
+type ReporterFunc func(ctx context.Context, s *Status) error
+
+// Report implements Reporter.
+func (f ReporterFunc) Report(ctx context.Context, s *Status) error {
+	return f(ctx, s)
+}
+
+// HTTPPoster is a Reporter that posts statuses as JSON to a URL.
+//
+// The status is encoded like the body of the GitHub commit status API, so
+// statuses can be posted to GitHub directly:
+//
+//	&status.HTTPPoster{
+//		URL:    "https://api.github.com/repos/owner/repo/statuses/{sha}",
+//		Header: http.Header{"Authorization": {"Bearer " + token}},
+//	}
+type HTTPPoster struct {
+	// URL receives the statuses. The "{sha}" placeholder is replaced with
+	// the commit SHA of the status.
+	URL string
+
+	// Header is added to every request.
+	Header http.Header
+
+	// HTTPClient sends the requests. Defaults to a client with a clean
+	// transport.
+	HTTPClient *http.Client
+}
+
+var _ Reporter = &HTTPPoster{}
+
+// Report implements Reporter.
+func (p *HTTPPoster) Report(ctx context.Context, s *Status) error {
+	if p.URL == "" {
+		return errors.New("URL is not set")
+	}
+
+	url := p.URL
+	if strings.Contains(url, "{sha}") {
+		if s.CommitSHA == "" {
+			return fmt.Errorf("status of deploy request %d has no commit SHA", s.DeployRequestNumber)
+		}
+		url = strings.Replace(url, "{sha}", s.CommitSHA, -1)
+	}
+
+	body, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	for k, v := range p.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := p.HTTPClient
+	if client == nil {
+		client = cleanhttp.DefaultClient()
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		out, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("posting status: %s: %s", res.Status, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+// Package status mirrors the state of deploy requests as commit statuses on a
+// code host, so merge protection can depend on a successful schema deploy.
+package status
+
+import (
+	"fmt"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+// State is the state of a commit status.
+type State string
+
+const (
+	Pending State = "pending" // Deploy request isn't deployed yet.
+	Success State = "success" // Deploy request was deployed.
+	Failure State = "failure" // Deploy request can't be or wasn't deployed.
+)
+
+// DefaultContext is the default context of the statuses, which identifies
+// them on the code host.
+const DefaultContext = "planetscale/deploy-request"
+
+// Status is a commit status for a deploy request. It's encoded with the
+// field names of the GitHub commit status API, so it can be posted to it
+// directly.
+type Status struct {
+	State       State  `json:"state"`
+	Context     string `json:"context"`
+	Description string `json:"description"`
+	TargetURL   string `json:"target_url"`
+
+	// CommitSHA is the commit the status belongs to.
+	CommitSHA string `json:"sha,omitempty"`
+
+	DeployRequestNumber uint64 `json:"deploy_request_number"`
+	DeploymentState     string `json:"deployment_state,omitempty"`
+}
+
+// FromDeployRequest maps the state of a deploy request and its deployment to
+// a status, which links to the deploy request in the web app of client. The
+// context and commit SHA of the status aren't set.
+func FromDeployRequest(client *ps.Client, org, database string, dr *ps.DeployRequest) *Status {
+	s := &Status{
+		TargetURL:           client.DeployRequestURL(org, database, dr.Number),
+		DeployRequestNumber: dr.Number,
+	}
+
+	var deployment string
+	if dr.Deployment != nil {
+		deployment = dr.Deployment.State
+		s.DeploymentState = deployment
+	}
+
+	switch ps.ClassifyDeployment(dr) {
+	case ps.DeploymentDeployed:
+		s.State, s.Description = Success, fmt.Sprintf("Deployed into %s", dr.IntoBranch)
+	case ps.DeploymentNoChanges:
+		s.State, s.Description = Success, "No schema changes to deploy"
+	case ps.DeploymentFailed:
+		s.State, s.Description = Failure, "Deployment failed"
+	case ps.DeploymentCancelled:
+		s.State, s.Description = Failure, "Deployment was cancelled"
+	case ps.DeploymentReverted:
+		s.State, s.Description = Failure, "Deployment was reverted"
+	case ps.DeploymentNotDeployable:
+		s.State, s.Description = Failure, "Schema changes can't be deployed"
+	case ps.DeploymentClosed:
+		s.State, s.Description = Failure, "Deploy request was closed without deploying"
+	default:
+		s.State = Pending
+		switch deployment {
+		case "", "pending":
+			s.Description = "Checking schema changes"
+		case "ready":
+			if dr.Approved {
+				s.Description = "Ready to deploy"
+			} else {
+				s.Description = "Waiting for approval"
+			}
+		case "queued", "submitting", "in_progress", "pending_cutover", "in_progress_vschema", "in_progress_cancel":
+			s.Description = fmt.Sprintf("Deploying into %s", dr.IntoBranch)
+		default:
+			s.Description = fmt.Sprintf("Deployment is %s", deployment)
+		}
+	}
+
+	return s
+}
+
+// Done reports whether the status is final.
+func (s *Status) Done() bool {
+	return s.State != Pending
+}
@@ -0,0 +1,112 @@
+package status
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+func TestFromDeployRequest(t *testing.T) {
+	c := qt.New(t)
+
+	tests := []struct {
+		name        string
+		dr          *ps.DeployRequest
+		state       State
+		description string
+	}{
+		{
+			name:        "no deployment",
+			dr:          &ps.DeployRequest{State: "open"},
+			state:       Pending,
+			description: "Checking schema changes",
+		},
+		{
+			name:        "waiting for approval",
+			dr:          &ps.DeployRequest{State: "open", Deployment: &ps.Deployment{State: "ready", Deployable: true}},
+			state:       Pending,
+			description: "Waiting for approval",
+		},
+		{
+			name:        "approved",
+			dr:          &ps.DeployRequest{State: "open", Approved: true, Deployment: &ps.Deployment{State: "ready", Deployable: true}},
+			state:       Pending,
+			description: "Ready to deploy",
+		},
+		{
+			name:        "not deployable",
+			dr:          &ps.DeployRequest{State: "open", Deployment: &ps.Deployment{State: "ready"}},
+			state:       Failure,
+			description: "Schema changes can't be deployed",
+		},
+		{
+			name:        "deploying",
+			dr:          &ps.DeployRequest{State: "open", IntoBranch: "main", Deployment: &ps.Deployment{State: "in_progress"}},
+			state:       Pending,
+			description: "Deploying into main",
+		},
+		{
+			name:        "complete",
+			dr:          &ps.DeployRequest{State: "closed", IntoBranch: "main", Deployment: &ps.Deployment{State: "complete"}},
+			state:       Success,
+			description: "Deployed into main",
+		},
+		{
+			name:        "no changes",
+			dr:          &ps.DeployRequest{State: "closed", Deployment: &ps.Deployment{State: "no_changes"}},
+			state:       Success,
+			description: "No schema changes to deploy",
+		},
+		{
+			name:        "failed",
+			dr:          &ps.DeployRequest{State: "open", Deployment: &ps.Deployment{State: "complete_error"}},
+			state:       Failure,
+			description: "Deployment failed",
+		},
+		{
+			name:        "cancelled",
+			dr:          &ps.DeployRequest{State: "open", Deployment: &ps.Deployment{State: "complete_cancel"}},
+			state:       Failure,
+			description: "Deployment was cancelled",
+		},
+		{
+			name:        "reverted",
+			dr:          &ps.DeployRequest{State: "closed", Deployment: &ps.Deployment{State: "complete_revert"}},
+			state:       Failure,
+			description: "Deployment was reverted",
+		},
+		{
+			name:        "pending revert",
+			dr:          &ps.DeployRequest{State: "closed", IntoBranch: "main", Deployment: &ps.Deployment{State: "complete_pending_revert"}},
+			state:       Success,
+			description: "Deployed into main",
+		},
+		{
+			name:        "closed",
+			dr:          &ps.DeployRequest{State: "closed", Deployment: &ps.Deployment{State: "ready", Deployable: true}},
+			state:       Failure,
+			description: "Deploy request was closed without deploying",
+		},
+		{
+			name:        "unknown state",
+			dr:          &ps.DeployRequest{State: "open", Deployment: &ps.Deployment{State: "shiny_new_state"}},
+			state:       Pending,
+			description: "Deployment is shiny_new_state",
+		},
+	}
+
+	client, err := ps.NewClient()
+	c.Assert(err, qt.IsNil)
+
+	for _, tt := range tests {
+		c.Run(tt.name, func(c *qt.C) {
+			tt.dr.Number = 7
+			s := FromDeployRequest(client, "my-org", "my-db", tt.dr)
+			c.Assert(s.State, qt.Equals, tt.state)
+			c.Assert(s.Description, qt.Equals, tt.description)
+			c.Assert(s.TargetURL, qt.Equals, "https://app.planetscale.com/my-org/my-db/deploy-requests/7")
+			c.Assert(s.Done(), qt.Equals, tt.state != Pending)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package tokenpolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Policy defines the accesses service tokens of an organization should have.
+// Tokens that aren't listed are left untouched.
+type Policy struct {
+	Organization string   `json:"organization"`
+	Tokens       []*Token `json:"tokens"`
+}
+
+// Token is the policy of a single service token.
+type Token struct {
+	// ID or Name identify the service token. Exactly one of them must be
+	// set.
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	// Databases maps database names to the accesses the token should have
+	// on them, e.g. "read_branch". Accesses on databases that aren't
+	// listed are removed.
+	Databases map[string][]string `json:"databases"`
+}
+
+func (t *Token) String() string {
+	if t.ID != "" {
+		return t.ID
+	}
+	return t.Name
+}
+
+// ReadFile reads and validates a policy file, e.g.:
+//
+//	{
+//	  "organization": "my-org",
+//	  "tokens": [
+//	    {"name": "ci-deployer", "databases": {"my-db": ["create_deploy_request"]}},
+//	    {"id": "txhc257pxjuc", "databases": {"my-db": ["read_branch", "connect_branch"]}}
+//	  ]
+//	}
+func ReadFile(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return p, nil
+}
+
+// Parse parses and validates a policy. Unknown fields are rejected, to catch
+// typos that would otherwise remove accesses.
+func Parse(data []byte) (*Policy, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	p := &Policy{}
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("malformed policy: %s", err)
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate checks that the policy is complete and unambiguous.
+func (p *Policy) Validate() error {
+	if p.Organization == "" {
+		return errors.New("organization is not set")
+	}
+
+	ids := make(map[string]bool)
+	names := make(map[string]bool)
+	for i, t := range p.Tokens {
+		if (t.ID == "") == (t.Name == "") {
+			return fmt.Errorf("token #%d: exactly one of id and name must be set", i+1)
+		}
+
+		seen := ids
+		if t.Name != "" {
+			seen = names
+		}
+		if seen[t.String()] {
+			return fmt.Errorf("token %s is listed more than once", t)
+		}
+		seen[t.String()] = true
+
+		for db, accesses := range t.Databases {
+			if db == "" {
+				return fmt.Errorf("token %s: database name is empty", t)
+			}
+			for _, a := range accesses {
+				if a == "" {
+					return fmt.Errorf("token %s: empty access on database %s", t, db)
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package tokenpolicy
+
+import (
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestReadFile(t *testing.T) {
+	c := qt.New(t)
+
+	p, err := ReadFile(filepath.Join("testdata", "policy.json"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(p, qt.DeepEquals, &Policy{
+		Organization: "my-org",
+		Tokens: []*Token{
+			{Name: "ci-deployer", Databases: map[string][]string{"my-db": {"create_deploy_request", "read_branch"}}},
+			{Name: "reporting", Databases: map[string][]string{"analytics": {"connect_branch"}}},
+		},
+	})
+}
+
+func TestParse_invalid(t *testing.T) {
+	c := qt.New(t)
+
+	tests := []struct {
+		name   string
+		policy string
+		want   string
+	}{
+		{"unknown field", `{"organization":"my-org","token":[]}`, `malformed policy: json: unknown field "token"`},
+		{"no organization", `{"tokens":[]}`, "organization is not set"},
+		{"id and name", `{"organization":"my-org","tokens":[{"id":"a","name":"b"}]}`, "token #1: exactly one of id and name must be set"},
+		{"no id or name", `{"organization":"my-org","tokens":[{}]}`, "token #1: exactly one of id and name must be set"},
+		{"duplicate", `{"organization":"my-org","tokens":[{"name":"ci"},{"name":"ci"}]}`, "token ci is listed more than once"},
+		{"empty access", `{"organization":"my-org","tokens":[{"id":"abc","databases":{"my-db":[""]}}]}`, "token abc: empty access on database my-db"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.policy))
+		c.Assert(err, qt.ErrorMatches, tt.want, qt.Commentf(tt.name))
+	}
+}
@@ -0,0 +1,291 @@
+// Package tokenpolicy reconciles the accesses of service tokens with a
+// policy file kept under version control:
+//
+//	policy, err := tokenpolicy.ReadFile("tokens.json")
+//	if err != nil {
+//		return err
+//	}
+//
+//	r, err := tokenpolicy.New(&tokenpolicy.Config{
+//		Client: client,
+//		Policy: policy,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	report, err := r.Plan(ctx) // or r.Apply(ctx)
+//	if err != nil {
+//		return err
+//	}
+//
+//	err = report.WriteJSON(os.Stdout)
+package tokenpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+// Mode is the mode a report was created in.
+type Mode string
+
+const (
+	ModePlan  Mode = "plan"  // Changes were computed, but not applied.
+	ModeApply Mode = "apply" // Changes were applied.
+)
+
+// Action defines what a change does.
+type Action string
+
+const (
+	Add    Action = "add"    // Accesses are granted.
+	Remove Action = "remove" // Accesses are revoked.
+)
+
+// databaseAccessType is the type of accesses to databases, as opposed to
+// e.g. accesses to the organization.
+const databaseAccessType = "DatabaseAccess"
+
+// Change grants or revokes accesses of a token on a database.
+type Change struct {
+	TokenID   string   `json:"token_id"`
+	TokenName string   `json:"token_name,omitempty"`
+	Database  string   `json:"database"`
+	Action    Action   `json:"action"`
+	Accesses  []string `json:"accesses"`
+
+	// Applied and Error are set in apply mode.
+	Applied bool   `json:"applied,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Report lists the changes of a plan or apply run.
+type Report struct {
+	Organization string    `json:"organization"`
+	Mode         Mode      `json:"mode"`
+	Changes      []*Change `json:"changes"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Config defines the configuration of a Reconciler.
+type Config struct {
+	// Client defines a PlanetScale client. Use planetscale.NewClient() to
+	// create a new instance.
+	Client *ps.Client
+
+	// Policy is the desired state of the service tokens.
+	Policy *Policy
+}
+
+// Reconciler reconciles the accesses of service tokens with a policy.
+type Reconciler struct {
+	cfg Config
+	now func() time.Time
+}
+
+// New returns a new Reconciler with the given configuration.
+func New(cfg *Config) (*Reconciler, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("planetscale Client is not set")
+	}
+
+	if cfg.Policy == nil {
+		return nil, errors.New("policy is not set")
+	}
+
+	if err := cfg.Policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Reconciler{cfg: *cfg, now: time.Now}, nil
+}
+
+// Plan computes the changes that make the service tokens match the policy,
+// without applying them.
+func (r *Reconciler) Plan(ctx context.Context) (*Report, error) {
+	changes, err := r.changes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.report(ModePlan, changes), nil
+}
+
+// Apply computes the changes and applies them. Additions are applied before
+// removals, so a token moving to new accesses is never left without any.
+// Failed changes don't stop the others; they are recorded in the report and
+// Apply returns an error after all changes were tried.
+func (r *Reconciler) Apply(ctx context.Context) (*Report, error) {
+	changes, err := r.changes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := 0
+	for _, c := range changes {
+		if err := r.apply(ctx, c); err != nil {
+			c.Error = err.Error()
+			failed++
+			continue
+		}
+		c.Applied = true
+	}
+
+	report := r.report(ModeApply, changes)
+	if failed > 0 {
+		return report, fmt.Errorf("%d of %d changes failed", failed, len(changes))
+	}
+	return report, nil
+}
+
+func (r *Reconciler) apply(ctx context.Context, c *Change) error {
+	org := r.cfg.Policy.Organization
+
+	if c.Action == Add {
+		_, err := r.cfg.Client.ServiceTokens.AddAccess(ctx, &ps.AddServiceTokenAccessRequest{
+			Organization: org,
+			ID:           c.TokenID,
+			Database:     c.Database,
+			Accesses:     c.Accesses,
+		})
+		return err
+	}
+
+	return r.cfg.Client.ServiceTokens.DeleteAccess(ctx, &ps.DeleteServiceTokenAccessRequest{
+		Organization: org,
+		ID:           c.TokenID,
+		Database:     c.Database,
+		Accesses:     c.Accesses,
+	})
+}
+
+// changes resolves the tokens of the policy and diffs their accesses. All
+// additions are returned before all removals.
+func (r *Reconciler) changes(ctx context.Context) ([]*Change, error) {
+	org := r.cfg.Policy.Organization
+
+	tokens, err := r.cfg.Client.ServiceTokens.List(ctx, &ps.ListServiceTokensRequest{
+		Organization: org,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing service tokens: %s", err)
+	}
+
+	var adds, removes []*Change
+	for _, want := range r.cfg.Policy.Tokens {
+		token, err := resolve(tokens, want)
+		if err != nil {
+			return nil, err
+		}
+
+		accesses, err := r.cfg.Client.ServiceTokens.GetAccess(ctx, &ps.GetServiceTokenAccessRequest{
+			Organization: org,
+			ID:           token.ID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("fetching accesses of token %s: %s", want, err)
+		}
+
+		have := make(map[string]map[string]bool)
+		for _, a := range accesses {
+			// policies only cover database accesses, others are left alone
+			if a.Type != databaseAccessType {
+				continue
+			}
+
+			db := a.Resource.Name
+			if have[db] == nil {
+				have[db] = make(map[string]bool)
+			}
+			have[db][a.Access] = true
+		}
+
+		wanted := make(map[string]map[string]bool)
+		for db, list := range want.Databases {
+			wanted[db] = make(map[string]bool)
+			for _, a := range list {
+				wanted[db][a] = true
+			}
+		}
+
+		for _, db := range sortedKeys(wanted) {
+			if missing := difference(wanted[db], have[db]); len(missing) > 0 {
+				adds = append(adds, &Change{TokenID: token.ID, TokenName: token.Name, Database: db, Action: Add, Accesses: missing})
+			}
+		}
+		for _, db := range sortedKeys(have) {
+			if extra := difference(have[db], wanted[db]); len(extra) > 0 {
+				removes = append(removes, &Change{TokenID: token.ID, TokenName: token.Name, Database: db, Action: Remove, Accesses: extra})
+			}
+		}
+	}
+
+	return append(adds, removes...), nil
+}
+
+func (r *Reconciler) report(mode Mode, changes []*Change) *Report {
+	if changes == nil {
+		changes = []*Change{}
+	}
+
+	return &Report{
+		Organization: r.cfg.Policy.Organization,
+		Mode:         mode,
+		Changes:      changes,
+		CreatedAt:    r.now().UTC(),
+	}
+}
+
+// resolve finds the service token of a token policy by ID or name.
+func resolve(tokens []*ps.ServiceToken, want *Token) (*ps.ServiceToken, error) {
+	var found *ps.ServiceToken
+	for _, t := range tokens {
+		if (want.ID != "" && t.ID == want.ID) || (want.Name != "" && t.Name == want.Name) {
+			if found != nil {
+				return nil, fmt.Errorf("token name %s is ambiguous, use the token ID", want.Name)
+			}
+			found = t
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("token %s doesn't exist", want)
+	}
+	return found, nil
+}
+
+// difference returns the sorted keys of a that aren't in b.
+func difference(a, b map[string]bool) []string {
+	var out []string
+	for k := range a {
+		if !b[k] {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sortedKeys(m map[string]map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,225 @@
+package tokenpolicy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/planetscale/planetscale-go/internal/fakeapi"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+type testEnv struct {
+	api       *fakeapi.Server
+	client    *ps.Client
+	deployer  *ps.ServiceToken
+	reporting *ps.ServiceToken
+}
+
+func newTestEnv(c *qt.C) *testEnv {
+	api, ts := fakeapi.NewServer(c)
+	api.CreateDatabase("my-org", "my-db")
+	api.CreateDatabase("my-org", "analytics")
+
+	client, err := ps.NewClient(ps.WithBaseURL(ts.URL))
+	c.Assert(err, qt.IsNil)
+
+	env := &testEnv{
+		api:       api,
+		client:    client,
+		deployer:  api.CreateServiceToken("my-org", "ci-deployer"),
+		reporting: api.CreateServiceToken("my-org", "reporting"),
+	}
+
+	// ci-deployer has one access too many and one too few
+	_, err = client.ServiceTokens.AddAccess(context.Background(), &ps.AddServiceTokenAccessRequest{
+		Organization: "my-org",
+		ID:           env.deployer.ID,
+		Database:     "my-db",
+		Accesses:     []string{"read_branch", "delete_branch"},
+	})
+	c.Assert(err, qt.IsNil)
+
+	// reporting has accesses on a database that isn't in the policy
+	_, err = client.ServiceTokens.AddAccess(context.Background(), &ps.AddServiceTokenAccessRequest{
+		Organization: "my-org",
+		ID:           env.reporting.ID,
+		Database:     "my-db",
+		Accesses:     []string{"connect_branch"},
+	})
+	c.Assert(err, qt.IsNil)
+
+	return env
+}
+
+func (env *testEnv) reconciler(c *qt.C) *Reconciler {
+	policy, err := ReadFile(filepath.Join("testdata", "policy.json"))
+	c.Assert(err, qt.IsNil)
+
+	r, err := New(&Config{Client: env.client, Policy: policy})
+	c.Assert(err, qt.IsNil)
+	r.now = func() time.Time { return time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC) }
+	return r
+}
+
+func (env *testEnv) wantChanges() []*Change {
+	return []*Change{
+		{TokenID: env.deployer.ID, TokenName: "ci-deployer", Database: "my-db", Action: Add, Accesses: []string{"create_deploy_request"}},
+		{TokenID: env.reporting.ID, TokenName: "reporting", Database: "analytics", Action: Add, Accesses: []string{"connect_branch"}},
+		{TokenID: env.deployer.ID, TokenName: "ci-deployer", Database: "my-db", Action: Remove, Accesses: []string{"delete_branch"}},
+		{TokenID: env.reporting.ID, TokenName: "reporting", Database: "my-db", Action: Remove, Accesses: []string{"connect_branch"}},
+	}
+}
+
+// accesses returns the accesses of a token as "database:access".
+func (env *testEnv) accesses(c *qt.C, id string) []string {
+	accesses, err := env.client.ServiceTokens.GetAccess(context.Background(), &ps.GetServiceTokenAccessRequest{
+		Organization: "my-org",
+		ID:           id,
+	})
+	c.Assert(err, qt.IsNil)
+
+	var out []string
+	for _, a := range accesses {
+		out = append(out, a.Resource.Name+":"+a.Access)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestPlan(t *testing.T) {
+	c := qt.New(t)
+	env := newTestEnv(c)
+
+	report, err := env.reconciler(c).Plan(context.Background())
+	c.Assert(err, qt.IsNil)
+	c.Assert(report.Mode, qt.Equals, ModePlan)
+	c.Assert(report.Changes, qt.DeepEquals, env.wantChanges())
+
+	// nothing changed
+	c.Assert(env.accesses(c, env.deployer.ID), qt.DeepEquals, []string{"my-db:delete_branch", "my-db:read_branch"})
+	c.Assert(env.accesses(c, env.reporting.ID), qt.DeepEquals, []string{"my-db:connect_branch"})
+}
+
+func TestApply(t *testing.T) {
+	c := qt.New(t)
+	env := newTestEnv(c)
+	r := env.reconciler(c)
+
+	report, err := r.Apply(context.Background())
+	c.Assert(err, qt.IsNil)
+	c.Assert(report.Mode, qt.Equals, ModeApply)
+
+	want := env.wantChanges()
+	for _, ch := range want {
+		ch.Applied = true
+	}
+	c.Assert(report.Changes, qt.DeepEquals, want)
+
+	c.Assert(env.accesses(c, env.deployer.ID), qt.DeepEquals, []string{"my-db:create_deploy_request", "my-db:read_branch"})
+	c.Assert(env.accesses(c, env.reporting.ID), qt.DeepEquals, []string{"analytics:connect_branch"})
+
+	// the tokens match the policy now
+	report, err = r.Plan(context.Background())
+	c.Assert(err, qt.IsNil)
+	c.Assert(report.Changes, qt.HasLen, 0)
+}
+
+func TestApply_otherAccesses(t *testing.T) {
+	c := qt.New(t)
+	env := newTestEnv(c)
+	r := env.reconciler(c)
+
+	// accesses that aren't database accesses aren't covered by the policy
+	c.Assert(env.api.GrantOrganizationAccess("my-org", env.deployer.ID, "read_organization"), qt.IsNil)
+
+	report, err := r.Apply(context.Background())
+	c.Assert(err, qt.IsNil)
+
+	want := env.wantChanges()
+	for _, ch := range want {
+		ch.Applied = true
+	}
+	c.Assert(report.Changes, qt.DeepEquals, want)
+	c.Assert(env.accesses(c, env.deployer.ID), qt.DeepEquals, []string{"my-db:create_deploy_request", "my-db:read_branch", "my-org:read_organization"})
+
+	report, err = r.Plan(context.Background())
+	c.Assert(err, qt.IsNil)
+	c.Assert(report.Changes, qt.HasLen, 0)
+}
+
+func TestApply_partialFailure(t *testing.T) {
+	c := qt.New(t)
+	env := newTestEnv(c)
+
+	policy := &Policy{
+		Organization: "my-org",
+		Tokens: []*Token{
+			{Name: "ci-deployer", Databases: map[string][]string{"missing-db": {"read_branch"}}},
+		},
+	}
+	r, err := New(&Config{Client: env.client, Policy: policy})
+	c.Assert(err, qt.IsNil)
+
+	report, err := r.Apply(context.Background())
+	c.Assert(err, qt.ErrorMatches, "1 of 2 changes failed")
+	c.Assert(report.Changes, qt.HasLen, 2)
+	c.Assert(report.Changes[0].Applied, qt.IsFalse)
+	c.Assert(report.Changes[0].Error, qt.Equals, "database missing-db doesn't exist")
+	c.Assert(report.Changes[1].Applied, qt.IsTrue)
+}
+
+func TestPlan_unknownToken(t *testing.T) {
+	c := qt.New(t)
+	env := newTestEnv(c)
+	env.api.CreateServiceToken("my-org", "reporting")
+
+	for _, tt := range []struct {
+		token *Token
+		want  string
+	}{
+		{&Token{ID: "missing"}, "token missing doesn't exist"},
+		{&Token{Name: "reporting"}, "token name reporting is ambiguous, use the token ID"},
+	} {
+		r, err := New(&Config{
+			Client: env.client,
+			Policy: &Policy{Organization: "my-org", Tokens: []*Token{tt.token}},
+		})
+		c.Assert(err, qt.IsNil)
+
+		_, err = r.Plan(context.Background())
+		c.Assert(err, qt.ErrorMatches, tt.want)
+	}
+}
+
+func TestReport_WriteJSON(t *testing.T) {
+	c := qt.New(t)
+	env := newTestEnv(c)
+
+	report, err := env.reconciler(c).Plan(context.Background())
+	c.Assert(err, qt.IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(report.WriteJSON(&buf), qt.IsNil)
+
+	var got map[string]interface{}
+	c.Assert(json.Unmarshal(buf.Bytes(), &got), qt.IsNil)
+	c.Assert(got["organization"], qt.Equals, "my-org")
+	c.Assert(got["mode"], qt.Equals, "plan")
+	c.Assert(got["created_at"], qt.Equals, "2021-06-01T12:00:00Z")
+	c.Assert(got["changes"], qt.HasLen, 4)
+
+	first := got["changes"].([]interface{})[0].(map[string]interface{})
+	c.Assert(first, qt.DeepEquals, map[string]interface{}{
+		"token_id":   env.deployer.ID,
+		"token_name": "ci-deployer",
+		"database":   "my-db",
+		"action":     "add",
+		"accesses":   []interface{}{"create_deploy_request"},
+	})
+}
@@ -0,0 +1,340 @@
+package watch
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+const (
+	defaultResyncInterval = 30 * time.Second
+	defaultMinBackoff     = time.Second
+	defaultMaxBackoff     = time.Minute
+)
+
+// EventType defines the type of a change.
+type EventType string
+
+const (
+	Added    EventType = "added"    // Resource appeared in the list.
+	Modified EventType = "modified" // Resource changed since the previous list.
+	Deleted  EventType = "deleted"  // Resource disappeared from the list.
+
+	// Synced is emitted once after the events of the first successful List
+	// call if Options.NotifySynced is set. The resource of the event is nil.
+	Synced EventType = "synced"
+)
+
+// Options configures a watch.
+type Options struct {
+	// ResyncInterval is the interval between two List calls. Defaults to 30
+	// seconds.
+	ResyncInterval time.Duration
+
+	// MinBackoff is the time to wait after a failed List call. It's doubled
+	// for every consecutive failure. Defaults to 1 second.
+	MinBackoff time.Duration
+
+	// MaxBackoff caps the time to wait after failed List calls. Defaults to
+	// 1 minute.
+	MaxBackoff time.Duration
+
+	// OnError is called with every error returned by a List call.
+	OnError func(error)
+
+	// NotifySynced enables the Synced event, which signals that the initial
+	// state was delivered.
+	NotifySynced bool
+}
+
+// DatabaseEvent is a change to a database of an organization.
+type DatabaseEvent struct {
+	Type     EventType
+	Database *ps.Database
+}
+
+// BranchEvent is a change to a branch of a database.
+type BranchEvent struct {
+	Type   EventType
+	Branch *ps.DatabaseBranch
+}
+
+// DeployRequestEvent is a change to a deploy request of a database.
+type DeployRequestEvent struct {
+	Type          EventType
+	DeployRequest *ps.DeployRequest
+}
+
+// BackupEvent is a change to a backup of a database branch.
+type BackupEvent struct {
+	Type   EventType
+	Backup *ps.Backup
+}
+
+// Databases watches the databases of an organization by diffing successive
+// List results. The returned channel is closed once ctx is canceled.
+func Databases(ctx context.Context, svc ps.DatabasesService, listReq *ps.ListDatabasesRequest, opts *Options) <-chan DatabaseEvent {
+	ch := make(chan DatabaseEvent)
+
+	list := func(ctx context.Context) (map[string]interface{}, error) {
+		dbs, err := svc.List(ctx, listReq)
+		if err != nil {
+			return nil, err
+		}
+
+		objs := make(map[string]interface{}, len(dbs))
+		for _, db := range dbs {
+			objs[db.Name] = db
+		}
+		return objs, nil
+	}
+
+	go func() {
+		defer close(ch)
+		run(ctx, list, opts, func(typ EventType, obj interface{}) bool {
+			db, _ := obj.(*ps.Database)
+			select {
+			case ch <- DatabaseEvent{Type: typ, Database: db}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	return ch
+}
+
+// Branches watches the branches of a database by diffing successive List
+// results. The returned channel is closed once ctx is canceled.
+func Branches(ctx context.Context, svc ps.DatabaseBranchesService, listReq *ps.ListDatabaseBranchesRequest, opts *Options) <-chan BranchEvent {
+	ch := make(chan BranchEvent)
+
+	list := func(ctx context.Context) (map[string]interface{}, error) {
+		branches, err := svc.List(ctx, listReq)
+		if err != nil {
+			return nil, err
+		}
+
+		objs := make(map[string]interface{}, len(branches))
+		for _, b := range branches {
+			objs[b.Name] = b
+		}
+		return objs, nil
+	}
+
+	go func() {
+		defer close(ch)
+		run(ctx, list, opts, func(typ EventType, obj interface{}) bool {
+			branch, _ := obj.(*ps.DatabaseBranch)
+			select {
+			case ch <- BranchEvent{Type: typ, Branch: branch}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	return ch
+}
+
+// DeployRequests watches the deploy requests of a database. The returned
+// channel is closed once ctx is canceled.
+func DeployRequests(ctx context.Context, svc ps.DeployRequestsService, listReq *ps.ListDeployRequestsRequest, opts *Options) <-chan DeployRequestEvent {
+	ch := make(chan DeployRequestEvent)
+
+	list := func(ctx context.Context) (map[string]interface{}, error) {
+		drs, err := svc.List(ctx, listReq)
+		if err != nil {
+			return nil, err
+		}
+
+		objs := make(map[string]interface{}, len(drs))
+		for _, dr := range drs {
+			objs[strconv.FormatUint(dr.Number, 10)] = dr
+		}
+		return objs, nil
+	}
+
+	go func() {
+		defer close(ch)
+		run(ctx, list, opts, func(typ EventType, obj interface{}) bool {
+			dr, _ := obj.(*ps.DeployRequest)
+			select {
+			case ch <- DeployRequestEvent{Type: typ, DeployRequest: dr}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	return ch
+}
+
+// Backups watches the backups of a database branch. The returned channel is
+// closed once ctx is canceled.
+func Backups(ctx context.Context, svc ps.BackupsService, listReq *ps.ListBackupsRequest, opts *Options) <-chan BackupEvent {
+	ch := make(chan BackupEvent)
+
+	list := func(ctx context.Context) (map[string]interface{}, error) {
+		backups, err := svc.List(ctx, listReq)
+		if err != nil {
+			return nil, err
+		}
+
+		objs := make(map[string]interface{}, len(backups))
+		for _, b := range backups {
+			objs[b.Name] = b
+		}
+		return objs, nil
+	}
+
+	go func() {
+		defer close(ch)
+		run(ctx, list, opts, func(typ EventType, obj interface{}) bool {
+			backup, _ := obj.(*ps.Backup)
+			select {
+			case ch <- BackupEvent{Type: typ, Backup: backup}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	return ch
+}
+
+// listFunc returns the current objects keyed by a unique identifier.
+type listFunc func(ctx context.Context) (map[string]interface{}, error)
+
+// emitFunc delivers an event. It returns false if the watch should stop.
+type emitFunc func(typ EventType, obj interface{}) bool
+
+// run calls list until ctx is canceled and emits the differences between
+// successive results.
+func run(ctx context.Context, list listFunc, opts *Options, emit emitFunc) {
+	o := withDefaults(opts)
+
+	var (
+		known    map[string]interface{}
+		failures int
+	)
+
+	for {
+		wait := o.ResyncInterval
+
+		objs, err := list(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			if o.OnError != nil {
+				o.OnError(err)
+			}
+
+			failures++
+			wait = backoff(o, failures)
+		} else {
+			failures = 0
+			if !diff(known, objs, emit) {
+				return
+			}
+
+			if known == nil && o.NotifySynced && !emit(Synced, nil) {
+				return
+			}
+			known = objs
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// diff emits the events needed to get from old to new. Events are emitted in
+// the order of the keys, deletions last.
+func diff(old, new map[string]interface{}, emit emitFunc) bool {
+	for _, key := range sortedKeys(new) {
+		obj := new[key]
+		prev, ok := old[key]
+		switch {
+		case !ok:
+			if !emit(Added, obj) {
+				return false
+			}
+		case !reflect.DeepEqual(prev, obj):
+			if !emit(Modified, obj) {
+				return false
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(old) {
+		if _, ok := new[key]; !ok {
+			if !emit(Deleted, old[key]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func backoff(o Options, failures int) time.Duration {
+	d := o.MinBackoff
+	for i := 1; i < failures && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+
+	return d
+}
+
+func withDefaults(opts *Options) Options {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.ResyncInterval <= 0 {
+		o.ResyncInterval = defaultResyncInterval
+	}
+
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = defaultMinBackoff
+	}
+
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = defaultMaxBackoff
+		if o.MaxBackoff < o.MinBackoff {
+			o.MaxBackoff = o.MinBackoff
+		}
+	}
+
+	return o
+}
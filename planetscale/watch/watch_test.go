@@ -0,0 +1,200 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	ps "github.com/planetscale/planetscale-go/planetscale"
+)
+
+// listResult is a single response of a fake List call.
+type listResult struct {
+	dbs      []*ps.Database
+	branches []*ps.DatabaseBranch
+	drs      []*ps.DeployRequest
+	backups  []*ps.Backup
+	err      error
+}
+
+// fakeLister returns the given results in order and repeats the last one.
+type fakeLister struct {
+	mu      sync.Mutex
+	results []listResult
+}
+
+func (f *fakeLister) next() listResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r := f.results[0]
+	if len(f.results) > 1 {
+		f.results = f.results[1:]
+	}
+	return r
+}
+
+type fakeBranches struct {
+	ps.DatabaseBranchesService
+	fakeLister
+}
+
+func (f *fakeBranches) List(context.Context, *ps.ListDatabaseBranchesRequest) ([]*ps.DatabaseBranch, error) {
+	r := f.next()
+	return r.branches, r.err
+}
+
+type fakeDeployRequests struct {
+	ps.DeployRequestsService
+	fakeLister
+}
+
+func (f *fakeDeployRequests) List(context.Context, *ps.ListDeployRequestsRequest) ([]*ps.DeployRequest, error) {
+	r := f.next()
+	return r.drs, r.err
+}
+
+type fakeBackups struct {
+	ps.BackupsService
+	fakeLister
+}
+
+func (f *fakeBackups) List(context.Context, *ps.ListBackupsRequest) ([]*ps.Backup, error) {
+	r := f.next()
+	return r.backups, r.err
+}
+
+var testOptions = &Options{
+	ResyncInterval: time.Millisecond,
+	MinBackoff:     time.Millisecond,
+	MaxBackoff:     time.Millisecond,
+}
+
+func TestBranches(t *testing.T) {
+	c := qt.New(t)
+
+	var errs []error
+	opts := *testOptions
+	opts.OnError = func(err error) { errs = append(errs, err) }
+
+	svc := &fakeBranches{}
+	svc.results = []listResult{
+		{branches: []*ps.DatabaseBranch{{Name: "main"}, {Name: "dev", Status: "pending"}}},
+		{branches: []*ps.DatabaseBranch{{Name: "main"}, {Name: "dev", Status: "pending"}}},
+		{err: errors.New("api unavailable")},
+		{branches: []*ps.DatabaseBranch{{Name: "main"}, {Name: "dev", Status: "ready"}}},
+		{branches: []*ps.DatabaseBranch{{Name: "dev", Status: "ready"}}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := Branches(ctx, svc, &ps.ListDatabaseBranchesRequest{}, &opts)
+
+	var got []BranchEvent
+	for len(got) < 4 {
+		got = append(got, <-events)
+	}
+	cancel()
+
+	// the channel is closed after cancellation
+	for range events {
+	}
+
+	c.Assert(got, qt.DeepEquals, []BranchEvent{
+		{Type: Added, Branch: &ps.DatabaseBranch{Name: "dev", Status: "pending"}},
+		{Type: Added, Branch: &ps.DatabaseBranch{Name: "main"}},
+		{Type: Modified, Branch: &ps.DatabaseBranch{Name: "dev", Status: "ready"}},
+		{Type: Deleted, Branch: &ps.DatabaseBranch{Name: "main"}},
+	})
+	c.Assert(errs, qt.HasLen, 1)
+	c.Assert(errs[0], qt.ErrorMatches, "api unavailable")
+}
+
+func TestDeployRequests(t *testing.T) {
+	c := qt.New(t)
+
+	svc := &fakeDeployRequests{}
+	svc.results = []listResult{
+		{drs: []*ps.DeployRequest{{Number: 1, State: "open"}}},
+		{drs: []*ps.DeployRequest{{Number: 1, State: "closed"}, {Number: 2, State: "open"}}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := DeployRequests(ctx, svc, &ps.ListDeployRequestsRequest{}, testOptions)
+
+	c.Assert(<-events, qt.DeepEquals, DeployRequestEvent{Type: Added, DeployRequest: &ps.DeployRequest{Number: 1, State: "open"}})
+	c.Assert(<-events, qt.DeepEquals, DeployRequestEvent{Type: Modified, DeployRequest: &ps.DeployRequest{Number: 1, State: "closed"}})
+	c.Assert(<-events, qt.DeepEquals, DeployRequestEvent{Type: Added, DeployRequest: &ps.DeployRequest{Number: 2, State: "open"}})
+}
+
+func TestBackups(t *testing.T) {
+	c := qt.New(t)
+
+	svc := &fakeBackups{}
+	svc.results = []listResult{
+		{backups: []*ps.Backup{{Name: "backup-1", State: "pending"}}},
+		{backups: []*ps.Backup{}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := Backups(ctx, svc, &ps.ListBackupsRequest{}, testOptions)
+
+	c.Assert(<-events, qt.DeepEquals, BackupEvent{Type: Added, Backup: &ps.Backup{Name: "backup-1", State: "pending"}})
+	c.Assert(<-events, qt.DeepEquals, BackupEvent{Type: Deleted, Backup: &ps.Backup{Name: "backup-1", State: "pending"}})
+}
+
+func TestBackoff(t *testing.T) {
+	c := qt.New(t)
+
+	o := withDefaults(&Options{MinBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	c.Assert(backoff(o, 1), qt.Equals, time.Second)
+	c.Assert(backoff(o, 2), qt.Equals, 2*time.Second)
+	c.Assert(backoff(o, 3), qt.Equals, 4*time.Second)
+	c.Assert(backoff(o, 10), qt.Equals, 5*time.Second)
+
+	o = withDefaults(nil)
+	c.Assert(o.ResyncInterval, qt.Equals, defaultResyncInterval)
+	c.Assert(o.MinBackoff, qt.Equals, defaultMinBackoff)
+	c.Assert(o.MaxBackoff, qt.Equals, defaultMaxBackoff)
+}
+
+type fakeDatabases struct {
+	ps.DatabasesService
+	fakeLister
+}
+
+func (f *fakeDatabases) List(context.Context, *ps.ListDatabasesRequest) ([]*ps.Database, error) {
+	r := f.next()
+	return r.dbs, r.err
+}
+
+func TestDatabases_notifySynced(t *testing.T) {
+	c := qt.New(t)
+
+	opts := *testOptions
+	opts.NotifySynced = true
+
+	svc := &fakeDatabases{}
+	svc.results = []listResult{
+		{dbs: []*ps.Database{}},
+		{dbs: []*ps.Database{{Name: "my-db", State: "pending"}}},
+		{dbs: []*ps.Database{{Name: "my-db", State: "ready"}}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := Databases(ctx, svc, &ps.ListDatabasesRequest{}, &opts)
+
+	c.Assert(<-events, qt.DeepEquals, DatabaseEvent{Type: Synced})
+	c.Assert(<-events, qt.DeepEquals, DatabaseEvent{Type: Added, Database: &ps.Database{Name: "my-db", State: "pending"}})
+	c.Assert(<-events, qt.DeepEquals, DatabaseEvent{Type: Modified, Database: &ps.Database{Name: "my-db", State: "ready"}})
+}